@@ -0,0 +1,118 @@
+package scdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// Account is the subscription status shown on SCDB's /my/ account page. Fields the page
+// does not show are nil.
+type Account struct {
+	Username           string     `json:"username"`
+	SubscriptionExpiry *time.Time `json:"subscription_expiry,omitempty"`
+	DownloadsRemaining *int       `json:"downloads_remaining,omitempty"`
+	DownloadLimit      *int       `json:"download_limit,omitempty"`
+}
+
+var (
+	// expiryPattern finds a subscription end date after a label such as "valid until"
+	expiryPattern = regexp.MustCompile(`(?i)(?:valid until|valid till|expires(?: on)?|expiry date|expiration date|subscription ends(?: on)?|gültig bis|läuft ab am)\s*:?\s*(\d{4}-\d{2}-\d{2}|\d{1,2}\.\d{1,2}\.\d{4})`)
+	// remainingPattern finds "remaining downloads: 3", optionally followed by "of 5"
+	remainingPattern = regexp.MustCompile(`(?i)(?:remaining downloads|downloads remaining|downloads left|verbleibende downloads)\s*:?\s*(\d+)(?:\s*(?:of|/|von)\s*(\d+))?`)
+	// remainingOfPattern finds "3 of 5 downloads remaining"
+	remainingOfPattern = regexp.MustCompile(`(?i)(\d+)\s*(?:of|/|von)\s*(\d+)\s*downloads?\s*(?:remaining|left|übrig|verbleibend)`)
+	// limitPattern finds "download limit: 5"
+	limitPattern = regexp.MustCompile(`(?i)(?:download limit|daily limit|downloads per day|downloadlimit)\s*:?\s*(\d+)`)
+)
+
+// expiryLayouts are the date formats accepted for the subscription expiry
+var expiryLayouts = []string{"2006-01-02", "2.1.2006"}
+
+// AccountInfo logs in, reusing a saved session when possible, and reads the subscription
+// status from the /my/ account page. Details missing from the page are left nil rather
+// than reported as errors.
+func (d *SCDBDownloader) AccountInfo(ctx context.Context) (*Account, error) {
+	if err := d.login(ctx); err != nil {
+		return nil, fmt.Errorf("login failed: %w", err)
+	}
+
+	ctx, cancel := d.loginContext(ctx)
+	defer cancel()
+
+	resp, err := d.doWithRetry(func() (*http.Request, error) {
+		return d.newRequest(ctx, "GET", accountPath, nil)
+	})
+	if err != nil {
+		return nil, requestError("account page", "GET", accountPath, nil, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if landed := landingPath(resp); strings.Contains(landed, "/login") {
+		return nil, fmt.Errorf("session is not authenticated: %s redirected to %s", accountPath, landed)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, requestError("account page", "GET", accountPath, resp, nil)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read account page: %w", err)
+	}
+
+	account := parseAccountPage(body)
+	account.Username = d.config.Username
+	return account, nil
+}
+
+// parseAccountPage extracts the subscription details from the account page's visible text
+func parseAccountPage(body []byte) *Account {
+	account := &Account{}
+
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return account
+	}
+	text := nodeText(doc)
+
+	if m := expiryPattern.FindStringSubmatch(text); m != nil {
+		for _, layout := range expiryLayouts {
+			if t, err := time.Parse(layout, m[1]); err == nil {
+				account.SubscriptionExpiry = &t
+				break
+			}
+		}
+	}
+
+	if m := remainingPattern.FindStringSubmatch(text); m != nil {
+		account.DownloadsRemaining = atoiPtr(m[1])
+		account.DownloadLimit = atoiPtr(m[2])
+	} else if m := remainingOfPattern.FindStringSubmatch(text); m != nil {
+		account.DownloadsRemaining = atoiPtr(m[1])
+		account.DownloadLimit = atoiPtr(m[2])
+	}
+	if account.DownloadLimit == nil {
+		if m := limitPattern.FindStringSubmatch(text); m != nil {
+			account.DownloadLimit = atoiPtr(m[1])
+		}
+	}
+
+	return account
+}
+
+// atoiPtr returns a pointer to the value of the decimal s, or nil when s is empty or invalid
+func atoiPtr(s string) *int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return nil
+	}
+	return &n
+}
@@ -0,0 +1,154 @@
+package scdb
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
+)
+
+const (
+	// archiveDir holds one timestamped directory per run with Config.Archive
+	archiveDir = "archive"
+	// latestDir links to (or, on Windows, copies) the newest archived run
+	latestDir = "latest"
+	// archiveStampLayout names the run directories; it sorts chronologically
+	archiveStampLayout = "2006-01-02-150405"
+)
+
+// outputDir returns the directory the current run writes to: Config.OutputDir, or with
+// Config.Archive a directory named after the run's start time below <OutputDir>/archive
+func (d *SCDBDownloader) outputDir() string {
+	if !d.config.Archive {
+		return d.config.OutputDir
+	}
+
+	started := d.started
+	if started.IsZero() {
+		started = time.Now()
+	}
+	return filepath.Join(d.config.OutputDir, archiveDir, started.Format(archiveStampLayout))
+}
+
+// finishArchive points <OutputDir>/latest at the run's archive directory, then removes
+// the archived runs beyond the newest Config.Keep
+func (d *SCDBDownloader) finishArchive() error {
+	runDir := d.outputDir()
+	latest := filepath.Join(d.config.OutputDir, latestDir)
+	if err := updateLatest(latest, runDir); err != nil {
+		return fmt.Errorf("failed to update %s: %w", latest, err)
+	}
+	d.logger.Info("archive updated", "dir", runDir, "latest", latest)
+
+	if d.config.Keep <= 0 {
+		return nil
+	}
+	removed, err := pruneArchives(filepath.Join(d.config.OutputDir, archiveDir), d.config.Keep)
+	for _, dir := range removed {
+		d.logger.Info("old archive removed", "dir", dir)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to prune archives: %w", err)
+	}
+	return nil
+}
+
+// updateLatest replaces latest with a relative symlink to runDir. Where symlinks are
+// unavailable, as on Windows without developer mode, latest becomes a copy of runDir.
+func updateLatest(latest, runDir string) error {
+	if runtime.GOOS != "windows" {
+		target, err := filepath.Rel(filepath.Dir(latest), runDir)
+		if err != nil {
+			return err
+		}
+
+		// Swap in a new link with a rename, so latest always points somewhere
+		tmp := latest + ".tmp"
+		_ = os.Remove(tmp)
+		if err := os.Symlink(target, tmp); err == nil {
+			if info, err := os.Lstat(latest); err == nil && info.IsDir() {
+				if err := os.RemoveAll(latest); err != nil {
+					return err
+				}
+			}
+			return os.Rename(tmp, latest)
+		}
+	}
+
+	if err := os.RemoveAll(latest); err != nil {
+		return err
+	}
+	return copyDir(runDir, latest)
+}
+
+// copyDir copies the files and directories below src to dst
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		return copyFile(path, target)
+	})
+}
+
+// copyFile copies the regular file src to dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// pruneArchives removes the timestamped run directories in dir beyond the newest keep and
+// returns the removed paths. Other entries in dir are left alone.
+func pruneArchives(dir string, keep int) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []string
+	for _, entry := range entries {
+		if _, err := time.Parse(archiveStampLayout, entry.Name()); entry.IsDir() && err == nil {
+			runs = append(runs, entry.Name())
+		}
+	}
+	if len(runs) <= keep {
+		return nil, nil
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(runs)))
+	var removed []string
+	for _, name := range runs[keep:] {
+		path := filepath.Join(dir, name)
+		if err := os.RemoveAll(path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
@@ -0,0 +1,36 @@
+package scdb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// backupPath returns where Config.Backup moves the existing file at path before a
+// download replaces it
+func backupPath(path string) string {
+	return path + ".bak"
+}
+
+// backupExisting renames the file at path to backupPath(path), replacing an older
+// backup. There is nothing to back up when path does not exist.
+func backupExisting(path string) (bool, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err := os.Rename(path, backupPath(path)); err != nil {
+		return false, fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// checkClobber fails with ErrOutputExists when Config.NoClobber is set and path exists
+func (d *SCDBDownloader) checkClobber(path string) error {
+	if !d.config.NoClobber {
+		return nil
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%w: %s", ErrOutputExists, path)
+	}
+	return nil
+}
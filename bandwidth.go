@@ -0,0 +1,147 @@
+package scdb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// byteUnits maps the unit suffixes ParseByteRate and ParseByteSize accept to their size in bytes
+var byteUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1 << 10,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1 << 20,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1 << 30,
+	"gib": 1 << 30,
+}
+
+// ParseByteRate converts a rate such as 500KB, 1.5M or 2MB/s to bytes per second. Units
+// are binary, so 1KB is 1024 bytes; a bare number is bytes. 0 means unlimited.
+func ParseByteRate(s string) (int64, error) {
+	text := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), "/s")
+	rate, ok := parseBytes(text)
+	switch {
+	case !ok:
+		return 0, fmt.Errorf("invalid rate %q (want bytes per second such as 500KB or 2MB)", s)
+	case rate > 0 && rate < 1:
+		return 0, fmt.Errorf("invalid rate %q: less than one byte per second", s)
+	case rate >= math.MaxInt64:
+		return 0, fmt.Errorf("invalid rate %q: too large", s)
+	}
+	return int64(rate), nil
+}
+
+// ParseByteSize converts a size such as 500MB, 1.5G or 2GiB to bytes. Units are binary,
+// as with ParseByteRate; a bare number is bytes.
+func ParseByteSize(s string) (int64, error) {
+	size, ok := parseBytes(strings.ToLower(strings.TrimSpace(s)))
+	switch {
+	case !ok:
+		return 0, fmt.Errorf("invalid size %q (want bytes or a size such as 500MB or 2GB)", s)
+	case size > 0 && size < 1:
+		return 0, fmt.Errorf("invalid size %q: less than one byte", s)
+	case size >= math.MaxInt64:
+		return 0, fmt.Errorf("invalid size %q: too large", s)
+	}
+	return int64(size), nil
+}
+
+// parseBytes converts lowercase text such as 1.5m to bytes. ok is false when text is not
+// a number with one of byteUnits. The bytes are left a float64 for the caller to check
+// the range before converting, as int64 would silently wrap a size past it.
+func parseBytes(text string) (bytes float64, ok bool) {
+	number := strings.TrimRight(text, "bgikm")
+	unit, ok := byteUnits[text[len(number):]]
+	value, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if !ok || err != nil || value < 0 || math.IsInf(value, 0) || math.IsNaN(value) {
+		return 0, false
+	}
+	return value * unit, true
+}
+
+// bandwidthLimiter is a token bucket shared by all downloads of a run, so concurrent
+// per-country downloads together stay within Config.MaxRate. The bucket holds one
+// second's worth of bytes; reads beyond it go into debt that later readers wait off.
+type bandwidthLimiter struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// reserve takes n bytes from the bucket refilled at rate bytes per second and returns
+// how long the caller has to wait before reading on
+func (l *bandwidthLimiter) reserve(n int, rate int64) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.last.IsZero() {
+		l.tokens = float64(rate)
+	} else {
+		l.tokens = min(float64(rate), l.tokens+now.Sub(l.last).Seconds()*float64(rate))
+	}
+	l.last = now
+
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / float64(rate) * float64(time.Second))
+}
+
+// throttledReader reads from r no faster than the limiter allows. A wait ends early with
+// ctx's error when ctx is done.
+type throttledReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *bandwidthLimiter
+	rate    int64
+}
+
+func (t *throttledReader) Read(b []byte) (int, error) {
+	// A read larger than the bucket would come in one burst
+	if int64(len(b)) > t.rate {
+		b = b[:t.rate]
+	}
+	n, err := t.r.Read(b)
+	if wait := t.limiter.reserve(n, t.rate); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-t.ctx.Done():
+			return n, t.ctx.Err()
+		}
+	}
+	return n, err
+}
+
+// responseBody returns the body of a download response as it should be copied: limited
+// to Config.MaxRate, then counted for ProgressFunc, so the progress shows the throttled
+// speed. The throttle stops waiting once the request's context is done.
+func (d *SCDBDownloader) responseBody(resp *http.Response) io.Reader {
+	var body io.Reader = resp.Body
+	if d.config.MaxRate > 0 {
+		ctx := context.Background()
+		if resp.Request != nil {
+			ctx = resp.Request.Context()
+		}
+		body = &throttledReader{ctx: ctx, r: body, limiter: &d.bandwidth, rate: d.config.MaxRate}
+	}
+	if d.ProgressFunc != nil {
+		body = newProgressReader(body, resp.ContentLength, d.ProgressFunc)
+	}
+	return body
+}
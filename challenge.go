@@ -0,0 +1,46 @@
+package scdb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// challengeMarkers are lowercase fragments of the CAPTCHA and bot check pages that may be
+// served instead of the login form, or in answer to it, after repeated logins. A bare
+// "captcha" is left out: a login form may embed a CAPTCHA widget and still work.
+var challengeMarkers = []string{
+	"cf-turnstile",
+	"challenge-platform",
+	"cf-chl-",
+	"verify you are human",
+	"checking your browser",
+}
+
+// isChallengePage reports whether body asks for a CAPTCHA or another check that only a
+// browser can pass. A page that still holds the login form's CSRF token is the login
+// page, whatever scripts it loads.
+func isChallengePage(body []byte) bool {
+	if _, _, ok := findCSRFToken(body); ok {
+		return false
+	}
+	page := strings.ToLower(string(body))
+	for _, marker := range challengeMarkers {
+		if strings.Contains(page, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// challengeError explains how to get past a challenge page: a session saved from a
+// browser login is reused without logging in again
+func (d *SCDBDownloader) challengeError() error {
+	switch store := d.sessionStore().(type) {
+	case nil:
+		return fmt.Errorf("%w: log in with a browser, then save its PHPSESSID cookie in a session file and run again with it", ErrLoginChallenge)
+	case FileCookieStore:
+		return fmt.Errorf("%w: log in with a browser, add its PHPSESSID cookie to the session file %s as the README shows, and run again", ErrLoginChallenge, store.Path)
+	default:
+		return fmt.Errorf("%w: log in with a browser and put its PHPSESSID cookie in the session store", ErrLoginChallenge)
+	}
+}
@@ -0,0 +1,127 @@
+package scdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// stateFile keeps, for Config.OnlyChanged, the SHA-256 of the last fixed archive of each
+// country, next to the per-country archives
+const stateFile = "state.json"
+
+// countryState tracks the checksums of Config.OnlyChanged during a per-country run
+type countryState struct {
+	path    string
+	sums    map[string]string // country code to SHA-256, as loaded and updated
+	paths   map[string]string // archive path to country code
+	changed bool              // sums differs from the file
+}
+
+// loadCountryState reads the checksums saved at path; a missing file means none
+func loadCountryState(path string) (map[string]string, error) {
+	sums := make(map[string]string)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return sums, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &sums); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %w", path, err)
+	}
+	return sums, nil
+}
+
+// prepareCountryState loads the state file and maps the archive of every selected
+// country back to its code, for Config.OnlyChanged
+func (d *SCDBDownloader) prepareCountryState() error {
+	path := filepath.Join(d.typeOutputDir("fixed"), stateFile)
+	sums, err := loadCountryState(path)
+	if err != nil {
+		return err
+	}
+
+	paths := make(map[string]string, len(d.config.Countries))
+	for _, country := range d.config.Countries {
+		archive, err := d.outputPath("fixed", country)
+		if err != nil {
+			return err
+		}
+		paths[archive] = country
+	}
+	d.state = &countryState{path: path, sums: sums, paths: paths}
+	return nil
+}
+
+// unchangedCountry reports whether the archive at path belongs to a country whose last
+// download had checksum sum, and is still there
+func (d *SCDBDownloader) unchangedCountry(path, sum string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.state == nil {
+		return false
+	}
+	country, ok := d.state.paths[path]
+	if !ok || d.state.sums[country] != sum {
+		return false
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// recordCountryState stores sum as the checksum of the country whose archive is at path
+func (d *SCDBDownloader) recordCountryState(path, sum string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.state == nil {
+		return
+	}
+	country, ok := d.state.paths[path]
+	if !ok || d.state.sums[country] == sum {
+		return
+	}
+	d.state.sums[country] = sum
+	d.state.changed = true
+}
+
+// saveCountryState writes the state file if a checksum changed, and logs how many
+// countries changed
+func (d *SCDBDownloader) saveCountryState() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	state := d.state
+	if state == nil {
+		return nil
+	}
+
+	changed, unchanged := 0, 0
+	for _, file := range d.files {
+		if _, ok := state.paths[file.Path]; !ok {
+			continue
+		}
+		if file.Unchanged {
+			unchanged++
+		} else {
+			changed++
+		}
+	}
+	d.logger.Info("country archives compared", "changed", changed, "unchanged", unchanged)
+
+	if !state.changed {
+		return nil
+	}
+	data, err := json.MarshalIndent(state.sums, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(state.path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	state.changed = false
+	d.logger.Debug("state file written", "path", state.path)
+	return nil
+}
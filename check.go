@@ -0,0 +1,132 @@
+package scdb
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// CheckResult is the outcome of one step of Check
+type CheckResult struct {
+	Name    string `json:"name"`
+	Skipped bool   `json:"skipped,omitempty"` // The step did not apply or an earlier step failed
+	Detail  string `json:"detail,omitempty"`  // What was found, or why the step was skipped
+	Err     error  `json:"-"`                 // Why the step failed; nil when it passed or was skipped
+}
+
+// ChecksPassed reports whether every check passed or was skipped
+func ChecksPassed(results []CheckResult) bool {
+	for _, r := range results {
+		if r.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Check tests the connection to SCDB without downloading anything: it resolves the host,
+// fetches the login page over TLS and looks for its CSRF token and, when credentials are
+// configured, logs in and opens the /my/ account page. Steps that depend on a failed one
+// are reported as skipped. No session is read or saved.
+func (d *SCDBDownloader) Check(ctx context.Context) []CheckResult {
+	var results []CheckResult
+	add := func(name, detail string, err error) {
+		results = append(results, CheckResult{Name: name, Detail: detail, Err: err})
+	}
+	skip := func(name, reason string) {
+		results = append(results, CheckResult{Name: name, Skipped: true, Detail: reason})
+	}
+	skipRest := func(reason string, names ...string) []CheckResult {
+		for _, name := range names {
+			skip(name, reason)
+		}
+		return results
+	}
+
+	base, err := url.Parse(d.url(""))
+	if err != nil || base.Hostname() == "" {
+		add("Resolve host", "", fmt.Errorf("invalid base URL %q", d.url("")))
+		return skipRest("invalid base URL", "TLS", "Login page", "CSRF token", "Log in", "Account page")
+	}
+
+	host := base.Hostname()
+	if d.config.ProxyURL != "" {
+		skip("Resolve host", "requests go through the proxy")
+	} else if addrs, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+		add("Resolve host", host, err)
+		return skipRest("host did not resolve", "TLS", "Login page", "CSRF token", "Log in", "Account page")
+	} else {
+		add("Resolve host", fmt.Sprintf("%s (%s)", host, strings.Join(addrs, ", ")), nil)
+	}
+
+	ctx, cancel := d.loginContext(ctx)
+	defer cancel()
+
+	resp, body, err := d.getLoginPage(ctx)
+	if err != nil {
+		var certErr *tls.CertificateVerificationError
+		if errors.As(err, &certErr) {
+			add("TLS", host, err)
+			return skipRest("TLS failed", "Login page", "CSRF token", "Log in", "Account page")
+		}
+		if base.Scheme == "https" {
+			skip("TLS", "login page not reached")
+		} else {
+			skip("TLS", "base URL does not use HTTPS")
+		}
+		add("Login page", d.url(loginPath), err)
+		return skipRest("login page not reached", "CSRF token", "Log in", "Account page")
+	}
+
+	switch {
+	case resp.TLS != nil:
+		detail := tls.VersionName(resp.TLS.Version)
+		if certs := resp.TLS.PeerCertificates; len(certs) > 0 {
+			detail += ", certificate for " + certs[0].Subject.CommonName
+		}
+		if d.config.InsecureSkipTLS {
+			detail += " (not verified: -insecure)"
+		}
+		add("TLS", detail, nil)
+	case base.Scheme == "https":
+		// A redirect may have left HTTPS
+		add("TLS", "", fmt.Errorf("login page was not served over HTTPS"))
+	default:
+		skip("TLS", "base URL does not use HTTPS")
+	}
+
+	add("Login page", fmt.Sprintf("HTTP %d", resp.StatusCode), nil)
+
+	if tokenName, _, ok := findCSRFToken(body); ok {
+		add("CSRF token", tokenName, nil)
+	} else if isMaintenancePage(body) {
+		add("CSRF token", "", maintenanceError(body))
+		return skipRest("SCDB is down for maintenance", "Log in", "Account page")
+	} else if isChallengePage(body) {
+		add("CSRF token", "", d.challengeError())
+		return skipRest("login blocked by a challenge", "Log in", "Account page")
+	} else {
+		add("CSRF token", "", fmt.Errorf("no CSRF token found in the login page"))
+		return skipRest("no CSRF token", "Log in", "Account page")
+	}
+
+	if d.config.Username == "" || d.config.Password == "" {
+		return skipRest("no credentials configured", "Log in", "Account page")
+	}
+	if err := d.authenticate(ctx); err != nil {
+		add("Log in", d.config.Username, err)
+		return skipRest("login failed", "Account page")
+	}
+	add("Log in", d.config.Username, nil)
+
+	if err := d.checkLoggedIn(ctx); err != nil {
+		add("Account page", d.url(accountPath), err)
+	} else {
+		add("Account page", d.url(accountPath), nil)
+	}
+	return results
+}
@@ -0,0 +1,81 @@
+package scdb
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checksumsFile is the manifest written to the output directory by -checksums
+const checksumsFile = "checksums.txt"
+
+// loadChecksums reads a manifest in sha256sum format ("<hex>  <name>" per line) and
+// returns the checksums keyed by file base name
+func loadChecksums(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checksum manifest: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		sum, name, ok := strings.Cut(text, " ")
+		if !ok || len(sum) != 64 {
+			return nil, fmt.Errorf("invalid checksum manifest line %d: %q", line, text)
+		}
+		// sha256sum marks binary mode with a '*' before the name
+		name = strings.TrimPrefix(strings.TrimLeft(name, " "), "*")
+		sums[filepath.Base(name)] = strings.ToLower(sum)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read checksum manifest: %w", err)
+	}
+
+	return sums, nil
+}
+
+// writeChecksums writes the checksums of files to path in sha256sum format, naming each
+// file relative to the manifest's directory
+func writeChecksums(path string, files []FileResult) error {
+	var b strings.Builder
+	for _, file := range files {
+		name, err := filepath.Rel(filepath.Dir(path), file.Path)
+		if err != nil {
+			name = filepath.Base(file.Path)
+		}
+		fmt.Fprintf(&b, "%s  %s\n", file.SHA256, filepath.ToSlash(name))
+	}
+
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write checksums: %w", err)
+	}
+	return nil
+}
+
+// fileSHA256 returns the hex SHA-256 and size of the file at path
+func fileSHA256(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
@@ -0,0 +1,145 @@
+package scdb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// dateMarker stands in for {{.Date}} while a filename template is turned into a pattern
+// matching the names of every date
+const dateMarker = "\x00date\x00"
+
+// archiveKind identifies the archives of a run: their type and, for per-country
+// downloads, their country
+type archiveKind struct {
+	typ, country string
+}
+
+// archiveKinds returns the archives a run with the current configuration writes
+func (d *SCDBDownloader) archiveKinds() []archiveKind {
+	var kinds []archiveKind
+	if d.config.DownloadFixed {
+		if d.config.SeparateByCountry {
+			for _, country := range d.config.Countries {
+				kinds = append(kinds, archiveKind{"fixed", country})
+			}
+		} else {
+			kinds = append(kinds, archiveKind{"fixed", ""})
+		}
+	}
+	if d.config.DownloadMobile {
+		kinds = append(kinds, archiveKind{"mobile", ""})
+	}
+	return kinds
+}
+
+// ownedFiles returns the files an earlier run with the current configuration may have
+// left in its directories: the archives its filename template names, for any date when
+// the template uses {{.Date}}, with their .etag, .partial and .partial.if-range files.
+// Backups (.bak), extracted directories, checksums.txt (rewritten by a run that writes
+// it) and anything else are not the downloader's to remove.
+func (d *SCDBDownloader) ownedFiles() ([]string, error) {
+	tmpl, err := parseFilenameTemplate(d.config.FilenameTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	patterns := make(map[string][]*regexp.Regexp)
+	for _, kind := range d.archiveKinds() {
+		name, err := renderFilename(tmpl, d.filenameData(kind.typ, kind.country, dateMarker))
+		if err != nil {
+			return nil, err
+		}
+		parts := strings.Split(name, dateMarker)
+		for i, part := range parts {
+			parts[i] = regexp.QuoteMeta(part)
+		}
+		pattern := "^" + strings.Join(parts, `\d{4}-\d{2}-\d{2}`) + `(\.etag|\.partial|\.partial\.if-range)?$`
+		dir := d.typeOutputDir(kind.typ)
+		patterns[dir] = append(patterns[dir], regexp.MustCompile(pattern))
+	}
+
+	var files []string
+	for _, dir := range d.outputDirs() {
+		entries, err := os.ReadDir(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", dir, err)
+		}
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			if !entry.Type().IsRegular() {
+				continue
+			}
+			for _, re := range patterns[dir] {
+				if re.MatchString(entry.Name()) {
+					files = append(files, path)
+					break
+				}
+			}
+		}
+	}
+	return files, nil
+}
+
+// cleanOutputs removes the files of earlier runs listed by ownedFiles, for Config.Clean.
+// It runs once every download has succeeded, and keeps the archives this run wrote or
+// kept, with their .etag files.
+// A dry run only prints them.
+func (d *SCDBDownloader) cleanOutputs() error {
+	files, err := d.ownedFiles()
+	if err != nil {
+		return err
+	}
+	current := make(map[string]bool)
+	d.mu.Lock()
+	for _, file := range d.files {
+		// Config.Diff keeps the existing archive beside the download
+		path := strings.TrimSuffix(file.Path, newArchiveSuffix)
+		current[path] = true
+		current[etagPath(path)] = true
+	}
+	d.mu.Unlock()
+
+	removed := 0
+	for _, path := range files {
+		if current[path] {
+			continue
+		}
+		if d.config.DryRun {
+			_, _ = fmt.Fprintf(os.Stdout, "[dry-run] remove %s\n", path)
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to clean %s: %w", path, err)
+		}
+		d.logger.Debug("removed earlier output", "path", path)
+		removed++
+	}
+	if removed > 0 {
+		d.logger.Info("earlier outputs removed", "files", removed)
+	}
+	return nil
+}
+
+// removePartials deletes the unfinished downloads left by a failed run, for Config.Clean,
+// which gives up resuming them
+func (d *SCDBDownloader) removePartials() {
+	files, err := d.ownedFiles()
+	if err != nil {
+		return
+	}
+	for _, path := range files {
+		if strings.HasSuffix(path, ".partial") || strings.HasSuffix(path, ".partial.if-range") {
+			if err := os.Remove(path); err == nil {
+				d.logger.Debug("removed partial download", "path", path)
+			}
+		}
+	}
+}
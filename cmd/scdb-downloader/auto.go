@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kjanat/scdb"
+)
+
+// autoCountries is the -countries entry replaced by the detected country and its region
+const autoCountries = "auto"
+
+// resolveAutoCountries replaces an "auto" entry of the comma-separated list with the
+// country detect reports and its neighbours, leaving the other entries as they are.
+// detect is only called when the list has an "auto" entry.
+func resolveAutoCountries(list string, detect func() (string, error)) (string, error) {
+	items := strings.Split(list, ",")
+	var resolved []string
+	for _, item := range items {
+		if !strings.EqualFold(strings.TrimSpace(item), autoCountries) {
+			resolved = append(resolved, item)
+			continue
+		}
+		code, err := detect()
+		if err != nil {
+			return "", fmt.Errorf("%w; list your countries instead, for example -countries NL or -countries benelux", err)
+		}
+		resolved = append(resolved, scdb.NearbyCountries(code)...)
+	}
+	return strings.Join(resolved, ","), nil
+}
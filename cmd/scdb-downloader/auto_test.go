@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kjanat/scdb"
+)
+
+func TestResolveAutoCountries(t *testing.T) {
+	detected := func() (string, error) { return "D", nil }
+	failed := func() (string, error) {
+		return "", scdb.ErrCountryDetection
+	}
+
+	tests := []struct {
+		name    string
+		list    string
+		detect  func() (string, error)
+		want    string
+		wantErr bool
+	}{
+		{"Auto alone", "auto", detected, "D,A,CH", false},
+		{"Auto with other entries", "NL,AUTO,-CH", detected, "NL,D,A,CH,-CH", false},
+		{"No auto entry", "benelux", failed, "benelux", false},
+		{"Empty list", "", failed, "", false},
+		{"Detection failed", "auto", failed, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveAutoCountries(tt.list, tt.detect)
+			if tt.wantErr {
+				if !errors.Is(err, scdb.ErrCountryDetection) {
+					t.Fatalf("resolveAutoCountries() error = %v, want ErrCountryDetection", err)
+				}
+				assertErrorContains(t, err, "-countries NL")
+				return
+			}
+			assertNoError(t, err)
+			if got != tt.want {
+				t.Errorf("resolveAutoCountries(%q) = %q, want %q", tt.list, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/kjanat/scdb"
+)
+
+// printCheckResults writes one PASS, FAIL or SKIP line per check to w
+func printCheckResults(w io.Writer, results []scdb.CheckResult) {
+	for _, r := range results {
+		status, detail := "PASS", r.Detail
+		switch {
+		case r.Err != nil:
+			status = "FAIL"
+			if detail != "" {
+				detail += ": "
+			}
+			detail += r.Err.Error()
+		case r.Skipped:
+			status = "SKIP"
+		}
+
+		if detail == "" {
+			_, _ = fmt.Fprintf(w, "%s  %s\n", status, r.Name)
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "%s  %-13s %s\n", status, r.Name, detail)
+	}
+}
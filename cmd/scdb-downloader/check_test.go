@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/kjanat/scdb"
+)
+
+func TestPrintCheckResults(t *testing.T) {
+	results := []scdb.CheckResult{
+		{Name: "Resolve host", Detail: "www.scdb.info (192.0.2.1)"},
+		{Name: "TLS", Skipped: true, Detail: "base URL does not use HTTPS"},
+		{Name: "Log in", Detail: "alice", Err: errors.New("login failed: invalid credentials")},
+		{Name: "Account page", Err: errors.New("status 500")},
+	}
+
+	var buf bytes.Buffer
+	printCheckResults(&buf, results)
+
+	want := "PASS  Resolve host  www.scdb.info (192.0.2.1)\n" +
+		"SKIP  TLS           base URL does not use HTTPS\n" +
+		"FAIL  Log in        alice: login failed: invalid credentials\n" +
+		"FAIL  Account page  status 500\n"
+	if got := buf.String(); got != want {
+		t.Errorf("printCheckResults() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/kjanat/scdb"
+	"github.com/zalando/go-keyring"
+	"golang.org/x/term"
+)
+
+// keyringService is the service name credentials are stored under in the system keyring
+const keyringService = "scdb"
+
+// resolvePassword fills in config.Password. Sources are tried in order: the -pass flag
+// (passFlag), passFile, stdin (if readStdin), a password from the config file or its
+// profile, the SCDB_PASS environment variable, then the system keyring entry for
+// config.Username. Like other flags, passFile and stdin override the config file.
+func resolvePassword(config *scdb.Config, passFlag bool, passFile string, readStdin bool, stdin io.Reader) error {
+	if config.Password != "" && (passFlag || passFile == "" && !readStdin) {
+		return nil
+	}
+
+	if passFile != "" {
+		password, err := readPasswordFile(passFile)
+		if err != nil {
+			return err
+		}
+		config.Password = password
+		return nil
+	}
+
+	if readStdin {
+		password, err := readFirstLine(stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read password from stdin: %w", err)
+		}
+		config.Password = password
+		return nil
+	}
+
+	config.Password = os.Getenv("SCDB_PASS")
+	if config.Password != "" || config.Username == "" {
+		return nil
+	}
+
+	// A missing entry or keyring backend is not an error: validation reports the
+	// missing password later
+	password, err := keyring.Get(keyringService, config.Username)
+	if err != nil {
+		if err != keyring.ErrNotFound {
+			slog.Debug("system keyring unavailable", "error", err)
+		}
+		return nil
+	}
+	config.Password = password
+	return nil
+}
+
+// promptCredentials asks on the terminal for the username and password missing from
+// config. Without a terminal on stdin it does nothing, so scripts fail with the usual
+// missing credentials error instead of waiting for input.
+func promptCredentials(config *scdb.Config) error {
+	if config.Username != "" && config.Password != "" {
+		return nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil
+	}
+	return readCredentials(config, os.Stdin, os.Stderr, func() ([]byte, error) {
+		return term.ReadPassword(fd)
+	})
+}
+
+// readCredentials prompts on out for the missing username, read from in, and password,
+// read with readPassword so it is not echoed. A password stored in the keyring for the
+// entered username is used without asking.
+func readCredentials(config *scdb.Config, in io.Reader, out io.Writer, readPassword func() ([]byte, error)) error {
+	if config.Username == "" {
+		_, _ = fmt.Fprint(out, "SCDB username: ")
+		username, err := readFirstLine(in)
+		if err != nil {
+			return fmt.Errorf("failed to read username: %w", err)
+		}
+		config.Username = strings.TrimSpace(username)
+		if config.Username == "" {
+			return nil
+		}
+		if err := resolvePassword(config, false, "", false, nil); err != nil {
+			return err
+		}
+	}
+
+	if config.Password == "" {
+		_, _ = fmt.Fprint(out, "SCDB password: ")
+		password, err := readPassword()
+		// The terminal swallowed the newline along with the password
+		_, _ = fmt.Fprintln(out)
+		if err != nil {
+			return fmt.Errorf("failed to read password: %w", err)
+		}
+		config.Password = strings.TrimRight(string(password), "\r\n")
+	}
+	return nil
+}
+
+// otpPrompt returns a scdb.SCDBDownloader OTPFunc asking on the terminal for the code of
+// a second login step, or nil without a terminal on stdin
+func otpPrompt() func(context.Context) (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil
+	}
+	return func(ctx context.Context) (string, error) {
+		return readOTP(ctx, os.Stdin, os.Stderr)
+	}
+}
+
+// readOTP prompts on out for a one-time login code and reads it from in. It returns
+// ctx's error as soon as ctx is done, such as on Ctrl-C, leaving the read behind.
+func readOTP(ctx context.Context, in io.Reader, out io.Writer) (string, error) {
+	_, _ = fmt.Fprint(out, "SCDB login code: ")
+
+	type line struct {
+		text string
+		err  error
+	}
+	read := make(chan line, 1)
+	go func() {
+		text, err := readFirstLine(in)
+		read <- line{text, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		_, _ = fmt.Fprintln(out)
+		return "", ctx.Err()
+	case l := <-read:
+		if l.err != nil {
+			return "", l.err
+		}
+		return strings.TrimSpace(l.text), nil
+	}
+}
+
+// storeCredentials saves the password for config.Username in the system keyring
+func storeCredentials(config *scdb.Config) error {
+	if config.Username == "" || config.Password == "" {
+		return fmt.Errorf("username and password are required to store credentials")
+	}
+
+	if err := keyring.Set(keyringService, config.Username, config.Password); err != nil {
+		return fmt.Errorf("failed to store credentials in system keyring: %w", err)
+	}
+	return nil
+}
+
+// readPasswordFile returns the first line of the file at path
+func readPasswordFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open password file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	password, err := readFirstLine(f)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password file %s: %w", path, err)
+	}
+	return password, nil
+}
+
+// readFirstLine reads up to the first newline, dropping the line ending
+func readFirstLine(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
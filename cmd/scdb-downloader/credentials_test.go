@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kjanat/scdb"
+	"github.com/zalando/go-keyring"
+	"golang.org/x/term"
+)
+
+func TestResolvePassword(t *testing.T) {
+	keyring.MockInit()
+
+	tempDir := t.TempDir()
+
+	passFile := filepath.Join(tempDir, "pass.txt")
+	if err := os.WriteFile(passFile, []byte("from-file\r\nsecond line\n"), 0600); err != nil {
+		t.Fatalf("Failed to write password file: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		flagPass  string
+		passFlag  bool // flagPass came from -pass rather than the config file
+		passFile  string
+		readStdin bool
+		stdin     string
+		env       string
+		want      string
+		wantErr   bool
+	}{
+		{"Flag wins over everything", "from-flag", true, passFile, true, "from-stdin\n", "from-env", "from-flag", false},
+		{"File wins over stdin and env", "", false, passFile, true, "from-stdin\n", "from-env", "from-file", false},
+		{"File wins over config file", "from-config", false, passFile, false, "", "", "from-file", false},
+		{"Stdin wins over config file", "from-config", false, "", true, "from-stdin\n", "", "from-stdin", false},
+		{"Config file wins over env", "from-config", false, "", false, "", "from-env", "from-config", false},
+		{"Stdin wins over env", "", false, "", true, "from-stdin\n", "from-env", "from-stdin", false},
+		{"Stdin without trailing newline", "", false, "", true, "from-stdin", "", "from-stdin", false},
+		{"Env as last resort", "", false, "", false, "", "from-env", "from-env", false},
+		{"Nothing provided", "", false, "", false, "", "", "", false},
+		{"Missing password file", "", false, filepath.Join(tempDir, "missing.txt"), false, "", "from-env", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SCDB_PASS", tt.env)
+
+			config := &scdb.Config{Password: tt.flagPass}
+			err := resolvePassword(config, tt.passFlag, tt.passFile, tt.readStdin, strings.NewReader(tt.stdin))
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolvePassword() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if config.Password != tt.want {
+				t.Errorf("resolvePassword() password = %q, want %q", config.Password, tt.want)
+			}
+		})
+	}
+
+	t.Run("Keyring as last resort", func(t *testing.T) {
+		t.Setenv("SCDB_PASS", "")
+
+		config := &scdb.Config{Username: "keyring-user", Password: "from-keyring"}
+		assertNoError(t, storeCredentials(config))
+
+		resolved := &scdb.Config{Username: "keyring-user"}
+		assertNoError(t, resolvePassword(resolved, false, "", false, strings.NewReader("")))
+		if resolved.Password != "from-keyring" {
+			t.Errorf("resolvePassword() password = %q, want %q", resolved.Password, "from-keyring")
+		}
+
+		// The environment still wins over the keyring
+		t.Setenv("SCDB_PASS", "from-env")
+		resolved = &scdb.Config{Username: "keyring-user"}
+		assertNoError(t, resolvePassword(resolved, false, "", false, strings.NewReader("")))
+		if resolved.Password != "from-env" {
+			t.Errorf("resolvePassword() password = %q, want %q", resolved.Password, "from-env")
+		}
+	})
+
+	t.Run("Unavailable keyring is ignored", func(t *testing.T) {
+		t.Setenv("SCDB_PASS", "")
+		keyring.MockInitWithError(errors.New("no keyring backend"))
+		defer keyring.MockInit()
+
+		config := &scdb.Config{Username: "testuser"}
+		assertNoError(t, resolvePassword(config, false, "", false, strings.NewReader("")))
+		if config.Password != "" {
+			t.Errorf("resolvePassword() password = %q, want empty", config.Password)
+		}
+	})
+
+	t.Run("Storing requires credentials", func(t *testing.T) {
+		err := storeCredentials(&scdb.Config{Username: "testuser"})
+		assertErrorContains(t, err, "username and password are required")
+	})
+
+	t.Run("Empty result still fails validation", func(t *testing.T) {
+		t.Setenv("SCDB_PASS", "")
+
+		config := &scdb.Config{Username: "testuser"}
+		assertNoError(t, resolvePassword(config, false, "", false, strings.NewReader("")))
+
+		err := scdb.ValidateConfig(config)
+		assertErrorContains(t, err, "username and password are required")
+	})
+}
+
+func TestReadCredentials(t *testing.T) {
+	keyring.MockInit()
+	t.Setenv("SCDB_PASS", "")
+	if err := keyring.Set(keyringService, "stored", "from-keyring"); err != nil {
+		t.Fatalf("Failed to seed keyring: %v", err)
+	}
+
+	password := func(s string, err error) func() ([]byte, error) {
+		return func() ([]byte, error) { return []byte(s), err }
+	}
+
+	tests := []struct {
+		name         string
+		config       scdb.Config
+		stdin        string
+		readPassword func() ([]byte, error)
+		wantUser     string
+		wantPass     string
+		wantPrompts  string
+		wantErr      bool
+	}{
+		{"Both missing", scdb.Config{}, " alice \n", password("secret", nil), "alice", "secret", "SCDB username: SCDB password: \n", false},
+		{"Password missing", scdb.Config{Username: "bob"}, "", password("secret", nil), "bob", "secret", "SCDB password: \n", false},
+		{"Password from keyring", scdb.Config{}, "stored\n", password("unused", nil), "stored", "from-keyring", "SCDB username: ", false},
+		{"Empty username", scdb.Config{}, "\n", password("unused", nil), "", "", "SCDB username: ", false},
+		{"Password read fails", scdb.Config{Username: "bob"}, "", password("", errors.New("closed")), "bob", "", "SCDB password: \n", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			var out strings.Builder
+			err := readCredentials(&config, strings.NewReader(tt.stdin), &out, tt.readPassword)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readCredentials() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if config.Username != tt.wantUser || config.Password != tt.wantPass {
+				t.Errorf("readCredentials() = %q, %q, want %q, %q", config.Username, config.Password, tt.wantUser, tt.wantPass)
+			}
+			if out.String() != tt.wantPrompts {
+				t.Errorf("prompts = %q, want %q", out.String(), tt.wantPrompts)
+			}
+		})
+	}
+
+	t.Run("No terminal", func(t *testing.T) {
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			t.Skip("stdin is a terminal")
+		}
+
+		config := &scdb.Config{}
+		assertNoError(t, promptCredentials(config))
+		if config.Username != "" || config.Password != "" {
+			t.Errorf("promptCredentials() without a terminal set %q, %q", config.Username, config.Password)
+		}
+	})
+}
+
+func TestReadOTP(t *testing.T) {
+	var out strings.Builder
+	code, err := readOTP(context.Background(), strings.NewReader(" 123456 \r\n"), &out)
+	assertNoError(t, err)
+	if code != "123456" || out.String() != "SCDB login code: " {
+		t.Errorf("readOTP() = %q with prompt %q, want 123456 and \"SCDB login code: \"", code, out.String())
+	}
+
+	// Ctrl-C while waiting for the code
+	pr, pw := io.Pipe()
+	defer func() { _ = pw.Close() }()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := readOTP(ctx, pr, io.Discard); !errors.Is(err, context.Canceled) {
+		t.Errorf("readOTP() with a cancelled context error = %v, want context.Canceled", err)
+	}
+}
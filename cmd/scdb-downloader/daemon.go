@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kjanat/scdb"
+	"github.com/robfig/cron/v3"
+)
+
+// shutdownTimeout bounds how long the daemon waits for open HTTP requests when it stops
+const shutdownTimeout = 5 * time.Second
+
+// daemonState is what the daemon's HTTP endpoints report: the outcome of the last run,
+// when the next one starts and how many runs there were
+type daemonState struct {
+	mu       sync.Mutex
+	last     *scdb.RunResult // nil until the first run finished
+	lastErr  error
+	finished time.Time
+	next     time.Time
+	runs     int
+	failures int
+	skipped  int
+}
+
+// record stores the outcome of a run that finished at finished, with the next run due at
+// next
+func (s *daemonState) record(result *scdb.RunResult, err error, finished, next time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last, s.lastErr = result, err
+	s.finished, s.next = finished, next
+	s.runs++
+	if err != nil {
+		s.failures++
+	}
+}
+
+// skip counts n scheduled runs that were skipped
+func (s *daemonState) skip(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.skipped += n
+}
+
+// handler serves /healthz and /metrics
+func (s *daemonState) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.serveHealth)
+	mux.HandleFunc("GET /metrics", s.serveMetrics)
+	return mux
+}
+
+// serveHealth answers 200 unless the last run failed, in which case it answers 503 with
+// the error. Before the first run has finished the daemon counts as healthy.
+func (s *daemonState) serveHealth(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	err := s.lastErr
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = fmt.Fprintf(w, "last run failed: %v\n", err)
+		return
+	}
+	_, _ = fmt.Fprintln(w, "ok")
+}
+
+// serveMetrics writes the metrics of the last run, as -metrics-file would, followed by
+// the daemon's run counts and the time of the next run
+func (s *daemonState) serveMetrics(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if s.last != nil {
+		_ = scdb.WriteMetrics(w, s.last, s.lastErr == nil, s.finished)
+	}
+	_, _ = fmt.Fprintf(w, "# HELP scdb_daemon_runs_total Download runs since the daemon started.\n")
+	_, _ = fmt.Fprintf(w, "# TYPE scdb_daemon_runs_total counter\n")
+	_, _ = fmt.Fprintf(w, "scdb_daemon_runs_total %d\n", s.runs)
+	_, _ = fmt.Fprintf(w, "# HELP scdb_daemon_failures_total Failed download runs since the daemon started.\n")
+	_, _ = fmt.Fprintf(w, "# TYPE scdb_daemon_failures_total counter\n")
+	_, _ = fmt.Fprintf(w, "scdb_daemon_failures_total %d\n", s.failures)
+	_, _ = fmt.Fprintf(w, "# HELP scdb_daemon_skipped_runs_total Scheduled runs skipped because the previous run was still in progress.\n")
+	_, _ = fmt.Fprintf(w, "# TYPE scdb_daemon_skipped_runs_total counter\n")
+	_, _ = fmt.Fprintf(w, "scdb_daemon_skipped_runs_total %d\n", s.skipped)
+	if !s.next.IsZero() {
+		_, _ = fmt.Fprintf(w, "# HELP scdb_daemon_next_run_timestamp Unix time the next download run starts.\n")
+		_, _ = fmt.Fprintf(w, "# TYPE scdb_daemon_next_run_timestamp gauge\n")
+		_, _ = fmt.Fprintf(w, "scdb_daemon_next_run_timestamp %d\n", s.next.Unix())
+	}
+}
+
+// schedule tells the daemon when to run next; cron.Schedule is one
+type schedule interface {
+	// Next returns the first run time after t, or the zero time if there is none
+	Next(t time.Time) time.Time
+}
+
+// intervalSchedule runs every interval
+type intervalSchedule time.Duration
+
+// Next returns t plus the interval
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+// daemonSchedule returns the schedule of -schedule or -interval and the time of the first
+// run: the first tick of a cron schedule, or right away with an interval
+func daemonSchedule(opts *cliOptions, now time.Time) (schedule, time.Time, error) {
+	if opts.schedule == "" {
+		return intervalSchedule(opts.interval), now, nil
+	}
+	sched, err := cron.ParseStandard(opts.schedule)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("invalid -schedule %q: %w", opts.schedule, err)
+	}
+	first := sched.Next(now)
+	if first.IsZero() {
+		return nil, time.Time{}, fmt.Errorf("-schedule %q never runs", opts.schedule)
+	}
+	return sched, first, nil
+}
+
+// checkDaemonOptions rejects -interval, -schedule and -listen without -daemon, and
+// -daemon with options that only make sense for a single run. explicit holds the flags
+// given on the command line.
+func checkDaemonOptions(opts *cliOptions, config *scdb.Config, explicit map[string]string) error {
+	if !opts.daemon {
+		for _, name := range []string{"interval", "schedule", "listen"} {
+			if _, ok := explicit[name]; ok {
+				return fmt.Errorf("-%s requires -daemon", name)
+			}
+		}
+		return nil
+	}
+	if _, ok := explicit["interval"]; ok && opts.schedule != "" {
+		return errors.New("-interval and -schedule cannot be used together")
+	}
+	if opts.interval <= 0 {
+		return fmt.Errorf("-interval must be positive (got %s)", opts.interval)
+	}
+	if _, _, err := daemonSchedule(opts, time.Now()); err != nil {
+		return err
+	}
+	if opts.jsonOutput {
+		return errors.New("-daemon cannot be used with -json")
+	}
+	if config.OutputDir == scdb.StdoutOutput {
+		return errors.New("-daemon cannot be used with -output -")
+	}
+	return nil
+}
+
+// runDaemon calls run at first and then whenever sched says, until ctx is done, serving
+// /healthz and /metrics on ln unless it is nil. A failed run is logged and tried again at
+// the next tick, so the daemon outlives network trouble and a used-up download limit
+// alike. Runs never overlap: ticks that pass while a run is in progress are skipped. The
+// run in flight when ctx is done is cancelled with it.
+func runDaemon(ctx context.Context, run func(context.Context) (*scdb.RunResult, error), sched schedule, first time.Time, ln net.Listener, logger *slog.Logger) {
+	state := &daemonState{}
+
+	if ln != nil {
+		server := &http.Server{Handler: state.handler(), ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("health server failed", "error", err)
+			}
+		}()
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			_ = server.Shutdown(shutdownCtx)
+		}()
+		logger.Info("serving health and metrics", "address", ln.Addr().String())
+	}
+
+	next := first
+	for {
+		if wait := time.Until(next); wait > 0 {
+			logger.Debug("waiting for the next run", "next_run", next.Format(time.RFC3339))
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				logger.Info("daemon stopped")
+				return
+			case <-timer.C:
+			}
+		}
+
+		result, err := run(ctx)
+		if ctx.Err() != nil {
+			logger.Info("daemon stopped")
+			return
+		}
+
+		finished := time.Now()
+		following := sched.Next(next)
+		skipped := 0
+		for !following.IsZero() && following.Before(finished) {
+			skipped++
+			following = sched.Next(following)
+		}
+		if skipped > 0 {
+			state.skip(skipped)
+			logger.Warn("skipped runs while the previous run was in progress", "skipped", skipped)
+		}
+		state.record(result, err, finished, following)
+
+		if err != nil {
+			logger.Error("download failed", "error", err, "next_run", following.Format(time.RFC3339))
+		} else {
+			logger.Info("downloads completed", "next_run", following.Format(time.RFC3339))
+		}
+		if following.IsZero() {
+			logger.Info("schedule has no further runs, daemon stopped")
+			return
+		}
+		next = following
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kjanat/scdb"
+)
+
+func TestRunDaemon(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assertNoError(t, err)
+	base := "http://" + ln.Addr().String()
+
+	// The first run fails, the second succeeds and the third waits to be stopped
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	third := make(chan struct{})
+	runs := 0
+	run := func(ctx context.Context) (*scdb.RunResult, error) {
+		runs++
+		switch runs {
+		case 1:
+			return &scdb.RunResult{}, errors.New("network down")
+		case 2:
+			return &scdb.RunResult{Files: []scdb.FileResult{{Type: "fixed", Bytes: 2048}}}, nil
+		default:
+			close(third)
+			<-ctx.Done()
+			return &scdb.RunResult{}, ctx.Err()
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		runDaemon(ctx, run, intervalSchedule(10*time.Millisecond), time.Now(), ln, discardLogger())
+		close(done)
+	}()
+
+	select {
+	case <-third:
+	case <-time.After(5 * time.Second):
+		t.Fatal("daemon did not start a third run")
+	}
+
+	get := func(path string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(base + path)
+		assertNoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+		body, err := io.ReadAll(resp.Body)
+		assertNoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	if status, body := get("/healthz"); status != http.StatusOK || body != "ok\n" {
+		t.Errorf("/healthz = %d %q, want 200 \"ok\\n\"", status, body)
+	}
+	status, body := get("/metrics")
+	if status != http.StatusOK {
+		t.Errorf("/metrics status = %d, want 200", status)
+	}
+	for _, want := range []string{
+		"scdb_last_run_success 1\n",
+		`scdb_bytes_downloaded{type="fixed"} 2048` + "\n",
+		"scdb_daemon_runs_total 2\n",
+		"scdb_daemon_failures_total 1\n",
+		"scdb_daemon_skipped_runs_total 0\n",
+		"scdb_daemon_next_run_timestamp ",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("/metrics does not contain %q:\n%s", want, body)
+		}
+	}
+
+	// Stopping cancels the run in flight and shuts the server down
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("daemon did not stop")
+	}
+	if _, err := http.Get(base + "/healthz"); err == nil {
+		t.Error("health server still answers after the daemon stopped")
+	}
+}
+
+func TestRunDaemonSkipsOverlappingRuns(t *testing.T) {
+	// Ticks every 10ms; the first run takes 55ms, so the five ticks during it are skipped
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var starts []time.Time
+	run := func(ctx context.Context) (*scdb.RunResult, error) {
+		starts = append(starts, time.Now())
+		if len(starts) == 1 {
+			time.Sleep(55 * time.Millisecond)
+		} else {
+			cancel()
+		}
+		return &scdb.RunResult{}, nil
+	}
+
+	first := time.Now()
+	runDaemon(ctx, run, intervalSchedule(10*time.Millisecond), first, nil, discardLogger())
+
+	if len(starts) != 2 {
+		t.Fatalf("runs = %d, want 2", len(starts))
+	}
+	// The second run waits for the first tick after the first run finished
+	if got := starts[1].Sub(first); got < 60*time.Millisecond {
+		t.Errorf("second run started %s after the first, want at least 60ms", got)
+	}
+}
+
+func TestDaemonSchedule(t *testing.T) {
+	now := time.Date(2025, 1, 15, 12, 30, 0, 0, time.Local)
+
+	sched, first, err := daemonSchedule(&cliOptions{interval: time.Hour}, now)
+	assertNoError(t, err)
+	if !first.Equal(now) || !sched.Next(now).Equal(now.Add(time.Hour)) {
+		t.Errorf("interval schedule starts at %s, then %s; want now and an hour later", first, sched.Next(now))
+	}
+
+	sched, first, err = daemonSchedule(&cliOptions{interval: time.Hour, schedule: "0 4 * * *"}, now)
+	assertNoError(t, err)
+	if want := time.Date(2025, 1, 16, 4, 0, 0, 0, time.Local); !first.Equal(want) {
+		t.Errorf("first run = %s, want %s", first, want)
+	}
+	if want := time.Date(2025, 1, 17, 4, 0, 0, 0, time.Local); !sched.Next(first).Equal(want) {
+		t.Errorf("second run = %s, want %s", sched.Next(first), want)
+	}
+
+	_, _, err = daemonSchedule(&cliOptions{schedule: "0 4 * *"}, now)
+	assertErrorContains(t, err, `invalid -schedule "0 4 * *"`)
+	_, _, err = daemonSchedule(&cliOptions{schedule: "0 0 30 2 *"}, now)
+	assertErrorContains(t, err, "never runs")
+}
+
+func TestDaemonState(t *testing.T) {
+	state := &daemonState{}
+	handler := state.handler()
+	serve := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec
+	}
+
+	// Healthy before the first run, with no run metrics yet
+	if rec := serve("/healthz"); rec.Code != http.StatusOK {
+		t.Errorf("/healthz before the first run = %d, want 200", rec.Code)
+	}
+	rec := serve("/metrics")
+	if strings.Contains(rec.Body.String(), "scdb_last_run_success") || !strings.Contains(rec.Body.String(), "scdb_daemon_runs_total 0\n") {
+		t.Errorf("/metrics before the first run:\n%s", rec.Body.String())
+	}
+
+	now := time.Now()
+	state.record(&scdb.RunResult{}, scdb.ErrDownloadLimitReached, now, now.Add(time.Hour))
+	rec = serve("/healthz")
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "download limit reached") {
+		t.Errorf("/healthz after a failed run = %d %q, want 503 with the error", rec.Code, rec.Body.String())
+	}
+	if body := serve("/metrics").Body.String(); !strings.Contains(body, "scdb_last_run_success 0\n") {
+		t.Errorf("/metrics after a failed run does not report the failure:\n%s", body)
+	}
+
+	if rec := serve("/other"); rec.Code != http.StatusNotFound {
+		t.Errorf("/other = %d, want 404", rec.Code)
+	}
+}
+
+// discardLogger returns a logger that drops everything
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/kjanat/scdb"
+	"golang.org/x/term"
+)
+
+// printArchiveDiff writes one line per entry of diff to w: + added, - removed and
+// ~ changed, with the sizes
+func printArchiveDiff(w io.Writer, path string, diff *scdb.ArchiveDiff) {
+	_, _ = fmt.Fprintf(w, "Changes in %s:\n", path)
+	if diff.Empty() {
+		_, _ = fmt.Fprintln(w, "  no entries differ")
+		return
+	}
+	for _, e := range diff.Added {
+		_, _ = fmt.Fprintf(w, "  + %s (%d bytes)\n", e.Name, e.Size)
+	}
+	for _, e := range diff.Removed {
+		_, _ = fmt.Fprintf(w, "  - %s (%d bytes)\n", e.Name, e.Size)
+	}
+	for _, c := range diff.Changed {
+		_, _ = fmt.Fprintf(w, "  ~ %s (%d -> %d bytes)\n", c.New.Name, c.Old.Size, c.New.Size)
+	}
+	_, _ = fmt.Fprintf(w, "  %d added, %d removed, %d changed\n", len(diff.Added), len(diff.Removed), len(diff.Changed))
+}
+
+// diffPrompt returns a scdb.SCDBDownloader DiffFunc that prints the differences to
+// standard error and, when stdin is a terminal and prompting is allowed, asks whether
+// to replace the existing file. Otherwise the existing file is always kept.
+func diffPrompt(prompt bool) func(string, *scdb.ArchiveDiff) bool {
+	prompt = prompt && term.IsTerminal(int(os.Stdin.Fd()))
+	return func(path string, diff *scdb.ArchiveDiff) bool {
+		printArchiveDiff(os.Stderr, path, diff)
+		if !prompt {
+			_, _ = fmt.Fprintf(os.Stderr, "Kept %s; the download is in %s.new\n", path, path)
+			return false
+		}
+		return confirmReplace(os.Stdin, os.Stderr, path)
+	}
+}
+
+// confirmReplace asks on out whether to replace path and reads the answer from in;
+// anything but yes keeps the existing file
+func confirmReplace(in io.Reader, out io.Writer, path string) bool {
+	_, _ = fmt.Fprintf(out, "Replace %s? [y/N]: ", path)
+	answer, err := readFirstLine(in)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	_, _ = fmt.Fprintf(out, "Kept %s; the download is in %s.new\n", path, path)
+	return false
+}
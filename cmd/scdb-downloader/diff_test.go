@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kjanat/scdb"
+)
+
+func TestPrintArchiveDiff(t *testing.T) {
+	diff := &scdb.ArchiveDiff{
+		Added:   []scdb.ArchiveEntry{{Name: "B.gpi", Size: 20}},
+		Removed: []scdb.ArchiveEntry{{Name: "D.gpi", Size: 21}},
+		Changed: []scdb.EntryChange{{Old: scdb.ArchiveEntry{Name: "NL.gpi", Size: 11}, New: scdb.ArchiveEntry{Name: "NL.gpi", Size: 22}}},
+	}
+	var out strings.Builder
+	printArchiveDiff(&out, "garmin.zip", diff)
+	want := `Changes in garmin.zip:
+  + B.gpi (20 bytes)
+  - D.gpi (21 bytes)
+  ~ NL.gpi (11 -> 22 bytes)
+  1 added, 1 removed, 1 changed
+`
+	if out.String() != want {
+		t.Errorf("printArchiveDiff() =\n%s\nwant\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	printArchiveDiff(&out, "garmin.zip", &scdb.ArchiveDiff{})
+	if want := "Changes in garmin.zip:\n  no entries differ\n"; out.String() != want {
+		t.Errorf("printArchiveDiff() without differences = %q, want %q", out.String(), want)
+	}
+}
+
+func TestConfirmReplace(t *testing.T) {
+	tests := []struct {
+		answer string
+		want   bool
+	}{
+		{"y\n", true},
+		{" YES \n", true},
+		{"n\n", false},
+		{"\n", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+		if got := confirmReplace(strings.NewReader(tt.answer), &out, "garmin.zip"); got != tt.want {
+			t.Errorf("confirmReplace(%q) = %v, want %v", tt.answer, got, tt.want)
+		}
+		if !strings.HasPrefix(out.String(), "Replace garmin.zip? [y/N]: ") {
+			t.Errorf("confirmReplace(%q) prompt = %q", tt.answer, out.String())
+		}
+		if kept := strings.Contains(out.String(), "garmin.zip.new"); kept == tt.want {
+			t.Errorf("confirmReplace(%q) output %q, want the .new file named only when kept", tt.answer, out.String())
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kjanat/scdb"
+)
+
+// displayTypeValue is a flag.Value that stores a display type code. It accepts the code
+// (1-4) or its name, such as split-all.
+type displayTypeValue struct {
+	code *int
+}
+
+func (v displayTypeValue) String() string {
+	if v.code == nil {
+		return "0"
+	}
+	return strconv.Itoa(*v.code)
+}
+
+func (v displayTypeValue) Set(s string) error {
+	code, err := scdb.ParseDisplayType(s)
+	if err != nil {
+		return err
+	}
+	*v.code = code
+	return nil
+}
+
+// iconSizeValue is a flag.Value that stores an icon size code. It accepts the code (1-5)
+// or the icon size in pixels, such as 48.
+type iconSizeValue struct {
+	code *int
+}
+
+func (v iconSizeValue) String() string {
+	if v.code == nil {
+		return "0"
+	}
+	return strconv.Itoa(*v.code)
+}
+
+func (v iconSizeValue) Set(s string) error {
+	code, err := scdb.ParseIconSize(s)
+	if err != nil {
+		return err
+	}
+	*v.code = code
+	return nil
+}
+
+// warningTimeValue is a flag.Value that stores a warning time as whole seconds. It
+// accepts a Go duration such as 5m or a bare number of seconds such as 300.
+type warningTimeValue struct {
+	seconds *int
+}
+
+func (v warningTimeValue) String() string {
+	if v.seconds == nil {
+		return "0"
+	}
+	return strconv.Itoa(*v.seconds)
+}
+
+func (v warningTimeValue) Set(s string) error {
+	seconds, err := scdb.ParseWarningTime(s)
+	if err != nil {
+		return err
+	}
+	*v.seconds = seconds
+	return nil
+}
+
+// byteRateValue is a flag.Value that stores a rate in bytes per second. It accepts a
+// number of bytes or a size such as 500KB or 2MB.
+type byteRateValue struct {
+	rate *int64
+}
+
+func (v byteRateValue) String() string {
+	if v.rate == nil {
+		return "0"
+	}
+	return strconv.FormatInt(*v.rate, 10)
+}
+
+func (v byteRateValue) Set(s string) error {
+	rate, err := scdb.ParseByteRate(s)
+	if err != nil {
+		return err
+	}
+	*v.rate = rate
+	return nil
+}
+
+// byteSizeValue is a flag.Value that stores a size in bytes. It accepts a number of bytes
+// or a size such as 500MB or 2GB.
+type byteSizeValue struct {
+	size *int64
+}
+
+func (v byteSizeValue) String() string {
+	if v.size == nil {
+		return "0"
+	}
+	return strconv.FormatInt(*v.size, 10)
+}
+
+func (v byteSizeValue) Set(s string) error {
+	size, err := scdb.ParseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*v.size = size
+	return nil
+}
+
+// formFieldsValue is a flag.Value that adds extra form fields. It accepts name=value,
+// several separated by commas, and may be repeated.
+type formFieldsValue struct {
+	fields *map[string]string
+}
+
+func (v formFieldsValue) String() string {
+	if v.fields == nil {
+		return ""
+	}
+	var pairs []string
+	for _, name := range slices.Sorted(maps.Keys(*v.fields)) {
+		pairs = append(pairs, name+"="+(*v.fields)[name])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (v formFieldsValue) Set(s string) error {
+	for _, pair := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return fmt.Errorf("invalid form field %q (want name=value)", pair)
+		}
+		if *v.fields == nil {
+			*v.fields = make(map[string]string)
+		}
+		(*v.fields)[name] = value
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kjanat/scdb"
+)
+
+// fromZipPrefix starts a -countries entry naming an earlier fixed camera download whose
+// countries are selected again, as in "from-zip:garmin.zip"
+const fromZipPrefix = "from-zip:"
+
+// resolveZipCountries replaces each "from-zip:<archive>" entry of the comma-separated list
+// with the countries found in the archive, keeping a leading "-" for exclusions. Entries
+// of the archive that name no country are passed to warn.
+func resolveZipCountries(list string, warn func(archive string, unknown []string)) (string, error) {
+	var resolved []string
+	for _, item := range strings.Split(list, ",") {
+		entry := strings.TrimSpace(item)
+		name, exclude := strings.CutPrefix(entry, "-")
+		archive, ok := strings.CutPrefix(strings.TrimSpace(name), fromZipPrefix)
+		if !ok {
+			resolved = append(resolved, item)
+			continue
+		}
+
+		countries, unknown, err := scdb.CountriesFromZip(archive)
+		if err != nil {
+			return "", err
+		}
+		if len(unknown) > 0 {
+			warn(archive, unknown)
+		}
+		if len(countries) == 0 {
+			return "", fmt.Errorf("no entry of %s is named after a country", archive)
+		}
+		for _, code := range countries {
+			if exclude {
+				code = "-" + code
+			}
+			resolved = append(resolved, code)
+		}
+	}
+	return strings.Join(resolved, ","), nil
+}
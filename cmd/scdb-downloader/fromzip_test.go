@@ -0,0 +1,63 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResolveZipCountries(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "garmin.zip")
+	f, err := os.Create(archive)
+	assertNoError(t, err)
+	w := zip.NewWriter(f)
+	for _, name := range []string{"NL.gpi", "B.gpi", "readme.txt"} {
+		_, err := w.Create(name)
+		assertNoError(t, err)
+	}
+	assertNoError(t, w.Close())
+	assertNoError(t, f.Close())
+
+	empty := filepath.Join(dir, "empty.zip")
+	f, err = os.Create(empty)
+	assertNoError(t, err)
+	assertNoError(t, zip.NewWriter(f).Close())
+	assertNoError(t, f.Close())
+
+	tests := []struct {
+		name    string
+		list    string
+		want    string
+		wantErr string
+	}{
+		{"Archive alone", "from-zip:" + archive, "NL,B", ""},
+		{"With other entries", "D, from-zip:" + archive + ",-B", "D,NL,B,-B", ""},
+		{"Exclusion", "all,-from-zip:" + archive, "all,-NL,-B", ""},
+		{"No archive entry", "benelux", "benelux", ""},
+		{"Missing archive", "from-zip:" + filepath.Join(dir, "missing.zip"), "", "failed to open"},
+		{"No countries", "from-zip:" + empty, "", "no entry of " + empty + " is named after a country"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var unknown []string
+			got, err := resolveZipCountries(tt.list, func(_ string, entries []string) {
+				unknown = append(unknown, entries...)
+			})
+			if tt.wantErr != "" {
+				assertErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assertNoError(t, err)
+			if got != tt.want {
+				t.Errorf("resolveZipCountries(%q) = %q, want %q", tt.list, got, tt.want)
+			}
+			if tt.want != tt.list && !reflect.DeepEqual(unknown, []string{"readme.txt"}) {
+				t.Errorf("resolveZipCountries(%q) reported unknown entries %v, want [readme.txt]", tt.list, unknown)
+			}
+		})
+	}
+}
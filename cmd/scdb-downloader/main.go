@@ -0,0 +1,855 @@
+// Command scdb-downloader downloads speed camera databases from scdb.info.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kjanat/scdb"
+	"golang.org/x/term"
+)
+
+// cliOptions holds the command line settings that are not part of scdb.Config
+type cliOptions struct {
+	configFile, saveConfigPath string
+	profile                    string
+	countries, countriesFile   string
+	addCountries, rmCountries  string
+	passFile                   string
+	passFlag                   bool // -pass was given, so it wins over -pass-file and -pass-stdin
+	passStdin, storeCreds      bool
+	noPrompt                   bool
+	saveConfigNoSecrets        bool
+	showProgress, jsonOutput   bool
+	listCountries, listRegions bool
+	showVersion, noSession     bool
+	check, status              bool
+	listOutput                 bool
+	printConfig, showSecrets   bool
+	daemon, wizard             bool
+	interval                   time.Duration
+	schedule, listen           string
+}
+
+// newFlagSet binds the command line flags to config and opts
+func newFlagSet(config *scdb.Config, opts *cliOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.Usage = printUsage
+	// main reports parse errors itself
+	fs.SetOutput(io.Discard)
+
+	// Configuration file flags
+	fs.StringVar(&opts.configFile, "config", "", "Load settings from YAML config file")
+	fs.StringVar(&opts.profile, "profile", "", "Use the credentials and countries of this profile from the -config file")
+	fs.StringVar(&opts.saveConfigPath, "saveconfig", "", "Save current settings to YAML config file")
+	fs.BoolVar(&opts.wizard, "wizard", false, "Set up the default config file by answering a few questions")
+	fs.BoolVar(&opts.saveConfigNoSecrets, "saveconfig-no-secrets", false, "With -saveconfig, leave the username and password out of the file")
+
+	// Credentials and download settings
+	fs.StringVar(&config.Username, "user", "", "SCDB username (required, or use SCDB_USER env var)")
+	fs.StringVar(&config.Password, "pass", "", "SCDB password (required, or use SCDB_PASS env var)")
+	fs.StringVar(&opts.passFile, "pass-file", "", "Read the SCDB password from the first line of a file")
+	fs.BoolVar(&opts.passStdin, "pass-stdin", false, "Read the SCDB password from standard input")
+	fs.BoolVar(&opts.storeCreds, "store-credentials", false, "Save the username and password in the system keyring and exit")
+	fs.StringVar(&config.OTP, "otp", "", "One-time code for a login that asks for one (or use SCDB_OTP env var)")
+	fs.BoolVar(&opts.noPrompt, "no-prompt", false, "Fail instead of asking for missing credentials or a login code on the terminal")
+	fs.StringVar(&config.OutputDir, "output", ".", "Output directory for downloads, or - to write the archive to stdout")
+	fs.StringVar(&config.FixedOutputDir, "fixed-output", "", "Directory for the fixed camera archives instead of -output")
+	fs.StringVar(&config.MobileOutputDir, "mobile-output", "", "Directory for the mobile camera archive instead of -output")
+
+	fs.StringVar(&opts.countries, "countries", "all", "Comma-separated country codes, regions, or 'all' for all countries")
+	fs.StringVar(&opts.countriesFile, "countries-file", "", "File with one country code or region per line, merged with -countries")
+	fs.StringVar(&opts.addCountries, "add-countries", "", "Comma-separated countries or regions to add to the config file's list")
+	fs.StringVar(&opts.rmCountries, "remove-countries", "", "Comma-separated countries or regions to remove from the list")
+	fs.BoolVar(&config.SortCountries, "sort-countries", false, "Sort the expanded country list alphabetically instead of keeping input order")
+	config.DisplayType = 1
+	fs.Var(displayTypeValue{&config.DisplayType}, "display", "Display type: 1-4 or split-all, split-speed-red, all-in-one, all-in-one-alt")
+	fs.BoolVar(&config.DangerZones, "dangerzones", true, "Include danger zones")
+	fs.BoolVar(&config.FranceDangerMode, "francedanger", false, "France: true=danger zone, false=correct position")
+	fs.BoolVar(&config.DangerZonesOnly, "dangerzones-only", false, "Experimental: ask for the danger zones alone, to garmin-dangerzones.zip")
+	config.IconSize = 5
+	fs.Var(iconSizeValue{&config.IconSize}, "iconsize", "Icon size: 1-5 or the size in pixels (22, 24, 32, 48, 80)")
+	fs.Var(warningTimeValue{&config.WarningTime}, "warningtime", "Warning time as seconds or a duration like 5m (0=disabled, default)")
+	fs.StringVar(&config.SinceDate, "since", "", "Only fetch cameras changed since this date (YYYY-MM-DD), if SCDB supports it")
+	fs.Var(formFieldsValue{&config.FormFields}, "form-field", "Send an extra fixed camera form field, as name=value (repeatable)")
+	fs.StringVar(&config.MobilePath, "mobile-path", "", "Path of the mobile camera download on the SCDB site (default: the one of -format)")
+	fs.Var(formFieldsValue{&config.MobileForm}, "mobile-form", "Send this mobile camera form instead of mobile_submit, as name=value (repeatable)")
+
+	fs.BoolVar(&config.AcceptAgreement, "accept-agreement", false, "Accept SCDB's download agreement (required to download fixed cameras)")
+	fs.BoolVar(&config.WaiveRescission, "waive-rescission", false, "Waive the right of rescission (withdrawal) for the fixed download")
+	fs.BoolVar(&config.DownloadFixed, "fixed", true, "Download fixed speed cameras")
+	fs.BoolVar(&config.DownloadMobile, "mobile", true, "Download mobile speed cameras")
+	fs.BoolVar(&config.StrictMobile, "strict-mobile", false, "Fail instead of warning when -mobile is combined with a country selection, which it ignores")
+	fs.BoolVar(&config.SeparateByCountry, "separate-by-country", false, "Download fixed cameras into one garmin-<CODE>.zip per country")
+	fs.IntVar(&config.Concurrency, "concurrency", 1, "Per-country downloads to run in parallel with -separate-by-country")
+	fs.BoolVar(&config.OnlyChanged, "only-changed", false, "With -separate-by-country, keep country archives whose download matches state.json")
+	fs.Var(byteRateValue{&config.MaxRate}, "max-rate", "Cap the download speed, e.g. 500KB or 2MB per second (0=unlimited)")
+	fs.Var(byteSizeValue{&config.MaxDownloadBytes}, "max-download-size", "Fail a download larger than this, e.g. 500MB (0=no cap)")
+	fs.Var(byteSizeValue{&config.MaxTotalBytes}, "max-total-size", "Fail the run once its downloads add up to more than this, e.g. 2GB (0=no cap)")
+	fs.DurationVar(&config.RequestDelay, "request-delay", 0, "Minimum time between the starts of HTTP requests, e.g. 2s (0 = none)")
+	fs.StringVar(&config.Format, "format", scdb.DefaultFormat, "Database format: "+strings.Join(scdb.Formats(), ", "))
+	fs.StringVar(&config.FilenameTemplate, "filename-template", "", "Go template for archive names, with {{.Type}}, {{.Date}}, {{.Countries}} and {{.Country}}")
+	fs.BoolVar(&config.UseServerFilename, "use-server-filename", false, "Name archives as the server's Content-Disposition header does, when it gives a safe .zip name")
+	fs.DurationVar(&config.MaxAge, "max-age", 0, "Skip files modified less than this long ago, e.g. 24h (0 = always download)")
+	fs.StringVar(&config.FormEncoding, "form-encoding", scdb.FormURLEncoded, "Encoding of the download forms: urlencoded or multipart")
+	fs.StringVar(&config.PostDownloadCommand, "post-download", "", "Shell command to run after a successful run, with SCDB_FIXED_PATH, SCDB_MOBILE_PATH and SCDB_COUNTRIES set")
+	fs.BoolVar(&config.PostDownloadIgnoreErrors, "post-download-ignore-errors", false, "Only log a failing -post-download command instead of failing the run")
+	fs.StringVar(&config.MetricsFile, "metrics-file", "", "Write Prometheus metrics of the run to this file, e.g. for node_exporter's textfile collector")
+	fs.BoolVar(&config.Archive, "archive", false, "Keep every run in <output>/archive/<timestamp>/ and link <output>/latest to the newest")
+	fs.IntVar(&config.Keep, "keep", 0, "With -archive, keep only the N most recent archived runs (0 = all)")
+	fs.StringVar(&config.SessionFile, "session-file", scdb.DefaultSessionPath(), "Save the login session here and reuse it on the next run")
+	fs.BoolVar(&opts.noSession, "no-session", false, "Always log in and do not save the session")
+	fs.BoolVar(&config.InsecureSkipTLS, "insecure", false, "Skip TLS certificate verification (for self-signed endpoints)")
+	fs.StringVar(&config.GeoIPURL, "geoip-url", "", "Service that -countries auto asks for the country of your IP address, or off")
+	fs.StringVar(&config.ProxyURL, "proxy", "", "Proxy URL (http://, https:// or socks5://), overrides HTTP_PROXY/HTTPS_PROXY")
+	fs.DurationVar(&config.Timeout, "timeout", scdb.DefaultTimeout, "Overall timeout per HTTP request, e.g. 10m (0 = none)")
+	fs.DurationVar(&config.LoginTimeout, "login-timeout", scdb.DefaultLoginTimeout, "Timeout for each login request (0 = none)")
+	fs.IntVar(&config.RetryCount, "retries", 2, "Retries after network errors or 5xx responses")
+	fs.DurationVar(&config.RetryBackoff, "retrybackoff", 2*time.Second, "Delay before the first retry, doubled each attempt")
+	fs.BoolVar(&config.VerifyZip, "verifyzip", true, "Reject downloads that are not valid ZIP archives")
+	fs.BoolVar(&config.AutoReauth, "auto-reauth", true, "Log in again and retry a download once when it returns an HTML page")
+	fs.BoolVar(&config.Checksums, "checksums", false, "Write SHA-256 checksums of the downloads to checksums.txt")
+	fs.BoolVar(&config.VerifyCountries, "verify-countries", false, "Warn about requested countries missing from the downloaded fixed archive")
+	fs.StringVar(&config.VerifyAgainst, "verify-against", "", "Keep existing files whose new download matches this checksum manifest")
+	fs.BoolVar(&config.Extract, "extract", false, "Unpack garmin.zip into <output>/garmin/ after downloading")
+	fs.BoolVar(&config.ExtractOnly, "extract-only", false, "With -extract, delete the archive after unpacking it")
+	fs.BoolVar(&config.Verbose, "verbose", false, "Enable verbose output (same as -log-level debug)")
+	fs.StringVar(&config.LogLevel, "log-level", "", "Log level: debug, info, warn or error (default: info)")
+	fs.StringVar(&config.LogFormat, "log-format", "text", "Log format: text or json")
+	fs.BoolVar(&config.Force, "force", false, "Download even when the existing files look up to date")
+	fs.BoolVar(&config.NoClobber, "no-clobber", false, "Fail instead of replacing an existing archive")
+	fs.BoolVar(&config.Backup, "backup", false, "Rename an existing archive to <name>.bak before replacing it")
+	fs.BoolVar(&config.Diff, "diff", false, "Show how a download differs from the existing archive and ask before replacing it")
+	fs.BoolVar(&config.Clean, "clean", false, "Remove earlier archives after a successful run, and partial files after a failure")
+	fs.BoolVar(&config.DryRun, "dryrun", false, "Print the requests that would be sent without contacting SCDB")
+	fs.BoolVar(&config.Trace, "trace", false, "Write every HTTP request and response to stderr, with passwords and cookies redacted")
+	fs.BoolVar(&opts.showProgress, "progress", false, "Show download progress on stderr")
+	fs.BoolVar(&opts.jsonOutput, "json", false, "Print a JSON summary of the run to stdout instead of log messages")
+	fs.BoolVar(&opts.daemon, "daemon", false, "Keep running and download every -interval")
+	fs.DurationVar(&opts.interval, "interval", 24*time.Hour, "With -daemon, time between download runs")
+	fs.StringVar(&opts.schedule, "schedule", "", "With -daemon, download at the times of this cron expression instead, e.g. \"0 4 * * *\"")
+	fs.StringVar(&opts.listen, "listen", "", "With -daemon, serve /healthz and /metrics on this address, e.g. :8080")
+	fs.BoolVar(&opts.listCountries, "list-countries", false, "List all country codes and exit")
+	fs.BoolVar(&opts.listRegions, "list-regions", false, "List all regional presets and exit")
+	fs.BoolVar(&opts.listOutput, "list-output", false, "List the paths a download would write, without downloading, and exit")
+	fs.BoolVar(&opts.printConfig, "print-config", false, "Print the effective configuration as YAML and exit")
+	fs.BoolVar(&opts.showSecrets, "show-secrets", false, "With -print-config, show the passwords instead of redacting them")
+	fs.BoolVar(&opts.check, "check", false, "Check the connection to SCDB and the login without downloading, then exit")
+	fs.BoolVar(&opts.status, "status", false, "Show the account's subscription expiry and remaining downloads, then exit")
+	fs.BoolVar(&opts.showVersion, "version", false, "Print version and build information and exit")
+
+	return fs
+}
+
+// parseCommandLine parses args into an scdb.Config. Settings are taken from, in increasing
+// precedence: the flag defaults, the -config file, the selected profile in it, and the
+// flags given explicitly.
+func parseCommandLine(args []string) (*scdb.Config, *cliOptions, error) {
+	config := &scdb.Config{}
+	opts := &cliOptions{}
+	fs := newFlagSet(config, opts)
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	explicit := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = f.Value.String()
+	})
+	_, opts.passFlag = explicit["pass"]
+
+	if opts.configFile != "" {
+		// Overlay the file on the defaults, then set the explicit flags again on top
+		if err := scdb.MergeConfigFile(config, opts.configFile); err != nil {
+			return nil, nil, err
+		}
+		if err := config.ApplyProfile(opts.profile); err != nil {
+			return nil, nil, err
+		}
+		for name, value := range explicit {
+			if err := fs.Set(name, value); err != nil {
+				return nil, nil, fmt.Errorf("invalid value for -%s: %w", name, err)
+			}
+		}
+		config.ConfigFile = opts.configFile
+	}
+
+	if opts.noSession {
+		config.SessionFile = ""
+	}
+	if opts.profile != "" && opts.configFile == "" {
+		return nil, nil, errors.New("-profile requires -config")
+	}
+	if opts.showSecrets && !opts.printConfig {
+		return nil, nil, errors.New("-show-secrets requires -print-config")
+	}
+	if opts.saveConfigNoSecrets && opts.saveConfigPath == "" {
+		return nil, nil, errors.New("-saveconfig-no-secrets requires -saveconfig")
+	}
+	if opts.jsonOutput && config.OutputDir == scdb.StdoutOutput {
+		return nil, nil, errors.New("-json cannot be used with -output -, which writes the archive to stdout")
+	}
+	if err := checkDaemonOptions(opts, config, explicit); err != nil {
+		return nil, nil, err
+	}
+
+	// The -countries default must neither replace the countries listed in the config
+	// file nor be merged with -countries-file
+	if _, ok := explicit["countries"]; !ok && (len(config.Countries) > 0 || opts.countriesFile != "") {
+		opts.countries = ""
+	}
+
+	return config, opts, nil
+}
+
+// selectedCountries combines -countries and -countries-file into the expanded country
+// list, resolving userRegions as well, and returns the deprecated codes it replaced.
+// Without either, -add-countries and -remove-countries change current, the config
+// file's list. ok is false when no country flag was given and current should be kept.
+func selectedCountries(opts *cliOptions, current []string, userRegions map[string][]string) (countries []string, subs []scdb.CountrySubstitution, ok bool, err error) {
+	replace := opts.countries != "" || opts.countriesFile != ""
+	if !replace && opts.addCountries == "" && opts.rmCountries == "" {
+		return nil, nil, false, nil
+	}
+
+	var items []string
+	if opts.countries != "" {
+		items = strings.Split(opts.countries, ",")
+		// Trim whitespace from each country/region
+		for i, c := range items {
+			items[i] = strings.TrimSpace(c)
+		}
+	}
+
+	if opts.countriesFile != "" {
+		fileItems, err := scdb.ReadCountriesFile(opts.countriesFile)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		items = append(items, fileItems...)
+	}
+
+	if !replace {
+		items = append(items, current...)
+	}
+	if opts.addCountries != "" {
+		items = append(items, strings.Split(opts.addCountries, ",")...)
+	}
+	if opts.rmCountries != "" {
+		// Exclusions apply after every inclusion, whatever their position
+		for _, item := range strings.Split(opts.rmCountries, ",") {
+			items = append(items, "-"+strings.TrimSpace(item))
+		}
+	}
+
+	countries, subs, err = scdb.ExpandCountriesWithSubstitutions(items, userRegions)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return countries, subs, true, nil
+}
+
+// exitDownloadLimit is the exit status when SCDB's daily download limit is reached, so
+// scheduled jobs can wait for the limit to reset instead of retrying
+const exitDownloadLimit = 3
+
+// exitMaintenance is the exit status when SCDB is down for maintenance, so scheduled jobs
+// can try again later instead of treating it as a configuration problem
+const exitMaintenance = 4
+
+// exitCode maps a failed run to the process exit status
+func exitCode(err error) int {
+	if errors.Is(err, scdb.ErrDownloadLimitReached) {
+		return exitDownloadLimit
+	}
+	if errors.Is(err, scdb.ErrServerMaintenance) {
+		return exitMaintenance
+	}
+	return 1
+}
+
+// fieldFlags maps the Config fields named by scdb.OptionError to their flags
+var fieldFlags = map[string]string{
+	"Archive":           "-archive",
+	"Backup":            "-backup",
+	"Checksums":         "-checksums",
+	"Clean":             "-clean",
+	"Concurrency":       "-concurrency",
+	"DangerZonesOnly":   "-dangerzones-only",
+	"Diff":              "-diff",
+	"DownloadFixed":     "-fixed",
+	"DownloadMobile":    "-mobile",
+	"Extract":           "-extract",
+	"ExtractOnly":       "-extract-only",
+	"FilenameTemplate":  "-filename-template",
+	"FixedOutputDir":    "-fixed-output",
+	"Keep":              "-keep",
+	"LogLevel":          "-log-level",
+	"MaxAge":            "-max-age",
+	"MobileOutputDir":   "-mobile-output",
+	"NoClobber":         "-no-clobber",
+	"OnlyChanged":       "-only-changed",
+	"OutputDir":         "-output",
+	"SeparateByCountry": "-separate-by-country",
+	"StrictMobile":      "-strict-mobile",
+	"UseServerFilename": "-use-server-filename",
+	"Verbose":           "-verbose",
+	"VerifyAgainst":     "-verify-against",
+	"VerifyCountries":   "-verify-countries",
+}
+
+// configError returns the message of a scdb.ValidateConfig error in terms of the
+// command line: the Config fields it names become their flags, and the errors a flag
+// or the environment can fix say how
+func configError(err error) string {
+	var optErr *scdb.OptionError
+	switch {
+	case errors.Is(err, scdb.ErrMissingCredentials):
+		return scdb.ErrMissingCredentials.Error() + "\nProvide via -user/-pass flags or SCDB_USER/SCDB_PASS environment variables"
+	case errors.Is(err, scdb.ErrAgreementNotAccepted):
+		return scdb.ErrAgreementNotAccepted.Error() + "\nAccept it with -accept-agreement (accept_agreement: true) or use -fixed=false"
+	case errors.As(err, &optErr):
+		msg := optErr.Format(func(field string) string {
+			if flag, ok := fieldFlags[field]; ok {
+				return flag
+			}
+			return field
+		})
+		if slices.Contains(optErr.Fields, "StrictMobile") {
+			msg += "\nUse -mobile=false or -countries all"
+		}
+		return msg
+	}
+	return err.Error()
+}
+
+func main() {
+	config, opts, err := parseCommandLine(os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	if opts.showVersion {
+		printVersion(os.Stdout)
+		return
+	}
+
+	// Listing needs neither credentials nor a config file
+	if opts.listCountries || opts.listRegions {
+		if opts.listCountries {
+			scdb.PrintCountries(os.Stdout)
+		}
+		if opts.listRegions {
+			if opts.listCountries {
+				fmt.Println()
+			}
+			scdb.PrintRegions(os.Stdout)
+		}
+		return
+	}
+
+	// JSON mode and streaming to stdout keep stderr quiet unless a log level was asked
+	// for explicitly
+	logConfig := config.Clone()
+	if (opts.jsonOutput || config.OutputDir == scdb.StdoutOutput) && logConfig.LogLevel == "" {
+		logConfig.LogLevel = "error"
+	}
+	logger, err := scdb.NewLogger(os.Stderr, logConfig)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
+	// The wizard asks for everything itself, so it runs before the other sources are tried
+	if opts.wizard {
+		fd := int(os.Stdin.Fd())
+		if !term.IsTerminal(fd) {
+			_, _ = fmt.Fprintf(os.Stderr, "Error: -wizard needs a terminal\n")
+			os.Exit(1)
+		}
+		path := scdb.DefaultConfigPath()
+		saved, err := runWizard(config, path, os.Stdin, os.Stdout, func() ([]byte, error) {
+			return term.ReadPassword(fd)
+		})
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if saved {
+			fmt.Printf("\nConfiguration saved to: %s\n", path)
+			fmt.Printf("Download with: %s -config %s\n", os.Args[0], path)
+		} else {
+			fmt.Printf("Kept the existing configuration in %s\n", path)
+		}
+		return
+	}
+
+	// Use environment variables if flags not provided
+	if config.Username == "" {
+		config.Username = os.Getenv("SCDB_USER")
+	}
+	if config.OTP == "" {
+		config.OTP = os.Getenv("SCDB_OTP")
+	}
+	if err := resolvePassword(config, opts.passFlag, opts.passFile, opts.passStdin, os.Stdin); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Ask for missing credentials, except for the commands that work without them
+	if !opts.noPrompt && !opts.check && !opts.listOutput && !opts.printConfig && opts.saveConfigPath == "" {
+		if err := promptCredentials(config); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if opts.storeCreds {
+		if err := storeCredentials(config); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Credentials for %s stored in the system keyring\n", config.Username)
+		return
+	}
+
+	// The connection check needs no countries, and credentials only for its login steps
+	if opts.check {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		results := newDownloader(config, opts, logger).Check(ctx)
+		stop()
+
+		printCheckResults(os.Stdout, results)
+		if !scdb.ChecksPassed(results) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// The account status needs credentials but no countries
+	if opts.status {
+		if config.Username == "" || config.Password == "" {
+			_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", scdb.ErrMissingCredentials)
+			os.Exit(1)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		account, err := newDownloader(config, opts, logger).AccountInfo(ctx)
+		stop()
+		if err != nil {
+			logger.Error("account status failed", "error", err)
+			os.Exit(exitCode(err))
+		}
+
+		if opts.jsonOutput {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			_ = enc.Encode(account)
+		} else {
+			printAccount(os.Stdout, account, time.Now())
+		}
+		return
+	}
+
+	// Parse and expand countries, unless the config file's list is kept
+	for _, name := range scdb.OverriddenRegions(config.Regions) {
+		logger.Debug("user region overrides built-in preset", "region", name)
+	}
+
+	// "auto" asks a lookup service which country the public IP address is in
+	detect := func() (string, error) {
+		code, err := scdb.DetectCountry(context.Background(), config)
+		if err == nil {
+			logger.Info("detected country", "country", scdb.CountryLabels([]string{code}))
+		}
+		return code, err
+	}
+	if opts.countries, err = resolveAutoCountries(opts.countries, detect); err == nil {
+		opts.addCountries, err = resolveAutoCountries(opts.addCountries, detect)
+	}
+
+	// "from-zip:" entries select the countries of an earlier download again
+	unknownEntries := func(archive string, unknown []string) {
+		logger.Warn("archive entries not named after a country", "path", archive, "entries", unknown)
+	}
+	for _, list := range []*string{&opts.countries, &opts.addCountries, &opts.rmCountries} {
+		if err == nil {
+			*list, err = resolveZipCountries(*list, unknownEntries)
+		}
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	countries, subs, ok, err := selectedCountries(opts, config.Countries, config.Regions)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error parsing countries: %v\n", err)
+		_, _ = fmt.Fprintln(os.Stderr)
+		scdb.PrintRegions(os.Stderr)
+		os.Exit(1)
+	}
+	if ok {
+		config.Countries = countries
+		// -add-countries and -remove-countries keep the config file's list, and so its
+		// replaced codes
+		if opts.countries != "" || opts.countriesFile != "" {
+			config.CountrySubstitutions = nil
+		}
+		config.CountrySubstitutions = append(config.CountrySubstitutions, subs...)
+	}
+	if config.SortCountries {
+		sort.Strings(config.Countries)
+	}
+
+	// Show the merged settings, countries expanded, before anything is saved or sent
+	if opts.printConfig {
+		if err := printConfig(os.Stdout, config, opts.showSecrets); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Save the config file if requested (do this first to allow saving without credentials)
+	if opts.saveConfigPath != "" {
+		saveConfigPath := opts.saveConfigPath
+		if saveConfigPath == "default" {
+			saveConfigPath = scdb.DefaultConfigPath()
+		}
+
+		// For saving config, only validate non-credential fields
+		if config.DisplayType < 1 || config.DisplayType > 4 {
+			_, _ = fmt.Fprintf(os.Stderr, "Error: display type must be 1-4 (got %d)\n", config.DisplayType)
+			os.Exit(1)
+		}
+		if config.IconSize < 1 || config.IconSize > 5 {
+			_, _ = fmt.Fprintf(os.Stderr, "Error: icon size must be 1-5 (got %d)\n", config.IconSize)
+			os.Exit(1)
+		}
+		if err := scdb.CheckWarningTime(config.WarningTime); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		save := scdb.SaveConfigFile
+		if opts.saveConfigNoSecrets {
+			save = scdb.SaveConfigFileWithoutSecrets
+		}
+		if err := save(config, saveConfigPath); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error saving config file: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Configuration saved to: %s\n", saveConfigPath)
+		if opts.saveConfigNoSecrets {
+			fmt.Printf("Credentials were not saved; set SCDB_USER and SCDB_PASS or use -store-credentials\n")
+		}
+		return
+	}
+
+	// Listing the output paths needs the countries but no credentials
+	if opts.listOutput {
+		if err := printOutputPaths(os.Stdout, config); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error: %s\n", configError(err))
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Validate configuration for running downloads
+	if err := scdb.ValidateConfig(config); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error: %s\n\n", configError(err))
+		printUsage()
+		os.Exit(1)
+	}
+
+	// Show the configuration at debug level (never the password)
+	logger.Debug("configuration",
+		"user", config.Username,
+		"profile", config.Profile,
+		"output", config.OutputDir,
+		"fixed_output", config.FixedOutputDir,
+		"mobile_output", config.MobileOutputDir,
+		"countries", scdb.CountryLabels(config.Countries),
+		"display_type", config.DisplayType,
+		"icon_size", config.IconSize,
+		"warning_time", config.WarningTime,
+		"since", config.SinceDate,
+		"form_fields", config.FormFields,
+		"mobile_path", config.MobilePath,
+		"mobile_form", config.MobileForm,
+		"danger_zones", config.DangerZones,
+		"france_danger_mode", config.FranceDangerMode,
+		"danger_zones_only", config.DangerZonesOnly,
+		"accept_agreement", config.AcceptAgreement,
+		"waive_rescission", config.WaiveRescission,
+		"download_fixed", config.DownloadFixed,
+		"download_mobile", config.DownloadMobile,
+		"strict_mobile", config.StrictMobile,
+		"separate_by_country", config.SeparateByCountry,
+		"concurrency", config.Concurrency,
+		"only_changed", config.OnlyChanged,
+		"request_delay", config.RequestDelay,
+		"max_rate", config.MaxRate,
+		"max_download_bytes", config.MaxDownloadBytes,
+		"max_total_bytes", config.MaxTotalBytes,
+		"session_file", config.SessionFile,
+		"geoip_url", config.GeoIPURL,
+		"format", config.Format,
+		"filename_template", config.FilenameTemplate,
+		"use_server_filename", config.UseServerFilename,
+		"max_age", config.MaxAge,
+		"form_encoding", config.FormEncoding,
+		"post_download_command", config.PostDownloadCommand,
+		"post_download_ignore_errors", config.PostDownloadIgnoreErrors,
+		"metrics_file", config.MetricsFile,
+		"verify_countries", config.VerifyCountries,
+		"auto_reauth", config.AutoReauth,
+		"no_clobber", config.NoClobber,
+		"backup", config.Backup,
+		"diff", config.Diff,
+		"clean", config.Clean,
+		"archive", config.Archive,
+		"keep", config.Keep,
+		"retries", config.RetryCount,
+		"retry_backoff", config.RetryBackoff,
+		"config_file", config.ConfigFile)
+
+	// Ctrl-C cancels the downloads in flight instead of leaving partial files behind
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Create a downloader and run
+	downloader := newDownloader(config, opts, logger)
+	if opts.showProgress && !opts.jsonOutput {
+		downloader.ProgressFunc = printProgress
+	}
+
+	if opts.daemon {
+		var ln net.Listener
+		if opts.listen != "" {
+			if ln, err = net.Listen("tcp", opts.listen); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		// Validated with the options; only the first run time can differ now
+		sched, first, _ := daemonSchedule(opts, time.Now())
+		logger.Info("daemon started", "interval", opts.interval, "schedule", opts.schedule, "first_run", first.Format(time.RFC3339))
+		runDaemon(ctx, downloader.RunWithResult, sched, first, ln, logger)
+		return
+	}
+
+	if opts.jsonOutput {
+		result, err := downloader.RunWithResult(ctx)
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if encErr := enc.Encode(result); encErr != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error writing JSON summary: %v\n", encErr)
+			os.Exit(1)
+		}
+		if err != nil {
+			os.Exit(exitCode(err))
+		}
+		return
+	}
+
+	if err := downloader.RunContext(ctx); err != nil {
+		logger.Error("download failed", "error", err)
+		os.Exit(exitCode(err))
+	}
+
+	logger.Info("downloads completed")
+}
+
+// newDownloader creates the downloader for config, which asks for a login code, and with
+// -diff whether to replace an archive, on the terminal unless -no-prompt is given
+func newDownloader(config *scdb.Config, opts *cliOptions, logger *slog.Logger) *scdb.SCDBDownloader {
+	downloader := scdb.NewDownloader(config, scdb.WithLogger(logger))
+	if !opts.noPrompt {
+		downloader.OTPFunc = otpPrompt()
+	}
+	if config.Diff {
+		downloader.DiffFunc = diffPrompt(!opts.noPrompt)
+	}
+	return downloader
+}
+
+// printUsage prints enhanced usage information
+func printUsage() {
+	fmt.Printf("SCDB Speed Camera Downloader v%s\n", version)
+	fmt.Printf("Download speed camera databases from scdb.info\n\n")
+	fmt.Printf("Usage: %s [options]\n\n", os.Args[0])
+	fmt.Printf("Authentication (required):\n")
+	fmt.Printf("  -user string        SCDB username (or use SCDB_USER env var)\n")
+	fmt.Printf("  -pass string        SCDB password (or use SCDB_PASS env var)\n")
+	fmt.Printf("  -pass-file string   Read the password from the first line of a file\n")
+	fmt.Printf("  -pass-stdin         Read the password from standard input\n")
+	fmt.Printf("  -store-credentials  Save the username and password in the system keyring\n")
+	fmt.Printf("  -otp string         One-time code for a login that asks for one (or use SCDB_OTP env var)\n")
+	fmt.Printf("  -no-prompt          Fail instead of asking for missing credentials or a code on a terminal\n")
+	fmt.Printf("                        Password precedence: -pass, -pass-file, -pass-stdin, config file, SCDB_PASS, keyring\n\n")
+	fmt.Printf("Download Agreement (fixed cameras):\n")
+	fmt.Printf("  -accept-agreement   Accept SCDB's terms for downloading the database, as the\n")
+	fmt.Printf("                        checkbox on the download page does. Required for -fixed\n")
+	fmt.Printf("  -waive-rescission   Waive your right of rescission: agree that the download starts\n")
+	fmt.Printf("                        at once and so lose the right to withdraw from the purchase.\n")
+	fmt.Printf("                        Otherwise the box is left unticked (default: false)\n\n")
+	fmt.Printf("Download Options:\n")
+	fmt.Printf("  -output string      Output directory (default: current dir)\n")
+	fmt.Printf("                        '-' writes the archive to stdout; needs -fixed=false or -mobile=false\n")
+	fmt.Printf("  -fixed-output dir   Directory for the fixed camera archives (default: -output)\n")
+	fmt.Printf("  -mobile-output dir  Directory for the mobile camera archive (default: -output)\n")
+	fmt.Printf("  -countries string   Country codes or regions (default: all)\n")
+	fmt.Printf("                        'all', country codes (NL,B,D), country names, or regions:\n")
+	fmt.Printf("                        africa, asia, europe, northamerica, southamerica, oceania\n")
+	fmt.Printf("                        dach, benelux, westeurope, easteurope, scandinavia\n")
+	fmt.Printf("                        baltics, iberia, balkans, alps, uk_ireland, eu\n")
+	fmt.Printf("                        Prefix an entry with '-' to exclude it: europe,-RUS,-BY\n")
+	fmt.Printf("                        'auto' selects the country of your IP address and its region\n")
+	fmt.Printf("                        'from-zip:file' selects the countries of an earlier download\n")
+	fmt.Printf("  -countries-file file  One country code or region per line ('#' comments), merged with -countries\n")
+	fmt.Printf("  -add-countries list  Countries or regions to add to the config file's list\n")
+	fmt.Printf("  -remove-countries list  Countries or regions to remove from the list\n")
+	fmt.Printf("  -sort-countries     Sort the expanded countries alphabetically (default: input order)\n")
+	fmt.Printf("  -fixed              Download fixed cameras (default: true)\n")
+	fmt.Printf("  -mobile             Download mobile cameras (default: true)\n")
+	fmt.Printf("  -strict-mobile      Fail instead of warning when -mobile is combined with a country\n")
+	fmt.Printf("                        selection, which it ignores (default: false)\n")
+	fmt.Printf("  -separate-by-country  Write one garmin-<CODE>.zip per country (default: false)\n")
+	fmt.Printf("  -concurrency int    Parallel per-country downloads with -separate-by-country (default: 1)\n")
+	fmt.Printf("  -only-changed       With -separate-by-country, only write countries whose download\n")
+	fmt.Printf("                        differs from the checksum in state.json (default: false)\n")
+	fmt.Printf("  -request-delay dur  Minimum time between the starts of HTTP requests, 0=none (default: 0)\n")
+	fmt.Printf("  -max-rate rate      Cap the download speed, e.g. 500KB or 2MB per second, 0=unlimited (default: 0)\n")
+	fmt.Printf("  -max-download-size size  Fail a download larger than this, e.g. 500MB, 0=no cap (default: 0)\n")
+	fmt.Printf("  -max-total-size size     Fail the run once its downloads add up to more than this,\n")
+	fmt.Printf("                        e.g. 2GB, 0=no cap (default: 0)\n")
+	fmt.Printf("  -format name        Database format: %s (default: %s)\n", strings.Join(scdb.Formats(), ", "), scdb.DefaultFormat)
+	fmt.Printf("  -filename-template tmpl  Archive name template, e.g. garmin-{{.Type}}-{{.Date}}.zip\n")
+	fmt.Printf("  -use-server-filename  Name archives as the server does, when it gives a safe .zip name\n")
+	fmt.Printf("                        (default: false)\n")
+	fmt.Printf("  -max-age dur        Skip files modified less than this long ago, 0=always download (default: 0)\n")
+	fmt.Printf("  -form-encoding enc  Encoding of the download forms: urlencoded or multipart (default: urlencoded)\n")
+	fmt.Printf("  -post-download cmd  Shell command to run after a successful run; SCDB_FIXED_PATH,\n")
+	fmt.Printf("                        SCDB_MOBILE_PATH, SCDB_COUNTRIES and SCDB_OUTPUT_DIR name the files\n")
+	fmt.Printf("  -post-download-ignore-errors  Only log a failing -post-download command\n")
+	fmt.Printf("  -metrics-file file  Write Prometheus metrics of the run to this .prom file\n")
+	fmt.Printf("  -archive            Keep every run in <output>/archive/<timestamp>/ (default: false)\n")
+	fmt.Printf("  -keep int           With -archive, keep only the N most recent runs, 0=all (default: 0)\n")
+	fmt.Printf("  -session-file file  Save the login session here and reuse it (default: ~/.config/scdb/cookies.json)\n")
+	fmt.Printf("  -no-session         Always log in and do not save the session\n")
+	fmt.Printf("  -verifyzip          Reject downloads that are not valid ZIP archives (default: true)\n")
+	fmt.Printf("  -auto-reauth        Log in again and retry a download once when it returns an HTML page (default: true)\n")
+	fmt.Printf("  -checksums          Write SHA-256 checksums to <output>/checksums.txt (default: false)\n")
+	fmt.Printf("  -verify-countries   Warn about requested countries missing from the fixed archive (default: false)\n")
+	fmt.Printf("  -verify-against file  Keep existing files whose download matches this checksum manifest\n")
+	fmt.Printf("  -extract            Unpack garmin.zip into <output>/garmin/ (default: false)\n")
+	fmt.Printf("  -extract-only       With -extract, delete the archive after unpacking (default: false)\n")
+	fmt.Printf("  -insecure           Skip TLS certificate verification (default: false)\n")
+	fmt.Printf("  -proxy string       Proxy URL: http://, https:// or socks5:// (default: HTTP_PROXY/HTTPS_PROXY)\n")
+	fmt.Printf("  -geoip-url url      Country lookup for -countries auto, or off (default: %s)\n", scdb.DefaultGeoIPURL)
+	fmt.Printf("  -timeout dur        Overall timeout per HTTP request, 0=none (default: 5m)\n")
+	fmt.Printf("  -login-timeout dur  Timeout for each login request, 0=none (default: 30s)\n")
+	fmt.Printf("  -retries int        Retries after network errors or 5xx responses (default: 2)\n")
+	fmt.Printf("  -retrybackoff dur   Delay before the first retry, doubled each attempt (default: 2s)\n\n")
+	fmt.Printf("Camera Configuration:\n")
+	fmt.Printf("  -display type       Display type as a number or name (default: 1)\n")
+	fmt.Printf("                        1=split-all, 2=split-speed-red, 3=all-in-one, 4=all-in-one-alt\n")
+	fmt.Printf("  -iconsize size      Icon size as a number or in pixels (default: 5)\n")
+	fmt.Printf("                        1=22, 2=24, 3=32, 4=48, 5=80 pixels square\n")
+	fmt.Printf("  -dangerzones        Include danger zones (default: true)\n")
+	fmt.Printf("  -francedanger       France: true=danger zone, false=correct position (default: false)\n")
+	fmt.Printf("  -dangerzones-only   Experimental: ask for the danger zones alone, to\n")
+	fmt.Printf("                        garmin-dangerzones.zip; overrides -dangerzones and\n")
+	fmt.Printf("                        -francedanger. SCDB may ignore it and send every camera\n")
+	fmt.Printf("  -warningtime value  Warning time as seconds (300) or a duration (5m), 0=disabled,\n")
+	fmt.Printf("                        at most 1h (default: 0)\n")
+	fmt.Printf("  -since date         Only fetch cameras changed since YYYY-MM-DD; no effect unless SCDB\n")
+	fmt.Printf("                        supports it (default: all)\n")
+	fmt.Printf("  -form-field n=v     Send an extra fixed camera form field for an export option the\n")
+	fmt.Printf("                        other flags do not cover; repeatable\n")
+	fmt.Printf("  -mobile-path path   Path of the mobile camera download (default: the one of -format)\n")
+	fmt.Printf("  -mobile-form n=v    Send this mobile camera form instead of mobile_submit; repeatable\n\n")
+	fmt.Printf("Configuration File:\n")
+	fmt.Printf("  -config string      Load settings from YAML file\n")
+	fmt.Printf("  -profile name       Use a profile's credentials and countries from the config file\n")
+	fmt.Printf("  -saveconfig string  Save current settings to YAML file\n")
+	fmt.Printf("                        Default: %s\n", scdb.DefaultConfigPath())
+	fmt.Printf("  -saveconfig-no-secrets  With -saveconfig, leave the username and password out\n")
+	fmt.Printf("  -wizard             Set up the default config file by answering questions\n")
+	fmt.Printf("  -print-config       Print the effective settings as YAML, passwords redacted, then exit\n")
+	fmt.Printf("  -show-secrets       With -print-config, show the passwords\n")
+	fmt.Printf("\n")
+	fmt.Printf("Other Options:\n")
+	fmt.Printf("  -verbose            Enable verbose output (same as -log-level debug)\n")
+	fmt.Printf("  -log-level string   Log level: debug, info, warn, error (default: info)\n")
+	fmt.Printf("  -log-format string  Log format on stderr: text or json (default: text)\n")
+	fmt.Printf("  -force              Download even when the existing files look up to date\n")
+	fmt.Printf("  -no-clobber         Fail instead of replacing an existing archive (default: false)\n")
+	fmt.Printf("  -backup             Rename an existing archive to <name>.bak before replacing it (default: false)\n")
+	fmt.Printf("  -diff               List the entries a download adds, removes or changes in the existing\n")
+	fmt.Printf("                        archive and ask before replacing it; otherwise saved as <name>.new\n")
+	fmt.Printf("  -clean              Remove earlier archives after a successful run, and partial files after a failure (default: false)\n")
+	fmt.Printf("  -dryrun             Print the requests that would be sent without contacting SCDB\n")
+	fmt.Printf("  -trace              Write every HTTP request and response to stderr, passwords and\n")
+	fmt.Printf("                        cookies redacted (default: false)\n")
+	fmt.Printf("  -progress           Show download progress on stderr\n")
+	fmt.Printf("  -json               Print a JSON summary of the run to stdout (logs only errors)\n")
+	fmt.Printf("  -daemon             Keep running and download every -interval until stopped\n")
+	fmt.Printf("  -interval dur       With -daemon, time between download runs (default: 24h)\n")
+	fmt.Printf("  -schedule expr      With -daemon, download at the times of a cron expression instead,\n")
+	fmt.Printf("                        e.g. \"0 4 * * *\" for 04:00 every day or @hourly\n")
+	fmt.Printf("  -listen addr        With -daemon, serve /healthz and /metrics on addr, e.g. :8080\n")
+	fmt.Printf("  -list-countries     List all country codes and exit\n")
+	fmt.Printf("  -list-regions       List all regional presets and their countries, then exit\n")
+	fmt.Printf("  -list-output        List the paths a download would write (existing ones marked), then exit\n")
+	fmt.Printf("  -check              Check DNS, TLS, the login page and the login, then exit\n")
+	fmt.Printf("  -status             Show subscription expiry and remaining downloads, then exit\n")
+	fmt.Printf("  -version            Print version, commit, build date and Go version, then exit\n")
+	fmt.Printf("  -help               Show this help message\n\n")
+	fmt.Printf("Examples:\n")
+	fmt.Printf("  # Download all countries with defaults\n")
+	fmt.Printf("  %s -user myuser -pass mypass\n\n", os.Args[0])
+	fmt.Printf("  # Download specific regions\n")
+	fmt.Printf("  %s -countries \"dach,benelux\" -francedanger -warningtime 5m\n\n", os.Args[0])
+	fmt.Printf("  # Download Europe except Russia and Belarus\n")
+	fmt.Printf("  %s -countries \"europe,-RUS,-BY\"\n\n", os.Args[0])
+	fmt.Printf("  # Use config file\n")
+	fmt.Printf("  %s -config ~/.config/scdb/config.yml\n\n", os.Args[0])
+	fmt.Printf("Environment Variables:\n")
+	fmt.Printf("  SCDB_USER     Username (alternative to -user flag)\n")
+	fmt.Printf("  SCDB_PASS     Password (alternative to -pass flag)\n")
+	fmt.Printf("  SCDB_OTP      One-time login code (alternative to -otp flag)\n\n")
+}
+
+// printProgress renders a single-line progress indicator on stderr
+func printProgress(written, total int64) {
+	if total > 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "\r  %5.1f%% (%d / %d bytes)", float64(written)*100/float64(total), written, total)
+	} else {
+		_, _ = fmt.Fprintf(os.Stderr, "\r  %d bytes", written)
+	}
+
+	if written == total {
+		_, _ = fmt.Fprintln(os.Stderr)
+	}
+}
@@ -0,0 +1,541 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kjanat/scdb"
+)
+
+func TestParseCommandLine(t *testing.T) {
+	tempDir := t.TempDir()
+
+	configPath := filepath.Join(tempDir, "config.yml")
+	fileContent := `username: fileuser
+display_type: 3
+icon_size: 2
+countries:
+  - D
+  - A
+`
+	if err := os.WriteFile(configPath, []byte(fileContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		args          []string
+		wantUser      string
+		wantDisplay   int
+		wantIconSize  int
+		wantCountries string
+		wantFileList  []string
+	}{
+		{
+			name:          "Defaults without config file",
+			args:          []string{},
+			wantDisplay:   1,
+			wantIconSize:  5,
+			wantCountries: "all",
+		},
+		{
+			name:         "File overrides defaults",
+			args:         []string{"-config", configPath},
+			wantUser:     "fileuser",
+			wantDisplay:  3,
+			wantIconSize: 2,
+			wantFileList: []string{"D", "A"},
+		},
+		{
+			name:         "Flag overrides file even when it equals the default",
+			args:         []string{"-config", configPath, "-display", "1"},
+			wantUser:     "fileuser",
+			wantDisplay:  1,
+			wantIconSize: 2,
+			wantFileList: []string{"D", "A"},
+		},
+		{
+			name:          "Flags before and after -config",
+			args:          []string{"-user", "cliuser", "-config", configPath, "-countries", "NL"},
+			wantUser:      "cliuser",
+			wantDisplay:   3,
+			wantIconSize:  2,
+			wantCountries: "NL",
+			wantFileList:  []string{"D", "A"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, opts, err := parseCommandLine(tt.args)
+			assertNoError(t, err)
+
+			if config.Username != tt.wantUser {
+				t.Errorf("Username = %q, want %q", config.Username, tt.wantUser)
+			}
+			if config.DisplayType != tt.wantDisplay {
+				t.Errorf("DisplayType = %d, want %d", config.DisplayType, tt.wantDisplay)
+			}
+			if config.IconSize != tt.wantIconSize {
+				t.Errorf("IconSize = %d, want %d", config.IconSize, tt.wantIconSize)
+			}
+			if opts.countries != tt.wantCountries {
+				t.Errorf("countries flag = %q, want %q", opts.countries, tt.wantCountries)
+			}
+			if !reflect.DeepEqual(config.Countries, tt.wantFileList) {
+				t.Errorf("Countries = %v, want %v", config.Countries, tt.wantFileList)
+			}
+
+			// Keys missing from the file keep their flag defaults
+			if !config.DownloadFixed || config.Timeout != scdb.DefaultTimeout {
+				t.Errorf("DownloadFixed = %v, Timeout = %v, want flag defaults", config.DownloadFixed, config.Timeout)
+			}
+		})
+	}
+
+	t.Run("Sort countries from flag or file", func(t *testing.T) {
+		sortPath := filepath.Join(tempDir, "sort.yml")
+		if err := os.WriteFile(sortPath, []byte("sort_countries: true\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, args := range [][]string{{"-sort-countries"}, {"-config", sortPath}} {
+			config, _, err := parseCommandLine(args)
+			assertNoError(t, err)
+			if !config.SortCountries {
+				t.Errorf("parseCommandLine(%v) SortCountries = false, want true", args)
+			}
+		}
+	})
+
+	t.Run("Agreement flags from flag or file", func(t *testing.T) {
+		config, _, err := parseCommandLine(nil)
+		assertNoError(t, err)
+		if config.AcceptAgreement || config.WaiveRescission {
+			t.Errorf("AcceptAgreement = %v, WaiveRescission = %v, want both false by default", config.AcceptAgreement, config.WaiveRescission)
+		}
+
+		agreementPath := filepath.Join(tempDir, "agreement.yml")
+		if err := os.WriteFile(agreementPath, []byte("accept_agreement: true\nwaive_rescission: true\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		for _, args := range [][]string{{"-accept-agreement", "-waive-rescission"}, {"-config", agreementPath}} {
+			config, _, err := parseCommandLine(args)
+			assertNoError(t, err)
+			if !config.AcceptAgreement || !config.WaiveRescission {
+				t.Errorf("parseCommandLine(%v) AcceptAgreement = %v, WaiveRescission = %v, want both true", args, config.AcceptAgreement, config.WaiveRescission)
+			}
+		}
+	})
+
+	t.Run("Profiles", func(t *testing.T) {
+		profilePath := filepath.Join(tempDir, "profiles.yml")
+		content := `username: shared
+countries: [NL]
+default_profile: north
+profiles:
+  north:
+    username: alice
+    password: alice-pass
+    countries: [scandinavia]
+  south:
+    username: bob
+    countries: [iberia]
+`
+		if err := os.WriteFile(profilePath, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			args      []string
+			user      string
+			pass      string
+			countries []string
+		}{
+			{[]string{"-config", profilePath}, "alice", "alice-pass", []string{"SE", "NO", "DK", "FI", "IS"}},
+			// The password of another account is not carried over
+			{[]string{"-config", profilePath, "-profile", "south"}, "bob", "", []string{"ES", "P"}},
+			{[]string{"-config", profilePath, "-profile", "south", "-user", "carol", "-countries", "B"}, "carol", "", []string{"B"}},
+		}
+		for _, tt := range tests {
+			config, opts, err := parseCommandLine(tt.args)
+			assertNoError(t, err)
+			countries, _, ok, err := selectedCountries(opts, config.Countries, config.Regions)
+			assertNoError(t, err)
+			if !ok {
+				countries = config.Countries
+			}
+			if config.Username != tt.user || config.Password != tt.pass || !reflect.DeepEqual(countries, tt.countries) {
+				t.Errorf("parseCommandLine(%v) = %q, %q, %v, want %q, %q, %v", tt.args, config.Username, config.Password, countries, tt.user, tt.pass, tt.countries)
+			}
+		}
+
+		_, _, err := parseCommandLine([]string{"-config", profilePath, "-profile", "east"})
+		assertErrorContains(t, err, `unknown profile "east" (want north, south)`)
+
+		_, _, err = parseCommandLine([]string{"-profile", "north"})
+		assertErrorContains(t, err, "-profile requires -config")
+	})
+
+	t.Run("Session file flags", func(t *testing.T) {
+		sessionPath := filepath.Join(tempDir, "session.yml")
+		if err := os.WriteFile(sessionPath, []byte("session_file: /tmp/scdb-cookies.json\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			args []string
+			want string
+		}{
+			{[]string{}, scdb.DefaultSessionPath()},
+			{[]string{"-session-file", "cookies.json"}, "cookies.json"},
+			{[]string{"-config", sessionPath}, "/tmp/scdb-cookies.json"},
+			{[]string{"-config", sessionPath, "-no-session"}, ""},
+		}
+		for _, tt := range tests {
+			config, _, err := parseCommandLine(tt.args)
+			assertNoError(t, err)
+			if config.SessionFile != tt.want {
+				t.Errorf("parseCommandLine(%v) SessionFile = %q, want %q", tt.args, config.SessionFile, tt.want)
+			}
+		}
+	})
+
+	t.Run("Save config without secrets", func(t *testing.T) {
+		_, opts, err := parseCommandLine([]string{"-saveconfig", "out.yml", "-saveconfig-no-secrets"})
+		assertNoError(t, err)
+		if !opts.saveConfigNoSecrets {
+			t.Error("saveConfigNoSecrets = false, want true")
+		}
+
+		_, _, err = parseCommandLine([]string{"-saveconfig-no-secrets"})
+		assertErrorContains(t, err, "-saveconfig-no-secrets requires -saveconfig")
+	})
+
+	t.Run("Show secrets without print config", func(t *testing.T) {
+		_, _, err := parseCommandLine([]string{"-show-secrets"})
+		assertErrorContains(t, err, "-show-secrets requires -print-config")
+	})
+
+	t.Run("JSON summary with stdout output", func(t *testing.T) {
+		_, _, err := parseCommandLine([]string{"-output", "-", "-json"})
+		assertErrorContains(t, err, "-json cannot be used with -output -")
+	})
+
+	t.Run("Missing config file", func(t *testing.T) {
+		_, _, err := parseCommandLine([]string{"-config", filepath.Join(tempDir, "missing.yml")})
+		assertErrorContains(t, err, "error reading config file")
+	})
+
+	t.Run("Invalid country in config file", func(t *testing.T) {
+		badPath := filepath.Join(tempDir, "bad.yml")
+		if err := os.WriteFile(badPath, []byte("countries: [XX, ZZ]\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, err := parseCommandLine([]string{"-config", badPath})
+		assertErrorContains(t, err, "invalid countries in config file "+badPath)
+		assertErrorContains(t, err, "invalid country/region: XX")
+	})
+
+	t.Run("Display type and icon size by name", func(t *testing.T) {
+		config, _, err := parseCommandLine([]string{"-display", "all-in-one", "-iconsize", "48"})
+		assertNoError(t, err)
+		if config.DisplayType != 3 || config.IconSize != 4 {
+			t.Errorf("DisplayType, IconSize = %d, %d, want 3, 4", config.DisplayType, config.IconSize)
+		}
+
+		_, _, err = parseCommandLine([]string{"-display", "compact"})
+		assertErrorContains(t, err, "split-all, split-speed-red, all-in-one, all-in-one-alt")
+	})
+
+	t.Run("Warning time as duration", func(t *testing.T) {
+		config, _, err := parseCommandLine([]string{"-warningtime", "5m"})
+		assertNoError(t, err)
+		if config.WarningTime != 300 {
+			t.Errorf("WarningTime = %d, want 300", config.WarningTime)
+		}
+	})
+
+	t.Run("Max rate with a unit", func(t *testing.T) {
+		config, _, err := parseCommandLine([]string{"-max-rate", "500KB"})
+		assertNoError(t, err)
+		if config.MaxRate != 500<<10 {
+			t.Errorf("MaxRate = %d, want %d", config.MaxRate, 500<<10)
+		}
+
+		_, _, err = parseCommandLine([]string{"-max-rate", "fast"})
+		assertErrorContains(t, err, "invalid rate")
+	})
+
+	t.Run("Size caps with a unit", func(t *testing.T) {
+		config, _, err := parseCommandLine([]string{"-max-download-size", "500MB", "-max-total-size", "2GB"})
+		assertNoError(t, err)
+		if config.MaxDownloadBytes != 500<<20 || config.MaxTotalBytes != 2<<30 {
+			t.Errorf("MaxDownloadBytes, MaxTotalBytes = %d, %d; want %d, %d", config.MaxDownloadBytes, config.MaxTotalBytes, 500<<20, int64(2<<30))
+		}
+
+		_, _, err = parseCommandLine([]string{"-max-total-size", "huge"})
+		assertErrorContains(t, err, "invalid size")
+	})
+
+	t.Run("Form fields", func(t *testing.T) {
+		config, _, err := parseCommandLine([]string{"-form-field", "split_speed_limits=1,prefix=", "-form-field", "layout=a=b"})
+		assertNoError(t, err)
+		want := map[string]string{"split_speed_limits": "1", "prefix": "", "layout": "a=b"}
+		if !reflect.DeepEqual(config.FormFields, want) {
+			t.Errorf("FormFields = %v, want %v", config.FormFields, want)
+		}
+
+		_, _, err = parseCommandLine([]string{"-form-field", "split_speed_limits"})
+		assertErrorContains(t, err, "want name=value")
+	})
+
+	t.Run("Mobile endpoint", func(t *testing.T) {
+		config, _, err := parseCommandLine([]string{"-mobile-path", "/intern/download/v2/garmin-mobile.zip", "-mobile-form", "submit=Download"})
+		assertNoError(t, err)
+		if config.MobilePath != "/intern/download/v2/garmin-mobile.zip" || !reflect.DeepEqual(config.MobileForm, map[string]string{"submit": "Download"}) {
+			t.Errorf("MobilePath = %q, MobileForm = %v", config.MobilePath, config.MobileForm)
+		}
+	})
+
+	t.Run("Daemon", func(t *testing.T) {
+		_, opts, err := parseCommandLine([]string{"-daemon", "-interval", "6h", "-listen", ":8080"})
+		assertNoError(t, err)
+		if !opts.daemon || opts.interval != 6*time.Hour || opts.listen != ":8080" {
+			t.Errorf("daemon options = %v %v %q, want true 6h \":8080\"", opts.daemon, opts.interval, opts.listen)
+		}
+
+		_, _, err = parseCommandLine([]string{"-listen", ":8080"})
+		assertErrorContains(t, err, "-listen requires -daemon")
+		_, _, err = parseCommandLine([]string{"-daemon", "-interval", "0s"})
+		assertErrorContains(t, err, "-interval must be positive")
+		_, opts, err = parseCommandLine([]string{"-daemon", "-schedule", "@daily"})
+		assertNoError(t, err)
+		if opts.schedule != "@daily" {
+			t.Errorf("schedule = %q, want @daily", opts.schedule)
+		}
+		_, _, err = parseCommandLine([]string{"-daemon", "-schedule", "every day"})
+		assertErrorContains(t, err, "invalid -schedule")
+		_, _, err = parseCommandLine([]string{"-daemon", "-schedule", "@daily", "-interval", "1h"})
+		assertErrorContains(t, err, "-interval and -schedule cannot be used together")
+		_, _, err = parseCommandLine([]string{"-schedule", "@daily"})
+		assertErrorContains(t, err, "-schedule requires -daemon")
+		_, _, err = parseCommandLine([]string{"-daemon", "-json"})
+		assertErrorContains(t, err, "-daemon cannot be used with -json")
+	})
+
+	t.Run("Unknown flag", func(t *testing.T) {
+		_, _, err := parseCommandLine([]string{"-nosuchflag"})
+		assertErrorContains(t, err, "flag provided but not defined")
+	})
+}
+
+func TestSelectedCountries(t *testing.T) {
+	tempDir := t.TempDir()
+
+	listPath := filepath.Join(tempDir, "countries.txt")
+	content := "# My subscription\nNL\n\n  dach  \n# -D would exclude Germany\n-CH\n"
+	if err := os.WriteFile(listPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		opts     cliOptions
+		expected []string
+		keep     bool
+		errMsg   string
+	}{
+		{"Neither flag keeps config list", cliOptions{}, nil, true, ""},
+		{"Countries flag only", cliOptions{countries: "B, L"}, []string{"B", "L"}, false, ""},
+		{"File only", cliOptions{countriesFile: listPath}, []string{"NL", "D", "A"}, false, ""},
+		{"Flag merged with file", cliOptions{countries: "B", countriesFile: listPath}, []string{"B", "NL", "D", "A"}, false, ""},
+		{"Missing file", cliOptions{countriesFile: filepath.Join(tempDir, "missing.txt")}, nil, false, "failed to read countries file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, ok, err := selectedCountries(&tt.opts, nil, nil)
+			if tt.errMsg != "" {
+				assertErrorContains(t, err, tt.errMsg)
+				return
+			}
+			assertNoError(t, err)
+
+			if ok == tt.keep {
+				t.Errorf("selectedCountries() ok = %v, want %v", ok, !tt.keep)
+			}
+			if tt.expected != nil && !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("selectedCountries() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+
+	t.Run("All with exclusion", func(t *testing.T) {
+		got, _, _, err := selectedCountries(&cliOptions{countries: "all,-RUS"}, nil, nil)
+		assertNoError(t, err)
+		if len(got) != len(scdb.AllCountries())-1 {
+			t.Errorf("selectedCountries() returned %d countries, want %d", len(got), len(scdb.AllCountries())-1)
+		}
+	})
+
+	t.Run("Add and remove countries", func(t *testing.T) {
+		current := []string{"NL", "B", "D"}
+		for _, tt := range []struct {
+			name     string
+			opts     cliOptions
+			expected []string
+		}{
+			{"Add to the config list", cliOptions{addCountries: "L, D,A"}, []string{"NL", "B", "D", "L", "A"}},
+			{"Remove from the config list", cliOptions{rmCountries: "B"}, []string{"NL", "D"}},
+			{"Add a region and remove a country", cliOptions{addCountries: "dach", rmCountries: "D, benelux"}, []string{"A", "CH"}},
+			{"Add to -countries instead", cliOptions{countries: "FR", addCountries: "ES"}, []string{"FR", "ES"}},
+		} {
+			got, _, ok, err := selectedCountries(&tt.opts, current, nil)
+			assertNoError(t, err)
+			if !ok || !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("%s: selectedCountries() = %v, %v, want %v, true", tt.name, got, ok, tt.expected)
+			}
+		}
+
+		_, _, _, err := selectedCountries(&cliOptions{rmCountries: "nowhere"}, current, nil)
+		assertErrorContains(t, err, "invalid exclusion")
+	})
+
+	t.Run("Countries file replaces the default", func(t *testing.T) {
+		_, opts, err := parseCommandLine([]string{"-countries-file", listPath})
+		assertNoError(t, err)
+		if opts.countries != "" {
+			t.Errorf("countries flag = %q, want the 'all' default dropped", opts.countries)
+		}
+	})
+}
+
+func TestPrintVersion(t *testing.T) {
+	oldVersion, oldCommit, oldDate := version, commit, date
+	defer func() { version, commit, date = oldVersion, oldCommit, oldDate }()
+	version, commit, date = "9.9.9", "abc1234", "2024-01-02T03:04:05Z"
+
+	var buf bytes.Buffer
+	printVersion(&buf)
+	out := buf.String()
+
+	for _, want := range []string{"scdb-downloader 9.9.9", "commit: abc1234", "built:  2024-01-02T03:04:05Z", runtime.Version()} {
+		if !strings.Contains(out, want) {
+			t.Errorf("printVersion() output missing %q:\n%s", want, out)
+		}
+	}
+
+	_, opts, err := parseCommandLine([]string{"-version"})
+	assertNoError(t, err)
+	if !opts.showVersion {
+		t.Error("parseCommandLine(-version) did not set showVersion")
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	limit := fmt.Errorf("failed to download fixed cameras: %w", scdb.ErrDownloadLimitReached)
+	if got := exitCode(limit); got != exitDownloadLimit {
+		t.Errorf("exitCode() = %d, want %d", got, exitDownloadLimit)
+	}
+	maintenance := fmt.Errorf("login failed: %w", scdb.ErrServerMaintenance)
+	if got := exitCode(maintenance); got != exitMaintenance {
+		t.Errorf("exitCode() = %d, want %d", got, exitMaintenance)
+	}
+	if got := exitCode(errors.New("network down")); got != 1 {
+		t.Errorf("exitCode() = %d, want 1 for other errors", got)
+	}
+}
+
+func TestConfigError(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*scdb.Config)
+		want   string
+	}{
+		{
+			name:   "Field with its flag",
+			modify: func(c *scdb.Config) { c.Keep = 2 },
+			want:   "-keep requires -archive",
+		},
+		{
+			name:   "Field with a value",
+			modify: func(c *scdb.Config) { c.Verbose, c.LogLevel = true, "warn" },
+			want:   "-verbose cannot be used with -log-level warn",
+		},
+		{
+			name:   "Strict mobile hint",
+			modify: func(c *scdb.Config) { c.DownloadMobile, c.StrictMobile = true, true },
+			want:   "\nUse -mobile=false or -countries all",
+		},
+		{
+			name:   "Missing credentials hint",
+			modify: func(c *scdb.Config) { c.Password = "" },
+			want:   "username and password are required\nProvide via -user/-pass flags",
+		},
+		{
+			name:   "Agreement hint",
+			modify: func(c *scdb.Config) { c.AcceptAgreement = false },
+			want:   "Accept it with -accept-agreement",
+		},
+		{
+			name:   "Other errors unchanged",
+			modify: func(c *scdb.Config) { c.IconSize = 9 },
+			want:   "icon size must be 1-5 (got 9)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &scdb.Config{
+				Username:        "user",
+				Password:        "pass",
+				Countries:       []string{"NL"},
+				DisplayType:     1,
+				IconSize:        5,
+				DownloadFixed:   true,
+				AcceptAgreement: true,
+			}
+			tt.modify(config)
+			err := scdb.ValidateConfig(config)
+			if err == nil {
+				t.Fatal("ValidateConfig() = nil, want an error")
+			}
+			if got := configError(err); !strings.Contains(got, tt.want) {
+				t.Errorf("configError() = %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// assertNoError reports err as a test failure
+func assertNoError(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+// assertErrorContains reports a test failure unless err contains substr
+func assertErrorContains(t *testing.T, err error, substr string) {
+	t.Helper()
+
+	if err == nil {
+		t.Errorf("Expected error containing %q, got nil", substr)
+		return
+	}
+
+	if !strings.Contains(err.Error(), substr) {
+		t.Errorf("Expected error to contain %q, got %q", substr, err.Error())
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kjanat/scdb"
+)
+
+// printOutputPaths writes the paths a run with config would write to w, one per line,
+// marking those that already exist and would be replaced. The credentials are not
+// needed to plan the paths, so a config without them is still checked for the rest.
+func printOutputPaths(w io.Writer, config *scdb.Config) error {
+	check := config.Clone()
+	if check.Username == "" || check.Password == "" {
+		check.Username, check.Password = "-", "-"
+	}
+	if err := scdb.ValidateConfig(check); err != nil {
+		return err
+	}
+
+	paths, err := scdb.NewDownloader(config).OutputPaths()
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil && path != scdb.StdoutOutput {
+			_, _ = fmt.Fprintf(w, "%s (exists)\n", path)
+			continue
+		}
+		_, _ = fmt.Fprintln(w, path)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kjanat/scdb"
+)
+
+func TestPrintOutputPaths(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "garmin.zip"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &scdb.Config{
+		OutputDir:       dir,
+		Countries:       []string{"NL"},
+		DisplayType:     1,
+		IconSize:        1,
+		DownloadFixed:   true,
+		DownloadMobile:  true,
+		AcceptAgreement: true,
+		WaiveRescission: true,
+	}
+
+	// No credentials are needed to list the paths
+	var buf bytes.Buffer
+	assertNoError(t, printOutputPaths(&buf, config))
+	want := filepath.Join(dir, "garmin.zip") + " (exists)\n" + filepath.Join(dir, "garmin-mobile.zip") + "\n"
+	if buf.String() != want {
+		t.Errorf("printOutputPaths() wrote %q, want %q", buf.String(), want)
+	}
+
+	// The rest of the configuration is still validated
+	config.IconSize = 9
+	assertErrorContains(t, printOutputPaths(&buf, config), "icon size")
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/kjanat/scdb"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// printConfig writes config to w as YAML, in the config file format. Passwords are
+// redacted unless showSecrets is set.
+func printConfig(w io.Writer, config *scdb.Config, showSecrets bool) error {
+	if !showSecrets {
+		config = scdb.RedactSecrets(config)
+	}
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("error marshaling config: %w", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kjanat/scdb"
+)
+
+func TestPrintConfig(t *testing.T) {
+	config := &scdb.Config{
+		Username:  "alice",
+		Password:  "s3cret",
+		Countries: []string{"D", "A", "CH"},
+		Profiles: map[string]scdb.Profile{
+			"work": {Username: "bob", Password: "hunter2"},
+		},
+	}
+
+	var buf bytes.Buffer
+	assertNoError(t, printConfig(&buf, config, false))
+	out := buf.String()
+	for _, want := range []string{"username: alice", "password: REDACTED", "- CH", "username: bob"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("printConfig() output missing %q:\n%s", want, out)
+		}
+	}
+	for _, secret := range []string{"s3cret", "hunter2"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("printConfig() output contains the password %q:\n%s", secret, out)
+		}
+	}
+	// Redacting works on a copy
+	if config.Password != "s3cret" || config.Profiles["work"].Password != "hunter2" {
+		t.Error("printConfig() modified the config")
+	}
+
+	buf.Reset()
+	assertNoError(t, printConfig(&buf, config, true))
+	if out := buf.String(); !strings.Contains(out, "password: s3cret") || !strings.Contains(out, "password: hunter2") {
+		t.Errorf("printConfig() with secrets shown:\n%s", out)
+	}
+}
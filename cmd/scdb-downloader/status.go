@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/kjanat/scdb"
+)
+
+// printAccount writes the subscription status in account to w, counting the days left
+// from now. Details SCDB did not show are printed as unknown.
+func printAccount(w io.Writer, account *scdb.Account, now time.Time) {
+	subscription := "unknown"
+	if expiry := account.SubscriptionExpiry; expiry != nil {
+		date := expiry.Format("2006-01-02")
+		// The subscription lasts through its expiry day
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, expiry.Location())
+		days := int(expiry.Sub(today).Hours() / 24)
+		switch {
+		case days < 0:
+			subscription = fmt.Sprintf("expired on %s", date)
+		case days == 0:
+			subscription = fmt.Sprintf("valid until %s (last day)", date)
+		default:
+			subscription = fmt.Sprintf("valid until %s (%d days left)", date, days)
+		}
+	}
+
+	downloads := "unknown"
+	switch remaining, limit := account.DownloadsRemaining, account.DownloadLimit; {
+	case remaining != nil && limit != nil:
+		downloads = fmt.Sprintf("%d of %d remaining", *remaining, *limit)
+	case remaining != nil:
+		downloads = fmt.Sprintf("%d remaining", *remaining)
+	case limit != nil:
+		downloads = fmt.Sprintf("limit %d", *limit)
+	}
+
+	_, _ = fmt.Fprintf(w, "Account:       %s\n", account.Username)
+	_, _ = fmt.Fprintf(w, "Subscription:  %s\n", subscription)
+	_, _ = fmt.Fprintf(w, "Downloads:     %s\n", downloads)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kjanat/scdb"
+)
+
+func TestPrintAccount(t *testing.T) {
+	now := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+	date := func(s string) *time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return &d
+	}
+	n := func(v int) *int { return &v }
+
+	tests := []struct {
+		name    string
+		account scdb.Account
+		want    []string
+	}{
+		{
+			name:    "Everything known",
+			account: scdb.Account{Username: "alice", SubscriptionExpiry: date("2025-01-20"), DownloadsRemaining: n(2), DownloadLimit: n(5)},
+			want:    []string{"Account:       alice", "valid until 2025-01-20 (10 days left)", "2 of 5 remaining"},
+		},
+		{
+			name:    "Last day",
+			account: scdb.Account{SubscriptionExpiry: date("2025-01-10"), DownloadsRemaining: n(1)},
+			want:    []string{"valid until 2025-01-10 (last day)", "Downloads:     1 remaining"},
+		},
+		{
+			name:    "Expired",
+			account: scdb.Account{SubscriptionExpiry: date("2025-01-01"), DownloadLimit: n(5)},
+			want:    []string{"expired on 2025-01-01", "limit 5"},
+		},
+		{
+			name: "Nothing known",
+			want: []string{"Subscription:  unknown", "Downloads:     unknown"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			printAccount(&buf, &tt.account, now)
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("printAccount() output missing %q:\n%s", want, buf.String())
+				}
+			}
+		})
+	}
+}
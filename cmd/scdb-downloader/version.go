@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build information, set at link time:
+//
+//	go build -ldflags "-X main.version=1.3.0 -X main.commit=$(git rev-parse --short HEAD) -X main.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version = "1.2"
+	commit  = ""
+	date    = ""
+)
+
+// buildInfo returns the commit and build date, falling back to the VCS details Go
+// embeds in the binary when they were not set with -ldflags
+func buildInfo() (rev, built string) {
+	rev, built = commit, date
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && rev == "":
+				rev = s.Value
+				if len(rev) > 12 {
+					rev = rev[:12]
+				}
+			case s.Key == "vcs.time" && built == "":
+				built = s.Value
+			}
+		}
+	}
+	if rev == "" {
+		rev = "unknown"
+	}
+	if built == "" {
+		built = "unknown"
+	}
+	return rev, built
+}
+
+// printVersion writes the version, commit, build date and Go runtime to w
+func printVersion(w io.Writer) {
+	rev, built := buildInfo()
+	_, _ = fmt.Fprintf(w, "scdb-downloader %s\n", version)
+	_, _ = fmt.Fprintf(w, "  commit: %s\n", rev)
+	_, _ = fmt.Fprintf(w, "  built:  %s\n", built)
+	_, _ = fmt.Fprintf(w, "  go:     %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
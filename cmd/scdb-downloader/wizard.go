@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/kjanat/scdb"
+)
+
+// wizard asks the questions of -wizard: answers are read from in, prompts and
+// corrections written to out, and the password read with readPassword so it is not echoed
+type wizard struct {
+	in           *bufio.Reader
+	out          io.Writer
+	readPassword func() ([]byte, error)
+}
+
+// runWizard asks for the settings of a first config file and saves config, filled in with
+// the answers, to path. An existing file is only replaced once the user confirms; saved
+// reports whether the file was written.
+func runWizard(config *scdb.Config, path string, in io.Reader, out io.Writer, readPassword func() ([]byte, error)) (saved bool, err error) {
+	w := &wizard{in: bufio.NewReader(in), out: out, readPassword: readPassword}
+
+	_, _ = fmt.Fprintf(out, "This sets up %s. Press Enter to keep the value in brackets.\n\n", path)
+	if _, err := os.Stat(path); err == nil {
+		overwrite, err := w.confirm(fmt.Sprintf("%s already exists. Overwrite it?", path), false)
+		if err != nil || !overwrite {
+			return false, err
+		}
+	}
+
+	if config.Username, err = w.ask("SCDB username", config.Username, requireValue); err != nil {
+		return false, err
+	}
+	if config.Password, err = w.askPassword(); err != nil {
+		return false, err
+	}
+	if config.OutputDir, err = w.ask("Output directory", config.OutputDir, checkWizardOutputDir); err != nil {
+		return false, err
+	}
+
+	_, _ = fmt.Fprintln(out)
+	scdb.PrintRegions(out)
+	_, _ = fmt.Fprintln(out, "Countries are given by code (NL), name (Netherlands) or region; -CODE leaves one out.")
+	if _, err = w.ask("Countries and regions, comma-separated", "all", func(answer string) error {
+		countries, expandErr := scdb.ExpandCountriesWith(strings.Split(answer, ","), config.Regions)
+		config.Countries = countries
+		return expandErr
+	}); err != nil {
+		return false, err
+	}
+
+	_, _ = fmt.Fprintln(out, "\nFixed cameras can only be downloaded after accepting SCDB's download agreement.")
+	if config.AcceptAgreement, err = w.confirm("Accept the download agreement?", config.AcceptAgreement); err != nil {
+		return false, err
+	}
+	if !config.AcceptAgreement {
+		config.DownloadFixed = false
+		_, _ = fmt.Fprintln(out, "Only mobile cameras will be downloaded.")
+	}
+
+	if err := scdb.SaveConfigFile(config, path); err != nil {
+		return false, fmt.Errorf("failed to save config file: %w", err)
+	}
+	return true, nil
+}
+
+// line reads one answer, without its line ending and surrounding spaces
+func (w *wizard) line() (string, error) {
+	line, err := w.in.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err == io.EOF {
+		return "", errors.New("setup cancelled: no more input")
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// ask prompts for a value until check accepts it; an empty answer takes def
+func (w *wizard) ask(prompt, def string, check func(string) error) (string, error) {
+	for {
+		if def != "" {
+			_, _ = fmt.Fprintf(w.out, "%s [%s]: ", prompt, def)
+		} else {
+			_, _ = fmt.Fprintf(w.out, "%s: ", prompt)
+		}
+		answer, err := w.line()
+		if err != nil {
+			return "", err
+		}
+		if answer == "" {
+			answer = def
+		}
+		if err := check(answer); err != nil {
+			_, _ = fmt.Fprintf(w.out, "  %v\n", err)
+			continue
+		}
+		return answer, nil
+	}
+}
+
+// askPassword prompts for the password until one is entered
+func (w *wizard) askPassword() (string, error) {
+	for {
+		_, _ = fmt.Fprint(w.out, "SCDB password: ")
+		password, err := w.readPassword()
+		// The terminal swallowed the newline along with the password
+		_, _ = fmt.Fprintln(w.out)
+		if err != nil {
+			return "", fmt.Errorf("failed to read password: %w", err)
+		}
+		if p := strings.TrimRight(string(password), "\r\n"); p != "" {
+			return p, nil
+		}
+		_, _ = fmt.Fprintln(w.out, "  a password is required")
+	}
+}
+
+// confirm asks a yes/no question; an empty answer takes def
+func (w *wizard) confirm(prompt string, def bool) (bool, error) {
+	choices := "y/N"
+	if def {
+		choices = "Y/n"
+	}
+	for {
+		_, _ = fmt.Fprintf(w.out, "%s [%s]: ", prompt, choices)
+		answer, err := w.line()
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+		_, _ = fmt.Fprintln(w.out, "  please answer y or n")
+	}
+}
+
+// requireValue rejects an empty answer
+func requireValue(answer string) error {
+	if answer == "" {
+		return errors.New("a value is required")
+	}
+	return nil
+}
+
+// checkWizardOutputDir accepts a directory that exists or can be created later, but not
+// a file or standard output, which a saved configuration should not default to
+func checkWizardOutputDir(dir string) error {
+	if dir == "" {
+		return errors.New("a value is required")
+	}
+	if dir == scdb.StdoutOutput {
+		return errors.New("give a directory; use -output - on the command line to write to stdout")
+	}
+	info, err := os.Stat(dir)
+	if err == nil && !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return nil
+}
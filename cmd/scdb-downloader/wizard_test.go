@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kjanat/scdb"
+)
+
+func TestRunWizard(t *testing.T) {
+	// passwords hands out the given answers one per call
+	passwords := func(answers ...string) func() ([]byte, error) {
+		return func() ([]byte, error) {
+			answer := answers[0]
+			answers = answers[1:]
+			return []byte(answer), nil
+		}
+	}
+	defaults := func() *scdb.Config {
+		return &scdb.Config{OutputDir: ".", DisplayType: 1, IconSize: 5, DownloadFixed: true, DownloadMobile: true}
+	}
+
+	t.Run("Writes the answers", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "scdb", "config.yml")
+		outputFile := filepath.Join(t.TempDir(), "file")
+		assertNoError(t, os.WriteFile(outputFile, nil, 0644))
+
+		// Invalid answers are asked again
+		input := strings.Join([]string{
+			"",          // username is required
+			"alice",     //
+			outputFile,  // not a directory
+			"downloads", //
+			"atlantis",  // unknown country
+			"benelux,-L",
+			"maybe", // not yes or no
+			"y",
+		}, "\n") + "\n"
+		var out bytes.Buffer
+		saved, err := runWizard(defaults(), path, strings.NewReader(input), &out, passwords("", "secret"))
+		assertNoError(t, err)
+		if !saved {
+			t.Fatal("runWizard() saved = false, want true")
+		}
+
+		for _, want := range []string{"a value is required", "is not a directory", "atlantis", "a password is required", "please answer y or n", "benelux"} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("wizard output does not contain %q:\n%s", want, out.String())
+			}
+		}
+
+		config, err := scdb.LoadConfigFile(path)
+		assertNoError(t, err)
+		if config.Username != "alice" || config.Password != "secret" || config.OutputDir != "downloads" {
+			t.Errorf("saved user %q, password %q, output %q; want alice, secret, downloads", config.Username, config.Password, config.OutputDir)
+		}
+		if want := []string{"B", "NL"}; !reflect.DeepEqual(config.Countries, want) {
+			t.Errorf("saved countries = %v, want %v", config.Countries, want)
+		}
+		if !config.AcceptAgreement || !config.DownloadFixed || config.DisplayType != 1 {
+			t.Errorf("saved agreement %v, fixed %v, display %d; want true, true and the default 1", config.AcceptAgreement, config.DownloadFixed, config.DisplayType)
+		}
+	})
+
+	t.Run("Declining the agreement skips fixed cameras", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yml")
+		input := "bob\n\nNL\n\n"
+		saved, err := runWizard(defaults(), path, strings.NewReader(input), &bytes.Buffer{}, passwords("secret"))
+		assertNoError(t, err)
+		if !saved {
+			t.Fatal("runWizard() saved = false, want true")
+		}
+
+		config, err := scdb.LoadConfigFile(path)
+		assertNoError(t, err)
+		if config.AcceptAgreement || config.DownloadFixed || !config.DownloadMobile || config.OutputDir != "." {
+			t.Errorf("saved agreement %v, fixed %v, mobile %v, output %q; want mobile only in .", config.AcceptAgreement, config.DownloadFixed, config.DownloadMobile, config.OutputDir)
+		}
+	})
+
+	t.Run("Keeps an existing file unless confirmed", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yml")
+		assertNoError(t, os.WriteFile(path, []byte("username: old\n"), 0600))
+
+		saved, err := runWizard(defaults(), path, strings.NewReader("\n"), &bytes.Buffer{}, passwords())
+		assertNoError(t, err)
+		if saved {
+			t.Error("runWizard() saved = true without confirmation")
+		}
+		data, err := os.ReadFile(path)
+		assertNoError(t, err)
+		if string(data) != "username: old\n" {
+			t.Errorf("existing file changed to %q", data)
+		}
+
+		input := "yes\ncarol\n\n\ny\n"
+		saved, err = runWizard(defaults(), path, strings.NewReader(input), &bytes.Buffer{}, passwords("secret"))
+		assertNoError(t, err)
+		config, err := scdb.LoadConfigFile(path)
+		assertNoError(t, err)
+		if !saved || config.Username != "carol" {
+			t.Errorf("after confirming, saved = %v and username = %q, want true and carol", saved, config.Username)
+		}
+	})
+
+	t.Run("Input ends early", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yml")
+		_, err := runWizard(defaults(), path, strings.NewReader("dave\n"), &bytes.Buffer{}, passwords("secret"))
+		assertErrorContains(t, err, "no more input")
+		if _, statErr := os.Stat(path); statErr == nil {
+			t.Error("config file written although the wizard was cancelled")
+		}
+	})
+}
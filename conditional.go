@@ -0,0 +1,133 @@
+package scdb
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// etagPath returns where the ETag of a downloaded file is stored
+func etagPath(path string) string {
+	return path + ".etag"
+}
+
+// setConditionalHeaders asks the server to skip the body when the existing file at path
+// is still current, using its stored ETag and modification time
+func (d *SCDBDownloader) setConditionalHeaders(req *http.Request, path string) {
+	// A streamed download has no file to compare with
+	if d.config.Force || d.streaming() {
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+
+	if etag, err := os.ReadFile(etagPath(path)); err == nil {
+		if value := strings.TrimSpace(string(etag)); value != "" {
+			req.Header.Set("If-None-Match", value)
+		}
+	}
+	req.Header.Set("If-Modified-Since", info.ModTime().UTC().Format(http.TimeFormat))
+}
+
+// upToDate reports whether resp shows that the existing file at path needs no rewrite:
+// the server answered 304 Not Modified or announced a body of exactly the file's size
+func (d *SCDBDownloader) upToDate(resp *http.Response, path string) bool {
+	if d.config.Force || d.streaming() {
+		return false
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return true
+	case http.StatusPartialContent:
+		// The length is that of the rest of a resumed download
+		return false
+	}
+	return resp.ContentLength > 0 && resp.ContentLength == info.Size()
+}
+
+// fresh reports whether the existing file at path was modified less than Config.MaxAge
+// ago, so downloading it again can be skipped
+func (d *SCDBDownloader) fresh(path string) bool {
+	if d.config.MaxAge <= 0 || d.config.Force {
+		return false
+	}
+
+	info, err := os.Stat(path)
+	return err == nil && time.Since(info.ModTime()) < d.config.MaxAge
+}
+
+// keepFresh records the existing file at path as kept, without a request, when it is
+// fresh. It reports whether the download can be skipped.
+func (d *SCDBDownloader) keepFresh(path string) (bool, error) {
+	if !d.fresh(path) {
+		return false, nil
+	}
+
+	sum, size, err := fileSHA256(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read existing file: %w", err)
+	}
+	d.logger.Info("fresh, skipping download", "path", path, "max_age", d.config.MaxAge)
+	d.addFile(FileResult{Path: path, Bytes: size, SHA256: sum, Unchanged: true})
+	return true, nil
+}
+
+// allFresh reports whether every file the run would download is fresh, in which case
+// there is no need to log in at all
+func (d *SCDBDownloader) allFresh() bool {
+	if d.config.MaxAge <= 0 || d.config.Force {
+		return false
+	}
+
+	var paths []string
+	if d.config.DownloadFixed {
+		if d.config.SeparateByCountry {
+			for _, country := range d.config.Countries {
+				paths = append(paths, d.freshCandidate("fixed", country))
+			}
+		} else {
+			paths = append(paths, d.freshCandidate("fixed", ""))
+		}
+	}
+	if d.config.DownloadMobile {
+		paths = append(paths, d.freshCandidate("mobile", ""))
+	}
+
+	for _, path := range paths {
+		if path == "" || !d.fresh(path) {
+			return false
+		}
+	}
+	return len(paths) > 0
+}
+
+// freshCandidate returns the output path of a download for allFresh, or "" when the
+// name cannot be rendered
+func (d *SCDBDownloader) freshCandidate(typ, country string) string {
+	path, err := d.outputPath(typ, country)
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// storeValidators saves the ETag the server sent for path, for the next conditional
+// request. The file keeps the time it was written as its modification time, not the
+// Last-Modified date: Config.MaxAge measures the time since the download, and a later
+// If-Modified-Since still gets a 304 from the server.
+func storeValidators(resp *http.Response, path string) {
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		_ = os.WriteFile(etagPath(path), []byte(etag+"\n"), 0644)
+	}
+}
@@ -1,11 +1,14 @@
-package main
+package scdb
 
 import (
+	"bytes"
+	"errors"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestValidateConfig(t *testing.T) {
@@ -14,6 +17,7 @@ func TestValidateConfig(t *testing.T) {
 		config  *Config
 		wantErr bool
 		errMsg  string
+		wantIs  error
 	}{
 		{
 			name: "Valid config",
@@ -25,6 +29,7 @@ func TestValidateConfig(t *testing.T) {
 				DisplayType:      2,
 				IconSize:         3,
 				WarningTime:      300,
+				AcceptAgreement:  true,
 				DownloadFixed:    true,
 				DownloadMobile:   true,
 				DangerZones:      true,
@@ -45,6 +50,7 @@ func TestValidateConfig(t *testing.T) {
 			},
 			wantErr: true,
 			errMsg:  "username and password are required",
+			wantIs:  ErrMissingCredentials,
 		},
 		{
 			name: "Missing password",
@@ -58,6 +64,7 @@ func TestValidateConfig(t *testing.T) {
 			},
 			wantErr: true,
 			errMsg:  "username and password are required",
+			wantIs:  ErrMissingCredentials,
 		},
 		{
 			name: "Invalid display type - too low",
@@ -72,6 +79,7 @@ func TestValidateConfig(t *testing.T) {
 			},
 			wantErr: true,
 			errMsg:  "display type must be 1-4",
+			wantIs:  ErrInvalidDisplayType,
 		},
 		{
 			name: "Invalid display type - too high",
@@ -86,6 +94,7 @@ func TestValidateConfig(t *testing.T) {
 			},
 			wantErr: true,
 			errMsg:  "display type must be 1-4",
+			wantIs:  ErrInvalidDisplayType,
 		},
 		{
 			name: "Invalid icon size - too low",
@@ -100,6 +109,7 @@ func TestValidateConfig(t *testing.T) {
 			},
 			wantErr: true,
 			errMsg:  "icon size must be 1-5",
+			wantIs:  ErrInvalidIconSize,
 		},
 		{
 			name: "Invalid icon size - too high",
@@ -114,6 +124,7 @@ func TestValidateConfig(t *testing.T) {
 			},
 			wantErr: true,
 			errMsg:  "icon size must be 1-5",
+			wantIs:  ErrInvalidIconSize,
 		},
 		{
 			name: "Negative warning time",
@@ -130,6 +141,787 @@ func TestValidateConfig(t *testing.T) {
 			wantErr: true,
 			errMsg:  "warning time cannot be negative",
 		},
+		{
+			name: "Warning time above maximum",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				WarningTime:    3601,
+				DownloadFixed:  true,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  "warning time cannot exceed 3600 seconds",
+		},
+		{
+			name: "Negative concurrency",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				Concurrency:    -1,
+				DownloadFixed:  true,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  "concurrency cannot be negative",
+		},
+		{
+			name: "Filename template with a path separator",
+			config: &Config{
+				Username:         "testuser",
+				Password:         "testpass",
+				Countries:        []string{"NL"},
+				DisplayType:      2,
+				IconSize:         3,
+				FilenameTemplate: "../{{.Type}}.zip",
+				DownloadFixed:    true,
+				DownloadMobile:   true,
+			},
+			wantErr: true,
+			errMsg:  "is not a plain file name",
+			wantIs:  ErrInvalidFilename,
+		},
+		{
+			name: "Filename template with a syntax error",
+			config: &Config{
+				Username:         "testuser",
+				Password:         "testpass",
+				Countries:        []string{"NL"},
+				DisplayType:      2,
+				IconSize:         3,
+				FilenameTemplate: "{{.Type",
+				DownloadFixed:    true,
+				DownloadMobile:   true,
+			},
+			wantErr: true,
+			errMsg:  "invalid filename template",
+			wantIs:  ErrInvalidFilename,
+		},
+		{
+			name: "Filename template without type",
+			config: &Config{
+				Username:         "testuser",
+				Password:         "testpass",
+				Countries:        []string{"NL"},
+				DisplayType:      2,
+				IconSize:         3,
+				FilenameTemplate: "scdb.zip",
+				DownloadFixed:    true,
+				DownloadMobile:   true,
+			},
+			wantErr: true,
+			errMsg:  "is used for fixed and mobile downloads",
+			wantIs:  ErrInvalidFilename,
+		},
+		{
+			name: "Filename template without country in separate mode",
+			config: &Config{
+				Username:          "testuser",
+				Password:          "testpass",
+				Countries:         []string{"NL"},
+				DisplayType:       2,
+				IconSize:          3,
+				FilenameTemplate:  "scdb-{{.Type}}.zip",
+				SeparateByCountry: true,
+				DownloadFixed:     true,
+				DownloadMobile:    true,
+			},
+			wantErr: true,
+			errMsg:  "is used for every country",
+			wantIs:  ErrInvalidFilename,
+		},
+		{
+			name: "Negative keep",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				Archive:        true,
+				Keep:           -1,
+				DownloadFixed:  true,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  "keep cannot be negative",
+		},
+		{
+			name: "Keep without archive",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				Keep:           3,
+				DownloadFixed:  true,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  "Keep requires Archive",
+		},
+		{
+			name: "Negative max age",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				MaxAge:         -time.Hour,
+				DownloadFixed:  true,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  "max age cannot be negative",
+		},
+		{
+			name: "Unknown format",
+			config: &Config{
+				Username:        "testuser",
+				Password:        "testpass",
+				Countries:       []string{"NL"},
+				DisplayType:     2,
+				IconSize:        3,
+				Format:          "navigon",
+				AcceptAgreement: true,
+				DownloadFixed:   true,
+				DownloadMobile:  true,
+			},
+			wantErr: true,
+			errMsg:  `invalid format "navigon" (want garmin)`,
+		},
+		{
+			name: "Invalid form encoding",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				FormEncoding:   "json",
+				DownloadFixed:  true,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  `invalid form encoding "json" (want urlencoded or multipart)`,
+		},
+		{
+			name: "Negative request delay",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				RequestDelay:   -time.Second,
+				DownloadFixed:  true,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  "request delay cannot be negative",
+		},
+		{
+			name: "Negative retry count",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				RetryCount:     -1,
+				DownloadFixed:  true,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  "retry count cannot be negative",
+		},
+		{
+			name: "Negative retry backoff",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				RetryBackoff:   -time.Second,
+				DownloadFixed:  true,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  "retry backoff cannot be negative",
+		},
+		{
+			name: "Invalid log level",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				LogLevel:       "loud",
+				DownloadFixed:  true,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  `invalid log level "loud"`,
+		},
+		{
+			name: "Invalid log format",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				LogFormat:      "xml",
+				DownloadFixed:  true,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  `invalid log format "xml"`,
+		},
+		{
+			name: "Extract-only without extract",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				ExtractOnly:    true,
+				DownloadFixed:  true,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  "ExtractOnly requires Extract",
+		},
+		{
+			name: "Since date that does not exist",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				SinceDate:      "2025-02-30",
+				DownloadFixed:  true,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  `invalid since date "2025-02-30" (want YYYY-MM-DD)`,
+		},
+		{
+			name: "Since date",
+			config: &Config{
+				Username:        "testuser",
+				Password:        "testpass",
+				Countries:       []string{"NL"},
+				DisplayType:     2,
+				IconSize:        3,
+				SinceDate:       "2025-01-31",
+				AcceptAgreement: true,
+				DownloadFixed:   true,
+				DownloadMobile:  true,
+			},
+			wantErr: false,
+		},
+		{
+			name: "No-clobber with backup",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				NoClobber:      true,
+				Backup:         true,
+				DownloadFixed:  true,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  "NoClobber and Backup cannot be used together",
+		},
+		{
+			name: "Form field set by an option",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				FormFields:     map[string]string{"split_speed_limits": "1", "typ": "5"},
+				DownloadFixed:  false,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  `form field "typ" is set by -display`,
+		},
+		{
+			name: "Form field without a name",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				FormFields:     map[string]string{" ": "1"},
+				DownloadFixed:  false,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  "form field name cannot be empty",
+		},
+		{
+			name: "Extra form field",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				FormFields:     map[string]string{"split_speed_limits": "1"},
+				DownloadFixed:  false,
+				DownloadMobile: true,
+			},
+			wantErr: false,
+		},
+		{
+			name: "Only changed without separate by country",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				OnlyChanged:    true,
+				DownloadFixed:  false,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  "OnlyChanged requires SeparateByCountry",
+		},
+		{
+			name: "Clean with archive",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				Clean:          true,
+				Archive:        true,
+				DownloadFixed:  false,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  "Clean cannot be used with Archive",
+		},
+		{
+			name: "Clean with max age",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				Clean:          true,
+				MaxAge:         time.Hour,
+				DownloadFixed:  false,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  "Clean cannot be used with MaxAge",
+		},
+		{
+			name: "Clean with only changed",
+			config: &Config{
+				Username:          "testuser",
+				Password:          "testpass",
+				Countries:         []string{"NL"},
+				DisplayType:       2,
+				IconSize:          3,
+				Clean:             true,
+				OnlyChanged:       true,
+				SeparateByCountry: true,
+				DownloadFixed:     true,
+				DownloadMobile:    false,
+				AcceptAgreement:   true,
+			},
+			wantErr: true,
+			errMsg:  "Clean cannot be used with OnlyChanged",
+		},
+		{
+			name: "Negative max rate",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				MaxRate:        -1,
+				DownloadFixed:  false,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  "max rate cannot be negative (got -1)",
+		},
+		{
+			name: "Strict mobile with a country selection",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"D", "A", "CH"},
+				DisplayType:    2,
+				IconSize:       3,
+				DownloadFixed:  false,
+				DownloadMobile: true,
+				StrictMobile:   true,
+			},
+			wantErr: true,
+			errMsg:  "StrictMobile: the mobile camera database always covers every country",
+		},
+		{
+			name: "Strict mobile with all countries",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      AllCountries(),
+				DisplayType:    2,
+				IconSize:       3,
+				DownloadFixed:  false,
+				DownloadMobile: true,
+				StrictMobile:   true,
+			},
+			wantErr: false,
+		},
+		{
+			name: "Mobile path with a host",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				DownloadFixed:  false,
+				DownloadMobile: true,
+				MobilePath:     "https://example.com/garmin-mobile.zip",
+			},
+			wantErr: true,
+			errMsg:  `invalid mobile path "https://example.com/garmin-mobile.zip"`,
+		},
+		{
+			name: "Mobile form field without a name",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				DownloadFixed:  false,
+				DownloadMobile: true,
+				MobileForm:     map[string]string{"": "Download"},
+			},
+			wantErr: true,
+			errMsg:  "mobile form field name cannot be empty",
+		},
+		{
+			name: "Server file names with separate-by-country",
+			config: &Config{
+				Username:          "testuser",
+				Password:          "testpass",
+				Countries:         []string{"NL"},
+				DisplayType:       2,
+				IconSize:          3,
+				DownloadFixed:     false,
+				DownloadMobile:    true,
+				SeparateByCountry: true,
+				UseServerFilename: true,
+			},
+			wantErr: true,
+			errMsg:  "UseServerFilename cannot be used with SeparateByCountry",
+		},
+		{
+			name: "Server file names with a filename template",
+			config: &Config{
+				Username:          "testuser",
+				Password:          "testpass",
+				Countries:         []string{"NL"},
+				DisplayType:       2,
+				IconSize:          3,
+				DownloadFixed:     false,
+				DownloadMobile:    true,
+				FilenameTemplate:  "{{.Type}}.zip",
+				UseServerFilename: true,
+			},
+			wantErr: true,
+			errMsg:  "UseServerFilename cannot be used with FilenameTemplate",
+		},
+		{
+			name: "Danger zones only without fixed cameras",
+			config: &Config{
+				Username:        "testuser",
+				Password:        "testpass",
+				Countries:       []string{"NL"},
+				DisplayType:     2,
+				IconSize:        3,
+				DownloadFixed:   false,
+				DownloadMobile:  true,
+				DangerZonesOnly: true,
+			},
+			wantErr: true,
+			errMsg:  "DangerZonesOnly requires DownloadFixed",
+		},
+		{
+			name: "Diff with archive",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				DownloadFixed:  false,
+				DownloadMobile: true,
+				Archive:        true,
+				Diff:           true,
+			},
+			wantErr: true,
+			errMsg:  "Diff cannot be used with Archive",
+		},
+		{
+			name: "Diff with extract",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				DownloadFixed:  false,
+				DownloadMobile: true,
+				Extract:        true,
+				Diff:           true,
+			},
+			wantErr: true,
+			errMsg:  "Diff cannot be used with Extract",
+		},
+		{
+			name: "Negative max download size",
+			config: &Config{
+				Username:         "testuser",
+				Password:         "testpass",
+				Countries:        []string{"NL"},
+				DisplayType:      2,
+				IconSize:         3,
+				MaxDownloadBytes: -1,
+				DownloadFixed:    false,
+				DownloadMobile:   true,
+			},
+			wantErr: true,
+			errMsg:  "max download size cannot be negative (got -1)",
+		},
+		{
+			name: "Negative max total size",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				MaxTotalBytes:  -1,
+				DownloadFixed:  false,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  "max total size cannot be negative (got -1)",
+		},
+		{
+			name: "Concurrency without separate-by-country",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				Concurrency:    4,
+				DownloadFixed:  false,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  "Concurrency 4 requires SeparateByCountry",
+		},
+		{
+			name: "Verbose with a quieter log level",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				Verbose:        true,
+				LogLevel:       "warn",
+				DownloadFixed:  false,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  "Verbose cannot be used with LogLevel warn",
+		},
+		{
+			name: "Verbose with debug log level",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				Verbose:        true,
+				LogLevel:       "debug",
+				DownloadFixed:  false,
+				DownloadMobile: true,
+			},
+			wantErr: false,
+		},
+		{
+			name: "Stdout output with both downloads",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				OutputDir:      StdoutOutput,
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				DownloadFixed:  true,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  "OutputDir - writes a single archive",
+		},
+		{
+			name: "Stdout output with checksums",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				OutputDir:      StdoutOutput,
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				Checksums:      true,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  "Checksums cannot be used with OutputDir -",
+		},
+		{
+			name: "Type output directories with archive",
+			config: &Config{
+				Username:        "testuser",
+				Password:        "testpass",
+				Countries:       []string{"NL"},
+				DisplayType:     2,
+				IconSize:        3,
+				MobileOutputDir: "/media/phone",
+				Archive:         true,
+				DownloadMobile:  true,
+			},
+			wantErr: true,
+			errMsg:  "MobileOutputDir cannot be used with Archive",
+		},
+		{
+			name: "Unknown default profile",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				DownloadMobile: true,
+				Profiles:       map[string]Profile{"home": {Username: "alice"}},
+				DefaultProfile: "work",
+			},
+			wantErr: true,
+			errMsg:  `unknown profile "work" (want home)`,
+		},
+		{
+			name: "Negative timeout",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				Timeout:        -time.Minute,
+				DownloadFixed:  true,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  "timeout cannot be negative",
+		},
+		{
+			name: "Negative login timeout",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				LoginTimeout:   -time.Second,
+				DownloadFixed:  true,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  "login timeout cannot be negative",
+		},
+		{
+			name: "Unsupported proxy scheme",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				ProxyURL:       "ftp://proxy.example.com",
+				DownloadFixed:  true,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  "scheme must be http, https or socks5",
+		},
+		{
+			name: "Proxy without host",
+			config: &Config{
+				Username:       "testuser",
+				Password:       "testpass",
+				Countries:      []string{"NL"},
+				DisplayType:    2,
+				IconSize:       3,
+				ProxyURL:       "http://",
+				DownloadFixed:  true,
+				DownloadMobile: true,
+			},
+			wantErr: true,
+			errMsg:  "missing host",
+		},
+		{
+			name: "Valid SOCKS proxy",
+			config: &Config{
+				Username:        "testuser",
+				Password:        "testpass",
+				Countries:       []string{"NL"},
+				DisplayType:     2,
+				IconSize:        3,
+				ProxyURL:        "socks5://127.0.0.1:1080",
+				AcceptAgreement: true,
+				DownloadFixed:   true,
+				DownloadMobile:  true,
+			},
+			wantErr: false,
+		},
 		{
 			name: "Both download options disabled",
 			config: &Config{
@@ -143,7 +935,7 @@ func TestValidateConfig(t *testing.T) {
 				DownloadMobile: false,
 			},
 			wantErr: true,
-			errMsg:  "at least one of -fixed or -mobile must be enabled",
+			errMsg:  "at least one of DownloadFixed or DownloadMobile must be enabled",
 		},
 		{
 			name: "No countries specified",
@@ -160,17 +952,34 @@ func TestValidateConfig(t *testing.T) {
 			wantErr: true,
 			errMsg:  "no countries specified",
 		},
+		{
+			name: "Download agreement not accepted",
+			config: &Config{
+				Username:        "testuser",
+				Password:        "testpass",
+				Countries:       []string{"NL"},
+				DisplayType:     2,
+				IconSize:        3,
+				WaiveRescission: true,
+				DownloadFixed:   true,
+				DownloadMobile:  true,
+			},
+			wantErr: true,
+			errMsg:  "set Config.AcceptAgreement",
+			wantIs:  ErrAgreementNotAccepted,
+		},
 		{
 			name: "Valid with only fixed download",
 			config: &Config{
-				Username:       "testuser",
-				Password:       "testpass",
-				Countries:      []string{"NL"},
-				DisplayType:    2,
-				IconSize:       3,
-				WarningTime:    600,
-				DownloadFixed:  true,
-				DownloadMobile: false,
+				Username:        "testuser",
+				Password:        "testpass",
+				Countries:       []string{"NL"},
+				DisplayType:     2,
+				IconSize:        3,
+				WarningTime:     600,
+				AcceptAgreement: true,
+				DownloadFixed:   true,
+				DownloadMobile:  false,
 			},
 			wantErr: false,
 		},
@@ -192,18 +1001,21 @@ func TestValidateConfig(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validateConfig(tt.config)
+			err := ValidateConfig(tt.config)
 
 			if (err != nil) != tt.wantErr {
-				t.Errorf("validateConfig() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("ValidateConfig() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 
 			if tt.wantErr && tt.errMsg != "" {
 				if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
-					t.Errorf("validateConfig() error = %v, want error containing %q", err, tt.errMsg)
+					t.Errorf("ValidateConfig() error = %v, want error containing %q", err, tt.errMsg)
 				}
 			}
+			if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+				t.Errorf("ValidateConfig() error = %v, want errors.Is %v", err, tt.wantIs)
+			}
 		})
 	}
 }
@@ -253,15 +1065,15 @@ func TestGetDefaultConfigPath(t *testing.T) {
 				_ = os.Unsetenv("XDG_CONFIG_HOME")
 			}
 
-			path := getDefaultConfigPath()
+			path := DefaultConfigPath()
 
 			if !strings.HasSuffix(path, tt.expectedSuffix) {
-				t.Errorf("getDefaultConfigPath() = %q, want suffix %q", path, tt.expectedSuffix)
+				t.Errorf("DefaultConfigPath() = %q, want suffix %q", path, tt.expectedSuffix)
 			}
 
 			// Ensure path is absolute
 			if !filepath.IsAbs(path) {
-				t.Errorf("getDefaultConfigPath() = %q, want absolute path", path)
+				t.Errorf("DefaultConfigPath() = %q, want absolute path", path)
 			}
 		})
 	}
@@ -271,11 +1083,11 @@ func TestGetDefaultConfigPath(t *testing.T) {
 		_ = os.Unsetenv("HOME")
 		_ = os.Unsetenv("XDG_CONFIG_HOME")
 
-		path := getDefaultConfigPath()
+		path := DefaultConfigPath()
 		expected := "./scdb-config.yml"
 
 		if path != expected {
-			t.Errorf("getDefaultConfigPath() = %q, want %q", path, expected)
+			t.Errorf("DefaultConfigPath() = %q, want %q", path, expected)
 		}
 	})
 }
@@ -373,6 +1185,42 @@ verbose: true`,
 			expected:    &Config{}, // Default zero values
 			wantErr:     false,
 		},
+		{
+			name:        "Invalid country code",
+			fileContent: "countries:\n- NL\n- XX\n",
+			expected:    nil,
+			wantErr:     true,
+			errMsg:      "invalid countries in config file",
+		},
+		{
+			name:        "Regions and names are expanded",
+			fileContent: "countries:\n- benelux\n- germany\n- -L\n",
+			expected:    &Config{Countries: []string{"B", "NL", "D"}},
+			wantErr:     false,
+		},
+		{
+			name:        "User regions are expanded",
+			fileContent: "regions:\n  myroute: [NL, D, alps]\ncountries:\n- myroute\n",
+			expected: &Config{
+				Countries: []string{"NL", "D", "CH", "A", "LI", "FR", "I"},
+				Regions:   map[string][]string{"myroute": {"NL", "D", "alps"}},
+			},
+			wantErr: false,
+		},
+		{
+			name:        "Unused region cycle is rejected",
+			fileContent: "regions:\n  north: [NL, south]\n  south: [B, north]\n",
+			expected:    nil,
+			wantErr:     true,
+			errMsg:      "region cycle",
+		},
+		{
+			name:        "Region named like a country code is rejected",
+			fileContent: "regions:\n  nl: [NL, B]\n",
+			expected:    nil,
+			wantErr:     true,
+			errMsg:      `region "nl" has the name of the country code NL`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -384,33 +1232,197 @@ verbose: true`,
 				t.Fatalf("Failed to create test file: %v", err)
 			}
 
-			got, err := loadConfigFile(testFile)
+			got, err := LoadConfigFile(testFile)
 
 			if (err != nil) != tt.wantErr {
-				t.Errorf("loadConfigFile() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("LoadConfigFile() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 
 			if tt.wantErr && tt.errMsg != "" {
 				if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
-					t.Errorf("loadConfigFile() error = %v, want error containing %q", err, tt.errMsg)
+					t.Errorf("LoadConfigFile() error = %v, want error containing %q", err, tt.errMsg)
 				}
 				return
 			}
 
 			if !tt.wantErr && !reflect.DeepEqual(got, tt.expected) {
-				t.Errorf("loadConfigFile() = %+v, want %+v", got, tt.expected)
+				t.Errorf("LoadConfigFile() = %+v, want %+v", got, tt.expected)
 			}
 		})
 	}
 
 	// Test file not found
 	t.Run("File not found", func(t *testing.T) {
-		_, err := loadConfigFile("/nonexistent/file.yml")
+		_, err := LoadConfigFile("/nonexistent/file.yml")
 		if err == nil {
-			t.Error("loadConfigFile() expected error for nonexistent file, got nil")
+			t.Error("LoadConfigFile() expected error for nonexistent file, got nil")
+		}
+	})
+}
+
+func TestLoadConfigFileExtends(t *testing.T) {
+	tempDir := t.TempDir()
+
+	write := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	write("shared/base.yml", "countries: [benelux, D]\ndisplay_type: 2\nicon_size: 3\ndanger_zones: true\n")
+
+	t.Run("Overlay on base", func(t *testing.T) {
+		// The base is found relative to the including file, not the working directory
+		path := write("machines/car.yml", "extends: ../shared/base.yml\ndisplay_type: 4\noutput_dir: /media/garmin\n")
+
+		got, err := LoadConfigFile(path)
+		AssertNoError(t, err)
+		want := &Config{
+			Countries:   []string{"B", "NL", "L", "D"},
+			DisplayType: 4,
+			IconSize:    3,
+			DangerZones: true,
+			OutputDir:   "/media/garmin",
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("LoadConfigFile() = %+v, want %+v", got, want)
 		}
 	})
+
+	t.Run("Chained bases", func(t *testing.T) {
+		write("shared/europe.yml", "extends: base.yml\ncountries: [europe]\n")
+		path := write("machines/truck.yml", "extends: ../shared/europe.yml\nicon_size: 5\n")
+
+		got, err := LoadConfigFile(path)
+		AssertNoError(t, err)
+		if got.DisplayType != 2 || got.IconSize != 5 || len(got.Countries) != len(regionMap["europe"]) {
+			t.Errorf("LoadConfigFile() = %+v, want display type 2, icon size 5 and the europe countries", got)
+		}
+	})
+
+	t.Run("Cycle", func(t *testing.T) {
+		write("loop/a.yml", "extends: b.yml\n")
+		path := write("loop/b.yml", "extends: a.yml\n")
+
+		_, err := LoadConfigFile(path)
+		AssertErrorContains(t, err, "config file extends cycle")
+	})
+
+	t.Run("Extending itself", func(t *testing.T) {
+		path := write("self.yml", "extends: self.yml\n")
+
+		_, err := LoadConfigFile(path)
+		AssertErrorContains(t, err, "config file extends cycle")
+	})
+
+	t.Run("Missing base", func(t *testing.T) {
+		path := write("orphan.yml", "extends: missing.yml\n")
+
+		_, err := LoadConfigFile(path)
+		AssertErrorContains(t, err, "extends missing.yml: error reading config file")
+	})
+}
+
+func TestConfigApplyProfile(t *testing.T) {
+	newConfig := func() *Config {
+		return &Config{
+			Username:  "shared",
+			Password:  "shared-pass",
+			Countries: []string{"NL"},
+			Regions:   map[string][]string{"home": {"B", "L"}},
+			Profiles: map[string]Profile{
+				"default": {Countries: []string{"home"}},
+				"alice":   {Username: "alice", Password: "alice-pass", Countries: []string{"dach"}},
+				"rotated": {Password: "new-pass"},
+			},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		profile   string
+		user      string
+		pass      string
+		countries []string
+	}{
+		{"Default profile by name", "", "shared", "shared-pass", []string{"B", "L"}},
+		{"Selected profile", "alice", "alice", "alice-pass", []string{"D", "A", "CH"}},
+		{"Password only", "rotated", "shared", "new-pass", []string{"NL"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newConfig()
+			AssertNoError(t, config.ApplyProfile(tt.profile))
+			if config.Username != tt.user || config.Password != tt.pass || !reflect.DeepEqual(config.Countries, tt.countries) {
+				t.Errorf("ApplyProfile(%q) = %q, %q, %v, want %q, %q, %v", tt.profile, config.Username, config.Password, config.Countries, tt.user, tt.pass, tt.countries)
+			}
+		})
+	}
+
+	t.Run("No profiles", func(t *testing.T) {
+		config := &Config{Username: "shared"}
+		AssertNoError(t, config.ApplyProfile(""))
+		if config.Profile != "" || config.Username != "shared" {
+			t.Errorf("ApplyProfile(\"\") changed the config: %+v", config)
+		}
+		AssertErrorContains(t, config.ApplyProfile("alice"), "the config file defines no profiles")
+	})
+}
+
+func TestConfigClone(t *testing.T) {
+	newConfig := func() *Config {
+		return &Config{
+			Username:  "shared",
+			Password:  "shared-pass",
+			Countries: []string{"NL", "B"},
+			CountrySubstitutions: []CountrySubstitution{
+				{Code: "UK", Replacement: "GB", Reason: "exceptionally reserved"},
+			},
+			Regions:    map[string][]string{"home": {"B", "L"}},
+			Profiles:   map[string]Profile{"work": {Username: "work", Password: "work-pass", Countries: []string{"D"}}},
+			FormFields: map[string]string{"extra": "1"},
+			MobileForm: map[string]string{"mobile_submit": "Download"},
+		}
+	}
+
+	original := newConfig()
+	clone := original.Clone()
+	if !reflect.DeepEqual(clone, original) {
+		t.Fatalf("Clone() = %+v, want %+v", clone, original)
+	}
+
+	clone.Countries[0] = "D"
+	clone.Countries = append(clone.Countries, "A")
+	clone.CountrySubstitutions[0].Replacement = "UK"
+	clone.Regions["home"][0] = "NL"
+	clone.Regions["away"] = []string{"FR"}
+	clone.Profiles["work"].Countries[0] = "CH"
+	clone.Profiles["home"] = Profile{Username: "home"}
+	clone.FormFields["extra"] = "2"
+	clone.MobileForm["mobile_submit"] = "Now"
+	if want := newConfig(); !reflect.DeepEqual(original, want) {
+		t.Errorf("changing the clone changed the original to %+v, want %+v", original, want)
+	}
+
+	if (*Config)(nil).Clone() != nil {
+		t.Error("Clone() of a nil config is not nil")
+	}
+	if empty := (&Config{}).Clone(); !reflect.DeepEqual(empty, &Config{}) {
+		t.Errorf("Clone() of an empty config = %+v, want nil slices and maps kept nil", empty)
+	}
+
+	// RedactSecrets works on a clone, so the config it shows keeps its passwords
+	redacted := RedactSecrets(original)
+	if redacted.Profiles["work"].Password != "REDACTED" || original.Profiles["work"].Password != "work-pass" {
+		t.Errorf("RedactSecrets() profile password = %q, original %q", redacted.Profiles["work"].Password, original.Profiles["work"].Password)
+	}
 }
 
 func TestSaveConfigFile(t *testing.T) {
@@ -439,20 +1451,20 @@ func TestSaveConfigFile(t *testing.T) {
 	t.Run("Save to new file", func(t *testing.T) {
 		testFile := filepath.Join(tempDir, "save_test.yml")
 
-		err := saveConfigFile(config, testFile)
+		err := SaveConfigFile(config, testFile)
 		if err != nil {
-			t.Errorf("saveConfigFile() error = %v", err)
+			t.Errorf("SaveConfigFile() error = %v", err)
 			return
 		}
 
 		// Verify file was created
 		if _, err := os.Stat(testFile); os.IsNotExist(err) {
-			t.Errorf("saveConfigFile() did not create file %s", testFile)
+			t.Errorf("SaveConfigFile() did not create file %s", testFile)
 			return
 		}
 
 		// Verify file contents by loading it back
-		loaded, err := loadConfigFile(testFile)
+		loaded, err := LoadConfigFile(testFile)
 		if err != nil {
 			t.Errorf("Failed to load saved config: %v", err)
 			return
@@ -470,15 +1482,78 @@ func TestSaveConfigFile(t *testing.T) {
 		nestedDir := filepath.Join(tempDir, "nested", "dir")
 		testFile := filepath.Join(nestedDir, "config.yml")
 
-		err := saveConfigFile(config, testFile)
+		err := SaveConfigFile(config, testFile)
 		if err != nil {
-			t.Errorf("saveConfigFile() error = %v", err)
+			t.Errorf("SaveConfigFile() error = %v", err)
 			return
 		}
 
 		// Verify directory and file were created
 		if _, err := os.Stat(testFile); os.IsNotExist(err) {
-			t.Errorf("saveConfigFile() did not create file %s", testFile)
+			t.Errorf("SaveConfigFile() did not create file %s", testFile)
+		}
+	})
+
+	t.Run("Save without secrets", func(t *testing.T) {
+		testFile := filepath.Join(tempDir, "no_secrets.yml")
+
+		err := SaveConfigFileWithoutSecrets(config, testFile)
+		if err != nil {
+			t.Errorf("SaveConfigFileWithoutSecrets() error = %v", err)
+			return
+		}
+
+		data, err := os.ReadFile(testFile)
+		if err != nil {
+			t.Fatalf("Failed to read saved config: %v", err)
+		}
+		for _, secret := range []string{"testuser", "testpass"} {
+			if strings.Contains(string(data), secret) {
+				t.Errorf("Saved config contains %q:\n%s", secret, data)
+			}
+		}
+
+		loaded, err := LoadConfigFile(testFile)
+		if err != nil {
+			t.Fatalf("Failed to load saved config: %v", err)
+		}
+		want := config.Clone()
+		want.Username, want.Password = "", ""
+		loaded.ConfigFile = want.ConfigFile
+		if !reflect.DeepEqual(loaded, want) {
+			t.Errorf("Loaded config = %+v, want %+v", loaded, want)
+		}
+
+		// The caller's config keeps its credentials
+		if config.Username != "testuser" || config.Password != "testpass" {
+			t.Errorf("SaveConfigFileWithoutSecrets() changed credentials to %q, %q", config.Username, config.Password)
+		}
+	})
+
+	t.Run("Save profiles without secrets", func(t *testing.T) {
+		testFile := filepath.Join(tempDir, "no_profile_secrets.yml")
+		withProfiles := config.Clone()
+		withProfiles.Profiles = map[string]Profile{
+			"work": {Username: "workuser", Password: "workpass", Countries: []string{"D"}},
+			"home": {Password: "homepass"},
+		}
+		AssertNoError(t, SaveConfigFileWithoutSecrets(withProfiles, testFile))
+
+		data, err := os.ReadFile(testFile)
+		AssertNoError(t, err)
+		for _, secret := range []string{"testuser", "testpass", "workuser", "workpass", "homepass"} {
+			if strings.Contains(string(data), secret) {
+				t.Errorf("Saved config contains %q:\n%s", secret, data)
+			}
+		}
+
+		loaded, err := LoadConfigFile(testFile)
+		AssertNoError(t, err)
+		if got := loaded.Profiles["work"].Countries; !reflect.DeepEqual(got, []string{"D"}) {
+			t.Errorf("Loaded profile countries = %v, want [D]", got)
+		}
+		if withProfiles.Profiles["work"].Password != "workpass" {
+			t.Error("SaveConfigFileWithoutSecrets() changed the caller's profile password")
 		}
 	})
 
@@ -490,13 +1565,60 @@ func TestSaveConfigFile(t *testing.T) {
 		// Try to save to a location where we can't create directories
 		testFile := "/root/cannot_create/config.yml"
 
-		err := saveConfigFile(config, testFile)
+		err := SaveConfigFile(config, testFile)
 		if err == nil {
-			t.Error("saveConfigFile() expected error for invalid directory, got nil")
+			t.Error("SaveConfigFile() expected error for invalid directory, got nil")
 		}
 	})
 }
 
+func TestSaveConfigFileComments(t *testing.T) {
+	config := &Config{
+		Username:    "testuser",
+		Countries:   []string{"NL", "B"},
+		Regions:     map[string][]string{"home": {"NL"}},
+		Profiles:    map[string]Profile{"work": {Username: "work", Countries: []string{"D"}}},
+		DisplayType: 3,
+		IconSize:    4,
+		Timeout:     30 * time.Second,
+		FormFields:  map[string]string{"extra": "1"},
+	}
+	testFile := filepath.Join(t.TempDir(), "config.yml")
+	AssertNoError(t, SaveConfigFile(config, testFile))
+
+	data, err := os.ReadFile(testFile)
+	AssertNoError(t, err)
+	if !strings.HasPrefix(string(data), configHeader) {
+		t.Errorf("saved config does not start with the header:\n%s", data)
+	}
+	for _, want := range []string{
+		"# 1 = split all, 2 = split speed and red light cameras, 3 = all in one, 4 = all in one with another icon\ndisplay_type: 3\n",
+		"# 1 = 22x22, 2 = 24x24, 3 = 32x32, 4 = 48x48, 5 = 80x80 pixels\nicon_size: 4\n",
+		"regions:\n  home:\n",
+		"profiles:\n  work:\n    username: work\n",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("saved config does not contain %q:\n%s", want, data)
+		}
+	}
+
+	loaded, err := LoadConfigFile(testFile)
+	AssertNoError(t, err)
+	if !reflect.DeepEqual(loaded, config) {
+		t.Errorf("LoadConfigFile() = %+v, want %+v", loaded, config)
+	}
+
+	// Every key that can be saved is explained
+	comments := configComments()
+	fields := reflect.TypeOf(Config{})
+	for i := 0; i < fields.NumField(); i++ {
+		key, _, _ := strings.Cut(fields.Field(i).Tag.Get("yaml"), ",")
+		if key != "" && key != "-" && comments[key] == "" {
+			t.Errorf("configComments() has no comment for %s", key)
+		}
+	}
+}
+
 func TestConfigRoundTrip(t *testing.T) {
 	// Test that save -> load produces identical config
 	tempDir, err := os.MkdirTemp("", "scdb_config_roundtrip_test")
@@ -523,15 +1645,15 @@ func TestConfigRoundTrip(t *testing.T) {
 	testFile := filepath.Join(tempDir, "roundtrip.yml")
 
 	// Save
-	err = saveConfigFile(original, testFile)
+	err = SaveConfigFile(original, testFile)
 	if err != nil {
-		t.Fatalf("saveConfigFile() error = %v", err)
+		t.Fatalf("SaveConfigFile() error = %v", err)
 	}
 
 	// Load
-	loaded, err := loadConfigFile(testFile)
+	loaded, err := LoadConfigFile(testFile)
 	if err != nil {
-		t.Fatalf("loadConfigFile() error = %v", err)
+		t.Fatalf("LoadConfigFile() error = %v", err)
 	}
 
 	// Compare (ConfigFile field is not serialized)
@@ -541,3 +1663,217 @@ func TestConfigRoundTrip(t *testing.T) {
 		t.Errorf("Round trip failed:\nOriginal: %+v\nLoaded:   %+v", original, loaded)
 	}
 }
+
+func TestNewLogger(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    *Config
+		wantDebug bool
+		wantWarn  bool
+		wantJSON  bool
+	}{
+		{name: "Default is info text", config: &Config{}, wantWarn: true},
+		{name: "Verbose enables debug", config: &Config{Verbose: true}, wantDebug: true, wantWarn: true},
+		{name: "Explicit level wins over verbose", config: &Config{Verbose: true, LogLevel: "error"}},
+		{name: "Level names are case-insensitive", config: &Config{LogLevel: "WARN"}, wantWarn: true},
+		{name: "JSON format", config: &Config{LogFormat: "json"}, wantWarn: true, wantJSON: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger, err := NewLogger(&buf, tt.config)
+			AssertNoError(t, err)
+
+			logger.Debug("debug message")
+			logger.Warn("warn message")
+			out := buf.String()
+
+			if got := strings.Contains(out, "debug message"); got != tt.wantDebug {
+				t.Errorf("debug logged = %v, want %v\n%s", got, tt.wantDebug, out)
+			}
+			if got := strings.Contains(out, "warn message"); got != tt.wantWarn {
+				t.Errorf("warn logged = %v, want %v\n%s", got, tt.wantWarn, out)
+			}
+			if got := strings.HasPrefix(out, "{"); tt.wantWarn && got != tt.wantJSON {
+				t.Errorf("JSON output = %v, want %v\n%s", got, tt.wantJSON, out)
+			}
+		})
+	}
+}
+
+func TestParseDisplayType(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int
+	}{
+		{"1", 1},
+		{"4", 4},
+		{"split-all", 1},
+		{"split-speed-red", 2},
+		{"all-in-one", 3},
+		{"All-In-One-Alt", 4},
+		{" 2 ", 2},
+		{"0", 0},
+		{"5", 0},
+		{"split", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseDisplayType(tt.input)
+			if tt.want == 0 {
+				AssertErrorContains(t, err, "split-all, split-speed-red, all-in-one, all-in-one-alt")
+				if !errors.Is(err, ErrInvalidDisplayType) {
+					t.Errorf("ParseDisplayType(%q) error = %v, want ErrInvalidDisplayType", tt.input, err)
+				}
+				return
+			}
+			AssertNoError(t, err)
+			if got != tt.want {
+				t.Errorf("ParseDisplayType(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIconSize(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int
+	}{
+		{"1", 1},
+		{"5", 5},
+		{"22", 1},
+		{"24", 2},
+		{"32", 3},
+		{"48", 4},
+		{"80", 5},
+		{"0", 0},
+		{"6", 0},
+		{"64", 0},
+		{"large", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseIconSize(tt.input)
+			if tt.want == 0 {
+				AssertErrorContains(t, err, "22, 24, 32, 48, 80")
+				if !errors.Is(err, ErrInvalidIconSize) {
+					t.Errorf("ParseIconSize(%q) error = %v, want ErrInvalidIconSize", tt.input, err)
+				}
+				return
+			}
+			AssertNoError(t, err)
+			if got != tt.want {
+				t.Errorf("ParseIconSize(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWarningTime(t *testing.T) {
+	tests := []struct {
+		input  string
+		want   int
+		errMsg string
+	}{
+		{"0", 0, ""},
+		{"300", 300, ""},
+		{"300s", 300, ""},
+		{"5m", 300, ""},
+		{"1h", 3600, ""},
+		{"1m30s", 90, ""},
+		{"-5", 0, "cannot be negative"},
+		{"-1m", 0, "cannot be negative"},
+		{"2h", 0, "cannot exceed 3600 seconds"},
+		{"1500ms", 0, "whole number of seconds"},
+		{"soon", 0, "invalid warning time"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseWarningTime(tt.input)
+			if tt.errMsg != "" {
+				AssertErrorContains(t, err, tt.errMsg)
+				return
+			}
+			AssertNoError(t, err)
+			if got != tt.want {
+				t.Errorf("ParseWarningTime(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		input  string
+		want   int64
+		errMsg string
+	}{
+		{"0", 0, ""},
+		{"4096", 4096, ""},
+		{"500MB", 500 << 20, ""},
+		{"1.5g", 3 << 29, ""},
+		{" 2GiB ", 2 << 30, ""},
+		{"2MB/s", 0, "invalid size"},
+		{"-1MB", 0, "invalid size"},
+		{"big", 0, "invalid size"},
+		{"0.5", 0, "less than one byte"},
+		{"8589934591G", 8589934591 << 30, ""},
+		{"8589934592G", 0, "too large"},
+		{"9999999999999GB", 0, "too large"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseByteSize(tt.input)
+			if tt.errMsg != "" {
+				AssertErrorContains(t, err, tt.errMsg)
+				return
+			}
+			AssertNoError(t, err)
+			if got != tt.want {
+				t.Errorf("ParseByteSize(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseByteRate(t *testing.T) {
+	tests := []struct {
+		input  string
+		want   int64
+		errMsg string
+	}{
+		{"0", 0, ""},
+		{"1000", 1000, ""},
+		{"500KB", 500 << 10, ""},
+		{"500k", 500 << 10, ""},
+		{"1.5M", 3 << 19, ""},
+		{"2MB/s", 2 << 20, ""},
+		{"1GiB", 1 << 30, ""},
+		{"-1KB", 0, "invalid rate"},
+		{"fast", 0, "invalid rate"},
+		{"10TB", 0, "invalid rate"},
+		{"", 0, "invalid rate"},
+		{"0.1", 0, "less than one byte per second"},
+		{"9999999999999GB/s", 0, "too large"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseByteRate(tt.input)
+			if tt.errMsg != "" {
+				AssertErrorContains(t, err, tt.errMsg)
+				return
+			}
+			AssertNoError(t, err)
+			if got != tt.want {
+				t.Errorf("ParseByteRate(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package scdb
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// configHeader starts every config file written by SaveConfigFile
+const configHeader = `# SCDB downloader configuration
+#
+# Load it with -config. Flags given on the command line override the settings here.
+# Durations take a unit, as in 30s, 5m or 2h.
+`
+
+// durationComment is appended to the comments of the time.Duration settings
+const durationComment = ", a duration such as 30s or 5m"
+
+// configComments returns the comment written above each top-level key of a saved config
+// file, saying what the setting does and which values it takes
+func configComments() map[string]string {
+	return map[string]string{
+		"username":                    "SCDB account name; leave empty to use SCDB_USER",
+		"password":                    "SCDB password; leave empty to use SCDB_PASS or the keyring",
+		"output_dir":                  `Directory for the archives, or "-" to write a single archive to stdout`,
+		"fixed_output_dir":            "Directory for the fixed camera archives instead of output_dir",
+		"mobile_output_dir":           "Directory for the mobile camera archive instead of output_dir",
+		"countries":                   "Country codes, country names, regions or all; a leading - excludes an entry",
+		"profiles":                    "Accounts selected with -profile, each with its own username, password and countries",
+		"default_profile":             `Profile used without -profile ("" = the one named default)`,
+		"regions":                     "Your own regions: a name that is not a country code, with a list of countries and regions",
+		"sort_countries":              "Sort the countries instead of keeping their order: true or false",
+		"display_type":                "1 = split all, 2 = split speed and red light cameras, 3 = all in one, 4 = all in one with another icon",
+		"danger_zones":                "Include danger zones: true or false",
+		"france_danger_mode":          "true = show French cameras as danger zones, false = at their position",
+		"danger_zones_only":           "Experimental: ask for the danger zones alone, to garmin-dangerzones.zip: true or false",
+		"icon_size":                   "1 = 22x22, 2 = 24x24, 3 = 32x32, 4 = 48x48, 5 = 80x80 pixels",
+		"warning_time":                fmt.Sprintf("Seconds of warning before a camera, 0-%d (0 = off)", int(MaxWarningTime/time.Second)),
+		"accept_agreement":            "Accept SCDB's download agreement, required for the fixed cameras: true or false",
+		"waive_rescission":            "Waive the right of rescission for the fixed download: true or false",
+		"download_fixed":              "Download the fixed speed cameras: true or false",
+		"download_mobile":             "Download the mobile speed cameras: true or false",
+		"strict_mobile":               "Fail instead of warning when the mobile cameras are combined with a country selection",
+		"verbose":                     "Log debug messages: true or false",
+		"log_level":                   "debug, info, warn or error (default: info)",
+		"log_format":                  "text or json (default: text)",
+		"base_url":                    "SCDB site root (default: " + DefaultBaseURL + ")",
+		"insecure_skip_tls":           "Skip TLS certificate verification, for self-signed mirrors: true or false",
+		"geoip_url":                   `Country lookup service for "-countries auto" (default: ` + DefaultGeoIPURL + "; " + GeoIPOff + " = off)",
+		"proxy_url":                   "http://, https:// or socks5:// proxy (default: HTTP_PROXY and HTTPS_PROXY)",
+		"timeout":                     "Timeout of each request (0 = none)" + durationComment,
+		"login_timeout":               "Timeout of each login request (0 = none)" + durationComment,
+		"retry_count":                 "Extra attempts after a network error or 5xx response, 0 or more",
+		"retry_backoff":               "Delay before the first retry, doubled per attempt" + durationComment,
+		"separate_by_country":         "Write one archive per country: true or false",
+		"concurrency":                 "Parallel downloads with separate_by_country, 1 or more (0 = 1)",
+		"max_rate":                    "Download speed cap of all downloads together, in bytes per second (0 = unlimited)",
+		"max_download_bytes":          "Fail a download larger than this many bytes (0 = no cap)",
+		"max_total_bytes":             "Fail the run once its downloads add up to more than this many bytes (0 = no cap)",
+		"request_delay":               "Minimum time between the starts of requests (0 = none)" + durationComment,
+		"session_file":                `Save and reuse the login session here ("" = off)`,
+		"format":                      fmt.Sprintf("Navigation system the databases are made for: %s (default: %s)", strings.Join(Formats(), ", "), DefaultFormat),
+		"filename_template":           `Go template for the archive names ("" = ` + DefaultFilenameTemplate + ")",
+		"use_server_filename":         "Name archives after the file name the server sends: true or false",
+		"max_age":                     "Skip files modified less than this long ago (0 = always download)" + durationComment,
+		"form_encoding":               FormURLEncoded + " or " + FormMultipart + " (default: " + FormURLEncoded + ")",
+		"post_download_command":       "Shell command run after a successful run, with SCDB_* variables naming the files",
+		"post_download_ignore_errors": "Only log a failing post_download_command: true or false",
+		"metrics_file":                "Write Prometheus metrics of each run to this .prom file",
+		"archive":                     "Keep every run in <output_dir>/archive/<timestamp>/: true or false",
+		"keep":                        "With archive, how many runs to keep (0 = all)",
+		"since_date":                  `Ask for the cameras changed since this date, YYYY-MM-DD ("" = all)`,
+		"form_fields":                 "Extra fields of the fixed camera download form, by name",
+		"mobile_path":                 `Path of the mobile camera download on the SCDB site ("" = the one of format)`,
+		"mobile_form":                 "Fields of the mobile camera download form, by name",
+		"no_clobber":                  "Fail instead of replacing an existing archive: true or false",
+		"backup":                      "Rename an existing archive to <name>.bak before replacing it: true or false",
+		"only_changed":                "With separate_by_country, keep archives whose download has not changed: true or false",
+		"clean":                       "Remove the archives of earlier runs once every download succeeded: true or false",
+		"verify_zip":                  "Reject downloads that are not valid ZIP archives: true or false",
+		"auto_reauth":                 "Log in again and retry a download that returns a web page: true or false",
+		"extract":                     "Unpack the fixed camera archives next to them: true or false",
+		"extract_only":                "Delete an archive after extracting it: true or false",
+		"checksums":                   "Write checksums.txt next to the downloads: true or false",
+		"verify_countries":            "Warn about requested countries missing from the fixed archive: true or false",
+		"verify_against":              "Checksum manifest; downloads matching it are not rewritten",
+	}
+}
+
+// commentConfig adds configHeader and, on the line above each top-level key of the YAML
+// data, its comment from configComments. Comments are ignored when the file is loaded
+// again, so the result reads back the same as data.
+func commentConfig(data []byte) []byte {
+	comments := configComments()
+	var b strings.Builder
+	b.WriteString(configHeader)
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		// Nested keys are indented, and list items start with "-"
+		key, _, ok := strings.Cut(line, ":")
+		if comment := comments[key]; ok && comment != "" {
+			b.WriteString("\n# " + comment + "\n")
+		}
+		b.WriteString(line)
+	}
+	return []byte(b.String())
+}
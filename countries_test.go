@@ -1,12 +1,21 @@
-package main
+package scdb
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"slices"
+	"strings"
 	"testing"
 )
 
 func TestGetAllCountries(t *testing.T) {
-	countries := getAllCountries()
+	countries := AllCountries()
 
 	// Test that we get a reasonable number of countries
 	if len(countries) < 100 {
@@ -125,9 +134,9 @@ func TestExpandCountries(t *testing.T) {
 		},
 		{
 			name:     "Whitespace in country names",
-			input:    []string{" NL ", " B "},
-			expected: nil,
-			wantErr:  true, // Current implementation doesn't trim whitespace
+			input:    []string{" NL ", "B\t", " dach", " - CH "},
+			expected: []string{"NL", "B", "D", "A"},
+			wantErr:  false,
 		},
 		{
 			name:     "Europe region (large set)",
@@ -139,10 +148,10 @@ func TestExpandCountries(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := expandCountries(tt.input)
+			got, err := ExpandCountries(tt.input)
 
 			if (err != nil) != tt.wantErr {
-				t.Errorf("expandCountries() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("ExpandCountries() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 
@@ -157,13 +166,13 @@ func TestExpandCountries(t *testing.T) {
 
 			// Sort both slices for comparison since order might vary
 			if !reflect.DeepEqual(got, tt.expected) {
-				t.Errorf("expandCountries() = %v, want %v", got, tt.expected)
+				t.Errorf("ExpandCountries() = %v, want %v", got, tt.expected)
 			}
 		})
 	}
 }
 
-func TestRemoveDuplicates(t *testing.T) {
+func TestDeduplicateStable(t *testing.T) {
 	tests := []struct {
 		name     string
 		input    []string
@@ -203,40 +212,380 @@ func TestRemoveDuplicates(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := removeDuplicates(tt.input)
+			input := slices.Clone(tt.input)
+			got := DeduplicateStable(tt.input)
+
+			// The first occurrence of each element keeps its place
+			if !slices.Equal(got, tt.expected) {
+				t.Errorf("DeduplicateStable() = %v, want %v", got, tt.expected)
+			}
+			if !slices.Equal(tt.input, input) {
+				t.Errorf("DeduplicateStable() changed its input to %v", tt.input)
+			}
+		})
+	}
+
+	t.Run("Ints", func(t *testing.T) {
+		got := DeduplicateStable([]int{3, 1, 3, 2, 1, 0, 0})
+		if want := []int{3, 1, 2, 0}; !slices.Equal(got, want) {
+			t.Errorf("DeduplicateStable() = %v, want %v", got, want)
+		}
+		if got := DeduplicateStable([]int(nil)); len(got) != 0 {
+			t.Errorf("DeduplicateStable(nil) = %v, want an empty slice", got)
+		}
+	})
+}
+
+func TestPrintCountries(t *testing.T) {
+	var buf bytes.Buffer
+	PrintCountries(&buf)
+	out := buf.String()
+
+	for _, code := range allCountries {
+		if !strings.Contains(out, fmt.Sprintf("%-4s %s", code, CountryName(code))) {
+			t.Errorf("PrintCountries() output missing %q", code)
+		}
+	}
+
+	// Codes are listed alphabetically
+	if strings.Index(out, "A    Austria") > strings.Index(out, "ZW   Zimbabwe") {
+		t.Errorf("PrintCountries() output is not sorted:\n%s", out)
+	}
+}
+
+func TestCountryNames(t *testing.T) {
+	// Every supported code needs a display name, and no name may be orphaned
+	for _, code := range allCountries {
+		if _, ok := countryNames[code]; !ok {
+			t.Errorf("country code %q has no display name", code)
+		}
+	}
+	if len(countryNames) != len(allCountries) {
+		t.Errorf("countryNames has %d entries, allCountries has %d", len(countryNames), len(allCountries))
+	}
+
+	if got := countryLabel("RCH"); got != "RCH (Chile)" {
+		t.Errorf("countryLabel(RCH) = %q, want %q", got, "RCH (Chile)")
+	}
+	if got := CountryName("XX"); got != "XX" {
+		t.Errorf("CountryName(XX) = %q, want fallback %q", got, "XX")
+	}
+}
+
+func TestExpandCountriesByName(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []string
+		expected []string
+		errMsg   string
+	}{
+		{"Full name", []string{"Chile"}, []string{"RCH"}, ""},
+		{"Full name case-insensitive", []string{"south korea", "NETHERLANDS"}, []string{"ROK", "NL"}, ""},
+		{"Partial name", []string{"kyrgyz"}, []string{"KS"}, ""},
+		{"Mixed with codes and regions", []string{"benelux", "Salvador", "D"}, []string{"B", "NL", "L", "ES2", "D"}, ""},
+		{"Unknown name", []string{"Atlantis"}, nil, "invalid country/region"},
+		{"Ambiguous partial name", []string{"united"}, nil, "ambiguous country name"},
+		{"Typo suggests country name", []string{"Germny"}, nil, `did you mean "Germany"?`},
+		{"Typo suggests region", []string{"benelx"}, nil, `did you mean "benelux"?`},
+		{"Too short for partial match", []string{"ic"}, nil, "invalid country/region"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpandCountries(tt.input)
+
+			if tt.errMsg != "" {
+				AssertErrorContains(t, err, tt.errMsg)
+				return
+			}
+
+			AssertNoError(t, err)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("ExpandCountries(%v) = %v, want %v", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExpandCountriesDeprecated(t *testing.T) {
+	// Replacements and suggestions must not point at codes SCDB does not know either
+	for code, deprecated := range deprecatedCountries {
+		if _, ok := countryNames[code]; ok {
+			t.Errorf("deprecated code %q is still a supported code", code)
+		}
+		if _, ok := countryNames[deprecated.replacement]; !ok {
+			t.Errorf("deprecated code %q is replaced by unknown code %q", code, deprecated.replacement)
+		}
+	}
+	for code, suggestion := range suggestedCountries {
+		if _, ok := countryNames[code]; ok {
+			t.Errorf("suggested code %q is a supported code", code)
+		}
+		if _, ok := countryNames[suggestion]; !ok {
+			t.Errorf("code %q suggests unknown code %q", code, suggestion)
+		}
+	}
+
+	uk := CountrySubstitution{Code: "uk", Replacement: "GB", Reason: deprecatedCountries["UK"].note}
+	tests := []struct {
+		name     string
+		input    []string
+		expected []string
+		subs     []CountrySubstitution
+	}{
+		{"Replaced code", []string{"NL", "uk"}, []string{"NL", "GB"}, []CountrySubstitution{uk}},
+		{"Replacement already selected", []string{"F", "FR"}, []string{"FR"}, []CountrySubstitution{{"F", "FR", deprecatedCountries["F"].note}}},
+		{"Excluded deprecated code", []string{"GB", "IRL", "-UK"}, []string{"IRL"}, []CountrySubstitution{{"UK", "GB", uk.Reason}}},
+		{"In a user region", []string{"home"}, []string{"GB"}, []CountrySubstitution{uk}},
+		{"Current codes only", []string{"benelux"}, []string{"B", "NL", "L"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, subs, err := ExpandCountriesWithSubstitutions(tt.input, map[string][]string{"home": {"uk"}})
+			AssertNoError(t, err)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("ExpandCountriesWithSubstitutions(%v) = %v, want %v", tt.input, got, tt.expected)
+			}
+			if !reflect.DeepEqual(subs, tt.subs) {
+				t.Errorf("substitutions = %+v, want %+v", subs, tt.subs)
+			}
+		})
+	}
+
+	t.Run("Rejected with a suggestion", func(t *testing.T) {
+		for code, want := range map[string]string{"NA": `"NAM"`, "scg": `"SRB"`, "YU": `"SRB"`} {
+			_, _, err := ExpandCountriesWithSubstitutions([]string{code}, nil)
+			if !errors.Is(err, ErrInvalidCountry) {
+				t.Errorf("%s: error = %v, want ErrInvalidCountry", code, err)
+			}
+			AssertErrorContains(t, err, "did you mean "+want)
+		}
+	})
+
+	t.Run("Kept by ApplyProfile", func(t *testing.T) {
+		config := &Config{Profiles: map[string]Profile{"work": {Countries: []string{"uk", "NL"}}}}
+		AssertNoError(t, config.ApplyProfile("work"))
+		if want := []CountrySubstitution{uk}; !reflect.DeepEqual(config.CountrySubstitutions, want) {
+			t.Errorf("CountrySubstitutions = %+v, want %+v", config.CountrySubstitutions, want)
+		}
+	})
 
-			// Check length first
-			if len(got) != len(tt.expected) {
-				t.Errorf("removeDuplicates() length = %d, want %d", len(got), len(tt.expected))
+	t.Run("Logged by the downloader", func(t *testing.T) {
+		var buf bytes.Buffer
+		logCountrySubstitutions(slog.New(slog.NewTextHandler(&buf, nil)), []CountrySubstitution{uk})
+		for _, want := range []string{
+			`msg="country code replaced" code=uk replacement="GB (United Kingdom)"`,
+		} {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("log does not contain %q:\n%s", want, buf.String())
+			}
+		}
+	})
+}
+
+func TestExpandCountriesExclusions(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []string
+		expected []string
+		errMsg   string
+	}{
+		{"Exclude from region", []string{"dach", "-CH"}, []string{"D", "A"}, ""},
+		{"Exclusion applies after later inclusions", []string{"-NL", "benelux", "NL"}, []string{"B", "L"}, ""},
+		{"Exclude a region", []string{"westeurope", "-benelux", "-dach"}, []string{"FR", "I", "ES", "P", "GB", "IRL"}, ""},
+		{"Exclusion is case-insensitive", []string{"scandinavia", "-is", "-Norway"}, []string{"SE", "DK", "FI"}, ""},
+		{"Exclusion of unselected code is a no-op", []string{"NL", "-D"}, []string{"NL"}, ""},
+		{"Unknown exclusion errors", []string{"europe", "-XX"}, nil, "invalid exclusion: invalid country/region: XX"},
+	}
+
+	t.Run("Unknown entries wrap ErrInvalidCountry", func(t *testing.T) {
+		for _, input := range [][]string{{"XX"}, {"NL", "-XX"}, {"Atlantis"}} {
+			if _, err := ExpandCountries(input); !errors.Is(err, ErrInvalidCountry) {
+				t.Errorf("ExpandCountries(%v) error = %v, want ErrInvalidCountry", input, err)
+			}
+		}
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpandCountries(tt.input)
+
+			if tt.errMsg != "" {
+				AssertErrorContains(t, err, tt.errMsg)
 				return
 			}
 
-			// Convert to sets for comparison (order doesn't matter)
-			gotSet := make(map[string]bool)
-			expectedSet := make(map[string]bool)
+			AssertNoError(t, err)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("ExpandCountries(%v) = %v, want %v", tt.input, got, tt.expected)
+			}
+		})
+	}
+
+	t.Run("Europe without Russia and Belarus", func(t *testing.T) {
+		got, err := ExpandCountries([]string{"europe", "-RUS", "-BY"})
+		AssertNoError(t, err)
+
+		if len(got) != len(regionMap["europe"])-2 {
+			t.Errorf("ExpandCountries() returned %d countries, want %d", len(got), len(regionMap["europe"])-2)
+		}
+		for _, code := range got {
+			if code == "RUS" || code == "BY" {
+				t.Errorf("ExpandCountries() result still contains excluded %q", code)
+			}
+		}
+	})
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"germany", "germny", 1},
+		{"kitten", "sitting", 3},
+		{"benelux", "benelux", 0},
+	}
+
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestPrintRegions(t *testing.T) {
+	var buf bytes.Buffer
+	PrintRegions(&buf)
+	out := buf.String()
+
+	for name := range regionMap {
+		if !strings.Contains(out, "  "+name+" ") {
+			t.Errorf("PrintRegions() output missing region %q", name)
+		}
+	}
+
+	if !strings.Contains(out, "dach          D, A, CH\n") {
+		t.Errorf("PrintRegions() output missing dach members:\n%s", out)
+	}
+
+	if strings.Index(out, "africa") > strings.Index(out, "westeurope") {
+		t.Errorf("PrintRegions() output is not sorted:\n%s", out)
+	}
+}
+
+func TestRegionPresets(t *testing.T) {
+	tests := []struct {
+		region  string
+		members []string
+	}{
+		{"baltics", []string{"EST", "LV", "LT"}},
+		{"iberia", []string{"ES", "P"}},
+		{"balkans", []string{"HR", "SLO", "BIH", "SRB", "MK", "BG", "RO", "GR"}},
+		{"eu", []string{"A", "B", "BG", "HR", "CY", "CZ", "DK", "EST", "FI", "FR", "D", "GR", "H", "IRL",
+			"I", "LV", "LT", "L", "M", "NL", "PL", "P", "RO", "SK", "SLO", "ES", "SE"}},
+		{"alps", []string{"CH", "A", "LI", "FR", "I", "D"}},
+		{"uk_ireland", []string{"GB", "IRL", "GBZ"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.region, func(t *testing.T) {
+			got, err := ExpandCountries([]string{tt.region})
+			AssertNoError(t, err)
 
-			for _, item := range got {
-				gotSet[item] = true
+			if !reflect.DeepEqual(got, tt.members) {
+				t.Errorf("ExpandCountries(%q) = %v, want %v", tt.region, got, tt.members)
 			}
-			for _, item := range tt.expected {
-				expectedSet[item] = true
+		})
+	}
+
+	// Every preset may only use codes SCDB offers
+	valid := make(map[string]bool)
+	for _, code := range allCountries {
+		valid[code] = true
+	}
+	for name, codes := range regionMap {
+		for _, code := range codes {
+			if !valid[code] {
+				t.Errorf("region %q contains unknown code %q", name, code)
+			}
+		}
+	}
+}
+
+func TestExpandCountriesWithUserRegions(t *testing.T) {
+	userRegions := map[string][]string{
+		"myroute":  {"NL", "D", "A", "I"},
+		"holiday":  {"myroute", "iberia"},
+		"Benelux":  {"NL", "B"},
+		"loop":     {"NL", "back"},
+		"back":     {"loop"},
+		"broken":   {"NL", "XX"},
+		"lowlands": {"benelux", "-B"},
+	}
+
+	tests := []struct {
+		name     string
+		input    []string
+		expected []string
+		errMsg   string
+	}{
+		{"User region", []string{"myroute"}, []string{"NL", "D", "A", "I"}, ""},
+		{"Case insensitive", []string{"MyRoute"}, []string{"NL", "D", "A", "I"}, ""},
+		{"Nested user and built-in regions", []string{"holiday"}, []string{"NL", "D", "A", "I", "ES", "P"}, ""},
+		{"User region overrides built-in", []string{"benelux"}, []string{"NL", "B"}, ""},
+		{"Excluding a user region", []string{"holiday", "-myroute"}, []string{"ES", "P"}, ""},
+		{"Cycle", []string{"loop"}, nil, "region cycle: loop -> back -> loop"},
+		{"Unknown member", []string{"broken"}, nil, `region "broken"`},
+		{"Exclusion inside a region is not supported", []string{"lowlands"}, nil, `region "lowlands"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpandCountriesWith(tt.input, userRegions)
+			if tt.errMsg != "" {
+				AssertErrorContains(t, err, tt.errMsg)
+				return
 			}
+			AssertNoError(t, err)
 
-			if !reflect.DeepEqual(gotSet, expectedSet) {
-				t.Errorf("removeDuplicates() = %v, want %v", got, tt.expected)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("ExpandCountriesWith(%v) = %v, want %v", tt.input, got, tt.expected)
 			}
 		})
 	}
+
+	if got := OverriddenRegions(userRegions); !reflect.DeepEqual(got, []string{"Benelux"}) {
+		t.Errorf("OverriddenRegions() = %v, want [Benelux]", got)
+	}
+}
+
+func TestCheckRegionNames(t *testing.T) {
+	// The built-in presets are resolved before country codes and must not hide one
+	AssertNoError(t, checkRegionNames(regionMap))
+	AssertNoError(t, checkRegionNames(map[string][]string{"myroute": {"NL"}, "benelux": {"B"}}))
+
+	for _, name := range []string{"D", "ch", " NL "} {
+		err := checkRegionNames(map[string][]string{"myroute": {"NL"}, name: {"B"}})
+		AssertErrorContains(t, err, fmt.Sprintf("region %q has the name of the country code", name))
+	}
+
+	_, err := ExpandCountriesWith([]string{"NL"}, map[string][]string{"nl": {"B"}})
+	AssertErrorContains(t, err, `region "nl" has the name of the country code NL`)
 }
 
 // Test edge cases and error conditions
 func TestExpandCountriesEdgeCases(t *testing.T) {
 	// Test all available regions to ensure they expand correctly
-	regions := []string{"africa", "asia", "europe", "northamerica", "southamerica", "oceania", "dach", "benelux", "westeurope", "easteurope", "scandinavia"}
+	regions := []string{"africa", "asia", "europe", "northamerica", "southamerica", "oceania", "dach", "benelux", "westeurope", "easteurope", "scandinavia",
+		"baltics", "iberia", "balkans", "eu", "alps", "uk_ireland"}
 
 	for _, region := range regions {
 		t.Run("region_"+region, func(t *testing.T) {
-			result, err := expandCountries([]string{region})
+			result, err := ExpandCountries([]string{region})
 			if err != nil {
 				t.Errorf("Region %s should be valid, got error: %v", region, err)
 			}
@@ -252,14 +601,14 @@ func BenchmarkExpandCountries(b *testing.B) {
 	input := []string{"dach", "benelux", "scandinavia", "FR", "GB", "USA"}
 
 	for i := 0; i < b.N; i++ {
-		_, err := expandCountries(input)
+		_, err := ExpandCountries(input)
 		if err != nil {
 			b.Fatalf("Unexpected error: %v", err)
 		}
 	}
 }
 
-func BenchmarkRemoveDuplicates(b *testing.B) {
+func BenchmarkDeduplicateStable(b *testing.B) {
 	// Create input with many duplicates
 	input := make([]string, 100)
 	countries := []string{"NL", "B", "D", "FR", "GB"}
@@ -268,6 +617,121 @@ func BenchmarkRemoveDuplicates(b *testing.B) {
 	}
 
 	for i := 0; i < b.N; i++ {
-		removeDuplicates(input)
+		DeduplicateStable(input)
+	}
+}
+
+func TestDetectCountry(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    string
+		wantErr string
+	}{
+		{"Germany", http.StatusOK, "DE\n", "D", ""},
+		{"Lowercase answer", http.StatusOK, "nl", "NL", ""},
+		{"Country without cameras", http.StatusOK, "AQ", "", `no cameras for country "AQ"`},
+		{"Lookup failed", http.StatusTooManyRequests, "", "", "HTTP 429"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			got, err := DetectCountry(context.Background(), &Config{GeoIPURL: server.URL})
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrCountryDetection) {
+					t.Fatalf("DetectCountry() error = %v, want ErrCountryDetection", err)
+				}
+				AssertErrorContains(t, err, tt.wantErr)
+				return
+			}
+			AssertNoError(t, err)
+			if got != tt.want {
+				t.Errorf("DetectCountry() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Turned off, nothing is asked
+	_, err := DetectCountry(context.Background(), &Config{GeoIPURL: GeoIPOff})
+	if !errors.Is(err, ErrCountryDetection) {
+		t.Errorf("DetectCountry() turned off error = %v, want ErrCountryDetection", err)
+	}
+}
+
+func TestNearbyCountries(t *testing.T) {
+	tests := []struct {
+		code string
+		want []string
+	}{
+		{"D", []string{"D", "A", "CH"}},
+		{"NL", []string{"NL", "B", "L"}},
+		{"GB", []string{"GB", "IRL", "GBZ"}},
+		{"USA", []string{"USA", "CDN", "MEX", "GT", "HN", "BZ", "PA", "TT"}},
+		{"GF", []string{"GF"}}, // In no region
+	}
+
+	for _, tt := range tests {
+		if got := NearbyCountries(tt.code); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("NearbyCountries(%q) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestISOCountries(t *testing.T) {
+	// Every SCDB country can be detected, and each from exactly one ISO code
+	seen := make(map[string]string)
+	for iso, code := range isoCountries {
+		if prev, ok := seen[code]; ok {
+			t.Errorf("%s is mapped from both %s and %s", code, prev, iso)
+		}
+		seen[code] = iso
+	}
+	for _, code := range allCountries {
+		if _, ok := seen[code]; !ok {
+			t.Errorf("no ISO code maps to %s", countryLabel(code))
+		}
+	}
+}
+
+func TestMobileIgnoresCountries(t *testing.T) {
+	tests := []struct {
+		name      string
+		countries []string
+		mobile    bool
+		want      bool
+	}{
+		{"Country selection with mobile", []string{"D", "A", "CH"}, true, true},
+		{"Country selection without mobile", []string{"D", "A", "CH"}, false, false},
+		{"All countries", AllCountries(), true, false},
+		{"No countries", nil, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Countries: tt.countries, DownloadMobile: tt.mobile}
+			if got := mobileIgnoresCountries(config); got != tt.want {
+				t.Errorf("mobileIgnoresCountries() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// A run with a country selection warns that the mobile download ignores it
+	mockServer := NewMockSCDBServer()
+	defer mockServer.Close()
+	config := CreateTestConfig()
+	config.BaseURL = mockServer.URL()
+	config.OutputDir = t.TempDir()
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	AssertNoError(t, NewDownloader(config, WithHTTPClient(mockServer.Client()), WithLogger(logger)).Run())
+	if !strings.Contains(buf.String(), "mobile cameras are not filtered by country") {
+		t.Errorf("log output does not warn about the country selection:\n%s", buf.String())
 	}
 }
@@ -0,0 +1,294 @@
+package scdb
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// countryNames maps SCDB country codes to English display names
+var countryNames = map[string]string{
+	"AFG": "Afghanistan",
+	"DZ":  "Algeria",
+	"AND": "Andorra",
+	"RA":  "Argentina",
+	"ARM": "Armenia",
+	"AUS": "Australia",
+	"A":   "Austria",
+	"AZ":  "Azerbaijan",
+	"BRN": "Bahrain",
+	"BY":  "Belarus",
+	"B":   "Belgium",
+	"BZ":  "Belize",
+	"BIH": "Bosnia and Herzegovina",
+	"BR":  "Brazil",
+	"BG":  "Bulgaria",
+	"CDN": "Canada",
+	"RCH": "Chile",
+	"CO":  "Colombia",
+	"HR":  "Croatia",
+	"CY":  "Cyprus",
+	"CZ":  "Czech Republic",
+	"DK":  "Denmark",
+	"EC":  "Ecuador",
+	"ET":  "Egypt",
+	"ES2": "El Salvador",
+	"EST": "Estonia",
+	"FJI": "Fiji",
+	"FI":  "Finland",
+	"FR":  "France",
+	"GF":  "French Guiana",
+	"GE":  "Georgia",
+	"D":   "Germany",
+	"GBZ": "Gibraltar",
+	"GR":  "Greece",
+	"GP":  "Guadeloupe",
+	"GT":  "Guatemala",
+	"GUY": "Guyana",
+	"HN":  "Honduras",
+	"HK":  "Hong Kong",
+	"H":   "Hungary",
+	"IS":  "Iceland",
+	"IND": "India",
+	"IR":  "Iran",
+	"IRQ": "Iraq",
+	"IRL": "Ireland",
+	"IL":  "Israel",
+	"I":   "Italy",
+	"J":   "Japan",
+	"JOR": "Jordan",
+	"KZ":  "Kazakhstan",
+	"KWT": "Kuwait",
+	"KS":  "Kyrgyzstan",
+	"LAO": "Laos",
+	"LV":  "Latvia",
+	"RL":  "Lebanon",
+	"LI":  "Liechtenstein",
+	"LT":  "Lithuania",
+	"L":   "Luxembourg",
+	"MO":  "Macau",
+	"MAL": "Malaysia",
+	"M":   "Malta",
+	"MQ":  "Martinique",
+	"MS":  "Mauritius",
+	"MEX": "Mexico",
+	"MD":  "Moldova",
+	"MGL": "Mongolia",
+	"MA":  "Morocco",
+	"NAM": "Namibia",
+	"NL":  "Netherlands",
+	"NZ":  "New Zealand",
+	"MK":  "North Macedonia",
+	"NO":  "Norway",
+	"OM":  "Oman",
+	"PK":  "Pakistan",
+	"PA":  "Panama",
+	"PY":  "Paraguay",
+	"PE":  "Peru",
+	"RP":  "Philippines",
+	"PL":  "Poland",
+	"P":   "Portugal",
+	"Q":   "Qatar",
+	"RO":  "Romania",
+	"RUS": "Russia",
+	"RWA": "Rwanda",
+	"RE":  "Reunion",
+	"RSM": "San Marino",
+	"KSA": "Saudi Arabia",
+	"SRB": "Serbia",
+	"SGP": "Singapore",
+	"SK":  "Slovakia",
+	"SLO": "Slovenia",
+	"ZA":  "South Africa",
+	"ROK": "South Korea",
+	"ES":  "Spain",
+	"SE":  "Sweden",
+	"CH":  "Switzerland",
+	"RCT": "Taiwan",
+	"T":   "Thailand",
+	"TT":  "Trinidad and Tobago",
+	"TN":  "Tunisia",
+	"TR":  "Turkey",
+	"UA":  "Ukraine",
+	"UAE": "United Arab Emirates",
+	"GB":  "United Kingdom",
+	"USA": "United States",
+	"ROU": "Uruguay",
+	"UZ":  "Uzbekistan",
+	"VN":  "Vietnam",
+	"Z":   "Zambia",
+	"ZW":  "Zimbabwe",
+}
+
+// deprecatedCountry describes a country code SCDB does not use, for a country it offers
+// under another code
+type deprecatedCountry struct {
+	replacement string // SCDB's code for the country
+	note        string // Where the code comes from
+}
+
+// deprecatedCountries maps the vehicle signs of the UN list of distinguishing signs
+// (Vienna Convention on Road Traffic) that differ from SCDB's code for the same country
+// to that code. The server ignores codes it does not know, so these are replaced with a
+// warning instead.
+var deprecatedCountries = map[string]deprecatedCountry{
+	"UK": {"GB", "UK is the vehicle sign of the United Kingdom"},
+	"F":  {"FR", "F is the vehicle sign of France"},
+	"E":  {"ES", "E is the vehicle sign of Spain"},
+	"S":  {"SE", "S is the vehicle sign of Sweden"},
+	"N":  {"NO", "N is the vehicle sign of Norway"},
+}
+
+// suggestedCountries maps codes that are not SCDB's, and may or may not mean one of its
+// countries, to the code of that country. They are rejected with it as the suggestion:
+// NA is the ISO 3166 code of Namibia, SCG and YU the former vehicle signs of Serbia and
+// Montenegro and of Yugoslavia, of which SCDB only offers Serbia.
+var suggestedCountries = map[string]string{
+	"NA":  "NAM",
+	"SCG": "SRB",
+	"YU":  "SRB",
+}
+
+// CountrySubstitution records a country code replaced with SCDB's code for the same
+// country while expanding a country list
+type CountrySubstitution struct {
+	Code        string // Code as given
+	Replacement string // Code used in its place
+	Reason      string // Where the code comes from
+}
+
+// resolveDeprecatedCountry returns SCDB's code for a code of deprecatedCountries and the
+// substitution to report, or ok false if code is not one of them
+func resolveDeprecatedCountry(code string) (codes []string, sub CountrySubstitution, ok bool) {
+	deprecated, ok := deprecatedCountries[strings.ToUpper(code)]
+	if !ok {
+		return nil, CountrySubstitution{}, false
+	}
+	sub = CountrySubstitution{Code: code, Replacement: deprecated.replacement, Reason: deprecated.note}
+	return []string{deprecated.replacement}, sub, true
+}
+
+// logCountrySubstitutions warns about each country code that was replaced
+func logCountrySubstitutions(logger *slog.Logger, subs []CountrySubstitution) {
+	for _, sub := range subs {
+		logger.Warn("country code replaced", "code", sub.Code, "replacement", countryLabel(sub.Replacement), "reason", sub.Reason)
+	}
+}
+
+// minPartialNameLength is the shortest input matched as part of a country name
+const minPartialNameLength = 3
+
+// CountryName returns the display name for a country code, or the code itself if unknown
+func CountryName(code string) string {
+	if name, ok := countryNames[code]; ok {
+		return name
+	}
+	return code
+}
+
+// countryLabel formats a country code with its display name, e.g. "RCH (Chile)"
+func countryLabel(code string) string {
+	return fmt.Sprintf("%s (%s)", code, CountryName(code))
+}
+
+// CountryLabels formats a list of country codes with their display names
+func CountryLabels(codes []string) string {
+	labels := make([]string, len(codes))
+	for i, code := range codes {
+		labels[i] = countryLabel(code)
+	}
+	return strings.Join(labels, ", ")
+}
+
+// lookupCountryName resolves a full or partial country name (case-insensitive) to its
+// code. A full name always wins; a partial name must match exactly one country.
+func lookupCountryName(input string) (string, error) {
+	needle := strings.ToLower(input)
+
+	var partial []string
+	for code, name := range countryNames {
+		lowerName := strings.ToLower(name)
+		if lowerName == needle {
+			return code, nil
+		}
+		if len(needle) >= minPartialNameLength && strings.Contains(lowerName, needle) {
+			partial = append(partial, code)
+		}
+	}
+
+	switch len(partial) {
+	case 0:
+		return "", unknownCountryError(input)
+	case 1:
+		return partial[0], nil
+	default:
+		sort.Strings(partial)
+		return "", fmt.Errorf("ambiguous country name %q matches: %s", input, CountryLabels(partial))
+	}
+}
+
+// unknownCountryError reports an unrecognized country or region, suggesting the closest
+// known code, region or country name when one is near enough to be a likely typo
+func unknownCountryError(input string) error {
+	if suggestion := suggestCountry(input); suggestion != "" {
+		return fmt.Errorf("%w: %s (did you mean %q?)", ErrInvalidCountry, input, suggestion)
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidCountry, input)
+}
+
+// suggestCountry returns the code of suggestedCountries for input, else the known code,
+// region or country name closest to input, or ""
+// if nothing is within a small edit distance
+func suggestCountry(input string) string {
+	if code, ok := suggestedCountries[strings.ToUpper(input)]; ok {
+		return code
+	}
+	needle := strings.ToLower(input)
+	maxDistance := max(1, len(needle)/3)
+
+	best, bestDistance := "", maxDistance+1
+	consider := func(candidate string) {
+		distance := levenshtein(needle, strings.ToLower(candidate))
+		if distance < bestDistance || (distance == bestDistance && candidate < best) {
+			best, bestDistance = candidate, distance
+		}
+	}
+
+	for _, code := range allCountries {
+		consider(code)
+	}
+	for region := range regionMap {
+		consider(region)
+	}
+	for _, name := range countryNames {
+		consider(name)
+	}
+
+	return best
+}
+
+// levenshtein returns the edit distance between two strings
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
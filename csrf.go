@@ -0,0 +1,79 @@
+package scdb
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// csrfTokenLength is the length of the hex-encoded SCDB login token name and value
+const csrfTokenLength = 40
+
+// csrfTokenPattern is the fallback for pages the HTML scan cannot make sense of
+var csrfTokenPattern = regexp.MustCompile(`name="([a-fA-F0-9]{40})"\s+value="([a-fA-F0-9]{40})"`)
+
+// extractCSRFToken returns the name and value of the CSRF token in the login page body,
+// or an error if it has none
+func extractCSRFToken(body []byte) (name, value string, err error) {
+	name, value, ok := findCSRFToken(body)
+	if !ok {
+		return "", "", errors.New("failed to find CSRF token in login page")
+	}
+	return name, value, nil
+}
+
+// findCSRFToken locates the login form's CSRF token: a hidden input whose name and value
+// are both 40-character hex strings. Attribute order, extra attributes and letter case do
+// not matter. If no such input is found, a plain regex match is tried as a fallback.
+func findCSRFToken(body []byte) (name, value string, ok bool) {
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			// End of document (or unparseable input): try the fallback
+			if matches := csrfTokenPattern.FindSubmatch(body); matches != nil {
+				return string(matches[1]), string(matches[2]), true
+			}
+			return "", "", false
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			if tok.Data != "input" {
+				continue
+			}
+
+			var inputType string
+			for _, attr := range tok.Attr {
+				switch attr.Key {
+				case "type":
+					inputType = strings.ToLower(attr.Val)
+				case "name":
+					name = attr.Val
+				case "value":
+					value = attr.Val
+				}
+			}
+
+			if inputType == "hidden" && isHexToken(name) && isHexToken(value) {
+				return name, value, true
+			}
+			name, value = "", ""
+		}
+	}
+}
+
+// isHexToken reports whether s is a csrfTokenLength-character hex string
+func isHexToken(s string) bool {
+	if len(s) != csrfTokenLength {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,145 @@
+package scdb
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// ArchiveEntry is a file inside a ZIP archive
+type ArchiveEntry struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// EntryChange is an entry found in both archives with different contents
+type EntryChange struct {
+	Old ArchiveEntry `json:"old"`
+	New ArchiveEntry `json:"new"`
+}
+
+// ArchiveDiff lists how the entries of a new archive differ from an old one, each list
+// sorted by name
+type ArchiveDiff struct {
+	Added   []ArchiveEntry `json:"added"`
+	Removed []ArchiveEntry `json:"removed"`
+	Changed []EntryChange  `json:"changed"`
+}
+
+// Empty reports whether both archives hold the same entries with the same contents
+func (a *ArchiveDiff) Empty() bool {
+	return len(a.Added) == 0 && len(a.Removed) == 0 && len(a.Changed) == 0
+}
+
+// DiffArchives compares the entries of the ZIP archives at oldPath and newPath by name,
+// size and SHA-256. Directories are left out.
+func DiffArchives(oldPath, newPath string) (*ArchiveDiff, error) {
+	oldEntries, err := archiveEntries(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	newEntries, err := archiveEntries(newPath)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &ArchiveDiff{}
+	for name, entry := range newEntries {
+		old, ok := oldEntries[name]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, entry)
+		case old != entry:
+			diff.Changed = append(diff.Changed, EntryChange{Old: old, New: entry})
+		}
+	}
+	for name, entry := range oldEntries {
+		if _, ok := newEntries[name]; !ok {
+			diff.Removed = append(diff.Removed, entry)
+		}
+	}
+
+	sort.Slice(diff.Added, func(i, j int) bool { return diff.Added[i].Name < diff.Added[j].Name })
+	sort.Slice(diff.Removed, func(i, j int) bool { return diff.Removed[i].Name < diff.Removed[j].Name })
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].New.Name < diff.Changed[j].New.Name })
+	return diff, nil
+}
+
+// archiveEntries reads every file entry of the archive at path, by name
+func archiveEntries(path string) (map[string]ArchiveEntry, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer func() { _ = r.Close() }()
+
+	entries := make(map[string]ArchiveEntry, len(r.File))
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		sum, size, err := entrySHA256(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s in %s: %w", f.Name, path, err)
+		}
+		entries[f.Name] = ArchiveEntry{Name: f.Name, Size: size, SHA256: sum}
+	}
+	return entries, nil
+}
+
+// entrySHA256 returns the checksum and uncompressed size of an archive entry
+func entrySHA256(f *zip.File) (string, int64, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() { _ = rc.Close() }()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, rc)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// newArchiveSuffix is added to the name of a download Config.Diff was not allowed to
+// save in place of the existing file
+const newArchiveSuffix = ".new"
+
+// newArchivePath returns where Config.Diff keeps a download that was not allowed to
+// replace the existing file at path
+func newArchivePath(path string) string {
+	return path + newArchiveSuffix
+}
+
+// confirmReplace compares the download at tmpPath with the existing file at path for
+// Config.Diff and asks DiffFunc whether to replace it. Without an existing file there is
+// nothing to compare and the download is saved as usual.
+func (d *SCDBDownloader) confirmReplace(path, tmpPath string) (bool, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		d.logger.Info("nothing to compare the download with", "path", path)
+		return true, nil
+	}
+
+	diff, err := DiffArchives(path, tmpPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to compare with the existing archive: %w", err)
+	}
+	d.logger.Info("download compared with the existing file", "path", path,
+		"added", len(diff.Added), "removed", len(diff.Removed), "changed", len(diff.Changed))
+	if d.DiffFunc == nil {
+		return false, nil
+	}
+
+	// One question at a time when several archives download in parallel
+	d.diffMu.Lock()
+	defer d.diffMu.Unlock()
+	return d.DiffFunc(path, diff), nil
+}
@@ -0,0 +1,8 @@
+//go:build !(darwin || freebsd || linux || windows)
+
+package scdb
+
+// freeDiskSpace cannot tell the free space on this platform
+func freeDiskSpace(string) (int64, bool) {
+	return 0, false
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package scdb
+
+import "golang.org/x/sys/windows"
+
+// freeDiskSpace returns the bytes available to the current user on the volume holding dir
+func freeDiskSpace(dir string) (int64, bool) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, false
+	}
+	var free uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &free, nil, nil); err != nil {
+		return 0, false
+	}
+	return int64(free), true
+}
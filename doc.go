@@ -0,0 +1,30 @@
+// Package scdb downloads Garmin speed camera databases from scdb.info.
+//
+// A Config describes the account, the countries and the camera options. NewDownloader
+// turns it into an SCDBDownloader, whose Run methods log in and write garmin.zip and
+// garmin-mobile.zip to Config.OutputDir:
+//
+//	cfg := &scdb.Config{
+//		Username:        "user",
+//		Password:        "secret",
+//		OutputDir:       "/var/lib/cameras",
+//		DisplayType:     1,
+//		IconSize:        5,
+//		AcceptAgreement: true, // only with the user's consent
+//		WaiveRescission: true,
+//		DownloadFixed:   true,
+//		DownloadMobile:  true,
+//		VerifyZip:       true,
+//		AutoReauth:      true,
+//		Timeout:         scdb.DefaultTimeout,
+//		LoginTimeout:    scdb.DefaultLoginTimeout,
+//	}
+//	cfg.Countries, _ = scdb.ExpandCountries([]string{"benelux", "D"})
+//	if err := scdb.ValidateConfig(cfg); err != nil {
+//		return err
+//	}
+//	result, err := scdb.NewDownloader(cfg).RunWithResult(ctx)
+//
+// The scdb-downloader command in cmd/scdb-downloader wraps the package in a command line
+// interface.
+package scdb
@@ -1,10 +1,11 @@
-package main
+package scdb
 
 import (
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 // TestE2EConfigurationFlow tests the complete configuration flow
@@ -31,22 +32,23 @@ func TestE2EConfigurationFlow(t *testing.T) {
 			FranceDangerMode: true,
 			IconSize:         4,
 			WarningTime:      600,
+			AcceptAgreement:  true,
 			DownloadFixed:    true,
 			DownloadMobile:   false, // Only fixed for this test
 			Verbose:          true,
 		}
 
 		// Validate original config
-		err := validateConfig(config)
+		err := ValidateConfig(config)
 		AssertNoError(t, err)
 
 		// Save config
-		err = saveConfigFile(config, configPath)
+		err = SaveConfigFile(config, configPath)
 		AssertNoError(t, err)
 		AssertFileExists(t, configPath, 100) // At least 100 bytes
 
 		// Load config back
-		loadedConfig, err := loadConfigFile(configPath)
+		loadedConfig, err := LoadConfigFile(configPath)
 		AssertNoError(t, err)
 
 		// Verify loaded config (excluding ConfigFile field)
@@ -64,7 +66,7 @@ func TestE2EConfigurationFlow(t *testing.T) {
 		}
 
 		// Validate loaded config
-		err = validateConfig(loadedConfig)
+		err = ValidateConfig(loadedConfig)
 		AssertNoError(t, err)
 	})
 }
@@ -103,7 +105,7 @@ func TestE2ECountryExpansion(t *testing.T) {
 			mustContain: []string{"SE", "NO", "DK", "FI", "IS"},
 		},
 		"All_Countries": {
-			input:       []string{"all"}, // This would be handled by getAllCountries() in real code
+			input:       []string{"all"}, // This would be handled by AllCountries() in real code
 			expectCount: 100,             // Approximate minimum
 		},
 	}
@@ -112,18 +114,18 @@ func TestE2ECountryExpansion(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			// Skip "all" test since it requires special handling
 			if scenario.input[0] == "all" {
-				allCountries := getAllCountries()
+				allCountries := AllCountries()
 				if len(allCountries) < scenario.expectCount {
-					t.Errorf("getAllCountries() returned %d countries, expected at least %d", len(allCountries), scenario.expectCount)
+					t.Errorf("AllCountries() returned %d countries, expected at least %d", len(allCountries), scenario.expectCount)
 				}
 				return
 			}
 
-			result, err := expandCountries(scenario.input)
+			result, err := ExpandCountries(scenario.input)
 			AssertNoError(t, err)
 
 			if len(result) < scenario.expectCount {
-				t.Errorf("expandCountries() returned %d countries, expected at least %d", len(result), scenario.expectCount)
+				t.Errorf("ExpandCountries() returned %d countries, expected at least %d", len(result), scenario.expectCount)
 			}
 
 			// Check required countries are present
@@ -134,19 +136,19 @@ func TestE2ECountryExpansion(t *testing.T) {
 
 			for _, required := range scenario.mustContain {
 				if !resultMap[required] {
-					t.Errorf("expandCountries() missing required country %q in result %v", required, result)
+					t.Errorf("ExpandCountries() missing required country %q in result %v", required, result)
 				}
 			}
 
 			for _, forbidden := range scenario.mustNotContain {
 				if resultMap[forbidden] {
-					t.Errorf("expandCountries() contains forbidden country %q in result %v", forbidden, result)
+					t.Errorf("ExpandCountries() contains forbidden country %q in result %v", forbidden, result)
 				}
 			}
 
 			// Verify no duplicates
 			if len(result) != len(resultMap) {
-				t.Errorf("expandCountries() returned duplicates: %v", result)
+				t.Errorf("ExpandCountries() returned duplicates: %v", result)
 			}
 		})
 	}
@@ -186,10 +188,10 @@ func TestE2EValidationScenarios(t *testing.T) {
 			configMod: func(c *Config) {
 				c.Username = "maxuser"
 				c.Password = "maxpass"
-				c.Countries = getAllCountries() // All countries
-				c.DisplayType = 4               // Maximum
-				c.IconSize = 5                  // Maximum
-				c.WarningTime = 3600            // 1 hour
+				c.Countries = AllCountries() // All countries
+				c.DisplayType = 4            // Maximum
+				c.IconSize = 5               // Maximum
+				c.WarningTime = 3600         // 1 hour
 				c.DownloadFixed = true
 				c.DownloadMobile = true
 				c.DangerZones = true
@@ -209,10 +211,17 @@ func TestE2EValidationScenarios(t *testing.T) {
 		{
 			name: "Edge_Case_Warning_Time_Max",
 			configMod: func(c *Config) {
-				c.WarningTime = 86400 // 24 hours - extreme but valid
+				c.WarningTime = 3600 // 1 hour - the longest accepted
 			},
 			wantErr: false,
 		},
+		{
+			name: "Edge_Case_Warning_Time_Too_Long",
+			configMod: func(c *Config) {
+				c.WarningTime = 86400
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, scenario := range scenarios {
@@ -235,9 +244,9 @@ func TestE2EValidationScenarios(t *testing.T) {
 				}
 
 				if needsExpansion {
-					expanded, err := expandCountries(config.Countries)
+					expanded, err := ExpandCountries(config.Countries)
 					if err != nil && !scenario.wantErr {
-						t.Errorf("expandCountries() failed: %v", err)
+						t.Errorf("ExpandCountries() failed: %v", err)
 						return
 					} else if err == nil {
 						config.Countries = expanded
@@ -246,16 +255,16 @@ func TestE2EValidationScenarios(t *testing.T) {
 			}
 
 			// Validate the final config
-			err := validateConfig(config)
+			err := ValidateConfig(config)
 
 			if (err != nil) != scenario.wantErr {
-				t.Errorf("validateConfig() error = %v, wantErr %v", err, scenario.wantErr)
+				t.Errorf("ValidateConfig() error = %v, wantErr %v", err, scenario.wantErr)
 				return
 			}
 
 			if scenario.wantErr && scenario.errContains != "" {
 				if err == nil || !strings.Contains(err.Error(), scenario.errContains) {
-					t.Errorf("validateConfig() error = %v, want error containing %q", err, scenario.errContains)
+					t.Errorf("ValidateConfig() error = %v, want error containing %q", err, scenario.errContains)
 				}
 			}
 		})
@@ -275,14 +284,15 @@ func TestE2EDownloaderSetup(t *testing.T) {
 		{
 			name: "Minimal_Setup",
 			config: &Config{
-				Username:       "testuser",
-				Password:       "testpass",
-				OutputDir:      tempDir,
-				Countries:      []string{"NL"},
-				DisplayType:    1,
-				IconSize:       5,
-				DownloadFixed:  true,
-				DownloadMobile: true,
+				Username:        "testuser",
+				Password:        "testpass",
+				OutputDir:       tempDir,
+				Countries:       []string{"NL"},
+				DisplayType:     1,
+				IconSize:        5,
+				AcceptAgreement: true,
+				DownloadFixed:   true,
+				DownloadMobile:  true,
 			},
 		},
 		{
@@ -297,6 +307,7 @@ func TestE2EDownloaderSetup(t *testing.T) {
 				FranceDangerMode: true,
 				IconSize:         4,
 				WarningTime:      600,
+				AcceptAgreement:  true,
 				DownloadFixed:    true,
 				DownloadMobile:   false,
 				Verbose:          true,
@@ -314,9 +325,11 @@ func TestE2EDownloaderSetup(t *testing.T) {
 				FranceDangerMode: false,
 				IconSize:         1, // Smallest icons
 				WarningTime:      0, // No warnings
+				AcceptAgreement:  true,
 				DownloadFixed:    true,
 				DownloadMobile:   false, // Only what's needed
 				Verbose:          false,
+				Timeout:          10 * time.Minute,
 			},
 		},
 	}
@@ -324,7 +337,7 @@ func TestE2EDownloaderSetup(t *testing.T) {
 	for _, scenario := range scenarios {
 		t.Run(scenario.name, func(t *testing.T) {
 			// Validate config
-			err := validateConfig(scenario.config)
+			err := ValidateConfig(scenario.config)
 			AssertNoError(t, err)
 
 			// Create downloader
@@ -357,8 +370,8 @@ func TestE2EDownloaderSetup(t *testing.T) {
 			}
 
 			// Verify HTTP client configuration
-			if downloader.client.Timeout == 0 {
-				t.Error("HTTP client timeout not set")
+			if downloader.client.Timeout != scenario.config.Timeout {
+				t.Errorf("HTTP client timeout = %v, want %v", downloader.client.Timeout, scenario.config.Timeout)
 			}
 
 			if downloader.client.Jar == nil {
@@ -441,7 +454,7 @@ func TestE2EErrorHandling(t *testing.T) {
 				config.DownloadMobile = false
 				return config
 			},
-			expectError: "at least one of -fixed or -mobile must be enabled",
+			expectError: "at least one of DownloadFixed or DownloadMobile must be enabled",
 		},
 		{
 			name: "Empty_Countries",
@@ -456,7 +469,7 @@ func TestE2EErrorHandling(t *testing.T) {
 			name: "Invalid_Country_Code",
 			setup: func() *Config {
 				config := CreateTestConfig()
-				// This will be tested at the expandCountries level
+				// This will be tested at the ExpandCountries level
 				return config
 			},
 			expectError: "", // Will be tested separately
@@ -469,24 +482,24 @@ func TestE2EErrorHandling(t *testing.T) {
 
 			if scenario.name == "Invalid_Country_Code" {
 				// Test invalid country expansion separately
-				_, err := expandCountries([]string{"INVALID_COUNTRY"})
+				_, err := ExpandCountries([]string{"INVALID_COUNTRY"})
 				if err == nil {
-					t.Error("expandCountries() should fail for invalid country")
+					t.Error("ExpandCountries() should fail for invalid country")
 				}
 				if !strings.Contains(err.Error(), "invalid country/region") {
-					t.Errorf("expandCountries() error = %v, want error containing 'invalid country/region'", err)
+					t.Errorf("ExpandCountries() error = %v, want error containing 'invalid country/region'", err)
 				}
 				return
 			}
 
-			err := validateConfig(config)
+			err := ValidateConfig(config)
 			if err == nil {
-				t.Errorf("validateConfig() should fail for %s", scenario.name)
+				t.Errorf("ValidateConfig() should fail for %s", scenario.name)
 				return
 			}
 
 			if !strings.Contains(err.Error(), scenario.expectError) {
-				t.Errorf("validateConfig() error = %v, want error containing %q", err, scenario.expectError)
+				t.Errorf("ValidateConfig() error = %v, want error containing %q", err, scenario.expectError)
 			}
 		})
 	}
@@ -553,16 +566,16 @@ func TestE2EConfigPathResolution(t *testing.T) {
 			}
 
 			// Get default path
-			path := getDefaultConfigPath()
+			path := DefaultConfigPath()
 
 			// Verify path contains expected elements
 			if !strings.Contains(path, scenario.expectedContains) {
-				t.Errorf("getDefaultConfigPath() = %q, want path containing %q", path, scenario.expectedContains)
+				t.Errorf("DefaultConfigPath() = %q, want path containing %q", path, scenario.expectedContains)
 			}
 
 			// For non-fallback scenarios, ensure path is absolute
 			if scenario.home != "" && !filepath.IsAbs(path) {
-				t.Errorf("getDefaultConfigPath() = %q, want absolute path", path)
+				t.Errorf("DefaultConfigPath() = %q, want absolute path", path)
 			}
 		})
 	}
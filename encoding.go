@@ -0,0 +1,58 @@
+package scdb
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// acceptEncoding is advertised on every request. Setting it explicitly turns off the
+// transport's transparent gzip handling, so decodeBody takes its place.
+const acceptEncoding = "gzip, deflate"
+
+// decodedBody reads the decoded form of a response body and closes both on Close
+type decodedBody struct {
+	io.Reader
+	decoder io.Closer
+	body    io.Closer
+}
+
+func (b *decodedBody) Close() error {
+	_ = b.decoder.Close()
+	return b.body.Close()
+}
+
+// decodeBody replaces a gzip or deflate encoded response body with the decoded content,
+// so error pages can be inspected and saved archives are the files themselves. Bodies
+// without a Content-Encoding, such as ZIP downloads, are left alone.
+func decodeBody(resp *http.Response) error {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding == "" || encoding == "identity" || resp.StatusCode == http.StatusNotModified || resp.ContentLength == 0 {
+		return nil
+	}
+
+	var decoder io.ReadCloser
+	var err error
+	switch encoding {
+	case "gzip", "x-gzip":
+		decoder, err = gzip.NewReader(resp.Body)
+	case "deflate":
+		decoder, err = zlib.NewReader(resp.Body)
+	default:
+		return fmt.Errorf("unsupported Content-Encoding %q", encoding)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", encoding, err)
+	}
+
+	resp.Body = &decodedBody{Reader: decoder, decoder: decoder, body: resp.Body}
+	// The encoded length says nothing about the decoded body
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
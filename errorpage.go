@@ -0,0 +1,151 @@
+package scdb
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	// maxErrorBodySize limits how much of an unexpected response is read
+	maxErrorBodySize = 64 << 10
+	// maxErrorTextLength caps the page text quoted in an error message
+	maxErrorTextLength = 160
+)
+
+// downloadLimitMarkers are lowercase phrases of the alert SCDB shows instead of a ZIP once
+// the daily download limit is exceeded, as in "Your daily download limit has been
+// reached."
+var downloadLimitMarkers = []string{
+	"download limit has been reached",
+	"download limit reached",
+	"download limit exceeded",
+	"too many downloads",
+}
+
+// isDownloadLimitPage reports whether body is SCDB's download limit page: one of its
+// error or alert elements says the limit is reached. The rest of the page is not
+// searched, since account pages and footers may mention the limit too.
+func isDownloadLimitPage(body []byte) bool {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+
+	var found bool
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if found {
+			return
+		}
+		if n.Type == html.ElementNode && isErrorElement(n) {
+			text := strings.ToLower(nodeText(n))
+			for _, marker := range downloadLimitMarkers {
+				if strings.Contains(text, marker) {
+					found = true
+					return
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return found
+}
+
+// describeErrorPage summarises an HTML (or plain text) error page as its title plus the
+// text of the first element marked as an error or alert. Pages without either fall back
+// to their first visible text. The result is truncated to maxErrorTextLength runes.
+func describeErrorPage(body []byte) string {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	var title, errorText, firstText string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.ElementNode:
+			switch n.Data {
+			case "script", "style", "noscript":
+				return
+			case "title":
+				if title == "" {
+					title = nodeText(n)
+				}
+				return
+			}
+			if errorText == "" && isErrorElement(n) {
+				errorText = nodeText(n)
+			}
+		case html.TextNode:
+			if firstText == "" {
+				firstText = strings.Join(strings.Fields(n.Data), " ")
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	var parts []string
+	if title != "" {
+		parts = append(parts, title)
+	}
+	if errorText != "" && errorText != title {
+		parts = append(parts, errorText)
+	}
+	if len(parts) == 0 && firstText != "" {
+		parts = append(parts, firstText)
+	}
+	return truncateText(strings.Join(parts, ": "), maxErrorTextLength)
+}
+
+// isErrorElement reports whether n's class or id marks it as an error or alert message
+func isErrorElement(n *html.Node) bool {
+	for _, attr := range n.Attr {
+		if attr.Key != "class" && attr.Key != "id" {
+			continue
+		}
+		val := strings.ToLower(attr.Val)
+		if strings.Contains(val, "error") || strings.Contains(val, "alert") {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeText returns the visible text below n with whitespace collapsed
+func nodeText(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && (n.Data == "script" || n.Data == "style") {
+			return
+		}
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+			sb.WriteByte(' ')
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
+// truncateText shortens s to at most max runes, marking a cut with an ellipsis
+func truncateText(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:max-1])) + "…"
+}
@@ -0,0 +1,132 @@
+package scdb
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Sentinel errors for the failure modes callers may want to tell apart with errors.Is.
+// They are returned wrapped, with the details that apply to the particular failure.
+var (
+	// ErrMissingCredentials means no username or password was configured
+	ErrMissingCredentials = errors.New("username and password are required")
+	// ErrInvalidDisplayType means the display type is outside 1-4
+	ErrInvalidDisplayType = errors.New("display type must be 1-4")
+	// ErrInvalidIconSize means the icon size is outside 1-5
+	ErrInvalidIconSize = errors.New("icon size must be 1-5")
+	// ErrInvalidCountry means a country code, name or region could not be resolved
+	ErrInvalidCountry = errors.New("invalid country/region")
+	// ErrInvalidFilename means Config.FilenameTemplate does not produce a usable, unique
+	// file name
+	ErrInvalidFilename = errors.New("invalid filename template")
+	// ErrAgreementNotAccepted means fixed cameras were requested without
+	// Config.AcceptAgreement
+	ErrAgreementNotAccepted = errors.New("the SCDB download agreement must be accepted to download fixed cameras")
+	// ErrNotAZip means a download was not a ZIP archive
+	ErrNotAZip = errors.New("not a valid ZIP archive")
+	// ErrDownloadLimitReached is returned when SCDB refuses a download because the
+	// account's daily download limit is used up. Retrying before the limit resets is
+	// pointless.
+	ErrDownloadLimitReached = errors.New("SCDB download limit reached")
+	// ErrCountryDetection means DetectCountry could not tell which country to download
+	ErrCountryDetection = errors.New("could not detect your country")
+	// ErrLoginChallenge means SCDB answered the login with a CAPTCHA or another
+	// verification that only a browser can complete
+	ErrLoginChallenge = errors.New("login blocked by a challenge page")
+	// ErrOTPRequired means the login asked for a one-time code and none was given
+	ErrOTPRequired = errors.New("login code required")
+	// ErrServerMaintenance means SCDB answered with its maintenance page. The run can be
+	// retried once the site is back.
+	ErrServerMaintenance = errors.New("SCDB is down for maintenance")
+	// ErrDownloadTooLarge means a download grew past Config.MaxDownloadBytes, or the
+	// downloads of a run together past Config.MaxTotalBytes
+	ErrDownloadTooLarge = errors.New("download size limit exceeded")
+	// ErrOutputExists means Config.NoClobber stopped a download from replacing an
+	// existing file
+	ErrOutputExists = errors.New("output file already exists")
+)
+
+// RequestError is a request to SCDB that failed, either without a response or with a
+// response the step could not use. Its message names the step, the request and the
+// status, like "download fixed: POST /my/downloadsection: 503 Service Unavailable".
+type RequestError struct {
+	Op         string // The step, such as "login" or "download mobile"
+	Method     string
+	Path       string
+	StatusCode int    // 0 when no response arrived
+	Status     string // The status line of the response, such as "503 Service Unavailable"
+	Err        error  // The transport error or what was wrong with the response, if known
+}
+
+func (e *RequestError) Error() string {
+	msg := fmt.Sprintf("%s: %s %s", e.Op, e.Method, e.Path)
+	if e.Status != "" {
+		msg += ": " + e.Status
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *RequestError) Unwrap() error { return e.Err }
+
+// OptionError is a Config whose settings do not go together, such as Keep without
+// Archive. Its message names the settings by their Config fields; Format names them the
+// way the caller presents them, such as by command line flag.
+type OptionError struct {
+	Fields []string // The Config fields at fault, in the order the message names them
+	format string
+	args   []any
+}
+
+// configField marks an argument of optionError as the name of a Config field
+type configField string
+
+// optionError returns the OptionError with the message format and args, where the
+// configField arguments are the fields at fault
+func optionError(format string, args ...any) *OptionError {
+	e := &OptionError{format: format, args: args}
+	for _, arg := range args {
+		if f, ok := arg.(configField); ok {
+			e.Fields = append(e.Fields, string(f))
+		}
+	}
+	return e
+}
+
+func (e *OptionError) Error() string {
+	return e.Format(func(field string) string { return field })
+}
+
+// Format returns the message with each Config field named by name
+func (e *OptionError) Format(name func(field string) string) string {
+	args := make([]any, len(e.args))
+	for i, arg := range e.args {
+		if f, ok := arg.(configField); ok {
+			arg = name(string(f))
+		}
+		args[i] = arg
+	}
+	return fmt.Sprintf(e.format, args...)
+}
+
+// requestError returns the RequestError of a request to path for step op. resp is the
+// response, or nil when err is all there is. The method and URL net/http puts around a
+// transport error are dropped, as the RequestError already names them.
+func requestError(op, method, path string, resp *http.Response, err error) error {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	reqErr := &RequestError{Op: op, Method: method, Path: path, Err: err}
+	if resp != nil {
+		reqErr.StatusCode = resp.StatusCode
+		reqErr.Status = resp.Status
+		if reqErr.Status == "" {
+			reqErr.Status = fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+		}
+	}
+	return reqErr
+}
@@ -0,0 +1,81 @@
+package scdb
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// extractDir returns the directory an archive is unpacked into: its path without ".zip"
+func extractDir(archive string) string {
+	return strings.TrimSuffix(archive, filepath.Ext(archive))
+}
+
+// extractZip unpacks the archive at src into dir, rejecting entries that would escape dir
+func extractZip(src, dir string) error {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer func() { _ = r.Close() }()
+
+	for _, f := range r.File {
+		target, err := safeJoin(dir, f.Name)
+		if err != nil {
+			return err
+		}
+
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return fmt.Errorf("failed to create directory: %w", err)
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		if err := extractFile(f, target); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// safeJoin joins an archive entry name onto dir, failing when the cleaned result lies
+// outside dir (zip-slip)
+func safeJoin(dir, name string) (string, error) {
+	target := filepath.Join(dir, name)
+	rel, err := filepath.Rel(dir, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("zip entry %q escapes the extraction directory", name)
+	}
+	return target, nil
+}
+
+// extractFile writes a single archive entry to target
+func extractFile(f *zip.File, target string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("failed to read zip entry %s: %w", f.Name, err)
+	}
+	defer func() { _ = rc.Close() }()
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", target, err)
+	}
+
+	_, err = io.Copy(out, rc)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to extract %s: %w", f.Name, err)
+	}
+	return nil
+}
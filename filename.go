@@ -0,0 +1,226 @@
+package scdb
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+// DefaultFilenameTemplate produces the standard archive names: garmin.zip, garmin-<CODE>.zip
+// with SeparateByCountry, garmin-dangerzones.zip with DangerZonesOnly, and
+// garmin-mobile.zip, with the format in place of garmin
+const DefaultFilenameTemplate = `{{.Format}}{{if eq .Type "mobile"}}-mobile{{else}}{{if .DangerZones}}-dangerzones{{end}}{{if .Country}}-{{.Country}}{{end}}{{end}}.zip`
+
+// FilenameData holds the fields available to Config.FilenameTemplate
+type FilenameData struct {
+	Format    string // The download format, such as "garmin"
+	Type      string // "fixed" or "mobile"
+	Date      string // Date the run started, YYYY-MM-DD
+	Countries string // Selected country codes joined with "-"
+	Country   string // The country of a SeparateByCountry download, empty otherwise
+	// DangerZones is set for the fixed archives of a DangerZonesOnly download
+	DangerZones bool
+}
+
+// parseFilenameTemplate parses text as a filename template, using DefaultFilenameTemplate
+// when text is empty
+func parseFilenameTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = DefaultFilenameTemplate
+	}
+	tmpl, err := template.New("filename").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidFilename, err)
+	}
+	return tmpl, nil
+}
+
+// renderFilename executes tmpl with data and checks that the result is a plain file name,
+// so a template cannot write outside the output directory
+func renderFilename(tmpl *template.Template, data FilenameData) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidFilename, err)
+	}
+
+	name := b.String()
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("%w: %q is not a plain file name", ErrInvalidFilename, name)
+	}
+	return name, nil
+}
+
+// outputPath returns where the archive of the given type ("fixed" or "mobile") is written
+// in the run's output directory, named by Config.FilenameTemplate. country is set for SeparateByCountry downloads.
+func (d *SCDBDownloader) outputPath(typ, country string) (string, error) {
+	if d.streaming() {
+		return StdoutOutput, nil
+	}
+
+	tmpl, err := parseFilenameTemplate(d.config.FilenameTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	started := d.started
+	if started.IsZero() {
+		started = time.Now()
+	}
+	name, err := renderFilename(tmpl, d.filenameData(typ, country, started.Format(time.DateOnly)))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d.typeOutputDir(typ), name), nil
+}
+
+// filenameData returns the template fields for the archive of the given type and
+// country written on date
+func (d *SCDBDownloader) filenameData(typ, country, date string) FilenameData {
+	countries := d.config.Countries
+	if country != "" {
+		countries = []string{country}
+	}
+	return FilenameData{
+		Format:      d.formatName(),
+		Type:        typ,
+		Date:        date,
+		Countries:   strings.Join(countries, "-"),
+		Country:     country,
+		DangerZones: typ == "fixed" && d.config.DangerZonesOnly,
+	}
+}
+
+// typeOutputDir returns the directory for archives of type typ ("fixed" or "mobile"):
+// Config.FixedOutputDir or Config.MobileOutputDir when set, else the run's output directory
+func (d *SCDBDownloader) typeOutputDir(typ string) string {
+	if typ == "fixed" && d.config.FixedOutputDir != "" {
+		return d.config.FixedOutputDir
+	}
+	if typ == "mobile" && d.config.MobileOutputDir != "" {
+		return d.config.MobileOutputDir
+	}
+	return d.outputDir()
+}
+
+// outputDirs returns the directories the run writes to: the output directory, which
+// also receives checksums.txt, and the type directories of the enabled downloads
+func (d *SCDBDownloader) outputDirs() []string {
+	dirs := []string{d.outputDir()}
+	if d.config.DownloadFixed {
+		dirs = append(dirs, d.typeOutputDir("fixed"))
+	}
+	if d.config.DownloadMobile {
+		dirs = append(dirs, d.typeOutputDir("mobile"))
+	}
+	slices.Sort(dirs)
+	return slices.Compact(dirs)
+}
+
+// checkFilenameTemplate renders config's filename template for every archive the run
+// would write and rejects templates that fail or give two archives in one directory the
+// same name
+func checkFilenameTemplate(config *Config) error {
+	tmpl, err := parseFilenameTemplate(config.FilenameTemplate)
+	if err != nil {
+		return err
+	}
+
+	format := config.Format
+	if format == "" {
+		format = DefaultFormat
+	}
+	date := time.Now().Format(time.DateOnly)
+	countries := strings.Join(config.Countries, "-")
+	var samples []FilenameData
+	if config.DownloadFixed {
+		if config.SeparateByCountry {
+			// Two made-up countries are enough to show whether names differ per country
+			samples = append(samples,
+				FilenameData{Format: format, Type: "fixed", Date: date, Countries: "A", Country: "A", DangerZones: config.DangerZonesOnly},
+				FilenameData{Format: format, Type: "fixed", Date: date, Countries: "B", Country: "B", DangerZones: config.DangerZonesOnly})
+		} else {
+			samples = append(samples, FilenameData{Format: format, Type: "fixed", Date: date, Countries: countries, DangerZones: config.DangerZonesOnly})
+		}
+	}
+	if config.DownloadMobile {
+		samples = append(samples, FilenameData{Format: format, Type: "mobile", Date: date, Countries: countries})
+	}
+
+	dirs := map[string]string{"fixed": config.FixedOutputDir, "mobile": config.MobileOutputDir}
+	seen := make(map[string]FilenameData)
+	for _, data := range samples {
+		name, err := renderFilename(tmpl, data)
+		if err != nil {
+			return err
+		}
+		dir := dirs[data.Type]
+		if dir == "" {
+			dir = config.OutputDir
+		}
+		path := filepath.Join(dir, name)
+		if prev, ok := seen[path]; ok {
+			what := "fixed and mobile downloads"
+			if prev.Type == data.Type {
+				what = "every country"
+			}
+			return fmt.Errorf("%w: %q is used for %s", ErrInvalidFilename, name, what)
+		}
+		seen[path] = data
+	}
+	return nil
+}
+
+// serverOutputPath returns where the archive in resp is written with
+// Config.UseServerFilename: the file name of its Content-Disposition header, in the
+// directory of path. It returns path when the option is off, or when the header is absent,
+// names no safe .zip file, or names a file this run already wrote.
+func (d *SCDBDownloader) serverOutputPath(resp *http.Response, path string) string {
+	if !d.config.UseServerFilename || path == StdoutOutput {
+		return path
+	}
+	name, ok := serverFilename(resp.Header.Get("Content-Disposition"))
+	if !ok {
+		d.logger.Debug("no usable server file name, keeping the default", "path", path, "content_disposition", resp.Header.Get("Content-Disposition"))
+		return path
+	}
+
+	serverPath := filepath.Join(filepath.Dir(path), name)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, file := range d.files {
+		if file.Path == serverPath {
+			d.logger.Warn("server file name already used by this run, keeping the default", "name", name, "path", path)
+			return path
+		}
+	}
+	return serverPath
+}
+
+// serverFilename returns the file name of a Content-Disposition header, when it is a
+// plain .zip file name that cannot point outside the output directory or hide the file
+func serverFilename(header string) (string, bool) {
+	if header == "" {
+		return "", false
+	}
+	_, params, err := mime.ParseMediaType(header)
+	if err != nil {
+		return "", false
+	}
+	name := params["filename"]
+	if name == "" || strings.ContainsAny(name, `/\:`) || strings.HasPrefix(name, ".") ||
+		!strings.EqualFold(filepath.Ext(name), ".zip") {
+		return "", false
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return "", false
+		}
+	}
+	return name, true
+}
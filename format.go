@@ -0,0 +1,95 @@
+package scdb
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// DefaultFormat is the download format used when Config.Format is empty
+const DefaultFormat = "garmin"
+
+// downloadFormat holds the endpoints serving one navigation system's databases
+type downloadFormat struct {
+	fixedPath  string // Target of the fixed camera form, also the page holding both forms
+	mobilePath string // Target of the mobile camera form
+}
+
+// formats maps the Config.Format names to their endpoints. The fixed form takes the same
+// fields for every format; the name is also the default prefix of the archive names.
+// Other navigation systems are added once their SCDB endpoints and fields are confirmed.
+var formats = map[string]downloadFormat{
+	"garmin": {fixedPath: downloadSectionPath, mobilePath: mobileDownloadPath},
+}
+
+// defaultMobileForm is the mobile camera download form sent when Config.MobileForm is empty
+var defaultMobileForm = map[string]string{"mobile_submit": "Download+For+Free"}
+
+// Formats returns the names accepted by Config.Format, sorted
+func Formats() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkFormat rejects a Config.Format that is neither empty nor one of Formats
+func checkFormat(format string) error {
+	if _, ok := formats[format]; format != "" && !ok {
+		return fmt.Errorf("invalid format %q (want %s)", format, strings.Join(Formats(), ", "))
+	}
+	return nil
+}
+
+// formatName returns Config.Format, or DefaultFormat when it is empty
+func (d *SCDBDownloader) formatName() string {
+	if d.config.Format == "" {
+		return DefaultFormat
+	}
+	return d.config.Format
+}
+
+// format returns the endpoints of the configured download format
+func (d *SCDBDownloader) format() downloadFormat {
+	return formats[d.formatName()]
+}
+
+// mobilePath returns Config.MobilePath, or the mobile endpoint of the configured format
+// when it is empty
+func (d *SCDBDownloader) mobilePath() string {
+	if d.config.MobilePath != "" {
+		return d.config.MobilePath
+	}
+	return d.format().mobilePath
+}
+
+// checkMobilePath rejects a Config.MobilePath that is not a path on the SCDB site
+func checkMobilePath(path string) error {
+	if path == "" {
+		return nil
+	}
+	u, err := url.Parse(path)
+	if err != nil || !strings.HasPrefix(path, "/") || u.Host != "" || u.Scheme != "" {
+		return fmt.Errorf("invalid mobile path %q (want a path on the SCDB site such as %s)", path, mobileDownloadPath)
+	}
+	return nil
+}
+
+// formPage returns the page holding the form posted to path, sent as the Referer
+func (d *SCDBDownloader) formPage(path string) (string, bool) {
+	if path == loginPath {
+		return loginPath, true
+	}
+	if path == d.mobilePath() {
+		return d.format().fixedPath, true
+	}
+	for _, f := range formats {
+		if path == f.fixedPath || path == f.mobilePath {
+			return f.fixedPath, true
+		}
+	}
+	return "", false
+}
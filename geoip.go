@@ -0,0 +1,109 @@
+package scdb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultGeoIPURL is the lookup service DetectCountry asks when Config.GeoIPURL is empty.
+// It answers with the ISO 3166 code of the caller's public IP address as plain text.
+const DefaultGeoIPURL = "https://ipapi.co/country/"
+
+// GeoIPOff as Config.GeoIPURL disables country detection, for offline use
+const GeoIPOff = "off"
+
+// geoIPTimeout bounds the country lookup, which only saves typing a country code
+const geoIPTimeout = 5 * time.Second
+
+// isoCountries maps ISO 3166-1 alpha-2 codes to the SCDB codes of the same countries
+var isoCountries = map[string]string{
+	"AF": "AFG", "DZ": "DZ", "AD": "AND", "AR": "RA", "AM": "ARM", "AU": "AUS", "AT": "A",
+	"AZ": "AZ", "BH": "BRN", "BY": "BY", "BE": "B", "BZ": "BZ", "BA": "BIH", "BR": "BR",
+	"BG": "BG", "CA": "CDN", "CL": "RCH", "CO": "CO", "HR": "HR", "CY": "CY", "CZ": "CZ",
+	"DK": "DK", "EC": "EC", "EG": "ET", "SV": "ES2", "EE": "EST", "FJ": "FJI", "FI": "FI",
+	"FR": "FR", "GF": "GF", "GE": "GE", "DE": "D", "GI": "GBZ", "GR": "GR", "GP": "GP",
+	"GT": "GT", "GY": "GUY", "HN": "HN", "HK": "HK", "HU": "H", "IS": "IS", "IN": "IND",
+	"IR": "IR", "IQ": "IRQ", "IE": "IRL", "IL": "IL", "IT": "I", "JP": "J", "JO": "JOR",
+	"KZ": "KZ", "KW": "KWT", "KG": "KS", "LA": "LAO", "LV": "LV", "LB": "RL", "LI": "LI",
+	"LT": "LT", "LU": "L", "MO": "MO", "MY": "MAL", "MT": "M", "MQ": "MQ", "MU": "MS",
+	"MX": "MEX", "MD": "MD", "MN": "MGL", "MA": "MA", "NA": "NAM", "NL": "NL", "NZ": "NZ",
+	"MK": "MK", "NO": "NO", "OM": "OM", "PK": "PK", "PA": "PA", "PY": "PY", "PE": "PE",
+	"PH": "RP", "PL": "PL", "PT": "P", "QA": "Q", "RO": "RO", "RU": "RUS", "RW": "RWA",
+	"RE": "RE", "SM": "RSM", "SA": "KSA", "RS": "SRB", "SG": "SGP", "SK": "SK", "SI": "SLO",
+	"ZA": "ZA", "KR": "ROK", "ES": "ES", "SE": "SE", "CH": "CH", "TW": "RCT", "TH": "T",
+	"TT": "TT", "TN": "TN", "TR": "TR", "UA": "UA", "AE": "UAE", "GB": "GB", "US": "USA",
+	"UY": "ROU", "UZ": "UZ", "VN": "VN", "ZM": "Z", "ZW": "ZW",
+}
+
+// DetectCountry looks up the SCDB code of the country the public IP address is in, asking
+// Config.GeoIPURL (DefaultGeoIPURL when empty) through the configured proxy. The lookup
+// gives up after a few seconds. Failures, and a GeoIPURL of GeoIPOff, return an error
+// wrapping ErrCountryDetection.
+func DetectCountry(ctx context.Context, cfg *Config) (string, error) {
+	lookup := cfg.GeoIPURL
+	if lookup == "" {
+		lookup = DefaultGeoIPURL
+	}
+	if lookup == GeoIPOff {
+		return "", fmt.Errorf("%w: detection is turned off", ErrCountryDetection)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, geoIPTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", lookup, nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrCountryDetection, err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	client := newHTTPClient(cfg)
+	client.Jar = nil // The lookup has no business with SCDB's cookies
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrCountryDetection, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: %s answered HTTP %d", ErrCountryDetection, req.URL.Host, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64))
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrCountryDetection, err)
+	}
+	iso := strings.ToUpper(strings.TrimSpace(string(body)))
+	code, ok := isoCountries[iso]
+	if !ok {
+		return "", fmt.Errorf("%w: SCDB has no cameras for country %q", ErrCountryDetection, iso)
+	}
+	return code, nil
+}
+
+// NearbyCountries returns code followed by the other members of the smallest built-in
+// region containing it, such as D, A and CH for D. A country in no region is returned
+// alone.
+func NearbyCountries(code string) []string {
+	var best []string
+	bestName := ""
+	for name, members := range regionMap {
+		if !slices.Contains(members, code) {
+			continue
+		}
+		if best == nil || len(members) < len(best) || (len(members) == len(best) && name < bestName) {
+			best, bestName = members, name
+		}
+	}
+
+	countries := []string{code}
+	for _, member := range best {
+		if member != code {
+			countries = append(countries, member)
+		}
+	}
+	return countries
+}
@@ -2,4 +2,16 @@ module github.com/kjanat/scdb
 
 go 1.24.6
 
-require gopkg.in/yaml.v2 v2.4.0
+require (
+	github.com/robfig/cron/v3 v3.0.1
+	github.com/zalando/go-keyring v0.2.8
+	golang.org/x/net v0.44.0
+	golang.org/x/sys v0.36.0
+	golang.org/x/term v0.35.0
+	gopkg.in/yaml.v2 v2.4.0
+)
+
+require (
+	github.com/danieljoos/wincred v1.2.3 // indirect
+	github.com/godbus/dbus/v5 v5.2.2 // indirect
+)
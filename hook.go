@@ -0,0 +1,71 @@
+package scdb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// runPostDownloadCommand runs Config.PostDownloadCommand through the shell with the
+// run's files in its environment, logging each line it prints. A failing command fails
+// the run unless Config.PostDownloadIgnoreErrors is set.
+func (d *SCDBDownloader) runPostDownloadCommand(ctx context.Context) error {
+	command := d.config.PostDownloadCommand
+
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+	cmd := exec.CommandContext(ctx, shell, flag, command)
+	cmd.Env = append(os.Environ(), d.hookEnv()...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	d.logger.Info("running post-download command", "command", command)
+	err := cmd.Run()
+
+	scanner := bufio.NewScanner(&output)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			d.logger.Info("post-download command output", "line", line)
+		}
+	}
+
+	if err == nil {
+		return nil
+	}
+	if d.config.PostDownloadIgnoreErrors {
+		d.logger.Warn("post-download command failed", "command", command, "error", err)
+		return nil
+	}
+	return fmt.Errorf("post-download command %q failed: %w", command, err)
+}
+
+// hookEnv returns the SCDB_* variables describing the run to the post-download command.
+// Several fixed archives (with SeparateByCountry) are joined by os.PathListSeparator.
+func (d *SCDBDownloader) hookEnv() []string {
+	var fixed, mobile []string
+	d.mu.Lock()
+	for _, file := range d.files {
+		if file.Type == "mobile" {
+			mobile = append(mobile, file.Path)
+		} else {
+			fixed = append(fixed, file.Path)
+		}
+	}
+	d.mu.Unlock()
+
+	sep := string(os.PathListSeparator)
+	return []string{
+		"SCDB_FIXED_PATH=" + strings.Join(fixed, sep),
+		"SCDB_MOBILE_PATH=" + strings.Join(mobile, sep),
+		"SCDB_COUNTRIES=" + strings.Join(d.config.Countries, ","),
+		"SCDB_OUTPUT_DIR=" + d.outputDir(),
+	}
+}
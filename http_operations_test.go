@@ -1,12 +1,22 @@
-package main
+package scdb
 
 import (
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
 	"time"
 )
 
@@ -34,13 +44,13 @@ func TestSCDBDownloader_HTTPClientSetup(t *testing.T) {
 		t.Fatal("Transport should be *http.Transport")
 	}
 
-	// Test TLS configuration for SCDB's self-signed certificates
+	// Test TLS configuration: certificates are verified by default
 	if transport.TLSClientConfig == nil {
 		t.Fatal("TLS config should be set")
 	}
 
-	if !transport.TLSClientConfig.InsecureSkipVerify {
-		t.Error("InsecureSkipVerify should be true for SCDB self-signed certs")
+	if transport.TLSClientConfig.InsecureSkipVerify {
+		t.Error("InsecureSkipVerify should be false unless InsecureSkipTLS is set")
 	}
 
 	// Test cookie jar for session management
@@ -49,6 +59,41 @@ func TestSCDBDownloader_HTTPClientSetup(t *testing.T) {
 	}
 }
 
+func TestSCDBDownloader_Proxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Requests through an HTTP proxy carry the absolute target URL
+		proxied = append(proxied, r.URL.String())
+		http.SetCookie(w, &http.Cookie{Name: "PHPSESSID", Value: "proxied", Path: "/"})
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+
+	config := CreateTestConfig()
+	config.BaseURL = "http://scdb.invalid"
+	config.ProxyURL = proxy.URL
+	config.InsecureSkipTLS = true
+	downloader := NewDownloader(config)
+
+	transport := downloader.client.Transport.(*http.Transport)
+	if !transport.TLSClientConfig.InsecureSkipVerify {
+		t.Error("TLS settings should be kept when a proxy is configured")
+	}
+
+	AssertNoError(t, downloader.checkLoggedIn(context.Background()))
+	AssertNoError(t, downloader.checkLoggedIn(context.Background()))
+
+	if len(proxied) != 2 || proxied[0] != "http://scdb.invalid/my/" {
+		t.Fatalf("proxied requests = %v, want two for http://scdb.invalid/my/", proxied)
+	}
+
+	// The session cookie set through the proxy belongs to the target host
+	target, _ := url.Parse(config.BaseURL)
+	if cookies := downloader.client.Jar.Cookies(target); len(cookies) != 1 || cookies[0].Value != "proxied" {
+		t.Errorf("cookies for %s = %v, want the proxied session", target, cookies)
+	}
+}
+
 func TestSCDBDownloader_LoginFlow(t *testing.T) {
 	mockServer := NewMockSCDBServer()
 	defer mockServer.Close()
@@ -210,7 +255,7 @@ func TestSCDBDownloader_DownloadOperations_Structure(t *testing.T) {
 	}
 
 	// Test country expansion (indirectly tests download preparation)
-	countries, err := expandCountries(downloader.config.Countries)
+	countries, err := ExpandCountries(downloader.config.Countries)
 	if err != nil {
 		t.Errorf("Country expansion failed: %v", err)
 	}
@@ -229,13 +274,13 @@ func TestSCDBDownloader_FormDataPreparation(t *testing.T) {
 	config.DangerZones = true
 
 	// Test that config values are properly validated for form submission
-	err := validateConfig(config)
+	err := ValidateConfig(config)
 	if err != nil {
 		t.Errorf("Valid config should not produce error: %v", err)
 	}
 
 	// Test country expansion for form data
-	expandedCountries, err := expandCountries(config.Countries)
+	expandedCountries, err := ExpandCountries(config.Countries)
 	if err != nil {
 		t.Errorf("Country expansion should succeed: %v", err)
 	}
@@ -271,6 +316,39 @@ func BenchmarkNewDownloader(b *testing.B) {
 	}
 }
 
+func TestSCDBDownloader_ZeroTimeout(t *testing.T) {
+	config := CreateTestConfig()
+	config.Timeout = 0
+	downloader := NewDownloader(config)
+
+	if downloader.client.Timeout != 0 {
+		t.Errorf("HTTP timeout = %v, want none", downloader.client.Timeout)
+	}
+}
+
+func TestSCDBDownloader_LoginTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Hang like an unresponsive login page until the test ends
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	config := CreateTestConfig()
+	config.BaseURL = server.URL
+	config.LoginTimeout = 50 * time.Millisecond
+	downloader := NewDownloader(config)
+
+	start := time.Now()
+	err := downloader.login(context.Background())
+	AssertErrorContains(t, err, "context deadline exceeded")
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("login took %v, want it bounded by the login timeout", elapsed)
+	}
+}
+
 // Test HTTP timeout behavior
 func TestSCDBDownloader_TimeoutHandling(t *testing.T) {
 	config := CreateTestConfig()
@@ -289,3 +367,607 @@ func TestSCDBDownloader_TimeoutHandling(t *testing.T) {
 		t.Errorf("Timeout too long, may hang tests: %v > %v", timeout, maxTimeout)
 	}
 }
+
+func TestSCDBDownloader_newRequest(t *testing.T) {
+	config := CreateTestConfig()
+	config.BaseURL = "https://mirror.example/"
+	downloader := NewDownloader(config)
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		form        url.Values
+		wantReferer string
+	}{
+		{"Login page", "GET", loginPath, nil, ""},
+		{"Login form", "POST", loginPath, url.Values{"u_name": {"testuser"}}, "https://mirror.example/en/login/"},
+		{"Fixed download", "POST", downloadSectionPath, url.Values{"land[]": {"NL"}}, "https://mirror.example/my/downloadsection"},
+		{"Mobile download", "POST", mobileDownloadPath, url.Values{"mobile_submit": {"1"}}, "https://mirror.example/my/downloadsection"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := downloader.newRequest(context.Background(), tt.method, tt.path, tt.form)
+			AssertNoError(t, err)
+
+			if want := "https://mirror.example" + tt.path; req.URL.String() != want {
+				t.Errorf("URL = %s, want %s", req.URL, want)
+			}
+			for header, want := range map[string]string{
+				"User-Agent":      userAgent,
+				"Accept":          acceptHeader,
+				"Accept-Language": acceptLanguage,
+				"Accept-Encoding": acceptEncoding,
+				"Referer":         tt.wantReferer,
+			} {
+				if got := req.Header.Get(header); got != want {
+					t.Errorf("%s = %q, want %q", header, got, want)
+				}
+			}
+
+			if tt.form == nil {
+				if req.Body != nil || req.Header.Get("Origin") != "" || req.Header.Get("Content-Type") != "" {
+					t.Errorf("request without form has a body, Origin or Content-Type")
+				}
+				return
+			}
+			if got := req.Header.Get("Origin"); got != "https://mirror.example" {
+				t.Errorf("Origin = %q, want https://mirror.example", got)
+			}
+			if got := req.Header.Get("Content-Type"); got != "application/x-www-form-urlencoded" {
+				t.Errorf("Content-Type = %q", got)
+			}
+			body, _ := io.ReadAll(req.Body)
+			if string(body) != tt.form.Encode() {
+				t.Errorf("body = %q, want %q", body, tt.form.Encode())
+			}
+		})
+	}
+}
+
+func TestSCDBDownloader_newRequestMultipart(t *testing.T) {
+	config := CreateTestConfig()
+	config.FormEncoding = FormMultipart
+	downloader := NewDownloader(config)
+
+	form := url.Values{"typ": {"1"}, "land[]": {"NL", "B", "D"}}
+	req, err := downloader.newRequest(context.Background(), "POST", downloadSectionPath, form)
+	AssertNoError(t, err)
+
+	if !strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/form-data; boundary=") {
+		t.Fatalf("Content-Type = %q, want multipart/form-data", req.Header.Get("Content-Type"))
+	}
+	if req.ContentLength <= 0 || req.GetBody == nil {
+		t.Errorf("ContentLength = %d, GetBody set = %v, want a replayable body", req.ContentLength, req.GetBody != nil)
+	}
+	AssertNoError(t, req.ParseMultipartForm(1<<20))
+	for field, want := range form {
+		if got := req.MultipartForm.Value[field]; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %v, want %v", field, got, want)
+		}
+	}
+
+	// The login form keeps the encoding of the site's login page
+	req, err = downloader.newRequest(context.Background(), "POST", loginPath, url.Values{"u_name": {"testuser"}})
+	AssertNoError(t, err)
+	if got := req.Header.Get("Content-Type"); got != "application/x-www-form-urlencoded" {
+		t.Errorf("login Content-Type = %q, want application/x-www-form-urlencoded", got)
+	}
+}
+
+func TestSCDBDownloader_EncodedResponses(t *testing.T) {
+	errorPage := `<html><head><title>SCDB.info</title></head><body>
+<div class="alert alert-danger">Your session has expired.</div></body></html>`
+	archive := MockZipContent(map[string]string{"mobile.gpi": "cameras"})
+
+	gzipped := func(data []byte) []byte {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, _ = zw.Write(data)
+		_ = zw.Close()
+		return buf.Bytes()
+	}
+	deflated := func(data []byte) []byte {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		_, _ = zw.Write(data)
+		_ = zw.Close()
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		encoding    string
+		body        []byte
+		errMsg      string
+	}{
+		{"Gzipped error page", "text/html", "gzip", gzipped([]byte(errorPage)), "Your session has expired"},
+		{"Deflated error page", "text/html", "deflate", deflated([]byte(errorPage)), "Your session has expired"},
+		{"Plain ZIP", "application/zip", "", archive, ""},
+		{"Gzipped ZIP", "application/octetstream", "gzip", gzipped(archive), ""},
+		{"Corrupt gzip", "text/html", "gzip", []byte("not gzip"), "failed to decode gzip response"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Accept-Encoding"); got != acceptEncoding {
+					t.Errorf("Accept-Encoding = %q, want %q", got, acceptEncoding)
+				}
+				w.Header().Set("Content-Type", tt.contentType)
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				_, _ = w.Write(tt.body)
+			}))
+			defer server.Close()
+
+			config := CreateTestConfig()
+			config.BaseURL = server.URL
+			config.OutputDir = t.TempDir()
+			config.VerifyZip = true
+			err := NewDownloader(config).downloadMobile(context.Background())
+
+			outputPath := filepath.Join(config.OutputDir, "garmin-mobile.zip")
+			if tt.errMsg != "" {
+				AssertErrorContains(t, err, tt.errMsg)
+				AssertFileNotExists(t, outputPath)
+				return
+			}
+			AssertNoError(t, err)
+			if saved, _ := os.ReadFile(outputPath); !bytes.Equal(saved, archive) {
+				t.Errorf("saved %d bytes, want the %d byte archive", len(saved), len(archive))
+			}
+		})
+	}
+}
+
+func TestSCDBDownloader_doWithRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int
+		retryCount   int
+		wantStatus   int
+		wantAttempts int
+	}{
+		{"Success on first attempt", 0, 3, http.StatusOK, 1},
+		{"Recovers after transient 503s", 2, 3, http.StatusOK, 3},
+		{"Gives up after retry budget", 5, 2, http.StatusServiceUnavailable, 3},
+		{"Retries disabled", 1, 0, http.StatusServiceUnavailable, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts++
+
+				// Every attempt must carry the full form body
+				if err := r.ParseForm(); err != nil || r.FormValue("land[]") != "NL" {
+					http.Error(w, "missing form body", http.StatusBadRequest)
+					return
+				}
+
+				if attempts <= tt.failures {
+					http.Error(w, "busy", http.StatusServiceUnavailable)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			config := CreateTestConfig()
+			config.RetryCount = tt.retryCount
+			config.RetryBackoff = time.Millisecond
+			config.Verbose = true
+			downloader := NewDownloader(config)
+
+			resp, err := downloader.doWithRetry(func() (*http.Request, error) {
+				req, err := http.NewRequest("POST", server.URL, strings.NewReader("land%5B%5D=NL"))
+				if err != nil {
+					return nil, err
+				}
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				return req, nil
+			})
+			AssertNoError(t, err)
+			if resp == nil {
+				t.Fatal("doWithRetry() returned nil response")
+			}
+			defer func() { _ = resp.Body.Close() }()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestSCDBDownloader_doWithRetryNetworkError(t *testing.T) {
+	// Grab a free address and close it so connections are refused
+	server := httptest.NewServer(http.NotFoundHandler())
+	addr := server.URL
+	server.Close()
+
+	config := CreateTestConfig()
+	config.RetryCount = 2
+	config.RetryBackoff = time.Millisecond
+	downloader := NewDownloader(config)
+
+	built := 0
+	_, err := downloader.doWithRetry(func() (*http.Request, error) {
+		built++
+		return http.NewRequest("GET", addr, nil)
+	})
+	if err == nil {
+		t.Fatal("doWithRetry() expected error for refused connection, got nil")
+	}
+	if built != 3 {
+		t.Errorf("requests built = %d, want 3", built)
+	}
+}
+
+func TestRequestError(t *testing.T) {
+	refused := &url.Error{Op: "Post", URL: "https://www.scdb.info/my/downloadsection", Err: errors.New("connection refused")}
+	tests := []struct {
+		name string
+		resp *http.Response
+		err  error
+		want string
+		// The error the result must wrap, if any
+		wraps error
+	}{
+		{"Transport error", nil, refused, "download fixed: POST /my/downloadsection: connection refused", refused.Err},
+		{"Status", &http.Response{StatusCode: 503, Status: "503 Service Unavailable"}, nil, "download fixed: POST /my/downloadsection: 503 Service Unavailable", nil},
+		{"Status without text", &http.Response{StatusCode: 503}, nil, "download fixed: POST /my/downloadsection: 503 Service Unavailable", nil},
+		{"Status and error", &http.Response{StatusCode: 400, Status: "400 Bad Request"}, ErrNotAZip, "download fixed: POST /my/downloadsection: 400 Bad Request: not a valid ZIP archive", ErrNotAZip},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := requestError("download fixed", "POST", downloadSectionPath, tt.resp, tt.err)
+			if err.Error() != tt.want {
+				t.Errorf("requestError() = %q, want %q", err, tt.want)
+			}
+			if tt.wraps != nil && !errors.Is(err, tt.wraps) {
+				t.Errorf("requestError() = %v, does not wrap %v", err, tt.wraps)
+			}
+		})
+	}
+
+	t.Run("Run", func(t *testing.T) {
+		mockServer := NewMockSCDBServer()
+		defer mockServer.Close()
+		mockServer.failMobile = true
+
+		config := CreateTestConfig()
+		config.OutputDir = t.TempDir()
+		config.DownloadFixed = false
+		err := CreateMockDownloader(config, mockServer).RunContext(context.Background())
+
+		var reqErr *RequestError
+		if !errors.As(err, &reqErr) {
+			t.Fatalf("RunContext() error = %v, want a RequestError", err)
+		}
+		if reqErr.Op != "download mobile" || reqErr.Path != mobileDownloadPath || reqErr.StatusCode != http.StatusInternalServerError {
+			t.Errorf("RequestError = %+v, want download mobile of %s with status 500", reqErr, mobileDownloadPath)
+		}
+		AssertErrorContains(t, err, "download mobile: POST "+mobileDownloadPath+": 500 Internal Server Error")
+	})
+}
+
+func TestSCDBDownloader_RequestDelay(t *testing.T) {
+	t.Run("Concurrent requests share the rate", func(t *testing.T) {
+		var mu sync.Mutex
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests++
+			mu.Unlock()
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		const workers = 4
+		config := CreateTestConfig()
+		config.RequestDelay = 30 * time.Millisecond
+		downloader := NewDownloader(config)
+
+		start := time.Now()
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, err := downloader.doWithRetry(func() (*http.Request, error) {
+					return http.NewRequest("GET", server.URL, nil)
+				})
+				if err != nil {
+					t.Errorf("doWithRetry() error = %v", err)
+					return
+				}
+				_ = resp.Body.Close()
+			}()
+		}
+		wg.Wait()
+
+		if requests != workers {
+			t.Errorf("requests = %d, want %d", requests, workers)
+		}
+		if elapsed, want := time.Since(start), (workers-1)*config.RequestDelay; elapsed < want {
+			t.Errorf("%d requests took %s, want at least %s", workers, elapsed, want)
+		}
+	})
+
+	t.Run("Waiting stops when the context is done", func(t *testing.T) {
+		var throttle requestThrottle
+		AssertNoError(t, throttle.wait(context.Background(), time.Hour))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := throttle.wait(ctx, time.Hour); err != context.DeadlineExceeded {
+			t.Errorf("wait() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+
+	t.Run("Zero delay never waits", func(t *testing.T) {
+		var throttle requestThrottle
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		for i := 0; i < 3; i++ {
+			AssertNoError(t, throttle.wait(ctx, 0))
+		}
+	})
+}
+
+func TestSCDBDownloader_MaxRate(t *testing.T) {
+	const rate = 64 << 10
+	// The full bucket covers the first second, the rest takes half a second more
+	content := bytes.Repeat([]byte("x"), rate+rate/2)
+
+	config := CreateTestConfig()
+	config.MaxRate = rate
+	downloader := NewDownloader(config)
+	var reported []int64
+	downloader.ProgressFunc = func(written, total int64) {
+		reported = append(reported, written)
+	}
+
+	resp := &http.Response{Body: io.NopCloser(bytes.NewReader(content)), ContentLength: int64(len(content))}
+	start := time.Now()
+	n, err := io.Copy(io.Discard, downloader.responseBody(resp))
+	elapsed := time.Since(start)
+	AssertNoError(t, err)
+	if n != int64(len(content)) {
+		t.Errorf("copied %d bytes, want %d", n, len(content))
+	}
+	if want := 400 * time.Millisecond; elapsed < want {
+		t.Errorf("%d bytes at %d B/s took %s, want at least %s", n, rate, elapsed, want)
+	}
+	// Progress is counted behind the throttle, so it advances in steps of at most the rate
+	if len(reported) < 2 || reported[len(reported)-1] != n {
+		t.Errorf("progress reports = %v, want several ending at %d", reported, n)
+	}
+
+	// Cancelling the request ends a wait for the throttle
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	resp = &http.Response{Body: io.NopCloser(bytes.NewReader(content)), ContentLength: int64(len(content)), Request: req}
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start = time.Now()
+	_, err = io.Copy(io.Discard, NewDownloader(config).responseBody(resp))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("copy error after cancel = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Errorf("cancelled copy took %s, want it to stop at the cancel", elapsed)
+	}
+
+	// Without a rate the body is passed through
+	config.MaxRate = 0
+	body := io.NopCloser(strings.NewReader("x"))
+	if got := NewDownloader(config).responseBody(&http.Response{Body: body}); got != body {
+		t.Error("responseBody() wrapped the body without a rate or progress callback")
+	}
+}
+
+func TestProgressReaderTruncated(t *testing.T) {
+	var last [2]int64
+	body := io.MultiReader(strings.NewReader("abcd"), iotest.ErrReader(io.ErrUnexpectedEOF))
+	_, err := io.Copy(io.Discard, newProgressReader(body, 10, func(written, total int64) {
+		last = [2]int64{written, total}
+	}))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("copy error = %v, want io.ErrUnexpectedEOF", err)
+	}
+	// The last report shows where the body stopped, short of the total
+	if last != [2]int64{4, 10} {
+		t.Errorf("last progress report = %v, want [4 10]", last)
+	}
+}
+
+func TestSCDBDownloader_Check(t *testing.T) {
+	// statuses summarises results as "name=PASS|FAIL|SKIP" entries
+	statuses := func(results []CheckResult) []string {
+		var out []string
+		for _, r := range results {
+			status := "PASS"
+			if r.Err != nil {
+				status = "FAIL"
+			} else if r.Skipped {
+				status = "SKIP"
+			}
+			out = append(out, r.Name+"="+status)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name          string
+		username      string
+		validPassword string
+		want          []string
+	}{
+		{
+			name:     "All checks pass",
+			username: "testuser",
+			want:     []string{"Resolve host=PASS", "TLS=SKIP", "Login page=PASS", "CSRF token=PASS", "Log in=PASS", "Account page=PASS"},
+		},
+		{
+			name: "Without credentials the login is skipped",
+			want: []string{"Resolve host=PASS", "TLS=SKIP", "Login page=PASS", "CSRF token=PASS", "Log in=SKIP", "Account page=SKIP"},
+		},
+		{
+			name:          "Wrong password",
+			username:      "testuser",
+			validPassword: "other",
+			want:          []string{"Resolve host=PASS", "TLS=SKIP", "Login page=PASS", "CSRF token=PASS", "Log in=FAIL", "Account page=SKIP"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := NewMockSCDBServer()
+			defer mockServer.Close()
+			mockServer.validPassword = tt.validPassword
+
+			config := CreateTestConfig()
+			config.Username = tt.username
+			results := CreateMockDownloader(config, mockServer).Check(context.Background())
+
+			if got := statuses(results); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("Check() = %v, want %v", got, tt.want)
+			}
+			if passed := ChecksPassed(results); passed != (tt.validPassword == "") {
+				t.Errorf("ChecksPassed() = %v for %v", passed, statuses(results))
+			}
+			if _, fixed, mobile := mockServer.GetStats(); fixed+mobile != 0 {
+				t.Errorf("Check() sent %d downloads, want none", fixed+mobile)
+			}
+		})
+	}
+
+	t.Run("Maintenance", func(t *testing.T) {
+		mockServer := NewMockSCDBServer()
+		defer mockServer.Close()
+		mockServer.maintenance = true
+
+		results := CreateMockDownloader(CreateTestConfig(), mockServer).Check(context.Background())
+		want := "Login page=PASS CSRF token=FAIL Log in=SKIP Account page=SKIP"
+		if got := strings.Join(statuses(results)[2:], " "); got != want {
+			t.Errorf("Check() during maintenance = %s, want %s", got, want)
+		}
+		if err := results[3].Err; !errors.Is(err, ErrServerMaintenance) {
+			t.Errorf("CSRF token check error = %v, want ErrServerMaintenance", err)
+		}
+	})
+
+	t.Run("TLS", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`<html><body>no form here</body></html>`))
+		}))
+		defer server.Close()
+
+		for _, insecure := range []bool{false, true} {
+			config := CreateTestConfig()
+			config.BaseURL = server.URL
+			config.InsecureSkipTLS = insecure
+			config.RetryCount = 0
+			results := NewDownloader(config).Check(context.Background())
+
+			want := "TLS=FAIL Login page=SKIP CSRF token=SKIP Log in=SKIP Account page=SKIP"
+			if insecure {
+				want = "TLS=PASS Login page=PASS CSRF token=FAIL Log in=SKIP Account page=SKIP"
+			}
+			if got := strings.Join(statuses(results)[1:], " "); got != want {
+				t.Errorf("Check() with InsecureSkipTLS=%v = %s, want %s", insecure, got, want)
+			}
+		}
+	})
+}
+
+func TestNextBackoff(t *testing.T) {
+	tests := []struct {
+		delay time.Duration
+		want  time.Duration
+	}{
+		{0, 0},
+		{time.Second, 2 * time.Second},
+		{20 * time.Second, 40 * time.Second},
+		{40 * time.Second, maxRetryBackoff},
+		{maxRetryBackoff, maxRetryBackoff},
+	}
+
+	for _, tt := range tests {
+		if got := nextBackoff(tt.delay); got != tt.want {
+			t.Errorf("nextBackoff(%s) = %s, want %s", tt.delay, got, tt.want)
+		}
+	}
+}
+
+func TestTracingTransport(t *testing.T) {
+	mockServer := NewMockSCDBServer()
+	defer mockServer.Close()
+
+	config := CreateTestConfig()
+	config.BaseURL = mockServer.URL()
+	config.OutputDir = t.TempDir()
+	var trace bytes.Buffer
+	downloader := NewDownloader(config, WithHTTPClient(withTrace(mockServer.Client(), &trace)))
+	AssertNoError(t, downloader.Run())
+
+	out := trace.String()
+	for _, want := range []string{
+		"> GET /en/login/ HTTP/1.1",
+		"> POST /en/login/ HTTP/1.1",
+		"u_password=" + redacted,
+		"< HTTP/1.1 200 OK",
+		`name="` + mockServer.csrfToken + `"`, // the login page itself
+		"< Set-Cookie: " + redacted,
+		"> Cookie: " + redacted,
+		"< [body not shown: application/zip",
+		"* first response byte",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("trace does not contain %q", want)
+		}
+	}
+	for _, secret := range []string{config.Password, "test_session_id", "PK\x03\x04"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("trace contains %q:\n%s", secret, out)
+		}
+	}
+
+	// Tracing leaves the bodies for the client to read
+	AssertFileExists(t, filepath.Join(config.OutputDir, "garmin.zip"), 1)
+}
+
+func TestTracingTransportCompressedPage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		_, _ = gz.Write([]byte("<title>Login</title>"))
+		_ = gz.Close()
+	}))
+	defer server.Close()
+
+	var trace bytes.Buffer
+	config := CreateTestConfig()
+	config.BaseURL = server.URL
+	downloader := NewDownloader(config, WithHTTPClient(withTrace(server.Client(), &trace)))
+	_, body, err := downloader.getLoginPage(context.Background())
+	AssertNoError(t, err)
+
+	if !strings.Contains(trace.String(), "< <title>Login</title>") {
+		t.Errorf("trace does not show the decoded page:\n%s", trace.String())
+	}
+	if string(body) != "<title>Login</title>" {
+		t.Errorf("login page = %q after tracing, want the page", body)
+	}
+}
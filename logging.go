@@ -0,0 +1,43 @@
+package scdb
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// NewLogger builds the logger described by cfg.LogLevel and cfg.LogFormat, writing to w.
+// Without an explicit level, Verbose selects debug and anything else info.
+func NewLogger(w io.Writer, cfg *Config) (*slog.Logger, error) {
+	level, err := parseLogLevel(cfg.LogLevel, cfg.Verbose)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(cfg.LogFormat) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q (want text or json)", cfg.LogFormat)
+	}
+}
+
+// parseLogLevel converts a level name (debug, info, warn, error) to a slog.Level
+func parseLogLevel(name string, verbose bool) (slog.Level, error) {
+	if name == "" {
+		if verbose {
+			return slog.LevelDebug, nil
+		}
+		return slog.LevelInfo, nil
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q (want debug, info, warn or error)", name)
+	}
+	return level, nil
+}
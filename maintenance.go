@@ -0,0 +1,36 @@
+package scdb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maintenanceMarkers are lowercase fragments of the page SCDB serves for every URL while
+// the site is being maintained, in English and German
+var maintenanceMarkers = []string{
+	"maintenance",
+	"wartungsarbeiten",
+	"temporarily unavailable",
+	"be back soon",
+}
+
+// isMaintenancePage reports whether body is SCDB's maintenance page rather than the page
+// that was asked for. A page with the login form never is, whatever its text says.
+func isMaintenancePage(body []byte) bool {
+	if _, _, ok := findCSRFToken(body); ok {
+		return false
+	}
+	page := strings.ToLower(string(body))
+	for _, marker := range maintenanceMarkers {
+		if strings.Contains(page, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// maintenanceError wraps ErrServerMaintenance with the title and message of the
+// maintenance page
+func maintenanceError(body []byte) error {
+	return fmt.Errorf("%w: %s; try again later", ErrServerMaintenance, describeErrorPage(body))
+}
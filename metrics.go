@@ -0,0 +1,73 @@
+package scdb
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// WriteMetrics writes the outcome of a run to w in the Prometheus text format: whether it
+// succeeded, when it finished, the bytes downloaded per type and how long it took
+func WriteMetrics(w io.Writer, result *RunResult, success bool, finished time.Time) error {
+	bytesByType := map[string]int64{"fixed": 0, "mobile": 0}
+	for _, file := range result.Files {
+		// Files kept from an earlier run were not downloaded this time
+		if !file.Unchanged {
+			bytesByType[file.Type] += file.Bytes
+		}
+	}
+
+	successValue := 0
+	if success {
+		successValue = 1
+	}
+
+	var b strings.Builder
+	b.WriteString("# HELP scdb_last_run_success Whether the last SCDB download run succeeded (1) or failed (0).\n")
+	b.WriteString("# TYPE scdb_last_run_success gauge\n")
+	fmt.Fprintf(&b, "scdb_last_run_success %d\n", successValue)
+	b.WriteString("# HELP scdb_last_run_timestamp Unix time the last SCDB download run finished.\n")
+	b.WriteString("# TYPE scdb_last_run_timestamp gauge\n")
+	fmt.Fprintf(&b, "scdb_last_run_timestamp %d\n", finished.Unix())
+	b.WriteString("# HELP scdb_bytes_downloaded Bytes downloaded by the last SCDB download run.\n")
+	b.WriteString("# TYPE scdb_bytes_downloaded gauge\n")
+	for _, typ := range []string{"fixed", "mobile"} {
+		fmt.Fprintf(&b, "scdb_bytes_downloaded{type=%q} %d\n", typ, bytesByType[typ])
+	}
+	b.WriteString("# HELP scdb_run_duration_seconds Duration of the last SCDB download run.\n")
+	b.WriteString("# TYPE scdb_run_duration_seconds gauge\n")
+	fmt.Fprintf(&b, "scdb_run_duration_seconds %.3f\n", result.DurationSeconds)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeMetrics writes the metrics of a run to path, for node_exporter's textfile
+// collector. The file is written under a temporary name and renamed into place, so the
+// collector never reads a partial file.
+func writeMetrics(path string, result *RunResult, success bool, finished time.Time) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".scdb-metrics-*")
+	if err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if err := WriteMetrics(tmp, result, success, finished); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	// CreateTemp makes the file private; the collector may run as another user
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	return nil
+}
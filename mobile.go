@@ -0,0 +1,29 @@
+package scdb
+
+import "errors"
+
+// errMobileCountries explains why a country selection and the mobile download do not mix
+var errMobileCountries = errors.New("the mobile camera database always covers every country; the countries only select fixed cameras")
+
+// selectsCountries reports whether countries leaves out any of AllCountries
+func selectsCountries(countries []string) bool {
+	if len(countries) == 0 {
+		return false
+	}
+	selected := make(map[string]bool, len(countries))
+	for _, code := range countries {
+		selected[code] = true
+	}
+	for _, code := range allCountries {
+		if !selected[code] {
+			return true
+		}
+	}
+	return false
+}
+
+// mobileIgnoresCountries reports whether config downloads the mobile cameras while
+// selecting countries, which the mobile download cannot be limited to
+func mobileIgnoresCountries(config *Config) bool {
+	return config.DownloadMobile && selectsCountries(config.Countries)
+}
@@ -0,0 +1,49 @@
+package scdb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// displayTypeNames holds the names accepted for the display types, in code order (1-4)
+var displayTypeNames = []string{"split-all", "split-speed-red", "all-in-one", "all-in-one-alt"}
+
+// iconSizePixels holds the icon edge lengths in pixels, in icon size code order (1-5)
+var iconSizePixels = []int{22, 24, 32, 48, 80}
+
+// ParseDisplayType converts a display type code (1-4) or name such as split-all to its code
+func ParseDisplayType(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if code, err := strconv.Atoi(s); err == nil && code >= 1 && code <= len(displayTypeNames) {
+		return code, nil
+	}
+	for i, name := range displayTypeNames {
+		if s == name {
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("%w or one of %s (got %q)", ErrInvalidDisplayType, strings.Join(displayTypeNames, ", "), s)
+}
+
+// ParseIconSize converts an icon size code (1-5) or a pixel size (22, 24, 32, 48 or 80) to
+// its code
+func ParseIconSize(s string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err == nil {
+		if n >= 1 && n <= len(iconSizePixels) {
+			return n, nil
+		}
+		for i, pixels := range iconSizePixels {
+			if n == pixels {
+				return i + 1, nil
+			}
+		}
+	}
+
+	sizes := make([]string, len(iconSizePixels))
+	for i, pixels := range iconSizePixels {
+		sizes[i] = strconv.Itoa(pixels)
+	}
+	return 0, fmt.Errorf("%w or a pixel size of %s (got %q)", ErrInvalidIconSize, strings.Join(sizes, ", "), s)
+}
@@ -0,0 +1,202 @@
+package scdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// otpFieldNames are the input names, lowercase, a form asking for the one-time code of a
+// second login step may use
+var otpFieldNames = []string{
+	"otp",
+	"otp_code",
+	"u_otp",
+	"totp",
+	"2fa_code",
+	"auth_code",
+	"verification_code",
+	"email_code",
+}
+
+// otpForm is the form of a second login step: where it posts, the name of the code field
+// and the other fields a browser would send along with the code
+type otpForm struct {
+	action string
+	field  string
+	values url.Values
+}
+
+// findOTPForm looks for a form in body with one of otpFieldNames, keeping its hidden
+// fields and named submit buttons. A page with the password field is the login form
+// again, never a code form.
+func findOTPForm(body []byte) (*otpForm, bool) {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, false
+	}
+
+	var found *otpForm
+	var walk func(n *html.Node, form *otpForm) bool
+	walk = func(n *html.Node, form *otpForm) bool {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "form":
+				form = &otpForm{action: attribute(n, "action"), values: url.Values{}}
+			case "input", "button":
+				name := attribute(n, "name")
+				if name == "u_password" {
+					return false
+				}
+				if form != nil && name != "" {
+					inputType := strings.ToLower(attribute(n, "type"))
+					switch {
+					case isOTPField(name):
+						form.field = name
+						found = form
+					case inputType == "hidden" || inputType == "submit" || n.Data == "button":
+						form.values.Set(name, attribute(n, "value"))
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if !walk(c, form) {
+				return false
+			}
+		}
+		return true
+	}
+	if !walk(doc, nil) || found == nil {
+		return nil, false
+	}
+	return found, true
+}
+
+// isOTPField reports whether an input name is one of otpFieldNames
+func isOTPField(name string) bool {
+	for _, field := range otpFieldNames {
+		if strings.EqualFold(name, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// attribute returns the value of the attribute key of n, or ""
+func attribute(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// otpCode returns the code for a second login step: Config.OTP the first time it is
+// asked for, then whatever OTPFunc answers. OTPFunc gets ctx without the login timeout,
+// so the user can take as long as the code takes to arrive.
+func (d *SCDBDownloader) otpCode(ctx context.Context) (string, error) {
+	if d.config.OTP != "" && !d.otpUsed {
+		d.otpUsed = true
+		return d.config.OTP, nil
+	}
+	if d.OTPFunc == nil {
+		return "", fmt.Errorf("%w\nProvide it with -otp or SCDB_OTP", ErrOTPRequired)
+	}
+	code, err := d.OTPFunc(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to read login code: %w", err)
+	}
+	if code = strings.TrimSpace(code); code == "" {
+		return "", ErrOTPRequired
+	}
+	return code, nil
+}
+
+// otpPath resolves the action of form, shown on page, to a path on the configured base
+// URL. A form posting to another site is refused rather than sent the code.
+func (d *SCDBDownloader) otpPath(page *url.URL, form *otpForm) (string, error) {
+	target, err := page.Parse(form.action)
+	if err != nil {
+		return "", fmt.Errorf("invalid login code form action %q: %w", form.action, err)
+	}
+	base, err := url.Parse(d.url(""))
+	if err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(target.Host, base.Host) {
+		return "", fmt.Errorf("login code form posts to another site: %s", target.Host)
+	}
+	return strings.TrimPrefix(target.RequestURI(), strings.TrimSuffix(base.Path, "/")), nil
+}
+
+// submitOTP completes a login SCDB answered with a code form, shown on page, by posting
+// the one-time code. Success is judged like the password step: a redirect to /my/ or a
+// page without a login form. ctx bounds the wait for OTPFunc; the POST that follows gets
+// a login timeout of its own.
+func (d *SCDBDownloader) submitOTP(ctx context.Context, page *url.URL, form *otpForm) error {
+	d.logger.Info("login needs a one-time code", "field", form.field)
+
+	path, err := d.otpPath(page, form)
+	if err != nil {
+		return err
+	}
+	code, err := d.otpCode(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := d.loginContext(ctx)
+	defer cancel()
+
+	formData := url.Values{}
+	for name, values := range form.values {
+		formData[name] = values
+	}
+	formData.Set(form.field, code)
+
+	resp, err := d.doWithRetry(func() (*http.Request, error) {
+		req, err := d.newRequest(ctx, "POST", path, formData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create login code request: %w", err)
+		}
+		req.Header.Set("Referer", page.String())
+		return req, nil
+	})
+	if err != nil {
+		return requestError("login code", "POST", path, nil, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusFound {
+		return requestError("login code", "POST", path, resp, nil)
+	}
+	if redirectedToAccount(resp) {
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read login code response: %w", err)
+	}
+	if _, ok := findOTPForm(body); ok {
+		return fmt.Errorf("login failed: the login code was not accepted")
+	}
+	if isChallengePage(body) {
+		return d.challengeError()
+	}
+	if isLoginFailurePage(body) {
+		return fmt.Errorf("login failed: invalid credentials")
+	}
+	if landed := landingPath(resp); landed != "" && strings.Contains(landed, "/login") {
+		return fmt.Errorf("login failed: redirected back to %s", landed)
+	}
+	return nil
+}
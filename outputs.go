@@ -0,0 +1,56 @@
+package scdb
+
+import (
+	"path/filepath"
+)
+
+// OutputPaths returns the paths a run with the current configuration would write,
+// without downloading or creating anything: the archives named by
+// Config.FilenameTemplate in their type directories, the directories the fixed archives
+// are unpacked into with Config.Extract (ending in a separator), checksums.txt with
+// Config.Checksums, state.json with Config.OnlyChanged and the latest link with
+// Config.Archive. Archives that Config.ExtractOnly removes after unpacking are left out.
+// A run streaming to standard output writes just StdoutOutput.
+func (d *SCDBDownloader) OutputPaths() ([]string, error) {
+	if d.streaming() {
+		return []string{StdoutOutput}, nil
+	}
+
+	var paths []string
+	if d.config.DownloadFixed {
+		countries := []string{""}
+		if d.config.SeparateByCountry {
+			countries = d.config.Countries
+		}
+		for _, country := range countries {
+			path, err := d.outputPath("fixed", country)
+			if err != nil {
+				return nil, err
+			}
+			if !d.config.ExtractOnly {
+				paths = append(paths, path)
+			}
+			if d.config.Extract {
+				paths = append(paths, extractDir(path)+string(filepath.Separator))
+			}
+		}
+	}
+	if d.config.DownloadMobile {
+		path, err := d.outputPath("mobile", "")
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+
+	if d.config.Checksums {
+		paths = append(paths, filepath.Join(d.outputDir(), checksumsFile))
+	}
+	if d.config.OnlyChanged && d.config.DownloadFixed {
+		paths = append(paths, filepath.Join(d.typeOutputDir("fixed"), stateFile))
+	}
+	if d.config.Archive {
+		paths = append(paths, filepath.Join(d.config.OutputDir, latestDir))
+	}
+	return paths, nil
+}
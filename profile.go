@@ -0,0 +1,89 @@
+package scdb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultProfileName is the profile used when neither a profile nor
+// Config.DefaultProfile is given
+const DefaultProfileName = "default"
+
+// Profile holds the account and countries of one SCDB subscription, for config files
+// shared by several
+type Profile struct {
+	Username  string   `yaml:"username,omitempty"`
+	Password  string   `yaml:"password,omitempty"`
+	Countries []string `yaml:"countries,omitempty"`
+}
+
+// ApplyProfile copies the credentials and countries of the named profile over config's.
+// An empty name selects Config.DefaultProfile, or the profile named DefaultProfileName;
+// without either the config is left as it is. A profile with a username also replaces
+// the password, so another account's password is never used with it.
+func (c *Config) ApplyProfile(name string) error {
+	if name == "" {
+		name = c.defaultProfile()
+		if name == "" {
+			return nil
+		}
+	}
+
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return unknownProfileError(name, c.Profiles)
+	}
+
+	if profile.Username != "" {
+		c.Username = profile.Username
+		c.Password = profile.Password
+	} else if profile.Password != "" {
+		c.Password = profile.Password
+	}
+	if len(profile.Countries) > 0 {
+		countries, subs, err := ExpandCountriesWithSubstitutions(profile.Countries, c.Regions)
+		if err != nil {
+			return fmt.Errorf("invalid countries in profile %q: %w", name, err)
+		}
+		c.Countries = countries
+		c.CountrySubstitutions = subs
+	}
+	c.Profile = name
+	return nil
+}
+
+// defaultProfile returns Config.DefaultProfile, or DefaultProfileName if such a profile
+// exists
+func (c *Config) defaultProfile() string {
+	if c.DefaultProfile != "" {
+		return c.DefaultProfile
+	}
+	if _, ok := c.Profiles[DefaultProfileName]; ok {
+		return DefaultProfileName
+	}
+	return ""
+}
+
+// checkProfiles rejects a selected or default profile that is not defined
+func checkProfiles(config *Config) error {
+	for _, name := range []string{config.Profile, config.DefaultProfile} {
+		if _, ok := config.Profiles[name]; name != "" && !ok {
+			return unknownProfileError(name, config.Profiles)
+		}
+	}
+	return nil
+}
+
+// unknownProfileError reports a profile name missing from profiles, listing the defined ones
+func unknownProfileError(name string, profiles map[string]Profile) error {
+	if len(profiles) == 0 {
+		return fmt.Errorf("unknown profile %q: the config file defines no profiles", name)
+	}
+	names := make([]string, 0, len(profiles))
+	for n := range profiles {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("unknown profile %q (want %s)", name, strings.Join(names, ", "))
+}
@@ -0,0 +1,52 @@
+package scdb
+
+import (
+	"io"
+	"time"
+)
+
+const (
+	// progressBytes is how many bytes may be copied between progress callbacks
+	progressBytes = 512 * 1024
+	// progressInterval is the longest time between progress callbacks
+	progressInterval = 250 * time.Millisecond
+)
+
+// progressReader counts bytes read through it and reports them to a progress callback
+type progressReader struct {
+	r        io.Reader
+	total    int64
+	written  int64
+	reported int64
+	last     time.Time
+	fn       func(written, total int64)
+}
+
+// newProgressReader wraps r, reporting progress against total (-1 if unknown) to fn
+func newProgressReader(r io.Reader, total int64, fn func(written, total int64)) *progressReader {
+	return &progressReader{r: r, total: total, last: time.Now(), fn: fn}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.written += int64(n)
+
+	if err != nil {
+		// The size is known once the body is exhausted; any other error ends the
+		// download short, which the last report shows
+		if err == io.EOF && p.total < 0 {
+			p.total = p.written
+		}
+		p.report()
+	} else if p.written-p.reported >= progressBytes || time.Since(p.last) >= progressInterval {
+		p.report()
+	}
+
+	return n, err
+}
+
+func (p *progressReader) report() {
+	p.reported = p.written
+	p.last = time.Now()
+	p.fn(p.written, p.total)
+}
@@ -0,0 +1,45 @@
+package scdb
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// requestThrottle spaces the start of consecutive requests at least a given delay apart.
+// Each caller reserves the next free slot under the lock, so concurrent workers share one
+// global rate.
+type requestThrottle struct {
+	mu   sync.Mutex
+	next time.Time // earliest start of the next request
+}
+
+// wait blocks until a request may be sent, keeping delay between request starts. It
+// returns early with the context's error when ctx is done. A delay of zero never waits.
+func (t *requestThrottle) wait(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	start := time.Now()
+	if t.next.After(start) {
+		start = t.next
+	}
+	t.next = start.Add(delay)
+	t.mu.Unlock()
+
+	wait := time.Until(start)
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
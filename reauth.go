@@ -0,0 +1,41 @@
+package scdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// htmlPageError marks a download answered with an HTML page other than the download limit
+// or maintenance page, which is what SCDB serves once the session has expired
+type htmlPageError struct {
+	err error
+}
+
+func (e *htmlPageError) Error() string { return e.err.Error() }
+func (e *htmlPageError) Unwrap() error { return e.err }
+
+// withReauth runs download, which requests and saves one archive. With Config.AutoReauth
+// a download that got an HTML page is run once more after logging in again; should that
+// also get a page, its error is returned.
+func (d *SCDBDownloader) withReauth(ctx context.Context, download func() error) error {
+	err := download()
+	var pageErr *htmlPageError
+	if !d.config.AutoReauth || !errors.As(err, &pageErr) {
+		return err
+	}
+
+	d.logger.Warn("download returned an HTML page, logging in again", "error", err)
+	if loginErr := d.relogin(ctx); loginErr != nil {
+		return fmt.Errorf("%w; logging in again failed: %w", err, loginErr)
+	}
+	return download()
+}
+
+// relogin checks the session and logs in afresh if it has expired. Parallel downloads
+// that fail together log in once: the others find the new session valid.
+func (d *SCDBDownloader) relogin(ctx context.Context) error {
+	d.reauthMu.Lock()
+	defer d.reauthMu.Unlock()
+	return d.login(ctx)
+}
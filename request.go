@@ -0,0 +1,111 @@
+package scdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Site paths the downloader requests
+const (
+	loginPath           = "/en/login/"
+	accountPath         = "/my/"
+	downloadSectionPath = "/my/downloadsection"
+	mobileDownloadPath  = "/intern/download/garmin-mobile.zip"
+)
+
+// Headers sent with every request, matching a current desktop browser
+const (
+	userAgent      = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/139.0.0.0 Safari/537.36"
+	acceptHeader   = "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8"
+	acceptLanguage = "en-GB,en;q=0.9"
+)
+
+// Values of Config.FormEncoding
+const (
+	// FormURLEncoded sends forms as application/x-www-form-urlencoded, like the SCDB site
+	FormURLEncoded = "urlencoded"
+	// FormMultipart sends the download forms as multipart/form-data
+	FormMultipart = "multipart"
+)
+
+// checkFormEncoding rejects a Config.FormEncoding other than "", FormURLEncoded and
+// FormMultipart
+func checkFormEncoding(encoding string) error {
+	switch encoding {
+	case "", FormURLEncoded, FormMultipart:
+		return nil
+	}
+	return fmt.Errorf("invalid form encoding %q (want %s or %s)", encoding, FormURLEncoded, FormMultipart)
+}
+
+// newRequest builds a request for path on the configured base URL with the headers every
+// request carries. A non-nil form is sent as the POST body together with the Origin and
+// Referer a browser submitting the form would send. The login forms are always
+// urlencoded; the download forms use Config.FormEncoding.
+func (d *SCDBDownloader) newRequest(ctx context.Context, method, path string, form url.Values) (*http.Request, error) {
+	var body io.Reader
+	contentType := "application/x-www-form-urlencoded"
+	page, downloadForm := d.formPage(path)
+	downloadForm = downloadForm && page != loginPath
+	if form != nil {
+		if d.config.FormEncoding == FormMultipart && downloadForm {
+			var err error
+			if body, contentType, err = encodeMultipartForm(form); err != nil {
+				return nil, err
+			}
+		} else {
+			body = strings.NewReader(form.Encode())
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, d.url(path), body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", acceptHeader)
+	req.Header.Set("Accept-Language", acceptLanguage)
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+
+	if form != nil {
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Origin", d.url(""))
+		if page != "" {
+			req.Header.Set("Referer", d.url(page))
+		}
+	}
+	return req, nil
+}
+
+// encodeMultipartForm encodes form as a multipart/form-data body, returning the body and
+// its Content-Type. Fields are written in key order like url.Values.Encode, and repeated
+// fields such as land[] as one part per value.
+func encodeMultipartForm(form url.Values) (*bytes.Buffer, string, error) {
+	keys := make([]string, 0, len(form))
+	for key := range form {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for _, key := range keys {
+		for _, value := range form[key] {
+			if err := w.WriteField(key, value); err != nil {
+				return nil, "", fmt.Errorf("failed to encode form field %s: %w", key, err)
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", fmt.Errorf("failed to encode form: %w", err)
+	}
+	return &buf, w.FormDataContentType(), nil
+}
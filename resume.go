@@ -0,0 +1,130 @@
+package scdb
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// partialPath returns where an unfinished download of path is kept until it completes
+func partialPath(path string) string {
+	return path + ".partial"
+}
+
+// ifRangePath returns where the validator (ETag or Last-Modified) of the response that
+// started a partial download is stored. A partial download without one is not resumed.
+func ifRangePath(path string) string {
+	return partialPath(path) + ".if-range"
+}
+
+// setRangeHeader asks for the rest of an unfinished download of path. If-Range makes a
+// server whose file changed in the meantime send the whole new file instead.
+func setRangeHeader(req *http.Request, path string) {
+	if path == StdoutOutput {
+		return
+	}
+	info, err := os.Stat(partialPath(path))
+	if err != nil || info.Size() == 0 {
+		return
+	}
+	validator, err := os.ReadFile(ifRangePath(path))
+	if err != nil || strings.TrimSpace(string(validator)) == "" {
+		return
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", info.Size()))
+	req.Header.Set("If-Range", strings.TrimSpace(string(validator)))
+}
+
+// openPartial opens the partial file of path for the body of resp: appended to for a
+// 206 Partial Content that continues it, truncated otherwise. It returns the file, the
+// number of bytes already in it and the complete size (0 or -1 if unknown). hash is fed
+// the bytes already downloaded.
+func openPartial(resp *http.Response, path string, hash io.Writer) (*os.File, int64, int64, error) {
+	partial := partialPath(path)
+
+	if resp.StatusCode != http.StatusPartialContent {
+		out, err := os.Create(partial)
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("failed to create output file: %w", err)
+		}
+		// Only a response with a validator can be resumed safely
+		_ = os.Remove(ifRangePath(path))
+		if validator := rangeValidator(resp); validator != "" && resp.Header.Get("Accept-Ranges") == "bytes" {
+			_ = os.WriteFile(ifRangePath(path), []byte(validator+"\n"), 0644)
+		}
+		return out, 0, resp.ContentLength, nil
+	}
+
+	start, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+	info, err := os.Stat(partial)
+	if !ok || err != nil || start != info.Size() {
+		return nil, 0, 0, fmt.Errorf("cannot resume %s: unexpected Content-Range %q", path, resp.Header.Get("Content-Range"))
+	}
+
+	out, err := os.OpenFile(partial, os.O_RDWR|os.O_APPEND, 0)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to open partial download: %w", err)
+	}
+	if _, err := io.Copy(hash, io.NewSectionReader(out, 0, start)); err != nil {
+		_ = out.Close()
+		return nil, 0, 0, fmt.Errorf("failed to read partial download: %w", err)
+	}
+	return out, start, total, nil
+}
+
+// removePartial deletes the partial download of path and its validator
+func removePartial(path string) {
+	_ = os.Remove(partialPath(path))
+	_ = os.Remove(ifRangePath(path))
+}
+
+// canResume reports whether a partial download of path started by resp is worth keeping:
+// the server takes range requests and a validator was stored
+func canResume(resp *http.Response, path string) bool {
+	if resp.StatusCode != http.StatusPartialContent && resp.Header.Get("Accept-Ranges") != "bytes" {
+		return false
+	}
+	_, err := os.Stat(ifRangePath(path))
+	return err == nil
+}
+
+// rangeValidator returns the ETag of resp, or its Last-Modified date without one
+func rangeValidator(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+// parseContentRange parses a "bytes <first>-<last>/<total>" Content-Range header. total
+// is -1 when the server gives "*".
+func parseContentRange(header string) (start, total int64, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes ")
+	if !found {
+		return 0, 0, false
+	}
+	byteRange, size, found := strings.Cut(spec, "/")
+	if !found {
+		return 0, 0, false
+	}
+	first, _, found := strings.Cut(byteRange, "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false
+	}
+	if size == "*" {
+		return start, -1, true
+	}
+	total, err = strconv.ParseInt(size, 10, 64)
+	if err != nil || total <= start {
+		return 0, 0, false
+	}
+	return start, total, true
+}
@@ -0,0 +1,78 @@
+package scdb
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// maxRetryBackoff caps the exponential delay between retry attempts
+const maxRetryBackoff = time.Minute
+
+// doWithRetry sends the request produced by newReq, retrying network errors and 5xx
+// responses up to Config.RetryCount times. newReq is called for every attempt so a
+// request body consumed by a failed attempt is never re-read. Retrying stops as soon as
+// the request's context is done. Every attempt waits for its turn under Config.RequestDelay.
+// A gzip or deflate encoded response body is returned decoded.
+func (d *SCDBDownloader) doWithRetry(newReq func() (*http.Request, error)) (*http.Response, error) {
+	delay := d.config.RetryBackoff
+
+	for attempt := 1; ; attempt++ {
+		req, err := newReq()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := d.throttle.wait(req.Context(), d.config.RequestDelay); err != nil {
+			return nil, err
+		}
+		resp, err := d.client.Do(req)
+		ctx := req.Context()
+		if !isRetryable(resp, err) || attempt > d.config.RetryCount || ctx.Err() != nil {
+			if err == nil {
+				if err := decodeBody(resp); err != nil {
+					_ = resp.Body.Close()
+					return nil, err
+				}
+			}
+			return resp, err
+		}
+
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Status
+			// Drain the body so the connection can be reused
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		d.logger.Warn("request failed, retrying", "method", req.Method, "path", req.URL.Path,
+			"reason", reason, "attempt", attempt, "retries", d.config.RetryCount, "delay", delay)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = nextBackoff(delay)
+	}
+}
+
+// isRetryable reports whether a request outcome is a transient failure worth retrying
+func isRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode >= http.StatusInternalServerError
+}
+
+// nextBackoff doubles the retry delay, capped at maxRetryBackoff
+func nextBackoff(delay time.Duration) time.Duration {
+	delay *= 2
+	if delay > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	return delay
+}
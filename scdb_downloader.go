@@ -1,18 +1,26 @@
-package main
+package scdb
 
 import (
-	"bytes"
+	"archive/zip"
+	"context"
+	"crypto/sha256"
 	"crypto/tls"
-	"flag"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"maps"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
 	"os"
 	"path/filepath"
-	"regexp"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	yaml "gopkg.in/yaml.v2"
@@ -20,79 +28,359 @@ import (
 
 // Config holds the downloader configuration
 type Config struct {
-	Username         string   `yaml:"username"`
-	Password         string   `yaml:"password"`
-	OutputDir        string   `yaml:"output_dir"`
-	Countries        []string `yaml:"countries"`
-	DisplayType      int      `yaml:"display_type"`       // 1=Split all, 2=Split speed/red, 3=All in one, 4=All in one (alt icon)
-	DangerZones      bool     `yaml:"danger_zones"`       // Include danger zones
-	FranceDangerMode bool     `yaml:"france_danger_mode"` // true=Display as danger zone, false=Display correct position
-	IconSize         int      `yaml:"icon_size"`          // 1=22x22, 2=24x24, 3=32x32, 4=48x48, 5=80x80
-	WarningTime      int      `yaml:"warning_time"`       // Warning time in seconds (0 = disabled, default)
-	DownloadFixed    bool     `yaml:"download_fixed"`     // Download fixed speed cameras
-	DownloadMobile   bool     `yaml:"download_mobile"`    // Download mobile speed cameras
-	Verbose          bool     `yaml:"verbose"`            // Enable verbose output
-	ConfigFile       string   `yaml:"-"`                  // Config file path (not saved in config)
+	Username                 string                `yaml:"username"`
+	Password                 string                `yaml:"password"`
+	OTP                      string                `yaml:"-"`                           // One-time code for a second login step, used once
+	OutputDir                string                `yaml:"output_dir"`                  // Directory for the archives, or StdoutOutput to stream a single one
+	FixedOutputDir           string                `yaml:"fixed_output_dir,omitempty"`  // Directory for the fixed archives instead of OutputDir
+	MobileOutputDir          string                `yaml:"mobile_output_dir,omitempty"` // Directory for the mobile archive instead of OutputDir
+	Countries                []string              `yaml:"countries"`
+	CountrySubstitutions     []CountrySubstitution `yaml:"-"`                                     // Deprecated codes replaced while expanding Countries, logged by Run
+	Profiles                 map[string]Profile    `yaml:"profiles,omitempty"`                    // Accounts with their own credentials and countries, selected with ApplyProfile
+	DefaultProfile           string                `yaml:"default_profile,omitempty"`             // Profile used when none is selected ("" = the one named DefaultProfileName)
+	Profile                  string                `yaml:"-"`                                     // Profile applied by ApplyProfile (not saved in config)
+	Regions                  map[string][]string   `yaml:"regions,omitempty"`                     // User-defined regions; may reference built-in ones
+	SortCountries            bool                  `yaml:"sort_countries,omitempty"`              // Sort the expanded list instead of keeping input order
+	DisplayType              int                   `yaml:"display_type"`                          // 1=Split all, 2=Split speed/red, 3=All in one, 4=All in one (alt icon)
+	DangerZones              bool                  `yaml:"danger_zones"`                          // Include danger zones
+	FranceDangerMode         bool                  `yaml:"france_danger_mode"`                    // true=Display as danger zone, false=Display correct position
+	DangerZonesOnly          bool                  `yaml:"danger_zones_only,omitempty"`           // Experimental: ask for the danger zones alone, to garmin-dangerzones.zip; overrides DangerZones and FranceDangerMode
+	IconSize                 int                   `yaml:"icon_size"`                             // 1=22x22, 2=24x24, 3=32x32, 4=48x48, 5=80x80
+	WarningTime              int                   `yaml:"warning_time"`                          // Warning time in seconds (0 = disabled, default)
+	AcceptAgreement          bool                  `yaml:"accept_agreement"`                      // Accept SCDB's download agreement, required to download fixed cameras
+	WaiveRescission          bool                  `yaml:"waive_rescission"`                      // Waive the right of rescission (withdrawal) for the fixed download
+	DownloadFixed            bool                  `yaml:"download_fixed"`                        // Download fixed speed cameras
+	DownloadMobile           bool                  `yaml:"download_mobile"`                       // Download mobile speed cameras
+	StrictMobile             bool                  `yaml:"strict_mobile,omitempty"`               // Fail instead of warning when DownloadMobile is combined with a country selection, which it ignores
+	Verbose                  bool                  `yaml:"verbose"`                               // Enable verbose output
+	LogLevel                 string                `yaml:"log_level,omitempty"`                   // debug, info, warn or error (default: info, debug with Verbose)
+	LogFormat                string                `yaml:"log_format,omitempty"`                  // text or json (default: text)
+	BaseURL                  string                `yaml:"base_url,omitempty"`                    // SCDB site root (default: https://www.scdb.info)
+	InsecureSkipTLS          bool                  `yaml:"insecure_skip_tls,omitempty"`           // Skip TLS certificate verification (self-signed endpoints)
+	GeoIPURL                 string                `yaml:"geoip_url,omitempty"`                   // Country lookup for "-countries auto" ("" = DefaultGeoIPURL, GeoIPOff = disabled)
+	ProxyURL                 string                `yaml:"proxy_url,omitempty"`                   // http://, https:// or socks5:// proxy (default: HTTP_PROXY/HTTPS_PROXY)
+	Timeout                  time.Duration         `yaml:"timeout,omitempty"`                     // Overall HTTP client timeout per request (0 = none)
+	LoginTimeout             time.Duration         `yaml:"login_timeout,omitempty"`               // Timeout for each login request (0 = none)
+	RetryCount               int                   `yaml:"retry_count,omitempty"`                 // Extra attempts after a network error or 5xx response
+	RetryBackoff             time.Duration         `yaml:"retry_backoff,omitempty"`               // Delay before the first retry, doubled per attempt
+	SeparateByCountry        bool                  `yaml:"separate_by_country,omitempty"`         // Write one garmin-<CODE>.zip per country
+	Concurrency              int                   `yaml:"concurrency,omitempty"`                 // Parallel per-country downloads with SeparateByCountry (0 = 1)
+	MaxRate                  int64                 `yaml:"max_rate,omitempty"`                    // Cap on the download speed of all downloads together, in bytes per second (0 = unlimited)
+	MaxDownloadBytes         int64                 `yaml:"max_download_bytes,omitempty"`          // Fail a download larger than this many bytes, removing the partial file (0 = no cap)
+	MaxTotalBytes            int64                 `yaml:"max_total_bytes,omitempty"`             // Fail the run once its downloads add up to more than this many bytes (0 = no cap)
+	RequestDelay             time.Duration         `yaml:"request_delay,omitempty"`               // Minimum time between the starts of requests (0 = none)
+	SessionFile              string                `yaml:"session_file,omitempty"`                // Save and reuse the login session cookies here ("" = off)
+	Format                   string                `yaml:"format,omitempty"`                      // Navigation system the databases are made for, see Formats ("" = DefaultFormat)
+	FilenameTemplate         string                `yaml:"filename_template,omitempty"`           // text/template for archive names, see FilenameData ("" = DefaultFilenameTemplate)
+	UseServerFilename        bool                  `yaml:"use_server_filename,omitempty"`         // Name archives after the server's Content-Disposition header when it gives a safe .zip name
+	MaxAge                   time.Duration         `yaml:"max_age,omitempty"`                     // Skip downloading files modified less than this long ago (0 = always download)
+	FormEncoding             string                `yaml:"form_encoding,omitempty"`               // Encoding of the download forms: FormURLEncoded or FormMultipart ("" = FormURLEncoded)
+	PostDownloadCommand      string                `yaml:"post_download_command,omitempty"`       // Shell command run after a successful run, with SCDB_* variables naming the files
+	PostDownloadIgnoreErrors bool                  `yaml:"post_download_ignore_errors,omitempty"` // Only log a failing PostDownloadCommand instead of failing the run
+	MetricsFile              string                `yaml:"metrics_file,omitempty"`                // Write Prometheus metrics of each run here, for node_exporter's textfile collector
+	Archive                  bool                  `yaml:"archive,omitempty"`                     // Write each run to <OutputDir>/archive/<YYYY-MM-DD-HHMMSS>/ and link <OutputDir>/latest to it
+	Keep                     int                   `yaml:"keep,omitempty"`                        // With Archive, how many archived runs to keep (0 = all)
+	DryRun                   bool                  `yaml:"-"`                                     // Print requests instead of sending them
+	Diff                     bool                  `yaml:"-"`                                     // Compare a download with the existing file and replace it only when SCDBDownloader.DiffFunc agrees
+	Trace                    bool                  `yaml:"-"`                                     // Write every HTTP request and response to standard error, with passwords and cookies redacted
+	Force                    bool                  `yaml:"-"`                                     // Download even when the existing file looks up to date
+	SinceDate                string                `yaml:"since_date,omitempty"`                  // Ask for the cameras changed since this date, YYYY-MM-DD; ignored unless SCDB supports it ("" = all)
+	FormFields               map[string]string     `yaml:"form_fields,omitempty"`                 // Extra fixed camera form fields, for export options without a setting of their own
+	MobilePath               string                `yaml:"mobile_path,omitempty"`                 // Path of the mobile camera download on the SCDB site ("" = the one of Format)
+	MobileForm               map[string]string     `yaml:"mobile_form,omitempty"`                 // Fields of the mobile camera download form, replacing the default mobile_submit field
+	NoClobber                bool                  `yaml:"no_clobber,omitempty"`                  // Fail instead of replacing an existing archive
+	Backup                   bool                  `yaml:"backup,omitempty"`                      // Rename an existing archive to <name>.bak before replacing it
+	OnlyChanged              bool                  `yaml:"only_changed,omitempty"`                // With SeparateByCountry, keep country archives whose download matches the checksum in state.json
+	Clean                    bool                  `yaml:"clean,omitempty"`                       // Remove the archives of earlier runs once all downloads succeeded, and partial files after a failed run
+	VerifyZip                bool                  `yaml:"verify_zip"`                            // Reject downloads that are not valid ZIP archives
+	AutoReauth               bool                  `yaml:"auto_reauth"`                           // Log in again and retry a download once when it returns an HTML page instead of an archive
+	Extract                  bool                  `yaml:"extract,omitempty"`                     // Unpack fixed archives into a directory next to them
+	ExtractOnly              bool                  `yaml:"extract_only,omitempty"`                // Delete the archive after extracting it
+	Checksums                bool                  `yaml:"checksums,omitempty"`                   // Write checksums.txt next to the downloads
+	VerifyCountries          bool                  `yaml:"verify_countries,omitempty"`            // Warn about requested countries without an entry in the fixed archive
+	VerifyAgainst            string                `yaml:"verify_against,omitempty"`              // Manifest of known checksums; matching downloads are not rewritten
+	ConfigFile               string                `yaml:"-"`                                     // Config file path (not saved in config)
 }
 
+// Clone returns a deep copy of c: its slices and maps, those of the profiles and regions
+// included, are copied too, so changing the copy leaves c as it is
+func (c *Config) Clone() *Config {
+	if c == nil {
+		return nil
+	}
+	clone := *c
+	clone.Countries = slices.Clone(c.Countries)
+	clone.CountrySubstitutions = slices.Clone(c.CountrySubstitutions)
+	if c.Profiles != nil {
+		clone.Profiles = make(map[string]Profile, len(c.Profiles))
+		for name, profile := range c.Profiles {
+			profile.Countries = slices.Clone(profile.Countries)
+			clone.Profiles[name] = profile
+		}
+	}
+	if c.Regions != nil {
+		clone.Regions = make(map[string][]string, len(c.Regions))
+		for name, countries := range c.Regions {
+			clone.Regions[name] = slices.Clone(countries)
+		}
+	}
+	clone.FormFields = maps.Clone(c.FormFields)
+	clone.MobileForm = maps.Clone(c.MobileForm)
+	return &clone
+}
+
+// DefaultBaseURL is the SCDB site used when Config.BaseURL is empty
+const DefaultBaseURL = "https://www.scdb.info"
+
+// Default -timeout and -login-timeout values
+const (
+	DefaultTimeout      = 5 * time.Minute
+	DefaultLoginTimeout = 30 * time.Second
+)
+
 // SCDBDownloader handles the download process
 type SCDBDownloader struct {
 	client *http.Client
 	config *Config
+	logger *slog.Logger
+
+	// started is when the current Run began, for the {{.Date}} of archive names
+	started time.Time
+
+	// throttle enforces Config.RequestDelay across all requests, including concurrent ones
+	throttle requestThrottle
+	// bandwidth enforces Config.MaxRate across all downloads
+	bandwidth bandwidthLimiter
+
+	// mu guards files and state, which per-country workers update concurrently
+	mu sync.Mutex
+	// files collects the archives written during the current Run
+	files []FileResult
+	// mobileFile is where Config.UseServerFilename put the mobile archive, if it renamed it
+	mobileFile string
+	// downloaded counts the bytes received during the current Run, for Config.MaxTotalBytes
+	downloaded int64
+	// state holds the checksums of Config.OnlyChanged during a per-country download
+	state *countryState
+	// manifest holds the checksums loaded from Config.VerifyAgainst, keyed by base name
+	manifest map[string]string
+	// cookieStore keeps the login session instead of Config.SessionFile when set
+	cookieStore CookieStore
+	// loggedIn is set once a login succeeded, so later logins only check the session
+	loggedIn bool
+
+	// ProgressFunc, when set, is called periodically while a download is written to disk
+	// and once when it ends (total is -1 while unknown). Parallel downloads call it
+	// concurrently.
+	ProgressFunc func(written, total int64)
+
+	// OTPFunc, when set, is asked for the one-time code of a second login step once
+	// Config.OTP has been used or when it is empty
+	OTPFunc func(ctx context.Context) (string, error)
+	// DiffFunc, when set, is shown how a download differs from the file it would replace
+	// with Config.Diff and decides whether to replace it; without it the existing file
+	// is kept and the download saved as <file>.new. Calls are made one at a time.
+	DiffFunc func(path string, diff *ArchiveDiff) bool
+	// diffMu serializes the calls to DiffFunc
+	diffMu sync.Mutex
+	// reauthMu serializes the logins of Config.AutoReauth
+	reauthMu sync.Mutex
+
+	// otpUsed records that Config.OTP was sent, as a code is only good for one login
+	otpUsed bool
+}
+
+// Option customizes an SCDBDownloader created by NewDownloader
+type Option func(*SCDBDownloader)
+
+// WithHTTPClient makes the downloader send its requests through client instead of the
+// default one. The client should carry a cookie jar, since the SCDB session lives in cookies.
+func WithHTTPClient(client *http.Client) Option {
+	return func(d *SCDBDownloader) {
+		d.client = client
+	}
+}
+
+// WithLogger makes the downloader log through logger instead of the stderr logger
+// built from the config
+func WithLogger(logger *slog.Logger) Option {
+	return func(d *SCDBDownloader) {
+		d.logger = logger
+	}
+}
+
+// WithCookieStore makes the downloader save and reuse the login session in store instead
+// of Config.SessionFile, for example to keep it in a database
+func WithCookieStore(store CookieStore) Option {
+	return func(d *SCDBDownloader) {
+		d.cookieStore = store
+	}
 }
 
 // NewDownloader creates a new SCDB downloader instance
-func NewDownloader(cfg *Config) *SCDBDownloader {
+func NewDownloader(cfg *Config, opts ...Option) *SCDBDownloader {
+	d := &SCDBDownloader{
+		client: newHTTPClient(cfg),
+		config: cfg,
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	if cfg.Trace {
+		d.client = withTrace(d.client, os.Stderr)
+	}
+
+	if d.logger == nil {
+		logger, err := NewLogger(os.Stderr, cfg)
+		if err != nil {
+			// ValidateConfig reports bad log settings; fall back to the defaults here
+			logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+		}
+		d.logger = logger
+	}
+
+	return d
+}
+
+// newHTTPClient creates the default HTTP client with a session cookie jar, sending its
+// requests through the configured proxy
+func newHTTPClient(cfg *Config) *http.Client {
 	jar, _ := cookiejar.New(nil)
 
-	client := &http.Client{
-		Timeout: time.Minute * 5,
-		Jar:     jar,
+	proxy := http.ProxyFromEnvironment
+	if cfg.ProxyURL != "" {
+		// ValidateConfig reports a bad proxy URL; fall back to the environment here
+		if proxyURL, err := parseProxyURL(cfg.ProxyURL); err == nil {
+			proxy = http.ProxyURL(proxyURL)
+		}
+	}
+
+	return &http.Client{
+		Timeout: cfg.Timeout,
+		Jar:     newSessionJar(jar), // Records what the saved session needs
 		Transport: &http.Transport{
+			Proxy: proxy,
 			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true, // For self-signed certificates
+				InsecureSkipVerify: cfg.InsecureSkipTLS, // Opt-in, for self-signed endpoints
 			},
 		},
 	}
+}
 
-	return &SCDBDownloader{
-		client: client,
-		config: cfg,
+// parseProxyURL parses a proxy URL, accepting the schemes http.Transport can use
+func parseProxyURL(raw string) (*url.URL, error) {
+	proxyURL, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL %q: %w", raw, err)
 	}
+
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid proxy URL %q: scheme must be http, https or socks5", raw)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: missing host", raw)
+	}
+
+	return proxyURL, nil
 }
 
-// login authenticates with the SCDB website
-func (d *SCDBDownloader) login() error {
-	if d.config.Verbose {
-		fmt.Println("Logging in to SCDB...")
+// url builds an absolute URL for a site-relative path on the configured SCDB base URL
+func (d *SCDBDownloader) url(path string) string {
+	base := d.config.BaseURL
+	if base == "" {
+		base = DefaultBaseURL
 	}
+	return strings.TrimSuffix(base, "/") + path
+}
 
-	// First, GET the login page to extract the CSRF token
-	resp, err := d.client.Get("https://www.scdb.info/en/login/")
-	if err != nil {
-		return fmt.Errorf("failed to get login page: %w", err)
+// Login authenticates with the SCDB website, after which Client sends authenticated
+// requests. It reuses the session saved in Config.SessionFile while that is still
+// valid. Once logged in, calling Login again only checks the session against /my/ and
+// logs in afresh if it has expired; Run calls Login itself, so a Run after Login does
+// not log in twice.
+func (d *SCDBDownloader) Login(ctx context.Context) error {
+	return d.login(ctx)
+}
+
+// Client returns the HTTP client the downloader sends its requests with. Its cookie jar
+// holds the SCDB session after Login.
+func (d *SCDBDownloader) Client() *http.Client {
+	return d.client
+}
+
+// login authenticates with the SCDB website unless the downloader's session, or the one
+// saved in Config.SessionFile, is still valid
+func (d *SCDBDownloader) login(ctx context.Context) error {
+	if d.config.DryRun {
+		return d.authenticate(ctx)
 	}
-	defer func() { _ = resp.Body.Close() }()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read login page: %w", err)
+	if d.loggedIn {
+		if err := d.checkLoggedIn(ctx); err == nil {
+			d.logger.Debug("already logged in", "user", d.config.Username)
+			return nil
+		}
+		d.loggedIn = false
+	}
+
+	if !d.resumeSession(ctx) {
+		if err := d.authenticate(ctx); err != nil {
+			return err
+		}
+		d.saveSession()
+	}
+	d.loggedIn = true
+	return nil
+}
+
+// authenticate logs in with the configured username and password and verifies the new
+// session against /my/
+func (d *SCDBDownloader) authenticate(ctx context.Context) error {
+	d.logger.Info("logging in", "user", d.config.Username)
+
+	if d.config.DryRun {
+		// The CSRF token is only known after fetching the login page
+		d.printDryRun("POST", d.url(loginPath), url.Values{
+			"<csrf-token>": {"<csrf-token>"},
+			"u_name":       {d.config.Username},
+			"u_password":   {"REDACTED"},
+			"login_submit": {"Login"},
+		})
+		return nil
 	}
 
-	// Extract the dynamic CSRF token from the form
-	tokenPattern := regexp.MustCompile(`name="([a-f0-9]{40})" value="([a-f0-9]{40})"`)
-	matches := tokenPattern.FindStringSubmatch(string(body))
-	if len(matches) < 3 {
-		return fmt.Errorf("failed to find CSRF token in login page")
+	// A hung login should fail fast rather than wait for the download timeout. The code
+	// of a second login step and the session check that follows get a timeout of their
+	// own, as waiting for the user to enter the code must not use it up.
+	loginCtx, cancel := d.loginContext(ctx)
+	defer cancel()
+
+	// First, GET the login page to extract the CSRF token
+	_, body, err := d.getLoginPage(loginCtx)
+	if err != nil {
+		return err
 	}
 
-	tokenName := matches[1]
-	tokenValue := matches[2]
+	if isMaintenancePage(body) {
+		return maintenanceError(body)
+	}
 
-	if d.config.Verbose {
-		fmt.Printf("Found CSRF token: %s=%s\n", tokenName, tokenValue)
+	// Extract the dynamic CSRF token from the form; only a page without it can be a
+	// challenge in its place
+	tokenName, tokenValue, err := extractCSRFToken(body)
+	if err != nil {
+		if isChallengePage(body) {
+			return d.challengeError()
+		}
+		return err
 	}
 
+	d.logger.Debug("found CSRF token", "name", tokenName)
+
 	// Prepare login form data with a dynamic token
 	formData := url.Values{
 		tokenName:      []string{tokenValue},
@@ -101,53 +389,313 @@ func (d *SCDBDownloader) login() error {
 		"login_submit": []string{"Login"},
 	}
 
-	req, err := http.NewRequest("POST", "https://www.scdb.info/en/login/",
-		bytes.NewBufferString(formData.Encode()))
+	resp, err := d.doWithRetry(func() (*http.Request, error) {
+		req, err := d.newRequest(loginCtx, "POST", loginPath, formData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create login request: %w", err)
+		}
+		return req, nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to create login request: %w", err)
+		return requestError("login", "POST", loginPath, nil, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// Check if login was successful by following redirects
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusFound {
+		return requestError("login", "POST", loginPath, resp, nil)
 	}
 
-	// Set headers
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/139.0.0.0 Safari/537.36")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8")
-	req.Header.Set("Accept-Language", "en-GB,en;q=0.9")
-	req.Header.Set("Origin", "https://www.scdb.info")
-	req.Header.Set("Referer", "https://www.scdb.info/en/login/")
+	// SCDB answers wrong credentials with 200 and the login form again, so only a
+	// redirect to /my/ or a page without the login form counts as success
+	if !redirectedToAccount(resp) {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read login response: %w", err)
+		}
 
-	resp, err = d.client.Do(req)
+		// An account with a second login step gets a form asking for a one-time code,
+		// possibly on a page below the login path
+		if form, ok := findOTPForm(body); ok {
+			page, _ := url.Parse(d.url(loginPath))
+			if resp.Request != nil {
+				page = resp.Request.URL
+			}
+			if err := d.submitOTP(ctx, page, form); err != nil {
+				return err
+			}
+		} else {
+			// A redirect chain that ends on the login page means the session was not accepted
+			if landed := landingPath(resp); landed != "" && strings.Contains(landed, "/login") {
+				return fmt.Errorf("login failed: redirected back to %s", landed)
+			}
+			if isChallengePage(body) {
+				return d.challengeError()
+			}
+			if isLoginFailurePage(body) {
+				return fmt.Errorf("login failed: invalid credentials")
+			}
+		}
+	}
+
+	if resp.Request != nil {
+		d.logger.Debug("login landed", "path", resp.Request.URL.Path)
+	}
+
+	// Make sure the session cookie actually authenticates us before downloading
+	if err := d.checkLoggedIn(ctx); err != nil {
+		return err
+	}
+
+	d.logger.Info("login successful")
+
+	return nil
+}
+
+// getLoginPage fetches the login page, returning the response (its body already closed)
+// together with the page
+func (d *SCDBDownloader) getLoginPage(ctx context.Context) (*http.Response, []byte, error) {
+	resp, err := d.doWithRetry(func() (*http.Request, error) {
+		return d.newRequest(ctx, "GET", loginPath, nil)
+	})
 	if err != nil {
-		return fmt.Errorf("login request failed: %w", err)
+		return nil, nil, requestError("login page", "GET", loginPath, nil, err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 
-	// Check if login was successful by following redirects
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusFound {
-		return fmt.Errorf("login failed with status: %d", resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read login page: %w", err)
 	}
+	return resp, body, nil
+}
+
+// checkLoggedIn verifies the current session by fetching the /my/ account page, which
+// SCDB redirects to the login page for anonymous visitors
+func (d *SCDBDownloader) checkLoggedIn(ctx context.Context) error {
+	ctx, cancel := d.loginContext(ctx)
+	defer cancel()
 
-	if d.config.Verbose {
-		fmt.Println("Login successful!")
+	resp, err := d.doWithRetry(func() (*http.Request, error) {
+		return d.newRequest(ctx, "GET", accountPath, nil)
+	})
+	if err != nil {
+		return requestError("session check", "GET", accountPath, nil, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.Request != nil && strings.Contains(resp.Request.URL.Path, "/login") {
+		return fmt.Errorf("session is not authenticated: /my/ redirected to %s", resp.Request.URL.Path)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return requestError("session check", "GET", accountPath, resp, nil)
 	}
 
 	return nil
 }
 
+// loginContext derives the context for login requests from ctx, bounded by
+// Config.LoginTimeout when it is set
+func (d *SCDBDownloader) loginContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if d.config.LoginTimeout > 0 {
+		return context.WithTimeout(ctx, d.config.LoginTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// loginErrorMarkers are lowercase phrases SCDB shows when a login attempt is rejected
+var loginErrorMarkers = []string{
+	"invalid username or password",
+	"wrong username or password",
+	"incorrect password",
+	"login failed",
+	"benutzername oder passwort",
+}
+
+// redirectedToAccount reports whether a login response ended up on the /my/ account area
+func redirectedToAccount(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusFound {
+		return strings.Contains(resp.Header.Get("Location"), accountPath)
+	}
+	return resp.Request != nil && strings.HasPrefix(resp.Request.URL.Path, accountPath)
+}
+
+// landingPath returns the final path of a response reached through redirects, or ""
+// when the response answers the original request directly
+func landingPath(resp *http.Response) string {
+	if resp.Request == nil || resp.Request.Response == nil {
+		return ""
+	}
+	return resp.Request.URL.Path
+}
+
+// hasLoginForm reports whether a page holds the login form's password field
+func hasLoginForm(body []byte) bool {
+	return strings.Contains(strings.ToLower(string(body)), `name="u_password"`)
+}
+
+// isLoginFailurePage reports whether a page is the login form redisplayed or shows a
+// known login error message
+func isLoginFailurePage(body []byte) bool {
+	if hasLoginForm(body) {
+		return true
+	}
+	page := strings.ToLower(string(body))
+	for _, marker := range loginErrorMarkers {
+		if strings.Contains(page, marker) {
+			return true
+		}
+	}
+	return false
+}
+
 // downloadFixed downloads the fixed speed camera database
-func (d *SCDBDownloader) downloadFixed() error {
-	if d.config.Verbose {
-		fmt.Println("Downloading fixed speed cameras...")
+func (d *SCDBDownloader) downloadFixed(ctx context.Context) error {
+	if d.config.SeparateByCountry {
+		return d.downloadFixedPerCountry(ctx)
+	}
+
+	d.logger.Info("downloading fixed speed cameras", "countries", len(d.config.Countries))
+
+	outputPath, err := d.outputPath("fixed", "")
+	if err != nil {
+		return err
+	}
+	return d.downloadFixedCountries(ctx, d.config.Countries, outputPath)
+}
+
+// downloadFixedPerCountry downloads one archive per selected country, running up
+// to Config.Concurrency downloads at once. Failures do not stop the remaining countries;
+// they are returned together at the end, in country order.
+func (d *SCDBDownloader) downloadFixedPerCountry(ctx context.Context) error {
+	workers := max(d.config.Concurrency, 1)
+	countries := d.config.Countries
+	d.logger.Info("downloading fixed speed cameras per country", "countries", len(countries), "concurrency", workers)
+
+	if d.config.OnlyChanged && !d.config.DryRun {
+		if err := d.prepareCountryState(); err != nil {
+			return err
+		}
+		defer func() { d.state = nil }()
+	}
+
+	errs := make([]error, len(countries))
+	jobs := make(chan int)
+	// limitReached stops handing out countries: the remaining ones would hit the same limit
+	var limitReached atomic.Bool
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if limitReached.Load() {
+					continue
+				}
+				errs[i] = d.downloadCountry(ctx, countries[i])
+				if errors.Is(errs[i], ErrDownloadLimitReached) {
+					limitReached.Store(true)
+				}
+			}
+		}()
 	}
 
-	// Build country selection
+	for i := range countries {
+		// Cancellation ends the whole run rather than failing each remaining country
+		if ctx.Err() != nil || limitReached.Load() {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	// The countries that succeeded are recorded even when others failed
+	if err := d.saveCountryState(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// downloadCountry downloads the fixed cameras of a single country, by default to
+// garmin-<CODE>.zip
+func (d *SCDBDownloader) downloadCountry(ctx context.Context, country string) error {
+	outputPath, err := d.outputPath("fixed", country)
+	if err != nil {
+		return fmt.Errorf("%s: %w", country, err)
+	}
+	if err := d.downloadFixedCountries(ctx, []string{country}, outputPath); err != nil {
+		d.logger.Error("country download failed", "country", countryLabel(country), "error", err)
+		return fmt.Errorf("%s: %w", country, err)
+	}
+
+	d.logger.Debug("country downloaded", "country", countryLabel(country), "path", outputPath)
+	return nil
+}
+
+// sinceFormField is the fixed camera form field carrying Config.SinceDate
+const sinceFormField = "since"
+
+// dangerZonesOnlyFormField is the fixed camera form field asking for the danger zones
+// alone, for Config.DangerZonesOnly. The name is not confirmed against the SCDB site,
+// which ignores fields it does not know.
+const dangerZonesOnlyFormField = "dangerzones_only"
+
+// managedFormFields are the fixed camera form fields buildFixedForm fills in from the
+// settings, with the option that sets each; Config.FormFields may not replace them
+var managedFormFields = map[string]string{
+	"download_agreement_accept":         "-accept-agreement",
+	"download_wave_right_of_rescission": "-waive-rescission",
+	"typ":                               "-display",
+	"dangerzones":                       "-dangerzones",
+	"vorwarnzeit":                       "-warningtime",
+	"iconsize":                          "-iconsize",
+	"france_danger":                     "-francedanger",
+	"land[]":                            "-countries",
+	"download_start":                    "",
+	sinceFormField:                      "-since",
+	dangerZonesOnlyFormField:            "-dangerzones-only",
+}
+
+// checkFormFields rejects extra form fields without a name or that would replace a field
+// the settings control
+func checkFormFields(fields map[string]string) error {
+	for _, name := range slices.Sorted(maps.Keys(fields)) {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("form field name cannot be empty")
+		}
+		flag, managed := managedFormFields[name]
+		if !managed {
+			continue
+		}
+		if flag == "" {
+			return fmt.Errorf("form field %q is set by the downloader and cannot be changed", name)
+		}
+		return fmt.Errorf("form field %q is set by %s; use that option instead", name, flag)
+	}
+	return nil
+}
+
+// buildFixedForm returns the fixed camera download form for the given countries, as the
+// download page would post it with the configured options
+func (d *SCDBDownloader) buildFixedForm(countries []string) url.Values {
 	formData := url.Values{
-		"download_agreement_accept":         {"1"},
-		"download_wave_right_of_rescission": {"1"},
-		"typ":                               {fmt.Sprintf("%d", d.config.DisplayType)},
-		"dangerzones":                       {"1"}, // Default to enabled, will be overridden below
-		"vorwarnzeit":                       {fmt.Sprintf("%d", d.config.WarningTime)},
-		"iconsize":                          {fmt.Sprintf("%d", d.config.IconSize)},
-		"download_start":                    {"Download+Now"},
+		"download_agreement_accept": {"1"}, // run refuses to start without AcceptAgreement
+		"typ":                       {fmt.Sprintf("%d", d.config.DisplayType)},
+		"dangerzones":               {"1"}, // Default to enabled, will be overridden below
+		"vorwarnzeit":               {fmt.Sprintf("%d", d.config.WarningTime)},
+		"iconsize":                  {fmt.Sprintf("%d", d.config.IconSize)},
+		"download_start":            {"Download+Now"},
+	}
+
+	// Like an unticked checkbox, the waiver is left out unless the user gave it
+	if d.config.WaiveRescission {
+		formData.Set("download_wave_right_of_rescission", "1")
 	}
 
 	// Add France-specific danger zone handling
@@ -164,122 +712,560 @@ func (d *SCDBDownloader) downloadFixed() error {
 		formData.Set("dangerzones", "0")
 	}
 
+	// The zones alone: on, with every French camera as a zone rather than its position
+	if d.config.DangerZonesOnly {
+		formData.Set("dangerzones", "1")
+		formData.Set("france_danger", "1")
+		formData.Set(dangerZonesOnlyFormField, "1")
+	}
+
 	// Add countries
-	for _, country := range d.config.Countries {
+	for _, country := range countries {
 		formData.Add("land[]", country)
 	}
 
-	req, err := http.NewRequest("POST", "https://www.scdb.info/my/downloadsection",
-		bytes.NewBufferString(formData.Encode()))
-	if err != nil {
-		return fmt.Errorf("failed to create download request: %w", err)
+	// SCDB's form has no such field yet; the server ignores fields it does not know
+	if d.config.SinceDate != "" {
+		formData.Set(sinceFormField, d.config.SinceDate)
+	}
+
+	// Sub-options of the export the settings do not model, as given by the user
+	for name, value := range d.config.FormFields {
+		formData.Set(name, value)
+	}
+
+	return formData
+}
+
+// buildMobileForm returns the mobile camera download form: Config.MobileForm, or
+// defaultMobileForm when it is empty
+func (d *SCDBDownloader) buildMobileForm() url.Values {
+	fields := d.config.MobileForm
+	if len(fields) == 0 {
+		fields = defaultMobileForm
+	}
+	formData := url.Values{}
+	for name, value := range fields {
+		formData.Set(name, value)
 	}
+	return formData
+}
+
+// downloadFixedCountries downloads the fixed cameras for the given countries to outputPath
+func (d *SCDBDownloader) downloadFixedCountries(ctx context.Context, countries []string, outputPath string) error {
+	formData := d.buildFixedForm(countries)
 
-	// Set headers
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/139.0.0.0 Safari/537.36")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8")
-	req.Header.Set("Origin", "https://www.scdb.info")
-	req.Header.Set("Referer", "https://www.scdb.info/my/downloadsection")
+	if skip, err := d.keepFresh(outputPath); skip || err != nil {
+		return err
+	}
+
+	if d.config.DryRun {
+		d.printDryRun("POST", d.url(d.format().fixedPath), formData)
+		return nil
+	}
+
+	path := d.format().fixedPath
+	err := d.withReauth(ctx, func() error {
+		resp, err := d.doWithRetry(func() (*http.Request, error) {
+			req, err := d.newRequest(ctx, "POST", path, formData)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create download request: %w", err)
+			}
+			d.setConditionalHeaders(req, outputPath)
+			setRangeHeader(req, outputPath)
+			return req, nil
+		})
+		if err != nil {
+			return requestError("download fixed", "POST", path, nil, err)
+		}
+		defer func() { _ = resp.Body.Close() }()
 
-	resp, err := d.client.Do(req)
+		// Save to file
+		outputPath = d.serverOutputPath(resp, outputPath)
+		return downloadError("download fixed", path, resp, d.saveResponseToFile(resp, outputPath))
+	})
 	if err != nil {
-		return fmt.Errorf("download request failed: %w", err)
+		return err
+	}
+
+	if d.config.VerifyCountries {
+		d.verifyCountries(outputPath, countries)
 	}
-	defer func() { _ = resp.Body.Close() }()
 
-	// Save to file
-	outputPath := filepath.Join(d.config.OutputDir, "garmin.zip")
-	return d.saveResponseToFile(resp, outputPath)
+	if d.config.Extract {
+		return d.extractArchive(outputPath)
+	}
+	return nil
 }
 
-// downloadMobile downloads the mobile speed camera database
-func (d *SCDBDownloader) downloadMobile() error {
-	if d.config.Verbose {
-		fmt.Println("Downloading mobile speed cameras...")
+// extractArchive unpacks a downloaded archive into extractDir(archive) and, in
+// extract-only mode, removes the archive afterwards
+func (d *SCDBDownloader) extractArchive(archive string) error {
+	dir := extractDir(archive)
+	if err := extractZip(archive, dir); err != nil {
+		return fmt.Errorf("failed to extract %s: %w", archive, err)
 	}
+	d.logger.Info("archive extracted", "path", archive, "dir", dir)
 
-	formData := url.Values{
-		"mobile_submit": {"Download+For+Free"},
+	if !d.config.ExtractOnly {
+		return nil
 	}
 
-	req, err := http.NewRequest("POST", "https://www.scdb.info/intern/download/garmin-mobile.zip",
-		bytes.NewBufferString(formData.Encode()))
-	if err != nil {
-		return fmt.Errorf("failed to create mobile download request: %w", err)
+	if err := os.Remove(archive); err != nil {
+		return fmt.Errorf("failed to remove %s after extraction: %w", archive, err)
 	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	kept := d.files[:0]
+	for _, file := range d.files {
+		if file.Path != archive {
+			kept = append(kept, file)
+		}
+	}
+	d.files = kept
+	return nil
+}
 
-	// Set headers
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/139.0.0.0 Safari/537.36")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8")
-	req.Header.Set("Origin", "https://www.scdb.info")
-	req.Header.Set("Referer", "https://www.scdb.info/my/")
+// addFile records an archive written (or kept) by the current run
+func (d *SCDBDownloader) addFile(file FileResult) {
+	file.Type = "fixed"
+	// A download Config.Diff kept beside the existing file takes the type of that file
+	path := strings.TrimSuffix(file.Path, newArchiveSuffix)
+	if d.streaming() {
+		// Streaming downloads only one of the two
+		if !d.config.DownloadFixed {
+			file.Type = "mobile"
+		}
+	} else if mobile, err := d.outputPath("mobile", ""); err == nil && path == mobile {
+		// The filename template never gives fixed and mobile archives the same name
+		file.Type = "mobile"
+	}
 
-	resp, err := d.client.Do(req)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.mobileFile != "" && path == d.mobileFile {
+		file.Type = "mobile"
+	}
+	d.files = append(d.files, file)
+}
+
+// downloadMobile downloads the mobile speed camera database
+func (d *SCDBDownloader) downloadMobile(ctx context.Context) error {
+	d.logger.Info("downloading mobile speed cameras")
+
+	outputPath, err := d.outputPath("mobile", "")
 	if err != nil {
-		return fmt.Errorf("mobile download request failed: %w", err)
+		return err
+	}
+	formData := d.buildMobileForm()
+
+	if skip, err := d.keepFresh(outputPath); skip || err != nil {
+		return err
+	}
+
+	if d.config.DryRun {
+		d.printDryRun("POST", d.url(d.mobilePath()), formData)
+		return nil
 	}
-	defer func() { _ = resp.Body.Close() }()
 
-	// Save to file
-	outputPath := filepath.Join(d.config.OutputDir, "garmin-mobile.zip")
-	return d.saveResponseToFile(resp, outputPath)
+	path := d.mobilePath()
+	return d.withReauth(ctx, func() error {
+		resp, err := d.doWithRetry(func() (*http.Request, error) {
+			req, err := d.newRequest(ctx, "POST", path, formData)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create mobile download request: %w", err)
+			}
+			d.setConditionalHeaders(req, outputPath)
+			setRangeHeader(req, outputPath)
+			return req, nil
+		})
+		if err != nil {
+			return requestError("download mobile", "POST", path, nil, err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		// Save to file
+		if serverPath := d.serverOutputPath(resp, outputPath); serverPath != outputPath {
+			d.mu.Lock()
+			d.mobileFile = serverPath
+			d.mu.Unlock()
+			outputPath = serverPath
+		}
+		return downloadError("download mobile", path, resp, d.saveResponseToFile(resp, outputPath))
+	})
+}
+
+// downloadError returns the error of saving the response to a download request, a
+// RequestError when the server answered with an error status
+func downloadError(op, path string, resp *http.Response, err error) error {
+	if err == nil || resp.StatusCode < http.StatusBadRequest {
+		return err
+	}
+	return requestError(op, "POST", path, resp, err)
+}
+
+// printDryRun shows a request that dry-run mode would otherwise have sent
+func (d *SCDBDownloader) printDryRun(method, target string, form url.Values) {
+	out := os.Stdout
+	if d.streaming() {
+		// Standard output is reserved for the archive
+		out = os.Stderr
+	}
+	_, _ = fmt.Fprintf(out, "[dry-run] %s %s\n", method, target)
+	_, _ = fmt.Fprintf(out, "[dry-run]   %s\n", form.Encode())
 }
 
 // saveResponseToFile saves the HTTP response body to a file
 func (d *SCDBDownloader) saveResponseToFile(resp *http.Response, filepath string) error {
 	// Check content type and response
 	contentType := resp.Header.Get("Content-Type")
-	if d.config.Verbose {
-		fmt.Printf("Response status: %d, Content-Type: %s\n", resp.StatusCode, contentType)
+	d.logger.Debug("download response", "status", resp.StatusCode, "content_type", contentType)
+
+	if d.upToDate(resp, filepath) {
+		sum, size, err := fileSHA256(filepath)
+		if err != nil {
+			return fmt.Errorf("failed to read existing file: %w", err)
+		}
+		removePartial(filepath)
+		d.recordCountryState(filepath, sum)
+		d.logger.Info("up to date", "path", filepath)
+		d.addFile(FileResult{Path: filepath, Bytes: size, SHA256: sum, Unchanged: true})
+		return nil
+	}
+
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		removePartial(filepath)
+		return fmt.Errorf("cannot resume %s: the server rejected the range, the next attempt starts over", filepath)
 	}
 
 	if !strings.Contains(contentType, "zip") && !strings.Contains(contentType, "octet") {
-		// Read the response body for an error message
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("unexpected response (not a zip file), Content-Type: %s, Body: %s", contentType, string(body))
+		// Summarise the page for the error; the full body is only worth a debug log
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		d.logger.Debug("unexpected response body", "body", string(body))
+		if isMaintenancePage(body) {
+			return maintenanceError(body)
+		}
+		// The login form means the session expired, whatever else the page says, and is
+		// left to Config.AutoReauth
+		if !hasLoginForm(body) && isDownloadLimitPage(body) {
+			return fmt.Errorf("%w: %s", ErrDownloadLimitReached, describeErrorPage(body))
+		}
+		var err error
+		if summary := describeErrorPage(body); summary != "" {
+			err = fmt.Errorf("unexpected response (%w): %q (HTTP %d, Content-Type: %s)", ErrNotAZip, summary, resp.StatusCode, contentType)
+		} else {
+			err = fmt.Errorf("unexpected response (%w): HTTP %d, Content-Type: %s", ErrNotAZip, resp.StatusCode, contentType)
+		}
+		if strings.Contains(contentType, "html") {
+			return &htmlPageError{err: err}
+		}
+		return err
+	}
+
+	if filepath == StdoutOutput {
+		return d.streamResponse(resp)
 	}
 
-	out, err := os.Create(filepath)
+	// Refuse before reading the body, so an existing file is never touched
+	if err := d.checkClobber(filepath); err != nil {
+		return err
+	}
+
+	// Write to a partial file and rename it into place only once every check has
+	// passed, so the output is either complete or absent and an existing file survives
+	// a failed download. An interrupted transfer from a server that takes range requests
+	// keeps the partial file for the next attempt to resume; anything else removes it.
+	tmpPath := partialPath(filepath)
+	hash := sha256.New()
+	out, offset, total, err := openPartial(resp, filepath, hash)
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
+		removePartial(filepath)
+		return err
+	}
+	keepPartial := false
+	defer func() {
+		if !keepPartial {
+			removePartial(filepath)
+		}
+	}()
+	if offset > 0 {
+		d.logger.Info("resuming download", "path", filepath, "offset", offset)
 	}
-	defer func() { _ = out.Close() }()
 
-	written, err := io.Copy(out, resp.Body)
+	// Refuse a download known to be too large before writing any of it
+	sizeErr := d.checkDownloadSize(filepath, offset, total)
+	if sizeErr == nil {
+		sizeErr = checkDiskSpace(tmpPath, total-offset)
+	}
+	if sizeErr != nil {
+		_ = out.Close()
+		return sizeErr
+	}
+
+	written, err := io.Copy(io.MultiWriter(out, hash), d.limitedBody(d.responseBody(resp), filepath, offset))
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
+		// A download over the size cap would only grow past it again
+		keepPartial = !errors.Is(err, ErrDownloadTooLarge) && canResume(resp, filepath)
 		return fmt.Errorf("failed to save file: %w", err)
 	}
+	written += offset
+	if total > 0 && written != total {
+		keepPartial = canResume(resp, filepath)
+		return fmt.Errorf("incomplete download of %s: received %d of %d bytes", filepath, written, total)
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	// The content type alone is no guarantee (the mobile endpoint sends
+	// application/octetstream), so check the archive itself
+	if d.config.VerifyZip {
+		if err := verifyZipFile(tmpPath); err != nil {
+			return err
+		}
+	}
+
+	if d.unchangedCountry(filepath, sum) {
+		storeValidators(resp, filepath)
+		d.logger.Info("country unchanged, keeping existing file", "path", filepath, "sha256", sum)
+		d.addFile(FileResult{Path: filepath, Bytes: written, SHA256: sum, Unchanged: true})
+		return nil
+	}
+
+	if d.matchesManifest(filepath, sum) {
+		storeValidators(resp, filepath)
+		d.logger.Info("download unchanged, keeping existing file", "path", filepath, "sha256", sum)
+		d.addFile(FileResult{Path: filepath, Bytes: written, SHA256: sum, Unchanged: true})
+		return nil
+	}
+
+	if d.config.Diff {
+		replace, err := d.confirmReplace(filepath, tmpPath)
+		if err != nil {
+			return err
+		}
+		if !replace {
+			// Validators are not stored: they would describe the file that was kept
+			newPath := newArchivePath(filepath)
+			if err := os.Rename(tmpPath, newPath); err != nil {
+				return fmt.Errorf("failed to save file: %w", err)
+			}
+			d.logger.Info("existing file kept, download saved beside it", "path", filepath, "new", newPath)
+			d.addFile(FileResult{Path: newPath, Bytes: written, SHA256: sum})
+			return nil
+		}
+		_ = os.Remove(newArchivePath(filepath))
+	}
+
+	if d.config.Backup {
+		backedUp, err := backupExisting(filepath)
+		if err != nil {
+			return err
+		}
+		if backedUp {
+			d.logger.Info("existing file backed up", "path", filepath, "backup", backupPath(filepath))
+		}
+	}
 
-	if d.config.Verbose {
-		fmt.Printf("Downloaded %d bytes to %s\n", written, filepath)
+	if err := os.Rename(tmpPath, filepath); err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
 	}
 
+	storeValidators(resp, filepath)
+	d.recordCountryState(filepath, sum)
+	d.logger.Info("download saved", "path", filepath, "bytes", written, "sha256", sum)
+	d.addFile(FileResult{Path: filepath, Bytes: written, SHA256: sum})
+
 	return nil
 }
 
+// matchesManifest reports whether the existing file at path is listed in the
+// -verify-against manifest with checksum sum
+func (d *SCDBDownloader) matchesManifest(path, sum string) bool {
+	want, ok := d.manifest[filepath.Base(path)]
+	if !ok || want != sum {
+		return false
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// checkOutputDir creates dir if needed and makes sure files can be written to it
+func checkOutputDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	f, err := os.CreateTemp(dir, ".scdb-write-check-*")
+	if err != nil {
+		return fmt.Errorf("output directory %s is not writable: %w", dir, err)
+	}
+	_ = f.Close()
+	return os.Remove(f.Name())
+}
+
+// verifyZipFile checks that the file at path can be opened as a ZIP archive
+func verifyZipFile(path string) error {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("downloaded file %s is %w: %w", path, ErrNotAZip, err)
+	}
+	return r.Close()
+}
+
 // Run executes the download process
 func (d *SCDBDownloader) Run() error {
-	// Login first
-	if err := d.login(); err != nil {
+	return d.RunContext(context.Background())
+}
+
+// RunContext executes the download process, aborting the requests in flight when ctx is
+// canceled. A partially written file is never left in place of an output file; it is
+// kept as <file>.partial only when the next run can resume it.
+func (d *SCDBDownloader) RunContext(ctx context.Context) error {
+	_, err := d.RunWithResult(ctx)
+	return err
+}
+
+// FileResult describes an archive written by a run
+type FileResult struct {
+	Path      string `json:"path"`
+	Type      string `json:"type"` // "fixed" or "mobile"
+	Bytes     int64  `json:"bytes"`
+	SHA256    string `json:"sha256"`
+	Unchanged bool   `json:"unchanged,omitempty"` // Existing file kept: up to date on the server, matched the manifest or still fresh
+}
+
+// RunResult is a machine-readable summary of a run
+type RunResult struct {
+	Countries       []string     `json:"countries"`
+	FixedAttempted  bool         `json:"fixed_attempted"`
+	MobileAttempted bool         `json:"mobile_attempted"`
+	Files           []FileResult `json:"files"`
+	DurationSeconds float64      `json:"duration_seconds"`
+	Errors          []string     `json:"errors,omitempty"`
+}
+
+// RunWithResult performs the same steps as Run and also reports what happened. The
+// result is returned even when the run fails.
+func (d *SCDBDownloader) RunWithResult(ctx context.Context) (*RunResult, error) {
+	start := time.Now()
+	d.started = start
+	d.files = nil
+	d.mobileFile = ""
+	d.downloaded = 0
+	result := &RunResult{Countries: d.config.Countries}
+
+	err := d.run(ctx, result)
+	if err != nil && d.config.Clean && !d.config.DryRun {
+		d.removePartials()
+	}
+
+	result.Files = d.files
+	if result.Files == nil {
+		result.Files = []FileResult{}
+	}
+	finished := time.Now()
+	result.DurationSeconds = finished.Sub(start).Seconds()
+	if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+	}
+
+	if d.config.MetricsFile != "" && !d.config.DryRun {
+		if metricsErr := writeMetrics(d.config.MetricsFile, result, err == nil, finished); metricsErr != nil {
+			d.logger.Error("metrics not written", "path", d.config.MetricsFile, "error", metricsErr)
+		} else {
+			d.logger.Debug("metrics written", "path", d.config.MetricsFile)
+		}
+	}
+	return result, err
+}
+
+// run logs in and downloads the selected databases, recording the attempts in result
+func (d *SCDBDownloader) run(ctx context.Context, result *RunResult) error {
+	d.manifest = nil
+	if d.config.VerifyAgainst != "" {
+		manifest, err := loadChecksums(d.config.VerifyAgainst)
+		if err != nil {
+			return err
+		}
+		d.manifest = manifest
+	}
+
+	if d.config.DownloadFixed && !d.config.AcceptAgreement {
+		return fmt.Errorf("%w: set Config.AcceptAgreement", ErrAgreementNotAccepted)
+	}
+	logCountrySubstitutions(d.logger, d.config.CountrySubstitutions)
+	if d.config.DangerZonesOnly && d.config.DownloadFixed {
+		d.logger.Warn("the danger zones only download is experimental; SCDB may ignore it and send every camera", "field", dangerZonesOnlyFormField)
+	}
+
+	// Fail before logging in rather than after using up a download (a dry run writes nothing)
+	if !d.config.DryRun && !d.streaming() {
+		dir := d.outputDir()
+		for _, typeDir := range d.outputDirs() {
+			if err := checkOutputDir(typeDir); err != nil {
+				return err
+			}
+		}
+		if d.config.Archive {
+			// Only removes the directory if the run failed before writing anything
+			defer func() { _ = os.Remove(dir) }()
+		}
+	}
+
+	if mobileIgnoresCountries(d.config) {
+		d.logger.Warn("mobile cameras are not filtered by country", "reason", errMobileCountries, "countries", len(d.config.Countries))
+	}
+
+	// Login first, unless -max-age leaves nothing to download
+	if d.allFresh() {
+		d.logger.Info("all files are fresh, skipping login", "max_age", d.config.MaxAge)
+	} else if err := d.login(ctx); err != nil {
 		return fmt.Errorf("login failed: %w", err)
 	}
 
 	// Download fixed cameras if requested
 	if d.config.DownloadFixed {
-		if err := d.downloadFixed(); err != nil {
+		result.FixedAttempted = true
+		if err := d.downloadFixed(ctx); err != nil {
 			return fmt.Errorf("failed to download fixed cameras: %w", err)
 		}
 	}
 
 	// Download mobile cameras if requested
 	if d.config.DownloadMobile {
-		if err := d.downloadMobile(); err != nil {
+		result.MobileAttempted = true
+		if err := d.downloadMobile(ctx); err != nil {
 			return fmt.Errorf("failed to download mobile cameras: %w", err)
 		}
 	}
 
+	if d.config.Checksums && !d.config.DryRun {
+		path := filepath.Join(d.outputDir(), checksumsFile)
+		if err := writeChecksums(path, d.files); err != nil {
+			return err
+		}
+		d.logger.Info("checksums written", "path", path)
+	}
+
+	// Only a run that got every download replaces the archives of earlier runs
+	if d.config.Clean {
+		if err := d.cleanOutputs(); err != nil {
+			return err
+		}
+	}
+
+	if d.config.Archive && !d.config.DryRun {
+		if err := d.finishArchive(); err != nil {
+			return err
+		}
+	}
+
+	if d.config.PostDownloadCommand != "" && !d.config.DryRun {
+		return d.runPostDownloadCommand(ctx)
+	}
+
 	return nil
 }
 
@@ -310,70 +1296,368 @@ var (
 		"westeurope":   {"B", "NL", "L", "FR", "D", "A", "CH", "I", "ES", "P", "GB", "IRL"},
 		"easteurope":   {"PL", "CZ", "SK", "H", "RO", "BG", "HR", "SLO", "EST", "LV", "LT", "BY", "UA", "RUS"},
 		"scandinavia":  {"SE", "NO", "DK", "FI", "IS"},
+		"baltics":      {"EST", "LV", "LT"},
+		"iberia":       {"ES", "P"},
+		"balkans":      {"HR", "SLO", "BIH", "SRB", "MK", "BG", "RO", "GR"},
+		"alps":         {"CH", "A", "LI", "FR", "I", "D"},
+		"uk_ireland":   {"GB", "IRL", "GBZ"}, // United Kingdom/Ireland/Gibraltar
+		// The 27 European Union member states
+		"eu": {"A", "B", "BG", "HR", "CY", "CZ", "DK", "EST", "FI", "FR", "D", "GR", "H", "IRL",
+			"I", "LV", "LT", "L", "M", "NL", "PL", "P", "RO", "SK", "SLO", "ES", "SE"},
 	}
 )
 
-// getAllCountries returns all available country codes
-func getAllCountries() []string {
-	return allCountries
+// Presets are looked up before country codes, so a preset named like a code would hide
+// that country. Fail as soon as the package loads rather than download the wrong countries.
+func init() {
+	if err := checkRegionNames(regionMap); err != nil {
+		panic("scdb: built-in " + err.Error())
+	}
+}
+
+// AllCountries returns all available country codes
+func AllCountries() []string {
+	return slices.Clone(allCountries)
 }
 
-// expandCountries expands regional presets to individual country codes
-func expandCountries(input []string) ([]string, error) {
+// PrintCountries writes every supported country code and name in sorted order
+func PrintCountries(w io.Writer) {
+	codes := append([]string(nil), allCountries...)
+	sort.Strings(codes)
+
+	_, _ = fmt.Fprintf(w, "Available country codes (%d):\n", len(codes))
+	for i, code := range codes {
+		_, _ = fmt.Fprintf(w, "  %-4s %-24s", code, CountryName(code))
+		if (i+1)%3 == 0 || i == len(codes)-1 {
+			_, _ = fmt.Fprintln(w)
+		}
+	}
+}
+
+// PrintRegions writes every regional preset with its member country codes
+func PrintRegions(w io.Writer) {
+	names := make([]string, 0, len(regionMap))
+	for name := range regionMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	_, _ = fmt.Fprintf(w, "Available regions (%d):\n", len(names))
+	for _, name := range names {
+		_, _ = fmt.Fprintf(w, "  %-13s %s\n", name, strings.Join(regionMap[name], ", "))
+	}
+}
+
+// ExpandCountries expands regional presets to individual country codes. Items that are
+// neither a region nor a code are matched against country names. Items with a leading
+// "-" are exclusions, removed from the result after all inclusions are expanded.
+func ExpandCountries(input []string) ([]string, error) {
+	return ExpandCountriesWith(input, nil)
+}
+
+// ExpandCountriesWith expands input like ExpandCountries, resolving the names in
+// userRegions first so they take precedence over the built-in presets
+func ExpandCountriesWith(input []string, userRegions map[string][]string) ([]string, error) {
+	countries, _, err := ExpandCountriesWithSubstitutions(input, userRegions)
+	return countries, err
+}
+
+// ExpandCountriesWithSubstitutions expands input like ExpandCountriesWith and also
+// returns the deprecated codes it replaced or dropped, in input order, for the caller to
+// report (see Config.CountrySubstitutions)
+func ExpandCountriesWithSubstitutions(input []string, userRegions map[string][]string) ([]string, []CountrySubstitution, error) {
+	if err := checkRegionNames(userRegions); err != nil {
+		return nil, nil, err
+	}
+	r := newRegionResolver(userRegions)
 	var result []string
+	excluded := make(map[string]bool)
+
 	for _, item := range input {
-		lowerItem := strings.ToLower(item)
-		if countries, exists := regionMap[lowerItem]; exists {
-			result = append(result, countries...)
-		} else {
-			// Check if it's a valid country code
-			found := false
-			for _, validCode := range allCountries {
-				if strings.ToUpper(item) == validCode {
-					result = append(result, validCode)
-					found = true
-					break
-				}
+		// Entries from config files and country files may carry stray spaces
+		item = strings.TrimSpace(item)
+		if name, ok := strings.CutPrefix(item, "-"); ok {
+			codes, err := r.resolve(strings.TrimSpace(name))
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid exclusion: %w", err)
+			}
+			for _, code := range codes {
+				excluded[code] = true
 			}
-			if !found {
-				return nil, fmt.Errorf("invalid country/region: %s", item)
+			continue
+		}
+
+		codes, err := r.resolve(item)
+		if err != nil {
+			return nil, nil, err
+		}
+		result = append(result, codes...)
+	}
+
+	if len(excluded) > 0 {
+		kept := result[:0]
+		for _, code := range result {
+			if !excluded[code] {
+				kept = append(kept, code)
 			}
 		}
+		result = kept
 	}
-	return removeDuplicates(result), nil
+
+	return DeduplicateStable(result), r.substitutions, nil
 }
 
-// removeDuplicates removes duplicate country codes
-func removeDuplicates(countries []string) []string {
-	keys := make(map[string]bool)
-	var result []string
-	for _, country := range countries {
-		if !keys[country] {
-			keys[country] = true
-			result = append(result, country)
+// regionResolver expands user-defined regions, which may refer to each other and to the
+// built-in presets
+type regionResolver struct {
+	user          map[string][]string   // keyed by lowercase name
+	path          []string              // regions being expanded, to detect cycles
+	substitutions []CountrySubstitution // deprecated codes met so far
+}
+
+// newRegionResolver creates a resolver for the given user regions
+func newRegionResolver(userRegions map[string][]string) *regionResolver {
+	user := make(map[string][]string, len(userRegions))
+	for name, members := range userRegions {
+		user[strings.ToLower(name)] = members
+	}
+	return &regionResolver{user: user}
+}
+
+// resolve expands a user region recursively, or falls back to resolveCountryItem
+func (r *regionResolver) resolve(item string) ([]string, error) {
+	name := strings.ToLower(item)
+	members, ok := r.user[name]
+	if !ok {
+		return r.resolveCountryItem(item)
+	}
+
+	if slices.Contains(r.path, name) {
+		return nil, fmt.Errorf("region cycle: %s -> %s", strings.Join(r.path, " -> "), name)
+	}
+	r.path = append(r.path, name)
+	defer func() { r.path = r.path[:len(r.path)-1] }()
+
+	var codes []string
+	for _, member := range members {
+		resolved, err := r.resolve(strings.TrimSpace(member))
+		if err != nil {
+			return nil, fmt.Errorf("region %q: %w", name, err)
 		}
+		codes = append(codes, resolved...)
 	}
-	return result
+	return codes, nil
 }
 
-// loadConfigFile loads configuration from YAML file
-func loadConfigFile(filename string) (*Config, error) {
-	data, err := os.ReadFile(filename)
+// OverriddenRegions returns the user region names that shadow a built-in preset, sorted
+func OverriddenRegions(userRegions map[string][]string) []string {
+	var names []string
+	for name := range userRegions {
+		if _, exists := regionMap[strings.ToLower(name)]; exists {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkRegionNames rejects a region named like a country code, which the code could
+// then no longer select
+func checkRegionNames(regions map[string][]string) error {
+	for _, name := range slices.Sorted(maps.Keys(regions)) {
+		for _, code := range allCountries {
+			if strings.EqualFold(strings.TrimSpace(name), code) {
+				return fmt.Errorf("region %q has the name of the country code %s", name, code)
+			}
+		}
+	}
+	return nil
+}
+
+// resolveCountryItem resolves "all", a single region, country code or country name to
+// codes, recording a deprecated code it replaces
+func (r *regionResolver) resolveCountryItem(item string) ([]string, error) {
+	if strings.EqualFold(item, "all") {
+		return AllCountries(), nil
+	}
+
+	if countries, exists := regionMap[strings.ToLower(item)]; exists {
+		return countries, nil
+	}
+
+	// Check if it's a valid country code
+	for _, validCode := range allCountries {
+		if strings.ToUpper(item) == validCode {
+			return []string{validCode}, nil
+		}
+	}
+
+	if codes, sub, ok := resolveDeprecatedCountry(item); ok {
+		r.substitutions = append(r.substitutions, sub)
+		return codes, nil
+	}
+
+	// Fall back to a full or partial country name
+	code, err := lookupCountryName(item)
 	if err != nil {
 		return nil, err
 	}
+	return []string{code}, nil
+}
 
-	var config Config
-	err = yaml.Unmarshal(data, &config)
+// ReadCountriesFile reads country codes, names or regions from a file, one per line.
+// Blank lines and lines starting with '#' are skipped.
+func ReadCountriesFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing config file: %w", err)
+		return nil, fmt.Errorf("failed to read countries file: %w", err)
 	}
 
+	var items []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		items = append(items, line)
+	}
+	return items, nil
+}
+
+// DeduplicateStable returns the distinct elements of items in the order they first
+// appear. items is left unchanged.
+func DeduplicateStable[T comparable](items []T) []T {
+	seen := make(map[T]bool, len(items))
+	var result []T
+	for _, item := range items {
+		if !seen[item] {
+			seen[item] = true
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// LoadConfigFile loads configuration from YAML file
+func LoadConfigFile(filename string) (*Config, error) {
+	var config Config
+	if err := MergeConfigFile(&config, filename); err != nil {
+		return nil, err
+	}
 	return &config, nil
 }
 
-// saveConfigFile saves configuration to YAML file
-func saveConfigFile(config *Config, filename string) error {
+// MergeConfigFile overlays the settings in a YAML file onto config; keys missing from the
+// file keep their current values. Countries and regions in the file are validated and
+// expanded to canonical codes. A file with an "extends" key naming another config file,
+// relative to its own directory, is overlaid on that base file.
+func MergeConfigFile(config *Config, filename string) error {
+	return mergeConfigFile(config, filename, nil)
+}
+
+// mergeConfigFile merges filename after the base files it extends. chain holds the
+// absolute paths of the files extending it, to detect cycles.
+func mergeConfigFile(config *Config, filename string, chain []string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %w", err)
+	}
+
+	var header struct {
+		Extends string `yaml:"extends"`
+	}
+	if err := yaml.Unmarshal(data, &header); err != nil {
+		return fmt.Errorf("error parsing config file %s: %w", filename, err)
+	}
+	if header.Extends != "" {
+		abs, err := filepath.Abs(filename)
+		if err != nil {
+			return fmt.Errorf("error resolving config file %s: %w", filename, err)
+		}
+		chain = append(chain, abs)
+
+		base := header.Extends
+		if !filepath.IsAbs(base) {
+			base = filepath.Join(filepath.Dir(abs), base)
+		}
+		if slices.Contains(chain, base) {
+			return fmt.Errorf("config file extends cycle: %s -> %s", strings.Join(chain, " -> "), base)
+		}
+		if err := mergeConfigFile(config, base, chain); err != nil {
+			return fmt.Errorf("config file %s extends %s: %w", filename, header.Extends, err)
+		}
+	}
+
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return fmt.Errorf("error parsing config file %s: %w", filename, err)
+	}
+
+	// Check every user region up front, not only the ones in use
+	if err := checkRegionNames(config.Regions); err != nil {
+		return fmt.Errorf("invalid regions in config file %s: %w", filename, err)
+	}
+	r := newRegionResolver(config.Regions)
+	for name := range config.Regions {
+		if _, err := r.resolve(name); err != nil {
+			return fmt.Errorf("invalid regions in config file %s: %w", filename, err)
+		}
+	}
+
+	if len(config.Countries) > 0 {
+		countries, subs, err := ExpandCountriesWithSubstitutions(config.Countries, config.Regions)
+		if err != nil {
+			return fmt.Errorf("invalid countries in config file %s: %w", filename, err)
+		}
+		config.Countries = countries
+		config.CountrySubstitutions = subs
+	}
+
+	for name, profile := range config.Profiles {
+		if _, err := ExpandCountriesWith(profile.Countries, config.Regions); err != nil {
+			return fmt.Errorf("invalid countries in profile %q of config file %s: %w", name, filename, err)
+		}
+	}
+	return nil
+}
+
+// SaveConfigFile saves configuration to YAML file
+func SaveConfigFile(config *Config, filename string) error {
+	return writeConfigFile(config, filename)
+}
+
+// SaveConfigFileWithoutSecrets saves configuration to YAML file with the username and
+// password left empty, those of the profiles included, so they come from the environment
+// or the keyring at runtime
+func SaveConfigFileWithoutSecrets(config *Config, filename string) error {
+	public := config.Clone()
+	public.Username = ""
+	public.Password = ""
+	for name, profile := range public.Profiles {
+		profile.Username, profile.Password = "", ""
+		public.Profiles[name] = profile
+	}
+	return writeConfigFile(public, filename)
+}
+
+// RedactSecrets returns a copy of config with its password and those of its profiles
+// replaced by "REDACTED", for showing the configuration to the user
+func RedactSecrets(config *Config) *Config {
+	redacted := config.Clone()
+	if redacted.Password != "" {
+		redacted.Password = "REDACTED"
+	}
+	for name, profile := range redacted.Profiles {
+		if profile.Password != "" {
+			profile.Password = "REDACTED"
+			redacted.Profiles[name] = profile
+		}
+	}
+	return redacted
+}
+
+// writeConfigFile marshals config to filename, readable by the owner only, with comments
+// explaining the settings
+func writeConfigFile(config *Config, filename string) error {
 	// Create a directory if it doesn't exist
 	dir := filepath.Dir(filename)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -385,11 +1669,11 @@ func saveConfigFile(config *Config, filename string) error {
 		return fmt.Errorf("error marshaling config: %w", err)
 	}
 
-	return os.WriteFile(filename, data, 0600)
+	return os.WriteFile(filename, commentConfig(data), 0600)
 }
 
-// getDefaultConfigPath returns the default configuration file path
-func getDefaultConfigPath() string {
+// DefaultConfigPath returns the default configuration file path
+func DefaultConfigPath() string {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return "./scdb-config.yml"
@@ -404,224 +1688,200 @@ func getDefaultConfigPath() string {
 	return filepath.Join(homeDir, ".config", "scdb", "config.yml")
 }
 
-// printUsage prints enhanced usage information
-func printUsage() {
-	fmt.Printf("SCDB Speed Camera Downloader v1.2\n")
-	fmt.Printf("Download speed camera databases from scdb.info\n\n")
-	fmt.Printf("Usage: %s [options]\n\n", os.Args[0])
-	fmt.Printf("Authentication (required):\n")
-	fmt.Printf("  -user string        SCDB username (or use SCDB_USER env var)\n")
-	fmt.Printf("  -pass string        SCDB password (or use SCDB_PASS env var)\n\n")
-	fmt.Printf("Download Options:\n")
-	fmt.Printf("  -output string      Output directory (default: current dir)\n")
-	fmt.Printf("  -countries string   Country codes or regions (default: all)\n")
-	fmt.Printf("                        'all', country codes (NL,B,D), or regions:\n")
-	fmt.Printf("                        africa, asia, europe, northamerica, southamerica, oceania\n")
-	fmt.Printf("                        dach, benelux, westeurope, easteurope, scandinavia\n")
-	fmt.Printf("  -fixed              Download fixed cameras (default: true)\n")
-	fmt.Printf("  -mobile             Download mobile cameras (default: true)\n\n")
-	fmt.Printf("Camera Configuration:\n")
-	fmt.Printf("  -display int        Display type: 1-4 (default: 1)\n")
-	fmt.Printf("                        1=Split all, 2=Split speed/red, 3=All in one, 4=Alt icon\n")
-	fmt.Printf("  -iconsize int       Icon size: 1-5 (default: 5)\n")
-	fmt.Printf("                        1=22x22, 2=24x24, 3=32x32, 4=48x48, 5=80x80 pixels\n")
-	fmt.Printf("  -dangerzones        Include danger zones (default: true)\n")
-	fmt.Printf("  -francedanger       France: true=danger zone, false=correct position (default: false)\n")
-	fmt.Printf("  -warningtime int    Warning time in seconds, 0=disabled (default: 0)\n\n")
-	fmt.Printf("Configuration File:\n")
-	fmt.Printf("  -config string      Load settings from YAML file\n")
-	fmt.Printf("  -saveconfig string  Save current settings to YAML file\n")
-	fmt.Printf("                        Default: %s\n", getDefaultConfigPath())
-	fmt.Printf("\n")
-	fmt.Printf("Other Options:\n")
-	fmt.Printf("  -verbose            Enable verbose output\n")
-	fmt.Printf("  -help               Show this help message\n\n")
-	fmt.Printf("Examples:\n")
-	fmt.Printf("  # Download all countries with defaults\n")
-	fmt.Printf("  %s -user myuser -pass mypass\n\n", os.Args[0])
-	fmt.Printf("  # Download specific regions\n")
-	fmt.Printf("  %s -countries \"dach,benelux\" -francedanger -warningtime 300\n\n", os.Args[0])
-	fmt.Printf("  # Use config file\n")
-	fmt.Printf("  %s -config ~/.config/scdb/config.yml\n\n", os.Args[0])
-	fmt.Printf("Environment Variables:\n")
-	fmt.Printf("  SCDB_USER     Username (alternative to -user flag)\n")
-	fmt.Printf("  SCDB_PASS     Password (alternative to -pass flag)\n\n")
-}
-
-// validateConfig validates the configuration and returns any errors
-func validateConfig(config *Config) error {
+// ValidateConfig validates the configuration and returns any errors
+func ValidateConfig(config *Config) error {
 	// Validate required fields
 	if config.Username == "" || config.Password == "" {
-		return fmt.Errorf("username and password are required\nProvide via -user/-pass flags or SCDB_USER/SCDB_PASS environment variables")
+		return fmt.Errorf("%w: set Config.Username and Config.Password", ErrMissingCredentials)
 	}
 
 	// Validate flag ranges
 	if config.DisplayType < 1 || config.DisplayType > 4 {
-		return fmt.Errorf("display type must be 1-4 (got %d)", config.DisplayType)
+		return fmt.Errorf("%w (got %d)", ErrInvalidDisplayType, config.DisplayType)
 	}
 
 	if config.IconSize < 1 || config.IconSize > 5 {
-		return fmt.Errorf("icon size must be 1-5 (got %d)", config.IconSize)
+		return fmt.Errorf("%w (got %d)", ErrInvalidIconSize, config.IconSize)
 	}
 
-	if config.WarningTime < 0 {
-		return fmt.Errorf("warning time cannot be negative (got %d)", config.WarningTime)
+	if err := CheckWarningTime(config.WarningTime); err != nil {
+		return err
 	}
 
-	// Validate that at least one download option is selected
-	if !config.DownloadFixed && !config.DownloadMobile {
-		return fmt.Errorf("at least one of -fixed or -mobile must be enabled")
+	if config.Timeout < 0 {
+		return fmt.Errorf("timeout cannot be negative (got %s)", config.Timeout)
+	}
+	if config.LoginTimeout < 0 {
+		return fmt.Errorf("login timeout cannot be negative (got %s)", config.LoginTimeout)
 	}
 
-	// Validate countries
-	if len(config.Countries) == 0 {
-		return fmt.Errorf("no countries specified")
+	if config.RequestDelay < 0 {
+		return fmt.Errorf("request delay cannot be negative (got %s)", config.RequestDelay)
 	}
 
-	return nil
-}
+	if config.MaxRate < 0 {
+		return fmt.Errorf("max rate cannot be negative (got %d)", config.MaxRate)
+	}
+	if config.MaxDownloadBytes < 0 {
+		return fmt.Errorf("max download size cannot be negative (got %d)", config.MaxDownloadBytes)
+	}
+	if config.MaxTotalBytes < 0 {
+		return fmt.Errorf("max total size cannot be negative (got %d)", config.MaxTotalBytes)
+	}
 
-func main() {
-	var config Config
-	var configFile, saveConfigPath string
-	var countries string
+	if config.Concurrency < 0 {
+		return fmt.Errorf("concurrency cannot be negative (got %d; 0 = 1)", config.Concurrency)
+	}
+	// Only per-country downloads run in parallel
+	if config.Concurrency > 1 && !config.SeparateByCountry {
+		return optionError("%s %d requires %s", configField("Concurrency"), config.Concurrency, configField("SeparateByCountry"))
+	}
 
-	// Custom flag handling for help
-	flag.Usage = printUsage
+	if config.RetryCount < 0 {
+		return fmt.Errorf("retry count cannot be negative (got %d)", config.RetryCount)
+	}
 
-	// Configuration file flags
-	flag.StringVar(&configFile, "config", "", "Load settings from YAML config file")
-	flag.StringVar(&saveConfigPath, "saveconfig", "", "Save current settings to YAML config file")
+	if config.RetryBackoff < 0 {
+		return fmt.Errorf("retry backoff cannot be negative (got %s)", config.RetryBackoff)
+	}
 
-	// Parse command line flags
-	flag.StringVar(&config.Username, "user", "", "SCDB username (required, or use SCDB_USER env var)")
-	flag.StringVar(&config.Password, "pass", "", "SCDB password (required, or use SCDB_PASS env var)")
-	flag.StringVar(&config.OutputDir, "output", ".", "Output directory for downloads")
+	if _, err := NewLogger(io.Discard, config); err != nil {
+		return err
+	}
+	// Verbose means debug, which a quieter LogLevel would silently override
+	if config.Verbose && config.LogLevel != "" && !strings.EqualFold(config.LogLevel, "debug") {
+		return optionError("%s cannot be used with %s %s", configField("Verbose"), configField("LogLevel"), config.LogLevel)
+	}
 
-	flag.StringVar(&countries, "countries", "all", "Comma-separated country codes, regions, or 'all' for all countries")
-	flag.IntVar(&config.DisplayType, "display", 1, "Display type (1=Split all, 2=Split speed/red, 3=All in one, 4=Alt icon)")
-	flag.BoolVar(&config.DangerZones, "dangerzones", true, "Include danger zones")
-	flag.BoolVar(&config.FranceDangerMode, "francedanger", false, "France: true=danger zone, false=correct position")
-	flag.IntVar(&config.IconSize, "iconsize", 5, "Icon size (1=22x22, 2=24x24, 3=32x32, 4=48x48, 5=80x80)")
-	flag.IntVar(&config.WarningTime, "warningtime", 0, "Warning time in seconds (0=disabled, default)")
+	if config.ProxyURL != "" {
+		if _, err := parseProxyURL(config.ProxyURL); err != nil {
+			return err
+		}
+	}
 
-	flag.BoolVar(&config.DownloadFixed, "fixed", true, "Download fixed speed cameras")
-	flag.BoolVar(&config.DownloadMobile, "mobile", true, "Download mobile speed cameras")
-	flag.BoolVar(&config.Verbose, "verbose", false, "Enable verbose output")
+	if err := checkFormat(config.Format); err != nil {
+		return err
+	}
+	if err := checkMobilePath(config.MobilePath); err != nil {
+		return err
+	}
+	if _, ok := config.MobileForm[""]; ok {
+		return fmt.Errorf("mobile form field name cannot be empty")
+	}
 
-	flag.Parse()
+	if err := checkFilenameTemplate(config); err != nil {
+		return err
+	}
 
-	// Load config file if specified
-	if configFile != "" {
-		loadedConfig, err := loadConfigFile(configFile)
-		if err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "Error loading config file %s: %v\n", configFile, err)
-			os.Exit(1)
-		}
-		// Merge loaded config with command line args (command line takes precedence)
-		config = *loadedConfig
-		config.ConfigFile = configFile
+	if err := checkFormEncoding(config.FormEncoding); err != nil {
+		return err
+	}
 
-		// Re-parse flags to override config file values
-		flag.Parse()
+	if config.MaxAge < 0 {
+		return fmt.Errorf("max age cannot be negative (got %s)", config.MaxAge)
 	}
 
-	// Use environment variables if flags not provided
-	if config.Username == "" {
-		config.Username = os.Getenv("SCDB_USER")
+	if config.Keep < 0 {
+		return fmt.Errorf("keep cannot be negative (got %d)", config.Keep)
 	}
-	if config.Password == "" {
-		config.Password = os.Getenv("SCDB_PASS")
+	if config.Keep > 0 && !config.Archive {
+		return optionError("%s requires %s", configField("Keep"), configField("Archive"))
 	}
 
-	// Parse and expand countries
-	if countries == "all" {
-		config.Countries = getAllCountries()
-	} else {
-		countryList := strings.Split(countries, ",")
-		// Trim whitespace from each country/region
-		for i, c := range countryList {
-			countryList[i] = strings.TrimSpace(c)
-		}
+	if config.Archive && config.FixedOutputDir != "" {
+		return optionError("%s cannot be used with %s", configField("FixedOutputDir"), configField("Archive"))
+	}
+	if config.Archive && config.MobileOutputDir != "" {
+		return optionError("%s cannot be used with %s", configField("MobileOutputDir"), configField("Archive"))
+	}
 
-		expanded, err := expandCountries(countryList)
-		if err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "Error parsing countries: %v\n", err)
-			_, _ = fmt.Fprintf(os.Stderr, "\nAvailable regions: africa, asia, europe, northamerica, southamerica, oceania\n")
-			_, _ = fmt.Fprintf(os.Stderr, "                   dach, benelux, westeurope, easteurope, scandinavia\n")
-			os.Exit(1)
-		}
-		config.Countries = expanded
+	if config.ExtractOnly && !config.Extract {
+		return optionError("%s requires %s", configField("ExtractOnly"), configField("Extract"))
 	}
 
-	// Save the config file if requested (do this first to allow saving without credentials)
-	if saveConfigPath != "" {
-		if saveConfigPath == "default" {
-			saveConfigPath = getDefaultConfigPath()
+	if config.SinceDate != "" {
+		if _, err := time.Parse(time.DateOnly, config.SinceDate); err != nil {
+			return fmt.Errorf("invalid since date %q (want YYYY-MM-DD)", config.SinceDate)
 		}
+	}
+	if err := checkFormFields(config.FormFields); err != nil {
+		return err
+	}
 
-		// For saving config, only validate non-credential fields
-		if config.DisplayType < 1 || config.DisplayType > 4 {
-			_, _ = fmt.Fprintf(os.Stderr, "Error: display type must be 1-4 (got %d)\n", config.DisplayType)
-			os.Exit(1)
-		}
-		if config.IconSize < 1 || config.IconSize > 5 {
-			_, _ = fmt.Fprintf(os.Stderr, "Error: icon size must be 1-5 (got %d)\n", config.IconSize)
-			os.Exit(1)
-		}
-		if config.WarningTime < 0 {
-			_, _ = fmt.Fprintf(os.Stderr, "Error: warning time cannot be negative (got %d)\n", config.WarningTime)
-			os.Exit(1)
+	if config.NoClobber && config.Backup {
+		return optionError("%s and %s cannot be used together", configField("NoClobber"), configField("Backup"))
+	}
+	if config.OnlyChanged && !config.SeparateByCountry {
+		return optionError("%s requires %s", configField("OnlyChanged"), configField("SeparateByCountry"))
+	}
+	if config.OnlyChanged && config.Archive {
+		return optionError("%s cannot be used with %s", configField("OnlyChanged"), configField("Archive"))
+	}
+	if config.Clean && config.Archive {
+		return optionError("%s cannot be used with %s", configField("Clean"), configField("Archive"))
+	}
+	if config.Clean && config.MaxAge > 0 {
+		return optionError("%s cannot be used with %s", configField("Clean"), configField("MaxAge"))
+	}
+	if config.Clean && config.OnlyChanged {
+		return optionError("%s cannot be used with %s", configField("Clean"), configField("OnlyChanged"))
+	}
+	// The server's names are only known once the downloads are under way, too late for
+	// options that look for the files of earlier runs or tell countries apart by name
+	if config.UseServerFilename {
+		switch {
+		case config.SeparateByCountry:
+			return optionError("%s cannot be used with %s", configField("UseServerFilename"), configField("SeparateByCountry"))
+		case config.FilenameTemplate != "":
+			return optionError("%s cannot be used with %s", configField("UseServerFilename"), configField("FilenameTemplate"))
+		case config.Clean:
+			return optionError("%s cannot be used with %s", configField("UseServerFilename"), configField("Clean"))
+		case config.MaxAge > 0:
+			return optionError("%s cannot be used with %s", configField("UseServerFilename"), configField("MaxAge"))
 		}
+	}
 
-		if err := saveConfigFile(&config, saveConfigPath); err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "Error saving config file: %v\n", err)
-			os.Exit(1)
+	if config.DangerZonesOnly && !config.DownloadFixed {
+		return optionError("%s requires %s", configField("DangerZonesOnly"), configField("DownloadFixed"))
+	}
+
+	// Diff needs an existing file to compare with and leaves it in place until confirmed
+	if config.Diff {
+		switch {
+		case config.Archive:
+			return optionError("%s cannot be used with %s", configField("Diff"), configField("Archive"))
+		case config.NoClobber:
+			return optionError("%s cannot be used with %s", configField("Diff"), configField("NoClobber"))
+		case config.Extract:
+			return optionError("%s cannot be used with %s", configField("Diff"), configField("Extract"))
 		}
-		fmt.Printf("Configuration saved to: %s\n", saveConfigPath)
-		return
 	}
 
-	// Validate configuration for running downloads
-	if err := validateConfig(&config); err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
-		flag.Usage()
-		os.Exit(1)
+	// Validate that at least one download option is selected
+	if !config.DownloadFixed && !config.DownloadMobile {
+		return optionError("at least one of %s or %s must be enabled", configField("DownloadFixed"), configField("DownloadMobile"))
 	}
 
-	// Create an output directory if it doesn't exist
-	if err := os.MkdirAll(config.OutputDir, 0755); err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "Error creating output directory: %v\n", err)
-		os.Exit(1)
+	if err := checkProfiles(config); err != nil {
+		return err
 	}
 
-	// Show configuration in verbose mode
-	if config.Verbose {
-		fmt.Println("SCDB Downloader Configuration:")
-		fmt.Printf("  User: %s\n", config.Username)
-		fmt.Printf("  Output: %s\n", config.OutputDir)
-		fmt.Printf("  Countries: %v (%d total)\n", config.Countries, len(config.Countries))
-		fmt.Printf("  Display Type: %d\n", config.DisplayType)
-		fmt.Printf("  Icon Size: %d\n", config.IconSize)
-		fmt.Printf("  Warning Time: %d seconds\n", config.WarningTime)
-		fmt.Printf("  Danger Zones: %t\n", config.DangerZones)
-		fmt.Printf("  France Danger Mode: %t\n", config.FranceDangerMode)
-		fmt.Printf("  Download Fixed: %t\n", config.DownloadFixed)
-		fmt.Printf("  Download Mobile: %t\n", config.DownloadMobile)
-		if config.ConfigFile != "" {
-			fmt.Printf("  Config File: %s\n", config.ConfigFile)
-		}
-		fmt.Println()
+	if err := checkStdoutOutput(config); err != nil {
+		return err
 	}
 
-	// Create a downloader and run
-	downloader := NewDownloader(&config)
-	if err := downloader.Run(); err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "Download failed: %v\n", err)
-		os.Exit(1)
+	// Validate countries
+	if len(config.Countries) == 0 {
+		return fmt.Errorf("no countries specified")
+	}
+	if config.StrictMobile && mobileIgnoresCountries(config) {
+		return optionError("%s: %v", configField("StrictMobile"), errMobileCountries)
 	}
 
-	if config.Verbose {
-		fmt.Println("Downloads completed successfully!")
+	// Never agree to SCDB's terms on the user's behalf
+	if config.DownloadFixed && !config.AcceptAgreement {
+		return fmt.Errorf("%w: set Config.AcceptAgreement", ErrAgreementNotAccepted)
 	}
+
+	return nil
 }
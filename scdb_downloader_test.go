@@ -1,11 +1,28 @@
-package main
+package scdb
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
-	"regexp"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
 	"time"
 )
 
@@ -44,8 +61,8 @@ func TestNewDownloader(t *testing.T) {
 
 	if transport.TLSClientConfig == nil {
 		t.Errorf("NewDownloader() TLS config is nil")
-	} else if !transport.TLSClientConfig.InsecureSkipVerify {
-		t.Errorf("NewDownloader() TLS InsecureSkipVerify = false, want true")
+	} else if transport.TLSClientConfig.InsecureSkipVerify {
+		t.Errorf("NewDownloader() TLS InsecureSkipVerify = true, want false by default")
 	}
 }
 
@@ -72,7 +89,83 @@ func TestSCDBDownloader_login(t *testing.T) {
 				m.SetFailures(true, false, false)
 			},
 			wantErr: true,
-			errMsg:  "login request failed",
+			errMsg:  "login: POST /en/login/: 401 Unauthorized",
+		},
+		{
+			name:   "Bad credentials re-render the login form",
+			config: CreateTestConfig(),
+			setupMock: func(m *MockSCDBServer) {
+				m.validPassword = "the-right-password"
+			},
+			wantErr: true,
+			errMsg:  "login failed: invalid credentials",
+		},
+		{
+			name:   "Challenge instead of the login form",
+			config: CreateTestConfig(),
+			setupMock: func(m *MockSCDBServer) {
+				m.challenge = true
+			},
+			wantErr: true,
+			errMsg:  "login blocked by a challenge page: log in with a browser",
+		},
+		{
+			name:   "Maintenance page instead of the login form",
+			config: CreateTestConfig(),
+			setupMock: func(m *MockSCDBServer) {
+				m.maintenance = true
+			},
+			wantErr: true,
+			errMsg:  "SCDB is down for maintenance: SCDB.info - Maintenance",
+		},
+		{
+			name:   "Challenge in answer to the login",
+			config: CreateTestConfig(),
+			setupMock: func(m *MockSCDBServer) {
+				m.challengeAfterLogin = true
+			},
+			wantErr: true,
+			errMsg:  "login blocked by a challenge page",
+		},
+		{
+			name:      "Login code from the config",
+			config:    &Config{Username: "testuser", Password: "testpass", OTP: "123456"},
+			setupMock: func(m *MockSCDBServer) { m.otpCode = "123456" },
+			wantErr:   false,
+		},
+		{
+			name:      "Wrong login code",
+			config:    &Config{Username: "testuser", Password: "testpass", OTP: "654321"},
+			setupMock: func(m *MockSCDBServer) { m.otpCode = "123456" },
+			wantErr:   true,
+			errMsg:    "login failed: the login code was not accepted",
+		},
+		{
+			name:      "Login code missing",
+			config:    CreateTestConfig(),
+			setupMock: func(m *MockSCDBServer) { m.otpCode = "123456" },
+			wantErr:   true,
+			errMsg:    "login code required\nProvide it with -otp or SCDB_OTP",
+		},
+		{
+			name:   "Session not established",
+			config: CreateTestConfig(),
+			setupMock: func(m *MockSCDBServer) {
+				m.noSession = true
+			},
+			wantErr: true,
+			errMsg:  "login failed: redirected back to /en/login/",
+		},
+		{
+			name: "Correct credentials with password check",
+			config: &Config{
+				Username: "testuser",
+				Password: "the-right-password",
+			},
+			setupMock: func(m *MockSCDBServer) {
+				m.validPassword = "the-right-password"
+			},
+			wantErr: false,
 		},
 		{
 			name: "Verbose login",
@@ -101,24 +194,518 @@ func TestSCDBDownloader_login(t *testing.T) {
 
 			tt.setupMock(mockServer)
 
-			// Create downloader with config pointing to mock server
+			// Point the downloader at the mock server
+			tt.config.BaseURL = mockServer.URL()
 			downloader := NewDownloader(tt.config)
 
-			// Replace URLs in the downloader to point to mock server
-			// This is a bit tricky since the URLs are hardcoded in the login method
-			// We'll need to modify this approach or use a more sophisticated mock
-
-			// For now, we'll test the URL construction logic separately
-			// and test login with a real-world scenario in E2E tests
+			err := downloader.login(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("login() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
 
-			// Test that we can create a downloader and it has the right structure
-			if downloader == nil {
-				t.Errorf("NewDownloader() returned nil")
+			if tt.wantErr {
+				AssertErrorContains(t, err, tt.errMsg)
 				return
 			}
 
-			if downloader.config != tt.config {
-				t.Errorf("Downloader config mismatch")
+			login, _, _ := mockServer.GetStats()
+			if login != 1 {
+				t.Errorf("login calls = %d, want 1", login)
+			}
+
+			// Origin and Referer must follow the configured base URL
+			if mockServer.lastOrigin != mockServer.URL() {
+				t.Errorf("Origin = %q, want %q", mockServer.lastOrigin, mockServer.URL())
+			}
+			if mockServer.lastReferer != mockServer.URL()+"/en/login/" {
+				t.Errorf("Referer = %q, want %q", mockServer.lastReferer, mockServer.URL()+"/en/login/")
+			}
+		})
+	}
+}
+
+func TestSCDBDownloader_loginNeverLogsPassword(t *testing.T) {
+	mockServer := NewMockSCDBServer()
+	defer mockServer.Close()
+
+	config := CreateTestConfig()
+	config.Password = "s3cret-password"
+	config.BaseURL = mockServer.URL()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	downloader := NewDownloader(config, WithHTTPClient(mockServer.Client()), WithLogger(logger))
+
+	AssertNoError(t, downloader.login(context.Background()))
+
+	out := buf.String()
+	if !strings.Contains(out, "login successful") {
+		t.Errorf("log output missing login milestone:\n%s", out)
+	}
+	if strings.Contains(out, config.Password) {
+		t.Errorf("log output contains the password:\n%s", out)
+	}
+}
+
+func TestSCDBDownloader_checkLoggedIn(t *testing.T) {
+	mockServer := NewMockSCDBServer()
+	defer mockServer.Close()
+
+	downloader := CreateMockDownloader(CreateTestConfig(), mockServer)
+
+	// Before logging in the account page bounces to the login form
+	err := downloader.checkLoggedIn(context.Background())
+	AssertErrorContains(t, err, "session is not authenticated")
+
+	AssertNoError(t, downloader.login(context.Background()))
+	AssertNoError(t, downloader.checkLoggedIn(context.Background()))
+}
+
+func TestSCDBDownloader_Login(t *testing.T) {
+	mockServer := NewMockSCDBServer()
+	defer mockServer.Close()
+
+	tempDir := CreateTempDir(t, "scdb_login_test")
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	config := CreateTestConfig()
+	config.OutputDir = tempDir
+	downloader := CreateMockDownloader(config, mockServer)
+	ctx := context.Background()
+
+	AssertNoError(t, downloader.Login(ctx))
+
+	// The client carries the session for requests of the embedder's own
+	resp, err := downloader.Client().Get(mockServer.URL() + accountPath)
+	AssertNoError(t, err)
+	_ = resp.Body.Close()
+	if resp.Request.URL.Path != accountPath {
+		t.Errorf("authenticated request landed on %s, want %s", resp.Request.URL.Path, accountPath)
+	}
+
+	// Logging in again, or running, reuses the session
+	AssertNoError(t, downloader.Login(ctx))
+	AssertNoError(t, downloader.Run())
+	if login, _, _ := mockServer.GetStats(); login != 1 {
+		t.Errorf("login calls = %d, want 1", login)
+	}
+}
+
+func TestSCDBDownloader_loginSavedSession(t *testing.T) {
+	newConfig := func(t *testing.T) *Config {
+		config := CreateTestConfig()
+		config.SessionFile = filepath.Join(t.TempDir(), "scdb", "cookies.json")
+		return config
+	}
+	writeState := func(t *testing.T, path string, session Session) {
+		t.Helper()
+		if err := (FileCookieStore{Path: path}).Save(&session); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("Saved session skips login", func(t *testing.T) {
+		mockServer := NewMockSCDBServer()
+		defer mockServer.Close()
+		config := newConfig(t)
+
+		AssertNoError(t, CreateMockDownloader(config, mockServer).login(context.Background()))
+		info, err := os.Stat(config.SessionFile)
+		AssertNoError(t, err)
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Errorf("session file mode = %o, want 600", perm)
+		}
+
+		// A fresh downloader starts with an empty cookie jar
+		downloader := CreateMockDownloader(config, mockServer)
+		AssertNoError(t, downloader.login(context.Background()))
+		AssertNoError(t, downloader.checkLoggedIn(context.Background()))
+		if login, _, _ := mockServer.GetStats(); login != 1 {
+			t.Errorf("login calls = %d, want 1", login)
+		}
+	})
+
+	t.Run("Expired session logs in again", func(t *testing.T) {
+		mockServer := NewMockSCDBServer()
+		defer mockServer.Close()
+		mockServer.expiredSession = "stale_session_id"
+		config := newConfig(t)
+		config.BaseURL = mockServer.URL()
+		writeState(t, config.SessionFile, Session{
+			BaseURL:  config.BaseURL,
+			Username: config.Username,
+			Cookies:  []SessionCookie{{Name: "PHPSESSID", Value: "stale_session_id"}},
+		})
+
+		AssertNoError(t, CreateMockDownloader(config, mockServer).login(context.Background()))
+		if login, _, _ := mockServer.GetStats(); login != 1 {
+			t.Errorf("login calls = %d, want 1", login)
+		}
+
+		session, err := FileCookieStore{Path: config.SessionFile}.Load()
+		AssertNoError(t, err)
+		if session == nil || len(session.Cookies) != 1 || session.Cookies[0].Value != "test_session_id" {
+			t.Errorf("saved session = %+v, want the new session", session)
+		}
+	})
+
+	t.Run("Session of another user is ignored", func(t *testing.T) {
+		mockServer := NewMockSCDBServer()
+		defer mockServer.Close()
+		config := newConfig(t)
+		config.BaseURL = mockServer.URL()
+		writeState(t, config.SessionFile, Session{
+			BaseURL:  config.BaseURL,
+			Username: "someone-else",
+			Cookies:  []SessionCookie{{Name: "PHPSESSID", Value: "test_session_id"}},
+		})
+
+		AssertNoError(t, CreateMockDownloader(config, mockServer).login(context.Background()))
+		if login, _, _ := mockServer.GetStats(); login != 1 {
+			t.Errorf("login calls = %d, want 1", login)
+		}
+	})
+
+	t.Run("Corrupt session file is ignored", func(t *testing.T) {
+		mockServer := NewMockSCDBServer()
+		defer mockServer.Close()
+		config := newConfig(t)
+		AssertNoError(t, os.MkdirAll(filepath.Dir(config.SessionFile), 0700))
+		AssertNoError(t, os.WriteFile(config.SessionFile, []byte("{not json"), 0600))
+
+		AssertNoError(t, CreateMockDownloader(config, mockServer).login(context.Background()))
+		if session, err := (FileCookieStore{Path: config.SessionFile}).Load(); err != nil || session == nil {
+			t.Errorf("session file not rewritten after login: %v", err)
+		}
+	})
+
+	t.Run("Cookie attributes are saved", func(t *testing.T) {
+		mockServer := NewMockSCDBServer()
+		defer mockServer.Close()
+		mockServer.sessionMaxAge = 3600
+		config := newConfig(t)
+
+		AssertNoError(t, CreateMockDownloader(config, mockServer).login(context.Background()))
+
+		session, err := FileCookieStore{Path: config.SessionFile}.Load()
+		AssertNoError(t, err)
+		if session == nil || len(session.Cookies) != 1 {
+			t.Fatalf("saved session = %+v, want one cookie", session)
+		}
+		cookie := session.Cookies[0]
+		host := strings.TrimPrefix(mockServer.URL(), "http://")
+		host = host[:strings.LastIndex(host, ":")]
+		if cookie.Domain != host || cookie.Path != "/" {
+			t.Errorf("cookie domain, path = %q, %q, want %q, /", cookie.Domain, cookie.Path, host)
+		}
+		if until := time.Until(cookie.Expires); until < 59*time.Minute || until > time.Hour {
+			t.Errorf("cookie expires in %s, want about an hour", until)
+		}
+	})
+
+	t.Run("Expired cookies are dropped", func(t *testing.T) {
+		mockServer := NewMockSCDBServer()
+		defer mockServer.Close()
+		config := newConfig(t)
+		config.BaseURL = mockServer.URL()
+		// The server would still accept the cookie, but its recorded expiry has passed
+		writeState(t, config.SessionFile, Session{
+			BaseURL:  config.BaseURL,
+			Username: config.Username,
+			Cookies:  []SessionCookie{{Name: "PHPSESSID", Value: "test_session_id", Expires: time.Now().Add(-time.Minute)}},
+		})
+
+		AssertNoError(t, CreateMockDownloader(config, mockServer).login(context.Background()))
+		if login, _, _ := mockServer.GetStats(); login != 1 {
+			t.Errorf("login calls = %d, want 1", login)
+		}
+	})
+
+	t.Run("Custom cookie store", func(t *testing.T) {
+		mockServer := NewMockSCDBServer()
+		defer mockServer.Close()
+		config := CreateTestConfig()
+		config.BaseURL = mockServer.URL()
+		store := &memoryCookieStore{}
+
+		for i := 0; i < 2; i++ {
+			downloader := NewDownloader(config, WithHTTPClient(mockServer.Client()), WithCookieStore(store))
+			AssertNoError(t, downloader.login(context.Background()))
+		}
+		if login, _, _ := mockServer.GetStats(); login != 1 {
+			t.Errorf("login calls = %d, want 1", login)
+		}
+		if store.saves != 1 || store.session == nil || store.session.Username != config.Username {
+			t.Errorf("store saves = %d, session = %+v, want one save for %s", store.saves, store.session, config.Username)
+		}
+	})
+
+	t.Run("No session file", func(t *testing.T) {
+		mockServer := NewMockSCDBServer()
+		defer mockServer.Close()
+		config := CreateTestConfig()
+
+		for i := 0; i < 2; i++ {
+			AssertNoError(t, CreateMockDownloader(config, mockServer).login(context.Background()))
+		}
+		if login, _, _ := mockServer.GetStats(); login != 2 {
+			t.Errorf("login calls = %d, want 2", login)
+		}
+	})
+}
+
+func TestParseAccountPage(t *testing.T) {
+	date := func(s string) *time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return &d
+	}
+	n := func(v int) *int { return &v }
+
+	tests := []struct {
+		name string
+		page string
+		want Account
+	}{
+		{
+			name: "Expiry and remaining of limit",
+			page: `<p>Premium subscription valid until: <b>2025-03-01</b></p><p>Remaining downloads: 3 of 5</p>`,
+			want: Account{SubscriptionExpiry: date("2025-03-01"), DownloadsRemaining: n(3), DownloadLimit: n(5)},
+		},
+		{
+			name: "German page",
+			page: `<td>Gültig bis</td><td>1.10.2025</td><td>Verbleibende Downloads: 2</td>`,
+			want: Account{SubscriptionExpiry: date("2025-10-01"), DownloadsRemaining: n(2)},
+		},
+		{
+			name: "Count before the label and a separate limit",
+			page: `<div>4 / 10 downloads left</div><div>Expires on 31.12.2024</div>`,
+			want: Account{SubscriptionExpiry: date("2024-12-31"), DownloadsRemaining: n(4), DownloadLimit: n(10)},
+		},
+		{
+			name: "Only a limit",
+			page: `<p>Daily limit: 5</p>`,
+			want: Account{DownloadLimit: n(5)},
+		},
+		{
+			name: "Nothing shown",
+			page: `<html><body><a href="/en/logout/">Logout</a></body></html>`,
+		},
+		{
+			name: "Unparseable date",
+			page: `<p>Valid until: 31.02.2025</p>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseAccountPage([]byte(tt.page))
+			if !reflect.DeepEqual(*got, tt.want) {
+				gotJSON, _ := json.Marshal(got)
+				wantJSON, _ := json.Marshal(tt.want)
+				t.Errorf("parseAccountPage() = %s, want %s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
+
+func TestSCDBDownloader_AccountInfo(t *testing.T) {
+	mockServer := NewMockSCDBServer()
+	defer mockServer.Close()
+	mockServer.accountPage = `<html><body><p>Valid until: 2030-01-15</p><p>Downloads remaining: 1 of 3</p></body></html>`
+
+	account, err := CreateMockDownloader(CreateTestConfig(), mockServer).AccountInfo(context.Background())
+	AssertNoError(t, err)
+
+	if account.Username != "testuser" {
+		t.Errorf("Username = %q, want testuser", account.Username)
+	}
+	if account.SubscriptionExpiry == nil || account.SubscriptionExpiry.Format("2006-01-02") != "2030-01-15" {
+		t.Errorf("SubscriptionExpiry = %v, want 2030-01-15", account.SubscriptionExpiry)
+	}
+	if account.DownloadsRemaining == nil || *account.DownloadsRemaining != 1 || account.DownloadLimit == nil || *account.DownloadLimit != 3 {
+		t.Errorf("downloads = %v of %v, want 1 of 3", account.DownloadsRemaining, account.DownloadLimit)
+	}
+	if _, fixed, mobile := mockServer.GetStats(); fixed+mobile != 0 {
+		t.Errorf("AccountInfo() sent %d downloads, want none", fixed+mobile)
+	}
+
+	mockServer.SetFailures(true, false, false)
+	_, err = CreateMockDownloader(CreateTestConfig(), mockServer).AccountInfo(context.Background())
+	AssertErrorContains(t, err, "login failed")
+}
+
+func TestIsLoginFailurePage(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want bool
+	}{
+		{"Login form redisplayed", `<form><input type="password" name="u_password"></form>`, true},
+		{"Known error message", `<div class="alert">Invalid username or password.</div>`, true},
+		{"German error message", `<p>Benutzername oder Passwort falsch</p>`, true},
+		{"Account page", `<html><body><a href="/en/logout/">Logout</a></body></html>`, false},
+		{"Empty page", ``, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isLoginFailurePage([]byte(tt.body)); got != tt.want {
+				t.Errorf("isLoginFailurePage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsMaintenancePage(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want bool
+	}{
+		{"Maintenance page", maintenancePage, true},
+		{"German maintenance page", `<title>SCDB.info</title><p>Wegen Wartungsarbeiten ist die Seite nicht erreichbar.</p>`, true},
+		{"Login form", `<form><input type="hidden" name="abcdef1234567890abcdef1234567890abcdef12" value="abcdef1234567890abcdef1234567890abcdef12"><p>Planned maintenance on Sunday</p></form>`, false},
+		{"Challenge page", challengePage, false},
+		{"Empty page", ``, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isMaintenancePage([]byte(tt.body)); got != tt.want {
+				t.Errorf("isMaintenancePage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	err := maintenanceError([]byte(maintenancePage))
+	if !errors.Is(err, ErrServerMaintenance) {
+		t.Errorf("maintenanceError() = %v, want ErrServerMaintenance", err)
+	}
+	AssertErrorContains(t, err, "try again later")
+}
+
+func TestSCDBDownloader_loginOTPFunc(t *testing.T) {
+	mockServer := NewMockSCDBServer()
+	defer mockServer.Close()
+	mockServer.otpCode = "123456"
+
+	// The code in the config is only good once; the second login asks OTPFunc
+	config := CreateTestConfig()
+	config.BaseURL = mockServer.URL()
+	config.OTP = "123456"
+	downloader := NewDownloader(config)
+	asked := 0
+	downloader.OTPFunc = func(ctx context.Context) (string, error) {
+		asked++
+		return " 123456\n", nil
+	}
+
+	AssertNoError(t, downloader.authenticate(context.Background()))
+	AssertNoError(t, downloader.authenticate(context.Background()))
+	if asked != 1 {
+		t.Errorf("OTPFunc asked %d times, want 1", asked)
+	}
+	if mockServer.otpCalls != 2 {
+		t.Errorf("login code posts = %d, want 2", mockServer.otpCalls)
+	}
+
+	downloader.OTPFunc = func(ctx context.Context) (string, error) { return "", nil }
+	err := downloader.authenticate(context.Background())
+	if !errors.Is(err, ErrOTPRequired) {
+		t.Errorf("authenticate() with an empty code = %v, want ErrOTPRequired", err)
+	}
+
+	// Waiting for the code does not use up the login timeout
+	config.LoginTimeout = 50 * time.Millisecond
+	downloader.OTPFunc = func(ctx context.Context) (string, error) {
+		if _, ok := ctx.Deadline(); ok {
+			t.Error("OTPFunc got a context with the login timeout")
+		}
+		time.Sleep(2 * config.LoginTimeout)
+		return "123456", nil
+	}
+	AssertNoError(t, downloader.authenticate(context.Background()))
+}
+
+func TestFindOTPForm(t *testing.T) {
+	form, ok := findOTPForm([]byte(otpPage))
+	if !ok {
+		t.Fatal("findOTPForm() found no form in otpPage")
+	}
+	if form.action != "otp/" || form.field != "otp" {
+		t.Errorf("findOTPForm() action %q, field %q; want otp/ and otp", form.action, form.field)
+	}
+	want := url.Values{"otp_token": {"step-2"}, "otp_submit": {"Continue"}}
+	if !reflect.DeepEqual(form.values, want) {
+		t.Errorf("findOTPForm() values = %v, want %v", form.values, want)
+	}
+
+	for name, body := range map[string]string{
+		"Login form":           `<form><input name="u_name"><input type="password" name="u_password"><input name="otp"></form>`,
+		"Field outside a form": `<input name="otp">`,
+		"Challenge page":       challengePage,
+		"Empty page":           ``,
+	} {
+		if _, ok := findOTPForm([]byte(body)); ok {
+			t.Errorf("findOTPForm() found a code form in %s", name)
+		}
+	}
+}
+
+func TestIsChallengePage(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want bool
+	}{
+		{"CAPTCHA page", challengePage, true},
+		{"hCaptcha widget alone", `<div class="h-captcha" data-sitekey="x"></div>`, false},
+		{"Login form with a CAPTCHA widget", `<form><input type="hidden" name="0123456789abcdef0123456789abcdef01234567" value="0123456789abcdef0123456789abcdef01234567"><input type="password" name="u_password"><div class="g-recaptcha"></div></form><script>// verify you are human</script>`, false},
+		{"Cloudflare check", `<title>Just a moment...</title><script src="/cdn-cgi/challenge-platform/h/b/orchestrate"></script>`, true},
+		{"Login form", `<form><input type="password" name="u_password"></form>`, false},
+		{"Empty page", ``, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isChallengePage([]byte(tt.body)); got != tt.want {
+				t.Errorf("isChallengePage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// The error names the session file to fill from a browser login
+	config := CreateTestConfig()
+	config.SessionFile = filepath.Join("state", "cookies.json")
+	err := NewDownloader(config).challengeError()
+	if !errors.Is(err, ErrLoginChallenge) {
+		t.Errorf("challengeError() = %v, want ErrLoginChallenge", err)
+	}
+	AssertErrorContains(t, err, config.SessionFile)
+}
+
+func TestSCDBDownloader_url(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseURL string
+		path    string
+		want    string
+	}{
+		{"Default base URL", "", "/en/login/", "https://www.scdb.info/en/login/"},
+		{"Custom base URL", "http://127.0.0.1:8080", "/my/downloadsection", "http://127.0.0.1:8080/my/downloadsection"},
+		{"Trailing slash trimmed", "https://mirror.example.com/", "/my/", "https://mirror.example.com/my/"},
+		{"Empty path", "https://mirror.example.com", "", "https://mirror.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := CreateTestConfig()
+			config.BaseURL = tt.baseURL
+			downloader := NewDownloader(config)
+
+			if got := downloader.url(tt.path); got != tt.want {
+				t.Errorf("url(%q) = %q, want %q", tt.path, got, tt.want)
 			}
 		})
 	}
@@ -161,7 +748,7 @@ func TestSCDBDownloader_saveResponseToFile(t *testing.T) {
 			content:     "<html><body>Error page</body></html>",
 			filename:    "error.zip",
 			wantErr:     true,
-			errMsg:      "unexpected response",
+			errMsg:      `unexpected response (not a valid ZIP archive): "Error page" (HTTP 200, Content-Type: text/html)`,
 		},
 		{
 			name:        "Valid ZIP with verbose output",
@@ -218,56 +805,406 @@ func TestSCDBDownloader_saveResponseToFile(t *testing.T) {
 	}
 }
 
-func TestSCDBDownloader_Run(t *testing.T) {
-	tempDir := CreateTempDir(t, "scdb_run_test")
-	defer func() { _ = os.RemoveAll(tempDir) }()
-
+func TestDescribeErrorPage(t *testing.T) {
 	tests := []struct {
-		name       string
-		config     *Config
-		wantErr    bool
-		errMsg     string
-		wantFixed  bool
-		wantMobile bool
+		name string
+		body string
+		want string
 	}{
 		{
-			name: "Download both fixed and mobile",
-			config: &Config{
-				Username:       "testuser",
-				Password:       "testpass",
-				OutputDir:      tempDir,
-				Countries:      []string{"NL"},
-				DisplayType:    1,
-				IconSize:       5,
-				DownloadFixed:  true,
-				DownloadMobile: true,
-			},
-			wantErr:    false,
-			wantFixed:  true,
-			wantMobile: true,
+			name: "Title and error element",
+			body: `<html><head><title>SCDB</title><script>var x = 1;</script></head>
+<body><nav>Home</nav><div class="alert alert-danger">
+  Download limit   reached.
+</div></body></html>`,
+			want: "SCDB: Download limit reached.",
 		},
 		{
-			name: "Download only fixed",
-			config: &Config{
-				Username:       "testuser",
-				Password:       "testpass",
-				OutputDir:      tempDir,
-				Countries:      []string{"NL"},
-				DisplayType:    1,
-				IconSize:       5,
-				DownloadFixed:  true,
-				DownloadMobile: false,
-			},
-			wantErr:    false,
-			wantFixed:  true,
-			wantMobile: false,
+			name: "Title only",
+			body: "<html><head><title>503 Service Unavailable</title></head><body><h1>Oops</h1></body></html>",
+			want: "503 Service Unavailable",
+		},
+		{
+			name: "Error id without title",
+			body: `<p>Welcome</p><p id="error-message">Session <b>expired</b></p>`,
+			want: "Session expired",
+		},
+		{
+			name: "Plain text",
+			body: "Internal error\nplease retry",
+			want: "Internal error please retry",
+		},
+		{
+			name: "Empty body",
+			body: "",
+			want: "",
+		},
+		{
+			name: "Long text is truncated",
+			body: "<title>" + strings.Repeat("x", 300) + "</title>",
+			want: strings.Repeat("x", maxErrorTextLength-1) + "…",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describeErrorPage([]byte(tt.body)); got != tt.want {
+				t.Errorf("describeErrorPage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSCDBDownloader_DownloadLimit(t *testing.T) {
+	t.Run("Save path returns ErrDownloadLimitReached", func(t *testing.T) {
+		tempDir := CreateTempDir(t, "scdb_limit_test")
+		defer func() { _ = os.RemoveAll(tempDir) }()
+
+		downloader := NewDownloader(CreateTestConfig())
+		resp := &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"text/html"}},
+			Body:       io.NopCloser(strings.NewReader(downloadLimitPage)),
+		}
+
+		path := filepath.Join(tempDir, "garmin.zip")
+		err := downloader.saveResponseToFile(resp, path)
+		if !errors.Is(err, ErrDownloadLimitReached) {
+			t.Fatalf("saveResponseToFile() error = %v, want ErrDownloadLimitReached", err)
+		}
+		AssertErrorContains(t, err, "Your daily download limit has been reached.")
+		AssertFileNotExists(t, path)
+	})
+
+	t.Run("Per-country downloads stop at the limit", func(t *testing.T) {
+		mockServer := NewMockSCDBServer()
+		defer mockServer.Close()
+		mockServer.limitReached = true
+
+		tempDir := CreateTempDir(t, "scdb_limit_run_test")
+		defer func() { _ = os.RemoveAll(tempDir) }()
+
+		config := CreateTestConfig()
+		config.OutputDir = tempDir
+		config.Countries = []string{"NL", "B", "D"}
+		config.SeparateByCountry = true
+
+		err := CreateMockDownloader(config, mockServer).Run()
+		if !errors.Is(err, ErrDownloadLimitReached) {
+			t.Fatalf("Run() error = %v, want ErrDownloadLimitReached", err)
+		}
+		if _, fixed, mobile := mockServer.GetStats(); fixed != 1 || mobile != 0 {
+			t.Errorf("download calls = %d fixed, %d mobile; want 1 and 0", fixed, mobile)
+		}
+	})
+
+	t.Run("Pages that only mention the limit", func(t *testing.T) {
+		for name, page := range map[string]string{
+			"Footer notice": `<html><body><p>Welcome</p><footer>Your daily download limit has been reached? Upgrade.</footer></body></html>`,
+			"Login page":    `<html><body><div class="alert">Your daily download limit has been reached.</div><form><input type="password" name="u_password"></form></body></html>`,
+		} {
+			resp := &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"text/html"}},
+				Body:       io.NopCloser(strings.NewReader(page)),
+			}
+			err := NewDownloader(CreateTestConfig()).saveResponseToFile(resp, filepath.Join(t.TempDir(), "garmin.zip"))
+			var pageErr *htmlPageError
+			if errors.Is(err, ErrDownloadLimitReached) || !errors.As(err, &pageErr) {
+				t.Errorf("%s: saveResponseToFile() error = %v, want an HTML page error for re-authentication", name, err)
+			}
+		}
+	})
+}
+
+func TestSCDBDownloader_saveResponseToFileVerifyZip(t *testing.T) {
+	tempDir := CreateTempDir(t, "scdb_verify_zip_test")
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	validZip := string(MockZipContent(map[string]string{"NL.gpi": "cameras"}))
+
+	tests := []struct {
+		name        string
+		contentType string
+		content     string
+		verifyZip   bool
+		wantErr     bool
+	}{
+		{"Valid ZIP archive", "application/zip", validZip, true, false},
+		{"Valid ZIP as octetstream", "application/octetstream", validZip, true, false},
+		{"Truncated ZIP", "application/zip", validZip[:len(validZip)/2], true, true},
+		{"Error page with ZIP content type", "application/zip", "<html>Session expired</html>", true, true},
+		{"Octetstream garbage", "application/octetstream", "not a zip", true, true},
+		{"Verification disabled", "application/zip", "not a zip", false, false},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := CreateTestConfig()
+			config.VerifyZip = tt.verifyZip
+			downloader := NewDownloader(config)
+
+			resp := &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     make(http.Header),
+				Body:       io.NopCloser(strings.NewReader(tt.content)),
+			}
+			resp.Header.Set("Content-Type", tt.contentType)
+
+			outputPath := filepath.Join(tempDir, fmt.Sprintf("verify-%d.zip", i))
+			err := downloader.saveResponseToFile(resp, outputPath)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("saveResponseToFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				if !errors.Is(err, ErrNotAZip) {
+					t.Errorf("saveResponseToFile() error = %v, want ErrNotAZip", err)
+				}
+				// Invalid archives must not be left behind
+				AssertFileNotExists(t, outputPath)
+				AssertFileNotExists(t, partialPath(outputPath))
+			} else {
+				AssertFileExists(t, outputPath, int64(len(tt.content)))
+			}
+		})
+	}
+}
+
+func TestSCDBDownloader_saveResponseToFileKeepsExisting(t *testing.T) {
+	tempDir := CreateTempDir(t, "scdb_keep_existing_test")
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	existing := MockZipContent(map[string]string{"NL.gpi": "previous"})
+	// A different size, so the response does not look like the existing file
+	update := MockZipContent(map[string]string{"NL.gpi": "current", "B.gpi": "current"})
+
+	tests := []struct {
+		name          string
+		body          io.Reader
+		contentLength int64
+		errMsg        string
+	}{
+		{"Invalid archive", strings.NewReader("not a zip"), 0, "not a valid ZIP archive"},
+		{"Interrupted transfer", io.MultiReader(strings.NewReader("PK\x03\x04"), iotest.ErrReader(io.ErrUnexpectedEOF)), 0, "failed to save file"},
+		// The body ends cleanly, but short of the announced length
+		{"Truncated body", bytes.NewReader(update[:len(update)/2]), int64(len(update)), fmt.Sprintf("received %d of %d bytes", len(update)/2, len(update))},
+		{"Empty body", strings.NewReader(""), int64(len(update)), fmt.Sprintf("received 0 of %d bytes", len(update))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputPath := filepath.Join(tempDir, "garmin.zip")
+			if err := os.WriteFile(outputPath, existing, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			config := CreateTestConfig()
+			config.VerifyZip = true
+			downloader := NewDownloader(config)
+
+			resp := &http.Response{
+				StatusCode:    http.StatusOK,
+				Header:        http.Header{"Content-Type": {"application/zip"}},
+				Body:          io.NopCloser(tt.body),
+				ContentLength: tt.contentLength,
+			}
+			err := downloader.saveResponseToFile(resp, outputPath)
+			AssertErrorContains(t, err, tt.errMsg)
+
+			data, err := os.ReadFile(outputPath)
+			AssertNoError(t, err)
+			if !bytes.Equal(data, existing) {
+				t.Error("existing garmin.zip was modified by a failed download")
+			}
+			AssertFileNotExists(t, partialPath(outputPath))
+		})
+	}
+}
+
+func TestSCDBDownloader_saveResponseToFileNoClobber(t *testing.T) {
+	existing := MockZipContent(map[string]string{"NL.gpi": "previous"})
+	update := MockZipContent(map[string]string{"NL.gpi": "current", "B.gpi": "current"})
+
+	tests := []struct {
+		name       string
+		noClobber  bool
+		backup     bool
+		wantErr    bool
+		wantFile   []byte
+		wantBackup []byte
+	}{
+		{"Overwrite by default", false, false, false, update, nil},
+		{"No clobber", true, false, true, existing, nil},
+		{"Backup", false, true, false, update, existing},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputPath := filepath.Join(t.TempDir(), "garmin.zip")
+			if err := os.WriteFile(outputPath, existing, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			config := CreateTestConfig()
+			config.NoClobber = tt.noClobber
+			config.Backup = tt.backup
+			body := bytes.NewReader(update)
+			resp := &http.Response{
+				StatusCode:    http.StatusOK,
+				Header:        http.Header{"Content-Type": {"application/zip"}},
+				Body:          io.NopCloser(body),
+				ContentLength: int64(len(update)),
+			}
+			err := NewDownloader(config).saveResponseToFile(resp, outputPath)
+			if tt.wantErr {
+				if !errors.Is(err, ErrOutputExists) {
+					t.Fatalf("saveResponseToFile() error = %v, want ErrOutputExists", err)
+				}
+				if body.Len() != len(update) {
+					t.Error("saveResponseToFile() read the response before refusing to clobber")
+				}
+			} else {
+				AssertNoError(t, err)
+			}
+
+			data, err := os.ReadFile(outputPath)
+			AssertNoError(t, err)
+			if !bytes.Equal(data, tt.wantFile) {
+				t.Error("garmin.zip does not hold the expected archive")
+			}
+			if tt.wantBackup == nil {
+				AssertFileNotExists(t, backupPath(outputPath))
+				return
+			}
+			data, err = os.ReadFile(backupPath(outputPath))
+			AssertNoError(t, err)
+			if !bytes.Equal(data, tt.wantBackup) {
+				t.Error("garmin.zip.bak does not hold the previous archive")
+			}
+		})
+	}
+
+	// Without an existing file there is nothing to refuse or back up
+	outputPath := filepath.Join(t.TempDir(), "garmin.zip")
+	config := CreateTestConfig()
+	config.NoClobber = true
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/zip"}},
+		Body:       io.NopCloser(bytes.NewReader(update)),
+	}
+	AssertNoError(t, NewDownloader(config).saveResponseToFile(resp, outputPath))
+	AssertFileExists(t, outputPath, int64(len(update)))
+}
+
+func TestSCDBDownloader_saveResponseToFileProgress(t *testing.T) {
+	tempDir := CreateTempDir(t, "scdb_progress_test")
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	content := strings.Repeat("x", 3*progressBytes+17)
+
+	tests := []struct {
+		name          string
+		contentLength int64
+	}{
+		{"Known Content-Length", int64(len(content))},
+		{"Unknown Content-Length", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []int64
+			var totals []int64
+
+			downloader := NewDownloader(CreateTestConfig())
+			downloader.ProgressFunc = func(written, total int64) {
+				calls = append(calls, written)
+				totals = append(totals, total)
+			}
+
+			resp := &http.Response{
+				StatusCode:    http.StatusOK,
+				Header:        make(http.Header),
+				Body:          io.NopCloser(strings.NewReader(content)),
+				ContentLength: tt.contentLength,
+			}
+			resp.Header.Set("Content-Type", "application/zip")
+
+			err := downloader.saveResponseToFile(resp, filepath.Join(tempDir, "progress.zip"))
+			AssertNoError(t, err)
+
+			if len(calls) < 3 {
+				t.Fatalf("ProgressFunc called %d times, want at least 3", len(calls))
+			}
+
+			// Progress must be monotonic and finish at the full size
+			for i := 1; i < len(calls); i++ {
+				if calls[i] < calls[i-1] {
+					t.Errorf("progress went backwards: %d after %d", calls[i], calls[i-1])
+				}
+			}
+
+			last := len(calls) - 1
+			if calls[last] != int64(len(content)) || totals[last] != int64(len(content)) {
+				t.Errorf("final progress = %d/%d, want %d/%d", calls[last], totals[last], len(content), len(content))
+			}
+			if tt.contentLength < 0 && totals[0] != -1 {
+				t.Errorf("total before EOF = %d, want -1", totals[0])
+			}
+		})
+	}
+}
+
+func TestSCDBDownloader_Run(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     *Config
+		setupMock  func(*MockSCDBServer)
+		wantErr    bool
+		errMsg     string
+		wantFixed  bool
+		wantMobile bool
+	}{
+		{
+			name: "Download both fixed and mobile",
+			config: &Config{
+				Username:        "testuser",
+				Password:        "testpass",
+				Countries:       []string{"NL"},
+				DisplayType:     1,
+				IconSize:        5,
+				AcceptAgreement: true,
+				DownloadFixed:   true,
+				DownloadMobile:  true,
+				VerifyZip:       true,
+			},
+			wantErr:    false,
+			wantFixed:  true,
+			wantMobile: true,
+		},
+		{
+			name: "Download only fixed",
+			config: &Config{
+				Username:        "testuser",
+				Password:        "testpass",
+				Countries:       []string{"NL"},
+				DisplayType:     1,
+				IconSize:        5,
+				AcceptAgreement: true,
+				DownloadFixed:   true,
+				DownloadMobile:  false,
+			},
+			wantErr:    false,
+			wantFixed:  true,
+			wantMobile: false,
 		},
 		{
 			name: "Download only mobile",
 			config: &Config{
 				Username:       "testuser",
 				Password:       "testpass",
-				OutputDir:      tempDir,
 				Countries:      []string{"NL"},
 				DisplayType:    1,
 				IconSize:       5,
@@ -278,282 +1215,2453 @@ func TestSCDBDownloader_Run(t *testing.T) {
 			wantFixed:  false,
 			wantMobile: true,
 		},
+		{
+			name:      "Login failure aborts run",
+			config:    CreateTestConfig(),
+			setupMock: func(m *MockSCDBServer) { m.SetFailures(true, false, false) },
+			wantErr:   true,
+			errMsg:    "login failed",
+		},
+		{
+			name:      "Fixed download failure",
+			config:    CreateTestConfig(),
+			setupMock: func(m *MockSCDBServer) { m.SetFailures(false, true, false) },
+			wantErr:   true,
+			errMsg:    "failed to download fixed cameras",
+		},
+		{
+			name:      "Mobile download failure",
+			config:    CreateTestConfig(),
+			setupMock: func(m *MockSCDBServer) { m.SetFailures(false, false, true) },
+			wantErr:   true,
+			errMsg:    "failed to download mobile cameras",
+			wantFixed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := NewMockSCDBServer()
+			defer mockServer.Close()
+
+			if tt.setupMock != nil {
+				tt.setupMock(mockServer)
+			}
+
+			tempDir := CreateTempDir(t, "scdb_run_test")
+			defer func() { _ = os.RemoveAll(tempDir) }()
+
+			tt.config.OutputDir = tempDir
+			downloader := CreateMockDownloader(tt.config, mockServer)
+
+			err := downloader.Run()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				AssertErrorContains(t, err, tt.errMsg)
+			}
+
+			fixedPath := filepath.Join(tempDir, "garmin.zip")
+			mobilePath := filepath.Join(tempDir, "garmin-mobile.zip")
+
+			if tt.wantFixed {
+				AssertFileExists(t, fixedPath, 1)
+			} else {
+				AssertFileNotExists(t, fixedPath)
+			}
+
+			if tt.wantMobile {
+				AssertFileExists(t, mobilePath, 1)
+			} else {
+				AssertFileNotExists(t, mobilePath)
+			}
+		})
+	}
+}
+
+func TestSCDBDownloader_outputPath(t *testing.T) {
+	today := time.Now().Format(time.DateOnly)
+	tests := []struct {
+		name     string
+		template string
+		typ      string
+		country  string
+		want     string
+	}{
+		{"Default fixed", "", "fixed", "", "garmin.zip"},
+		{"Default per country", "", "fixed", "NL", "garmin-NL.zip"},
+		{"Default mobile", "", "mobile", "", "garmin-mobile.zip"},
+		{"Type and date", "garmin-{{.Type}}-{{.Date}}.zip", "mobile", "", "garmin-mobile-" + today + ".zip"},
+		{"Joined countries", "{{.Countries}}-{{.Type}}.zip", "fixed", "", "NL-B-fixed.zip"},
+		{"Countries of a per-country download", "{{.Countries}}.zip", "fixed", "D", "D.zip"},
+		{"Danger zones", "", "fixed", "", "garmin-dangerzones.zip"},
+		{"Danger zones per country", "", "fixed", "NL", "garmin-dangerzones-NL.zip"},
+		{"Danger zones leave mobile alone", "", "mobile", "", "garmin-mobile.zip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := CreateTestConfig()
+			config.OutputDir = "out"
+			config.FilenameTemplate = tt.template
+			config.DangerZonesOnly = strings.HasPrefix(tt.name, "Danger zones")
+
+			got, err := NewDownloader(config).outputPath(tt.typ, tt.country)
+			AssertNoError(t, err)
+			if want := filepath.Join("out", tt.want); got != want {
+				t.Errorf("outputPath(%q, %q) = %q, want %q", tt.typ, tt.country, got, want)
+			}
+		})
+	}
+
+	// Templates that render nothing or leave the output directory are rejected
+	for _, template := range []string{"{{if .Country}}x{{end}}", ".", "..", "a/b.zip", `a\b.zip`} {
+		config := CreateTestConfig()
+		config.FilenameTemplate = template
+		_, err := NewDownloader(config).outputPath("fixed", "")
+		if !errors.Is(err, ErrInvalidFilename) {
+			t.Errorf("outputPath() with template %q error = %v, want ErrInvalidFilename", template, err)
+		}
+	}
+}
+
+func TestSCDBDownloader_OutputPaths(t *testing.T) {
+	sep := string(filepath.Separator)
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   []string
+	}{
+		{"Default", func(c *Config) {}, []string{"out/garmin.zip", "out/garmin-mobile.zip"}},
+		{"Per country", func(c *Config) { c.SeparateByCountry = true; c.DownloadMobile = false }, []string{"out/garmin-NL.zip", "out/garmin-B.zip"}},
+		{"Type directories", func(c *Config) { c.FixedOutputDir = "fixed"; c.MobileOutputDir = "mobile" }, []string{"fixed/garmin.zip", "mobile/garmin-mobile.zip"}},
+		{"Extract and checksums", func(c *Config) { c.Extract = true; c.Checksums = true }, []string{"out/garmin.zip", "out/garmin" + sep, "out/garmin-mobile.zip", "out/checksums.txt"}},
+		{"Extract only", func(c *Config) { c.Extract = true; c.ExtractOnly = true; c.DownloadMobile = false }, []string{"out/garmin" + sep}},
+		{"Only changed", func(c *Config) { c.SeparateByCountry = true; c.OnlyChanged = true; c.DownloadMobile = false }, []string{"out/garmin-NL.zip", "out/garmin-B.zip", "out/state.json"}},
+		{"Stdout", func(c *Config) { c.OutputDir = StdoutOutput; c.DownloadMobile = false }, []string{StdoutOutput}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := CreateTestConfig()
+			config.OutputDir = "out"
+			config.DownloadFixed, config.DownloadMobile = true, true
+			tt.modify(config)
+
+			got, err := NewDownloader(config).OutputPaths()
+			AssertNoError(t, err)
+			want := make([]string, len(tt.want))
+			for i, path := range tt.want {
+				want[i] = filepath.FromSlash(path)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("OutputPaths() = %q, want %q", got, want)
+			}
+		})
+	}
+
+	// Archive mode writes into a timestamped directory and moves the latest link
+	config := CreateTestConfig()
+	config.OutputDir = "out"
+	config.DownloadFixed, config.DownloadMobile = true, false
+	config.Archive = true
+	d := NewDownloader(config)
+	d.started = time.Date(2025, 3, 1, 6, 30, 0, 0, time.UTC)
+	got, err := d.OutputPaths()
+	AssertNoError(t, err)
+	want := []string{filepath.Join(d.outputDir(), "garmin.zip"), filepath.Join("out", latestDir)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("OutputPaths() in archive mode = %q, want %q", got, want)
+	}
+
+	config = CreateTestConfig()
+	config.FilenameTemplate = "a/b.zip"
+	if _, err := NewDownloader(config).OutputPaths(); !errors.Is(err, ErrInvalidFilename) {
+		t.Errorf("OutputPaths() with an invalid template error = %v, want ErrInvalidFilename", err)
+	}
+}
+
+func TestSCDBDownloader_RunFilenameTemplate(t *testing.T) {
+	mockServer := NewMockSCDBServer()
+	defer mockServer.Close()
+
+	tempDir := CreateTempDir(t, "scdb_filename_template_test")
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	config := CreateTestConfig()
+	config.OutputDir = tempDir
+	config.FilenameTemplate = "garmin-{{.Type}}-{{.Date}}.zip"
+	AssertNoError(t, ValidateConfig(config))
+	AssertNoError(t, CreateMockDownloader(config, mockServer).Run())
+
+	today := time.Now().Format(time.DateOnly)
+	AssertFileExists(t, filepath.Join(tempDir, "garmin-fixed-"+today+".zip"), 1)
+	AssertFileExists(t, filepath.Join(tempDir, "garmin-mobile-"+today+".zip"), 1)
+	AssertFileNotExists(t, filepath.Join(tempDir, "garmin.zip"))
+}
+
+func TestSCDBDownloader_RunServerFilename(t *testing.T) {
+	tests := []struct {
+		name              string
+		fixedDisposition  string
+		mobileDisposition string
+		want              map[string]string // file name by type
+	}{
+		{
+			name:              "Server names",
+			fixedDisposition:  `attachment; filename="scdb-garmin-2025.zip"`,
+			mobileDisposition: "attachment; filename=scdb-mobile.zip",
+			want:              map[string]string{"fixed": "scdb-garmin-2025.zip", "mobile": "scdb-mobile.zip"},
+		},
+		{
+			name:              "Unsafe names fall back to the standard ones",
+			fixedDisposition:  `attachment; filename="../garmin.zip"`,
+			mobileDisposition: `attachment; filename="mobile.exe"`,
+			want:              map[string]string{"fixed": "garmin.zip", "mobile": "garmin-mobile.zip"},
+		},
+		{
+			name:              "A name the run already wrote falls back",
+			fixedDisposition:  "attachment; filename=cameras.zip",
+			mobileDisposition: "attachment; filename=cameras.zip",
+			want:              map[string]string{"fixed": "cameras.zip", "mobile": "garmin-mobile.zip"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := NewMockSCDBServer()
+			defer mockServer.Close()
+			mockServer.fixedDisposition = tt.fixedDisposition
+			mockServer.mobileDisposition = tt.mobileDisposition
+
+			config := CreateTestConfig()
+			config.OutputDir = t.TempDir()
+			config.UseServerFilename = true
+			AssertNoError(t, ValidateConfig(config))
+			result, err := CreateMockDownloader(config, mockServer).RunWithResult(context.Background())
+			AssertNoError(t, err)
+
+			got := map[string]string{}
+			for _, file := range result.Files {
+				got[file.Type] = filepath.Base(file.Path)
+				AssertFileExists(t, file.Path, 1)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("files = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSCDBDownloader_RunDiff(t *testing.T) {
+	old := MockZipContent(map[string]string{"NL.gpi": "old_content", "D.gpi": "mock_garmin_content_D"})
+
+	for _, replace := range []bool{false, true} {
+		t.Run(fmt.Sprintf("Replace %v", replace), func(t *testing.T) {
+			mockServer := NewMockSCDBServer()
+			defer mockServer.Close()
+
+			config := CreateTestConfig()
+			config.OutputDir = t.TempDir()
+			config.DownloadMobile = false
+			config.Diff = true
+			AssertNoError(t, ValidateConfig(config))
+			path := filepath.Join(config.OutputDir, "garmin.zip")
+			AssertNoError(t, os.WriteFile(path, old, 0644))
+
+			downloader := CreateMockDownloader(config, mockServer)
+			var got *ArchiveDiff
+			downloader.DiffFunc = func(p string, diff *ArchiveDiff) bool {
+				if p != path {
+					t.Errorf("DiffFunc path = %q, want %q", p, path)
+				}
+				got = diff
+				return replace
+			}
+			result, err := downloader.RunWithResult(context.Background())
+			AssertNoError(t, err)
+
+			if got == nil {
+				t.Fatal("DiffFunc was not called")
+			}
+			names := func(entries []ArchiveEntry) []string {
+				var names []string
+				for _, e := range entries {
+					names = append(names, e.Name)
+				}
+				return names
+			}
+			if !slices.Equal(names(got.Added), []string{"B.gpi"}) || !slices.Equal(names(got.Removed), []string{"D.gpi"}) ||
+				len(got.Changed) != 1 || got.Changed[0].New.Name != "NL.gpi" || got.Changed[0].Old.Size != int64(len("old_content")) {
+				t.Errorf("diff = %+v, want B.gpi added, D.gpi removed and NL.gpi changed", got)
+			}
+
+			data, err := os.ReadFile(path)
+			AssertNoError(t, err)
+			if replaced := !bytes.Equal(data, old); replaced != replace {
+				t.Errorf("existing file replaced = %v, want %v", replaced, replace)
+			}
+			wantPath := path
+			if !replace {
+				wantPath = path + ".new"
+				AssertFileExists(t, wantPath, 1)
+			} else {
+				AssertFileNotExists(t, path+".new")
+			}
+			if len(result.Files) != 1 || result.Files[0].Path != wantPath || result.Files[0].Type != "fixed" {
+				t.Errorf("files = %+v, want the fixed archive at %s", result.Files, wantPath)
+			}
+		})
+	}
+}
+
+func TestSCDBDownloader_RunAutoReauth(t *testing.T) {
+	tests := []struct {
+		name       string
+		autoReauth bool
+		loginPages int // fixed downloads answered with the login page
+		wantErr    string
+		wantLogins int
+		wantFixed  int
+	}{
+		{name: "Logs in again and retries", autoReauth: true, loginPages: 1, wantLogins: 2, wantFixed: 2},
+		{name: "Page again after logging in", autoReauth: true, loginPages: 2, wantErr: `unexpected response (not a valid ZIP archive): "SCDB Login"`, wantLogins: 2, wantFixed: 2},
+		{name: "Disabled", autoReauth: false, loginPages: 1, wantErr: "not a valid ZIP archive", wantLogins: 1, wantFixed: 1},
+		{name: "No page", autoReauth: true, wantLogins: 1, wantFixed: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := NewMockSCDBServer()
+			defer mockServer.Close()
+			mockServer.loginPageDownloads = tt.loginPages
+
+			config := CreateTestConfig()
+			config.OutputDir = t.TempDir()
+			config.DownloadMobile = false
+			config.VerifyZip = true
+			config.AutoReauth = tt.autoReauth
+			err := CreateMockDownloader(config, mockServer).RunContext(context.Background())
+
+			if tt.wantErr != "" {
+				AssertErrorContains(t, err, tt.wantErr)
+				AssertFileNotExists(t, filepath.Join(config.OutputDir, "garmin.zip"))
+			} else {
+				AssertNoError(t, err)
+				AssertFileExists(t, filepath.Join(config.OutputDir, "garmin.zip"), 1)
+			}
+			if login, fixed, _ := mockServer.GetStats(); login != tt.wantLogins || fixed != tt.wantFixed {
+				t.Errorf("logins = %d, fixed downloads = %d; want %d and %d", login, fixed, tt.wantLogins, tt.wantFixed)
+			}
+		})
+	}
+}
+
+func TestDiffArchives(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, entries map[string]string) string {
+		path := filepath.Join(dir, name)
+		AssertNoError(t, os.WriteFile(path, MockZipContent(entries), 0644))
+		return path
+	}
+	a := write("a.zip", map[string]string{"same.gpi": "x", "size.gpi": "short", "content.gpi": "abc", "gone.gpi": "1", "dir/": ""})
+	b := write("b.zip", map[string]string{"same.gpi": "x", "size.gpi": "longer", "content.gpi": "abd", "new.gpi": "2"})
+
+	sum := func(s string) string { return fmt.Sprintf("%x", sha256.Sum256([]byte(s))) }
+
+	diff, err := DiffArchives(a, b)
+	AssertNoError(t, err)
+	want := &ArchiveDiff{
+		Added:   []ArchiveEntry{{Name: "new.gpi", Size: 1, SHA256: sum("2")}},
+		Removed: []ArchiveEntry{{Name: "gone.gpi", Size: 1, SHA256: sum("1")}},
+		Changed: []EntryChange{
+			{Old: ArchiveEntry{Name: "content.gpi", Size: 3, SHA256: sum("abc")}, New: ArchiveEntry{Name: "content.gpi", Size: 3, SHA256: sum("abd")}},
+			{Old: ArchiveEntry{Name: "size.gpi", Size: 5, SHA256: sum("short")}, New: ArchiveEntry{Name: "size.gpi", Size: 6, SHA256: sum("longer")}},
+		},
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("DiffArchives() = %+v, want %+v", diff, want)
+	}
+
+	diff, err = DiffArchives(a, a)
+	AssertNoError(t, err)
+	if !diff.Empty() {
+		t.Errorf("DiffArchives() of an archive with itself = %+v, want no differences", diff)
+	}
+
+	_, err = DiffArchives(a, filepath.Join(dir, "missing.zip"))
+	AssertErrorContains(t, err, "failed to open")
+}
+
+func TestServerFilename(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+		ok     bool
+	}{
+		{"attachment; filename=garmin.zip", "garmin.zip", true},
+		{`attachment; filename="Garmin Cameras.ZIP"`, "Garmin Cameras.ZIP", true},
+		{"attachment; filename*=UTF-8''kamera-%C3%BCbersicht.zip", "kamera-übersicht.zip", true},
+		{"", "", false},
+		{"attachment", "", false},
+		{`attachment; filename="../../etc/garmin.zip"`, "", false},
+		{`attachment; filename="..\\garmin.zip"`, "", false},
+		{`attachment; filename="C:garmin.zip"`, "", false},
+		{"attachment; filename=.garmin.zip", "", false},
+		{"attachment; filename=garmin.gpi", "", false},
+		{"attachment; filename=\"garmin\x01.zip\"", "", false},
+		{"attachment; filename=", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			got, ok := serverFilename(tt.header)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("serverFilename(%q) = %q, %v; want %q, %v", tt.header, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSCDBDownloader_RunUnwritableOutput(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// A regular file where the output directory should be
+	blocked := filepath.Join(tempDir, "file")
+	AssertNoError(t, os.WriteFile(blocked, nil, 0644))
+
+	readOnly := filepath.Join(tempDir, "readonly")
+	AssertNoError(t, os.Mkdir(readOnly, 0555))
+
+	tests := []struct {
+		name   string
+		dir    string
+		errMsg string
+	}{
+		{"Output path is a file", filepath.Join(blocked, "out"), "failed to create output directory"},
+		{"Read-only output directory", readOnly, "is not writable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.dir == readOnly && os.Geteuid() == 0 {
+				t.Skip("root can write to read-only directories")
+			}
+
+			mockServer := NewMockSCDBServer()
+			defer mockServer.Close()
+
+			config := CreateTestConfig()
+			config.OutputDir = tt.dir
+			AssertErrorContains(t, CreateMockDownloader(config, mockServer).Run(), tt.errMsg)
+
+			// Nothing was sent, so no download was used up
+			if login, fixed, mobile := mockServer.GetStats(); login+fixed+mobile != 0 {
+				t.Errorf("requests = %d/%d/%d, want none", login, fixed, mobile)
+			}
+		})
+	}
+
+	t.Run("Missing output directory is created", func(t *testing.T) {
+		mockServer := NewMockSCDBServer()
+		defer mockServer.Close()
+
+		config := CreateTestConfig()
+		config.OutputDir = filepath.Join(tempDir, "new", "dir")
+		AssertNoError(t, CreateMockDownloader(config, mockServer).Run())
+		AssertFileExists(t, filepath.Join(config.OutputDir, "garmin.zip"), 1)
+
+		entries, err := os.ReadDir(config.OutputDir)
+		AssertNoError(t, err)
+		if len(entries) != 2 {
+			t.Errorf("output directory holds %d entries, want only the two archives", len(entries))
+		}
+	})
+}
+
+func TestSCDBDownloader_RunArchive(t *testing.T) {
+	mockServer := NewMockSCDBServer()
+	defer mockServer.Close()
+
+	tempDir := CreateTempDir(t, "scdb_archive_test")
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	// Older runs, one of which falls outside -keep 2, and an unrelated directory
+	archive := filepath.Join(tempDir, archiveDir)
+	for _, name := range []string{"2020-01-01-000000", "2021-06-30-120000", "notes"} {
+		AssertNoError(t, os.MkdirAll(filepath.Join(archive, name), 0755))
+	}
+	AssertNoError(t, updateLatest(filepath.Join(tempDir, latestDir), filepath.Join(archive, "2021-06-30-120000")))
+
+	config := CreateTestConfig()
+	config.OutputDir = tempDir
+	config.Archive = true
+	config.Keep = 2
+	config.Checksums = true
+	downloader := CreateMockDownloader(config, mockServer)
+	result, err := downloader.RunWithResult(context.Background())
+	AssertNoError(t, err)
+
+	runDir := filepath.Join(archive, downloader.started.Format(archiveStampLayout))
+	for _, name := range []string{"garmin.zip", "garmin-mobile.zip", checksumsFile} {
+		AssertFileExists(t, filepath.Join(runDir, name), 1)
+		AssertFileExists(t, filepath.Join(tempDir, latestDir, name), 1)
+	}
+	AssertFileNotExists(t, filepath.Join(tempDir, "garmin.zip"))
+	if len(result.Files) != 2 || filepath.Dir(result.Files[0].Path) != runDir {
+		t.Errorf("RunWithResult() files = %+v, want two in %s", result.Files, runDir)
+	}
+
+	AssertFileNotExists(t, filepath.Join(archive, "2020-01-01-000000"))
+	AssertFileExists(t, filepath.Join(archive, "2021-06-30-120000"), 0)
+	AssertFileExists(t, filepath.Join(archive, "notes"), 0)
+}
+
+func TestUpdateLatest(t *testing.T) {
+	tempDir := t.TempDir()
+	latest := filepath.Join(tempDir, latestDir)
+
+	for _, run := range []string{"2024-01-01-000000", "2024-01-02-000000"} {
+		runDir := filepath.Join(tempDir, archiveDir, run)
+		AssertNoError(t, os.MkdirAll(filepath.Join(runDir, "garmin"), 0755))
+		AssertNoError(t, os.WriteFile(filepath.Join(runDir, "garmin", "run.txt"), []byte(run), 0644))
+
+		AssertNoError(t, updateLatest(latest, runDir))
+		data, err := os.ReadFile(filepath.Join(latest, "garmin", "run.txt"))
+		AssertNoError(t, err)
+		if string(data) != run {
+			t.Errorf("latest holds run %q, want %q", data, run)
+		}
+	}
+
+	// A copy left by the fallback is replaced as well
+	AssertNoError(t, os.Remove(latest))
+	AssertNoError(t, copyDir(filepath.Join(tempDir, archiveDir, "2024-01-01-000000"), latest))
+	AssertNoError(t, updateLatest(latest, filepath.Join(tempDir, archiveDir, "2024-01-02-000000")))
+	if data, err := os.ReadFile(filepath.Join(latest, "garmin", "run.txt")); err != nil || string(data) != "2024-01-02-000000" {
+		t.Errorf("latest holds %q (%v), want the newest run", data, err)
+	}
+}
+
+func TestSCDBDownloader_RunSeparateByCountry(t *testing.T) {
+	t.Run("One archive per country", func(t *testing.T) {
+		mockServer := NewMockSCDBServer()
+		defer mockServer.Close()
+
+		tempDir := CreateTempDir(t, "scdb_separate_test")
+		defer func() { _ = os.RemoveAll(tempDir) }()
+
+		config := CreateTestConfig()
+		config.OutputDir = tempDir
+		config.Countries = []string{"NL", "B", "D"}
+		config.DownloadMobile = false
+		config.SeparateByCountry = true
+		config.Verbose = true
+
+		err := CreateMockDownloader(config, mockServer).Run()
+		AssertNoError(t, err)
+
+		for _, country := range config.Countries {
+			AssertFileExists(t, filepath.Join(tempDir, "garmin-"+country+".zip"), 1)
+		}
+		AssertFileNotExists(t, filepath.Join(tempDir, "garmin.zip"))
+
+		if _, fixed, _ := mockServer.GetStats(); fixed != 3 {
+			t.Errorf("fixed download calls = %d, want 3", fixed)
+		}
+	})
+
+	t.Run("Failures are collected per country", func(t *testing.T) {
+		mockServer := NewMockSCDBServer()
+		defer mockServer.Close()
+		mockServer.failCountry = "B"
+
+		tempDir := CreateTempDir(t, "scdb_separate_fail_test")
+		defer func() { _ = os.RemoveAll(tempDir) }()
+
+		config := CreateTestConfig()
+		config.OutputDir = tempDir
+		config.Countries = []string{"NL", "B", "D"}
+		config.DownloadMobile = false
+		config.SeparateByCountry = true
+
+		err := CreateMockDownloader(config, mockServer).Run()
+		AssertErrorContains(t, err, "B: download fixed: POST /my/downloadsection: 400 Bad Request: unexpected response")
+
+		// The countries after the failure are still downloaded
+		AssertFileExists(t, filepath.Join(tempDir, "garmin-NL.zip"), 1)
+		AssertFileExists(t, filepath.Join(tempDir, "garmin-D.zip"), 1)
+		AssertFileNotExists(t, filepath.Join(tempDir, "garmin-B.zip"))
+	})
+
+	for _, tt := range []struct {
+		concurrency int
+		wantMax     int
+	}{{0, 1}, {1, 1}, {3, 3}} {
+		t.Run(fmt.Sprintf("Concurrency %d", tt.concurrency), func(t *testing.T) {
+			mockServer := NewMockSCDBServer()
+			defer mockServer.Close()
+			mockServer.failCountry = "D"
+			mockServer.fixedDelay = 50 * time.Millisecond
+
+			tempDir := CreateTempDir(t, "scdb_concurrency_test")
+			defer func() { _ = os.RemoveAll(tempDir) }()
+
+			config := CreateTestConfig()
+			config.OutputDir = tempDir
+			config.Countries = []string{"NL", "B", "D", "A", "CH", "L"}
+			config.DownloadMobile = false
+			config.SeparateByCountry = true
+			config.Concurrency = tt.concurrency
+
+			result, err := CreateMockDownloader(config, mockServer).RunWithResult(context.Background())
+			AssertErrorContains(t, err, "D: download fixed: POST /my/downloadsection: 400 Bad Request: unexpected response")
+
+			for _, country := range config.Countries {
+				path := filepath.Join(tempDir, "garmin-"+country+".zip")
+				if country == "D" {
+					AssertFileNotExists(t, path)
+					continue
+				}
+				AssertFileExists(t, path, 1)
+			}
+			if len(result.Files) != len(config.Countries)-1 {
+				t.Errorf("RunWithResult() recorded %d files, want %d", len(result.Files), len(config.Countries)-1)
+			}
+
+			mockServer.mu.Lock()
+			maxInFlight := mockServer.maxFixedInFlight
+			mockServer.mu.Unlock()
+			if maxInFlight > tt.wantMax || (tt.wantMax > 1 && maxInFlight < 2) {
+				t.Errorf("at most %d downloads ran at once, want %d", maxInFlight, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestSCDBDownloader_RunWithResult(t *testing.T) {
+	t.Run("Successful run", func(t *testing.T) {
+		mockServer := NewMockSCDBServer()
+		defer mockServer.Close()
+
+		tempDir := CreateTempDir(t, "scdb_result_test")
+		defer func() { _ = os.RemoveAll(tempDir) }()
+
+		config := CreateTestConfig()
+		config.OutputDir = tempDir
+		config.Countries = []string{"D", "A"}
+
+		result, err := CreateMockDownloader(config, mockServer).RunWithResult(context.Background())
+		AssertNoError(t, err)
+
+		if !result.FixedAttempted || !result.MobileAttempted {
+			t.Errorf("attempted = %v/%v, want true/true", result.FixedAttempted, result.MobileAttempted)
+		}
+		if !reflect.DeepEqual(result.Countries, config.Countries) {
+			t.Errorf("Countries = %v, want %v", result.Countries, config.Countries)
+		}
+		if len(result.Files) != 2 {
+			t.Fatalf("Files = %v, want 2 entries", result.Files)
+		}
+		for _, file := range result.Files {
+			info, err := os.Stat(file.Path)
+			AssertNoError(t, err)
+			if info.Size() != file.Bytes {
+				t.Errorf("%s: Bytes = %d, want %d", file.Path, file.Bytes, info.Size())
+			}
+		}
+		if len(result.Errors) != 0 {
+			t.Errorf("Errors = %v, want none", result.Errors)
+		}
+	})
+
+	t.Run("Failed run still reports", func(t *testing.T) {
+		mockServer := NewMockSCDBServer()
+		defer mockServer.Close()
+		mockServer.failMobile = true
+
+		tempDir := CreateTempDir(t, "scdb_result_fail_test")
+		defer func() { _ = os.RemoveAll(tempDir) }()
+
+		config := CreateTestConfig()
+		config.OutputDir = tempDir
+
+		result, err := CreateMockDownloader(config, mockServer).RunWithResult(context.Background())
+		AssertErrorContains(t, err, "failed to download mobile cameras")
+
+		if len(result.Files) != 1 || filepath.Base(result.Files[0].Path) != "garmin.zip" {
+			t.Errorf("Files = %v, want only garmin.zip", result.Files)
+		}
+		if len(result.Errors) != 1 {
+			t.Errorf("Errors = %v, want one entry", result.Errors)
+		}
+
+		data, err := json.Marshal(result)
+		AssertNoError(t, err)
+		for _, key := range []string{`"fixed_attempted":true`, `"mobile_attempted":true`, `"errors":[`} {
+			if !strings.Contains(string(data), key) {
+				t.Errorf("JSON %s missing %s", data, key)
+			}
+		}
+	})
+}
+
+func TestExtractZip(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries map[string]string
+		wantErr string
+	}{
+		{
+			name:    "Files and subdirectories",
+			entries: map[string]string{"D.gpi": "germany", "icons/D.bmp": "icon"},
+		},
+		{
+			name:    "Zip-slip entry",
+			entries: map[string]string{"../evil.txt": "escaped"},
+			wantErr: `zip entry "../evil.txt" escapes`,
+		},
+		{
+			name:    "Nested zip-slip entry",
+			entries: map[string]string{"icons/../../evil.txt": "escaped"},
+			wantErr: "escapes the extraction directory",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := CreateTempDir(t, "scdb_extract_test")
+			defer func() { _ = os.RemoveAll(tempDir) }()
+
+			archive := filepath.Join(tempDir, "garmin.zip")
+			if err := os.WriteFile(archive, MockZipContent(tt.entries), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			err := extractZip(archive, extractDir(archive))
+			if tt.wantErr != "" {
+				AssertErrorContains(t, err, tt.wantErr)
+				AssertFileNotExists(t, filepath.Join(tempDir, "evil.txt"))
+				return
+			}
+			AssertNoError(t, err)
+
+			for name, content := range tt.entries {
+				data, err := os.ReadFile(filepath.Join(tempDir, "garmin", name))
+				AssertNoError(t, err)
+				if string(data) != content {
+					t.Errorf("%s = %q, want %q", name, data, content)
+				}
+			}
+		})
+	}
+}
+
+func TestSCDBDownloader_RunExtract(t *testing.T) {
+	tests := []struct {
+		name        string
+		extractOnly bool
+	}{
+		{name: "Keep archive"},
+		{name: "Extract only", extractOnly: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := NewMockSCDBServer()
+			defer mockServer.Close()
+
+			tempDir := CreateTempDir(t, "scdb_run_extract_test")
+			defer func() { _ = os.RemoveAll(tempDir) }()
+
+			config := CreateTestConfig()
+			config.OutputDir = tempDir
+			config.Countries = []string{"NL", "B"}
+			config.DownloadMobile = false
+			config.Extract = true
+			config.ExtractOnly = tt.extractOnly
+
+			result, err := CreateMockDownloader(config, mockServer).RunWithResult(context.Background())
+			AssertNoError(t, err)
+
+			AssertFileExists(t, filepath.Join(tempDir, "garmin", "NL.gpi"), 1)
+			AssertFileExists(t, filepath.Join(tempDir, "garmin", "B.gpi"), 1)
+
+			archive := filepath.Join(tempDir, "garmin.zip")
+			if tt.extractOnly {
+				AssertFileNotExists(t, archive)
+				if len(result.Files) != 0 {
+					t.Errorf("Files = %v, want none after extract-only", result.Files)
+				}
+			} else {
+				AssertFileExists(t, archive, 1)
+			}
+		})
+	}
+}
+
+func TestLoadChecksums(t *testing.T) {
+	tempDir := CreateTempDir(t, "scdb_checksums_test")
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	sumA := strings.Repeat("a", 64)
+	sumB := strings.Repeat("B", 64)
+
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name:    "Text and binary mode entries",
+			content: sumA + "  garmin.zip\n" + sumB + " *downloads/garmin-mobile.zip\n\n# comment\n",
+			want:    map[string]string{"garmin.zip": sumA, "garmin-mobile.zip": strings.ToLower(sumB)},
+		},
+		{
+			name:    "Malformed line",
+			content: "abc garmin.zip\n",
+			wantErr: "invalid checksum manifest line 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tempDir, "manifest.txt")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := loadChecksums(path)
+			if tt.wantErr != "" {
+				AssertErrorContains(t, err, tt.wantErr)
+				return
+			}
+			AssertNoError(t, err)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadChecksums() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("Missing file", func(t *testing.T) {
+		_, err := loadChecksums(filepath.Join(tempDir, "missing.txt"))
+		AssertErrorContains(t, err, "failed to open checksum manifest")
+	})
+}
+
+func TestSCDBDownloader_RunChecksums(t *testing.T) {
+	mockServer := NewMockSCDBServer()
+	defer mockServer.Close()
+
+	tempDir := CreateTempDir(t, "scdb_run_checksums_test")
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	config := CreateTestConfig()
+	config.OutputDir = tempDir
+	config.Countries = []string{"NL"}
+	config.Checksums = true
+
+	result, err := CreateMockDownloader(config, mockServer).RunWithResult(context.Background())
+	AssertNoError(t, err)
+
+	manifestPath := filepath.Join(tempDir, "checksums.txt")
+	manifest, err := loadChecksums(manifestPath)
+	AssertNoError(t, err)
+	for _, file := range result.Files {
+		data, err := os.ReadFile(file.Path)
+		AssertNoError(t, err)
+		want := fmt.Sprintf("%x", sha256.Sum256(data))
+		if file.SHA256 != want || manifest[filepath.Base(file.Path)] != want {
+			t.Errorf("%s: sha256 = %s, manifest %s, want %s",
+				file.Path, file.SHA256, manifest[filepath.Base(file.Path)], want)
+		}
+	}
+
+	// A second run against the manifest keeps the existing files
+	fixedPath := filepath.Join(tempDir, "garmin.zip")
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(fixedPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// Force skips the size check so the manifest comparison is what keeps the files
+	config.VerifyAgainst = manifestPath
+	config.Force = true
+	result, err = CreateMockDownloader(config, mockServer).RunWithResult(context.Background())
+	AssertNoError(t, err)
+
+	for _, file := range result.Files {
+		if !file.Unchanged {
+			t.Errorf("%s: Unchanged = false, want true", file.Path)
+		}
+	}
+	if info, err := os.Stat(fixedPath); err != nil || !info.ModTime().Equal(old) {
+		t.Errorf("garmin.zip was rewritten (err %v)", err)
+	}
+	AssertFileNotExists(t, partialPath(fixedPath))
+}
+
+func TestSCDBDownloader_RunConditional(t *testing.T) {
+	tests := []struct {
+		name          string
+		force         bool
+		wantUnchanged bool
+	}{
+		{name: "Unchanged files are skipped", wantUnchanged: true},
+		{name: "Force downloads again", force: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := NewMockSCDBServer()
+			defer mockServer.Close()
+			mockServer.mobileETag = `"v1"`
+
+			tempDir := CreateTempDir(t, "scdb_conditional_test")
+			defer func() { _ = os.RemoveAll(tempDir) }()
+
+			config := CreateTestConfig()
+			config.OutputDir = tempDir
+
+			_, err := CreateMockDownloader(config, mockServer).RunWithResult(context.Background())
+			AssertNoError(t, err)
+
+			etag, err := os.ReadFile(filepath.Join(tempDir, "garmin-mobile.zip.etag"))
+			AssertNoError(t, err)
+			if strings.TrimSpace(string(etag)) != `"v1"` {
+				t.Errorf("stored ETag = %q, want %q", etag, `"v1"`)
+			}
+
+			config.Force = tt.force
+			result, err := CreateMockDownloader(config, mockServer).RunWithResult(context.Background())
+			AssertNoError(t, err)
+
+			if len(result.Files) != 2 {
+				t.Fatalf("Files = %v, want 2 entries", result.Files)
+			}
+			for _, file := range result.Files {
+				if file.Unchanged != tt.wantUnchanged {
+					t.Errorf("%s: Unchanged = %v, want %v", file.Path, file.Unchanged, tt.wantUnchanged)
+				}
+				if file.SHA256 == "" || file.Bytes == 0 {
+					t.Errorf("%s: missing checksum or size: %+v", file.Path, file)
+				}
+			}
+		})
+	}
+}
+
+func TestSCDBDownloader_RunMaxAge(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxAge       time.Duration
+		force        bool
+		staleMobile  bool
+		wantRequests [3]int // login, fixed, mobile
+	}{
+		{name: "Fresh files skip the login", maxAge: time.Hour, wantRequests: [3]int{0, 0, 0}},
+		{name: "Only the stale file is downloaded", maxAge: time.Hour, staleMobile: true, wantRequests: [3]int{1, 0, 1}},
+		{name: "Force ignores the age", maxAge: time.Hour, force: true, wantRequests: [3]int{1, 1, 1}},
+		{name: "Disabled", wantRequests: [3]int{1, 1, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := NewMockSCDBServer()
+			defer mockServer.Close()
+
+			tempDir := CreateTempDir(t, "scdb_max_age_test")
+			defer func() { _ = os.RemoveAll(tempDir) }()
+
+			archive := MockZipContent(map[string]string{"NL.gpi": "previous"})
+			for _, name := range []string{"garmin.zip", "garmin-mobile.zip"} {
+				AssertNoError(t, os.WriteFile(filepath.Join(tempDir, name), archive, 0644))
+			}
+			if tt.staleMobile {
+				old := time.Now().Add(-2 * time.Hour)
+				AssertNoError(t, os.Chtimes(filepath.Join(tempDir, "garmin-mobile.zip"), old, old))
+			}
+
+			config := CreateTestConfig()
+			config.OutputDir = tempDir
+			config.MaxAge = tt.maxAge
+			config.Force = tt.force
+			result, err := CreateMockDownloader(config, mockServer).RunWithResult(context.Background())
+			AssertNoError(t, err)
+
+			login, fixed, mobile := mockServer.GetStats()
+			if got := [3]int{login, fixed, mobile}; got != tt.wantRequests {
+				t.Errorf("login/fixed/mobile requests = %v, want %v", got, tt.wantRequests)
+			}
+			if len(result.Files) != 2 {
+				t.Fatalf("Files = %v, want 2 entries", result.Files)
+			}
+			if fresh := result.Files[0]; tt.wantRequests[1] == 0 && !fresh.Unchanged {
+				t.Errorf("fresh file %s not reported as unchanged", fresh.Path)
+			}
+		})
+	}
+}
+
+func TestSCDBDownloader_RunMaxAgeOldLastModified(t *testing.T) {
+	mockServer := NewMockSCDBServer()
+	defer mockServer.Close()
+	// The database was last published long before the max age
+	mockServer.lastModified = time.Now().Add(-30 * 24 * time.Hour)
+
+	config := CreateTestConfig()
+	config.OutputDir = t.TempDir()
+	config.MaxAge = time.Hour
+	AssertNoError(t, CreateMockDownloader(config, mockServer).Run())
+
+	// The files were just downloaded, so the next run skips the login
+	result, err := CreateMockDownloader(config, mockServer).RunWithResult(context.Background())
+	AssertNoError(t, err)
+	if login, fixed, mobile := mockServer.GetStats(); login != 1 || fixed != 1 || mobile != 1 {
+		t.Errorf("login/fixed/mobile requests = %d/%d/%d, want 1/1/1", login, fixed, mobile)
+	}
+	for _, file := range result.Files {
+		if !file.Unchanged {
+			t.Errorf("%s: Unchanged = false, want true", file.Path)
+		}
+	}
+}
+
+func TestSCDBDownloader_CancelRemovesPartialFile(t *testing.T) {
+	sent := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Length", "1000")
+		_, _ = w.Write([]byte("PK\x03\x04partial"))
+		w.(http.Flusher).Flush()
+		close(sent)
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	tempDir := CreateTempDir(t, "scdb_cancel_test")
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	config := CreateTestConfig()
+	config.BaseURL = server.URL
+	downloader := NewDownloader(config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-sent
+		cancel()
+	}()
+
+	outputPath := filepath.Join(tempDir, "garmin.zip")
+	err := downloader.downloadFixedCountries(ctx, []string{"NL"}, outputPath)
+	AssertErrorContains(t, err, "context canceled")
+
+	AssertFileNotExists(t, outputPath)
+	AssertFileNotExists(t, partialPath(outputPath))
+}
+
+func TestSCDBDownloader_ResumeDownload(t *testing.T) {
+	entries := make(map[string]string)
+	for i := 0; i < 20; i++ {
+		entries[fmt.Sprintf("C%02d.gpi", i)] = strings.Repeat(fmt.Sprintf("camera %d;", i), 200)
+	}
+	content := MockZipContent(entries)
+	half := len(content) / 2
+
+	var mu sync.Mutex
+	var mode, etag, gotRange string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		gotRange = r.Header.Get("Range")
+		currentMode, currentETag := mode, etag
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("ETag", currentETag)
+		if currentMode != "ignore ranges" {
+			w.Header().Set("Accept-Ranges", "bytes")
+		}
+		switch {
+		case currentMode == "abort":
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			_, _ = w.Write(content[:half])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		case currentMode == "ranges" && r.Header.Get("Range") != "" && r.Header.Get("If-Range") == currentETag:
+			var start int
+			_, _ = fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &start)
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(content)-1, len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(content[start:])
+		default:
+			_, _ = w.Write(content)
+		}
+	}))
+	defer server.Close()
+
+	tempDir := CreateTempDir(t, "scdb_resume_test")
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	config := CreateTestConfig()
+	config.BaseURL = server.URL
+	config.VerifyZip = true
+	config.RetryCount = 0
+	outputPath := filepath.Join(tempDir, "garmin.zip")
+	download := func(serverMode, serverETag string) (string, error) {
+		mu.Lock()
+		mode, etag = serverMode, serverETag
+		mu.Unlock()
+		err := NewDownloader(config).downloadFixedCountries(context.Background(), []string{"NL"}, outputPath)
+		mu.Lock()
+		defer mu.Unlock()
+		return gotRange, err
+	}
+	assertComplete := func(t *testing.T) {
+		t.Helper()
+		data, err := os.ReadFile(outputPath)
+		AssertNoError(t, err)
+		if !bytes.Equal(data, content) {
+			t.Errorf("garmin.zip has %d bytes, want the %d of the complete download", len(data), len(content))
+		}
+		AssertFileNotExists(t, partialPath(outputPath))
+		AssertFileNotExists(t, ifRangePath(outputPath))
+	}
+	interrupt := func(t *testing.T) {
+		t.Helper()
+		_ = os.Remove(outputPath)
+		if _, err := download("abort", `"v1"`); err == nil {
+			t.Fatal("interrupted download succeeded")
+		}
+		AssertFileNotExists(t, outputPath)
+		if info, err := os.Stat(partialPath(outputPath)); err != nil || info.Size() != int64(half) {
+			t.Fatalf("partial download = %v (err %v), want %d bytes kept", info, err, half)
+		}
+	}
+
+	t.Run("Interrupted download resumes", func(t *testing.T) {
+		interrupt(t)
+		gotRange, err := download("ranges", `"v1"`)
+		AssertNoError(t, err)
+		if want := fmt.Sprintf("bytes=%d-", half); gotRange != want {
+			t.Errorf("Range = %q, want %q", gotRange, want)
+		}
+		assertComplete(t)
+	})
+
+	t.Run("Changed file is downloaded whole", func(t *testing.T) {
+		interrupt(t)
+		_, err := download("ranges", `"v2"`)
+		AssertNoError(t, err)
+		assertComplete(t)
+	})
+
+	t.Run("Server ignoring ranges restarts", func(t *testing.T) {
+		interrupt(t)
+		_, err := download("ignore ranges", `"v1"`)
+		AssertNoError(t, err)
+		assertComplete(t)
+	})
+}
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		header    string
+		wantStart int64
+		wantTotal int64
+		wantOK    bool
+	}{
+		{"bytes 100-999/1000", 100, 1000, true},
+		{"bytes 0-9/*", 0, -1, true},
+		{"bytes 100-999/50", 0, 0, false},
+		{"bytes */1000", 0, 0, false},
+		{"items 0-9/10", 0, 0, false},
+		{"", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		start, total, ok := parseContentRange(tt.header)
+		if start != tt.wantStart || total != tt.wantTotal || ok != tt.wantOK {
+			t.Errorf("parseContentRange(%q) = %d, %d, %v, want %d, %d, %v", tt.header, start, total, ok, tt.wantStart, tt.wantTotal, tt.wantOK)
+		}
+	}
+}
+
+func TestSCDBDownloader_RunDryRun(t *testing.T) {
+	mockServer := NewMockSCDBServer()
+	defer mockServer.Close()
+
+	tempDir := CreateTempDir(t, "scdb_dryrun_test")
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	config := CreateTestConfig()
+	config.OutputDir = tempDir
+	config.Password = "s3cret-password"
+	config.Countries = []string{"D", "A"}
+	config.FranceDangerMode = true
+	config.DryRun = true
+
+	var err error
+	out := CaptureStdout(t, func() {
+		err = CreateMockDownloader(config, mockServer).Run()
+	})
+	AssertNoError(t, err)
+
+	// Nothing may reach the server or the disk
+	if login, fixed, mobile := mockServer.GetStats(); login+fixed+mobile != 0 {
+		t.Errorf("server calls = %d/%d/%d, want none", login, fixed, mobile)
+	}
+	AssertFileNotExists(t, filepath.Join(tempDir, "garmin.zip"))
+	AssertFileNotExists(t, filepath.Join(tempDir, "garmin-mobile.zip"))
+
+	for _, want := range []string{
+		"[dry-run] POST " + mockServer.URL() + "/en/login/",
+		"u_password=REDACTED",
+		"[dry-run] POST " + mockServer.URL() + "/my/downloadsection",
+		"land%5B%5D=D&land%5B%5D=A",
+		"france_danger=1",
+		"[dry-run] POST " + mockServer.URL() + "/intern/download/garmin-mobile.zip",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("dry-run output missing %q:\n%s", want, out)
+		}
+	}
+
+	if strings.Contains(out, config.Password) {
+		t.Errorf("dry-run output leaks the password:\n%s", out)
+	}
+}
+
+func TestNewDownloader_WithHTTPClient(t *testing.T) {
+	client := &http.Client{Timeout: time.Second}
+	downloader := NewDownloader(CreateTestConfig(), WithHTTPClient(client))
+
+	if downloader.client != client {
+		t.Errorf("NewDownloader() client = %p, want injected %p", downloader.client, client)
+	}
+}
+
+func TestSCDBDownloader_FormDataValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   url.Values
+	}{
+		{
+			name: "DACH with France as danger zone",
+			modify: func(c *Config) {
+				c.DisplayType = 3
+				c.IconSize = 4
+				c.WarningTime = 300
+				c.DangerZones = true
+				c.FranceDangerMode = true
+				c.WaiveRescission = false
+			},
+			want: url.Values{
+				"download_agreement_accept": {"1"},
+				"typ":                       {"3"},
+				"dangerzones":               {"1"},
+				"france_danger":             {"1"},
+				"vorwarnzeit":               {"300"},
+				"iconsize":                  {"4"},
+				"download_start":            {"Download+Now"},
+				"land[]":                    {"D", "A", "CH"},
+			},
+		},
+		{
+			name: "No danger zones, rescission waived",
+			modify: func(c *Config) {
+				c.DisplayType = 1
+				c.IconSize = 5
+				c.WarningTime = 0
+				c.DangerZones = false
+				c.FranceDangerMode = false
+				c.WaiveRescission = true
+			},
+			want: url.Values{
+				"download_agreement_accept":         {"1"},
+				"download_wave_right_of_rescission": {"1"},
+				"typ":                               {"1"},
+				"dangerzones":                       {"0"},
+				"france_danger":                     {"0"},
+				"vorwarnzeit":                       {"0"},
+				"iconsize":                          {"5"},
+				"download_start":                    {"Download+Now"},
+				"land[]":                            {"D", "A", "CH"},
+			},
+		},
+		{
+			name: "Changes since a date",
+			modify: func(c *Config) {
+				c.DisplayType = 1
+				c.IconSize = 5
+				c.WarningTime = 0
+				c.DangerZones = true
+				c.WaiveRescission = false
+				c.SinceDate = "2025-01-31"
+			},
+			want: url.Values{
+				"download_agreement_accept": {"1"},
+				"typ":                       {"1"},
+				"dangerzones":               {"1"},
+				"france_danger":             {"0"},
+				"vorwarnzeit":               {"0"},
+				"iconsize":                  {"5"},
+				"download_start":            {"Download+Now"},
+				"land[]":                    {"D", "A", "CH"},
+				"since":                     {"2025-01-31"},
+			},
+		},
+		{
+			name: "Danger zones only override the danger zone options",
+			modify: func(c *Config) {
+				c.DisplayType = 1
+				c.IconSize = 5
+				c.WarningTime = 0
+				c.DangerZones = false
+				c.FranceDangerMode = false
+				c.WaiveRescission = false
+				c.DangerZonesOnly = true
+			},
+			want: url.Values{
+				"download_agreement_accept": {"1"},
+				"typ":                       {"1"},
+				"dangerzones":               {"1"},
+				"france_danger":             {"1"},
+				"dangerzones_only":          {"1"},
+				"vorwarnzeit":               {"0"},
+				"iconsize":                  {"5"},
+				"download_start":            {"Download+Now"},
+				"land[]":                    {"D", "A", "CH"},
+			},
+		},
+		{
+			name: "Extra form fields",
+			modify: func(c *Config) {
+				c.DisplayType = 1
+				c.IconSize = 5
+				c.WarningTime = 0
+				c.DangerZones = true
+				c.WaiveRescission = false
+				c.FormFields = map[string]string{"split_speed_limits": "1", "poi_prefix": "scdb"}
+			},
+			want: url.Values{
+				"download_agreement_accept": {"1"},
+				"typ":                       {"1"},
+				"dangerzones":               {"1"},
+				"france_danger":             {"0"},
+				"vorwarnzeit":               {"0"},
+				"iconsize":                  {"5"},
+				"download_start":            {"Download+Now"},
+				"land[]":                    {"D", "A", "CH"},
+				"split_speed_limits":        {"1"},
+				"poi_prefix":                {"scdb"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := CreateTestConfig()
+			tt.modify(config)
+
+			got := NewDownloader(config).buildFixedForm([]string{"D", "A", "CH"})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buildFixedForm() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("Mobile form", func(t *testing.T) {
+		got := NewDownloader(CreateTestConfig()).buildMobileForm()
+		want := url.Values{"mobile_submit": {"Download+For+Free"}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("buildMobileForm() = %v, want %v", got, want)
+		}
+
+		config := CreateTestConfig()
+		config.MobileForm = map[string]string{"submit": "Download", "format": "gpx"}
+		got = NewDownloader(config).buildMobileForm()
+		want = url.Values{"submit": {"Download"}, "format": {"gpx"}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("buildMobileForm() with MobileForm = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestSCDBDownloader_HTTPClientConfiguration(t *testing.T) {
+	config := CreateTestConfig()
+	downloader := NewDownloader(config)
+
+	// Test that HTTP client has cookie jar
+	if downloader.client.Jar == nil {
+		t.Error("HTTP client should have cookie jar")
+		return
+	}
+
+	// Test that cookie jar works
+	jar := downloader.client.Jar
+	if jar == nil {
+		t.Error("Cookie jar is nil")
+		return
+	}
+
+	// Create a test cookie
+	testURL := "https://www.scdb.info/"
+	parsedURL, _ := parseURL(testURL)
+	if parsedURL == nil {
+		t.Error("Failed to parse test URL")
+		return
+	}
+
+	// The cookie jar should be ready to use (we don't need to test actual cookie storage here)
+}
+
+func TestSCDBDownloader_TLSConfiguration(t *testing.T) {
+	for _, insecure := range []bool{false, true} {
+		t.Run(fmt.Sprintf("InsecureSkipTLS=%t", insecure), func(t *testing.T) {
+			config := CreateTestConfig()
+			config.InsecureSkipTLS = insecure
+			downloader := NewDownloader(config)
+
+			// Verify TLS configuration
+			transport, ok := downloader.client.Transport.(*http.Transport)
+			if !ok {
+				t.Fatal("HTTP client transport is not *http.Transport")
+			}
+
+			tlsConfig := transport.TLSClientConfig
+			if tlsConfig == nil {
+				t.Fatal("TLS config is nil")
+			}
+
+			// Certificate checks are only skipped on request
+			if tlsConfig.InsecureSkipVerify != insecure {
+				t.Errorf("InsecureSkipVerify = %t, want %t", tlsConfig.InsecureSkipVerify, insecure)
+			}
+		})
+	}
+}
+
+// simpleBody implements io.ReadCloser for testing
+type simpleBody struct {
+	content string
+	pos     int
+	closed  bool
+}
+
+func (s *simpleBody) Read(p []byte) (n int, err error) {
+	if s.closed {
+		return 0, nil
+	}
+	if s.pos >= len(s.content) {
+		return 0, io.EOF
+	}
+	n = copy(p, s.content[s.pos:])
+	s.pos += n
+	return n, nil
+}
+
+func (s *simpleBody) Close() error {
+	s.closed = true
+	return nil
+}
+
+// Helper function to parse URL (simplified version for testing)
+func parseURL(rawURL string) (*http.Request, error) {
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// TestDownloaderIntegration tests basic integration without actual network calls
+func TestDownloaderIntegration(t *testing.T) {
+	tempDir := CreateTempDir(t, "scdb_integration_test")
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	config := &Config{
+		Username:         "test@example.com",
+		Password:         "testpass123",
+		OutputDir:        tempDir,
+		Countries:        []string{"NL", "B"},
+		DisplayType:      2,
+		DangerZones:      true,
+		FranceDangerMode: false,
+		IconSize:         4,
+		WarningTime:      300,
+		AcceptAgreement:  true,
+		DownloadFixed:    true,
+		DownloadMobile:   true,
+		Verbose:          true,
+	}
+
+	// Validate the config first
+	err := ValidateConfig(config)
+	AssertNoError(t, err)
+
+	// Create downloader
+	downloader := NewDownloader(config)
+
+	// Verify downloader setup
+	if downloader.config.Username != config.Username {
+		t.Errorf("Username = %q, want %q", downloader.config.Username, config.Username)
+	}
+
+	if downloader.config.Verbose != config.Verbose {
+		t.Errorf("Verbose = %v, want %v", downloader.config.Verbose, config.Verbose)
+	}
+
+	// Test that expected output files would be created in the right location
+	expectedFixed := filepath.Join(tempDir, "garmin.zip")
+	expectedMobile := filepath.Join(tempDir, "garmin-mobile.zip")
+
+	// These files shouldn't exist yet
+	AssertFileNotExists(t, expectedFixed)
+	AssertFileNotExists(t, expectedMobile)
+
+	// Verify we can create files in the output directory
+	testFile := filepath.Join(tempDir, "test.txt")
+	err = os.WriteFile(testFile, []byte("test"), 0644)
+	AssertNoError(t, err)
+	AssertFileExists(t, testFile, 4)
+}
+
+// TestCSRFTokenExtraction tests CSRF token pattern matching
+func TestCSRFTokenExtraction(t *testing.T) {
+	tests := []struct {
+		name     string
+		html     string
+		wantName string
+		wantVal  string
+		wantErr  bool
+	}{
+		{
+			name:     "Valid CSRF token",
+			html:     `<input type="hidden" name="abcdef1234567890abcdef1234567890abcdef12" value="abcdef1234567890abcdef1234567890abcdef12">`,
+			wantName: "abcdef1234567890abcdef1234567890abcdef12",
+			wantVal:  "abcdef1234567890abcdef1234567890abcdef12",
+			wantErr:  false,
+		},
+		{
+			name:     "Different token values",
+			html:     `<input type="hidden" name="1234567890abcdef1234567890abcdef12345678" value="8765432109fedcba8765432109fedcba87654321">`,
+			wantName: "1234567890abcdef1234567890abcdef12345678",
+			wantVal:  "8765432109fedcba8765432109fedcba87654321",
+			wantErr:  false,
+		},
+		{
+			name:    "No CSRF token",
+			html:    `<input type="text" name="username">`,
+			wantErr: true,
+		},
+		{
+			name:    "Invalid token length",
+			html:    `<input type="hidden" name="short" value="tooshort">`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenName, tokenValue, err := extractCSRFToken([]byte(tt.html))
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("extractCSRFToken() = %q, %q, want an error", tokenName, tokenValue)
+				}
+				return
+			}
+			AssertNoError(t, err)
+
+			if tokenName != tt.wantName {
+				t.Errorf("Token name = %q, want %q", tokenName, tt.wantName)
+			}
+
+			if tokenValue != tt.wantVal {
+				t.Errorf("Token value = %q, want %q", tokenValue, tt.wantVal)
+			}
+		})
+	}
+}
+
+func TestFindCSRFToken(t *testing.T) {
+	const token = "abcdef1234567890abcdef1234567890abcdef12"
+	const other = "8765432109fedcba8765432109fedcba87654321"
+
+	tests := []struct {
+		name      string
+		html      string
+		wantName  string
+		wantValue string
+		wantOK    bool
+	}{
+		{
+			name:      "Canonical attribute order",
+			html:      `<input type="hidden" name="` + token + `" value="` + other + `">`,
+			wantName:  token,
+			wantValue: other,
+			wantOK:    true,
+		},
+		{
+			name:      "Value before name",
+			html:      `<input value="` + other + `" name="` + token + `" type="hidden">`,
+			wantName:  token,
+			wantValue: other,
+			wantOK:    true,
+		},
+		{
+			name:      "Extra attributes and whitespace",
+			html:      "<input\n  name='" + token + "'\n  id=\"csrf\"  TYPE=\"HIDDEN\"\n  value=\"" + other + "\" />",
+			wantName:  token,
+			wantValue: other,
+			wantOK:    true,
+		},
+		{
+			name:      "Uppercase hex",
+			html:      `<input type="hidden" name="` + strings.ToUpper(token) + `" value="` + strings.ToUpper(other) + `">`,
+			wantName:  strings.ToUpper(token),
+			wantValue: strings.ToUpper(other),
+			wantOK:    true,
+		},
+		{
+			name:      "Skips unrelated hidden inputs",
+			html:      `<input type="hidden" name="redirect" value="/my/"><input type="hidden" name="` + token + `" value="` + other + `">`,
+			wantName:  token,
+			wantValue: other,
+			wantOK:    true,
+		},
+		{
+			name:      "Regex fallback for non-hidden input",
+			html:      `<input name="` + token + `" value="` + other + `">`,
+			wantName:  token,
+			wantValue: other,
+			wantOK:    true,
+		},
+		{
+			name:      "Full mock login page",
+			html:      MockHTMLResponse(token),
+			wantName:  token,
+			wantValue: token,
+			wantOK:    true,
+		},
+		{
+			name:   "Visible input with hex values is ignored",
+			html:   `<input type="text" value="` + other + `" name="` + token + `">`,
+			wantOK: false,
+		},
+		{
+			name:   "Token too short",
+			html:   `<input type="hidden" name="abcdef" value="abcdef">`,
+			wantOK: false,
+		},
+		{
+			name:   "No token",
+			html:   MockErrorHTMLResponse(),
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, value, ok := findCSRFToken([]byte(tt.html))
+			if ok != tt.wantOK {
+				t.Fatalf("findCSRFToken() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if name != tt.wantName || value != tt.wantValue {
+				t.Errorf("findCSRFToken() = %q, %q, want %q, %q", name, value, tt.wantName, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestSCDBDownloader_RunMetrics(t *testing.T) {
+	tests := []struct {
+		name        string
+		failLogin   bool
+		wantSuccess string
+	}{
+		{name: "Successful run", wantSuccess: "scdb_last_run_success 1\n"},
+		{name: "Failed run", failLogin: true, wantSuccess: "scdb_last_run_success 0\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := NewMockSCDBServer()
+			defer mockServer.Close()
+			mockServer.SetFailures(tt.failLogin, false, false)
+
+			tempDir := CreateTempDir(t, "scdb_metrics_test")
+			defer func() { _ = os.RemoveAll(tempDir) }()
+
+			config := CreateTestConfig()
+			config.OutputDir = tempDir
+			config.MetricsFile = filepath.Join(tempDir, "scdb.prom")
+			result, err := CreateMockDownloader(config, mockServer).RunWithResult(context.Background())
+			if tt.failLogin != (err != nil) {
+				t.Fatalf("RunWithResult() error = %v, want failure %v", err, tt.failLogin)
+			}
+
+			data, err := os.ReadFile(config.MetricsFile)
+			AssertNoError(t, err)
+			metrics := string(data)
+			for _, want := range []string{tt.wantSuccess, "scdb_last_run_timestamp ", "scdb_run_duration_seconds "} {
+				if !strings.Contains(metrics, want) {
+					t.Errorf("metrics missing %q:\n%s", want, metrics)
+				}
+			}
+
+			for _, file := range result.Files {
+				want := fmt.Sprintf("scdb_bytes_downloaded{type=%q} %d\n", file.Type, file.Bytes)
+				if !strings.Contains(metrics, want) {
+					t.Errorf("metrics missing %q:\n%s", want, metrics)
+				}
+			}
+			if !tt.failLogin {
+				if len(result.Files) != 2 || result.Files[0].Type != "fixed" || result.Files[1].Type != "mobile" {
+					t.Errorf("Files = %+v, want a fixed and a mobile entry", result.Files)
+				}
+			} else if !strings.Contains(metrics, "scdb_bytes_downloaded{type=\"mobile\"} 0\n") {
+				t.Errorf("failed run reports downloaded bytes:\n%s", metrics)
+			}
+
+			leftovers, err := filepath.Glob(filepath.Join(tempDir, ".scdb-metrics-*"))
+			AssertNoError(t, err)
+			if len(leftovers) != 0 {
+				t.Errorf("temporary metrics files left behind: %v", leftovers)
+			}
+		})
+	}
+}
+
+func TestSCDBDownloader_RunFormEncoding(t *testing.T) {
+	tests := []struct {
+		name            string
+		encoding        string
+		wantContentType string
+	}{
+		{name: "Default", wantContentType: "application/x-www-form-urlencoded"},
+		{name: "Urlencoded", encoding: FormURLEncoded, wantContentType: "application/x-www-form-urlencoded"},
+		{name: "Multipart", encoding: FormMultipart, wantContentType: "multipart/form-data; boundary="},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := NewMockSCDBServer()
+			defer mockServer.Close()
+
+			tempDir := CreateTempDir(t, "scdb_form_encoding_test")
+			defer func() { _ = os.RemoveAll(tempDir) }()
+
+			config := CreateTestConfig()
+			config.OutputDir = tempDir
+			config.Countries = []string{"NL", "B", "D"}
+			config.DownloadMobile = false
+			config.FormEncoding = tt.encoding
+			AssertNoError(t, CreateMockDownloader(config, mockServer).Run())
+
+			// The mock rejects fixed downloads whose form lacks a required field or land[]
+			AssertFileExists(t, filepath.Join(tempDir, "garmin.zip"), 100)
+			if !strings.HasPrefix(mockServer.lastContentType, tt.wantContentType) {
+				t.Errorf("Content-Type = %q, want %s", mockServer.lastContentType, tt.wantContentType)
+			}
+		})
+	}
+}
+
+func TestSCDBDownloader_RunAgreement(t *testing.T) {
+	tests := []struct {
+		name       string
+		accept     bool
+		waive      bool
+		wantErr    error
+		wantWaiver []string
+	}{
+		{name: "Agreement not accepted", waive: true, wantErr: ErrAgreementNotAccepted},
+		{name: "Rescission not waived", accept: true},
+		{name: "Rescission waived", accept: true, waive: true, wantWaiver: []string{"1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := NewMockSCDBServer()
+			defer mockServer.Close()
+
+			tempDir := CreateTempDir(t, "scdb_agreement_test")
+			defer func() { _ = os.RemoveAll(tempDir) }()
+
+			config := CreateTestConfig()
+			config.OutputDir = tempDir
+			config.DownloadMobile = false
+			config.AcceptAgreement = tt.accept
+			config.WaiveRescission = tt.waive
+			err := CreateMockDownloader(config, mockServer).Run()
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Run() error = %v, want %v", err, tt.wantErr)
+				}
+				// Nothing is sent to SCDB without the agreement
+				if login, fixed, _ := mockServer.GetStats(); login != 0 || fixed != 0 {
+					t.Errorf("login/fixed requests = %d/%d, want none", login, fixed)
+				}
+				return
+			}
+			AssertNoError(t, err)
+
+			if got := mockServer.lastForm["download_agreement_accept"]; !reflect.DeepEqual(got, []string{"1"}) {
+				t.Errorf("download_agreement_accept = %v, want [1]", got)
+			}
+			if got := mockServer.lastForm["download_wave_right_of_rescission"]; !reflect.DeepEqual(got, tt.wantWaiver) {
+				t.Errorf("download_wave_right_of_rescission = %v, want %v", got, tt.wantWaiver)
+			}
+		})
+	}
+}
+
+func TestSCDBDownloader_RunPostDownloadCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test commands use the POSIX shell")
+	}
+
+	tests := []struct {
+		name         string
+		command      string
+		ignoreErrors bool
+		wantErr      string
+		wantOutput   string
+	}{
+		{
+			name:       "Command succeeds",
+			command:    `printf '%s\n' "$SCDB_FIXED_PATH" "$SCDB_MOBILE_PATH" "$SCDB_COUNTRIES" > hook.txt; echo imported`,
+			wantOutput: "line=imported",
+		},
+		{name: "Command fails", command: "echo broken; exit 3", wantErr: "exit status 3", wantOutput: "line=broken"},
+		{name: "Failure ignored", command: "echo broken; exit 3", ignoreErrors: true, wantOutput: "line=broken"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			downloader := NewDownloader(tt.config)
-
-			// Note: Since we can't easily mock the HTTP client in the existing code,
-			// this test mainly verifies the structure and would need network access
-			// for full testing. In a real scenario, we'd want to inject the HTTP client
-			// or make the URLs configurable for testing.
+			mockServer := NewMockSCDBServer()
+			defer mockServer.Close()
 
-			// For now, we'll test that the downloader has the correct configuration
-			if downloader.config.DownloadFixed != tt.wantFixed {
-				t.Errorf("DownloadFixed = %v, want %v", downloader.config.DownloadFixed, tt.wantFixed)
+			tempDir := CreateTempDir(t, "scdb_hook_test")
+			defer func() { _ = os.RemoveAll(tempDir) }()
+
+			config := CreateTestConfig()
+			config.BaseURL = mockServer.URL()
+			config.OutputDir = tempDir
+			config.PostDownloadCommand = "cd " + tempDir + " && " + tt.command
+			config.PostDownloadIgnoreErrors = tt.ignoreErrors
+
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&buf, nil))
+			err := NewDownloader(config, WithHTTPClient(mockServer.Client()), WithLogger(logger)).Run()
+			if tt.wantErr != "" {
+				AssertErrorContains(t, err, tt.wantErr)
+			} else {
+				AssertNoError(t, err)
 			}
-
-			if downloader.config.DownloadMobile != tt.wantMobile {
-				t.Errorf("DownloadMobile = %v, want %v", downloader.config.DownloadMobile, tt.wantMobile)
+			if !strings.Contains(buf.String(), tt.wantOutput) {
+				t.Errorf("log lacks the command output %q:\n%s", tt.wantOutput, buf.String())
 			}
 
-			// Verify output directory is set correctly
-			if downloader.config.OutputDir != tempDir {
-				t.Errorf("OutputDir = %q, want %q", downloader.config.OutputDir, tempDir)
+			if tt.wantErr != "" || tt.ignoreErrors {
+				return
+			}
+			data, err := os.ReadFile(filepath.Join(tempDir, "hook.txt"))
+			AssertNoError(t, err)
+			want := filepath.Join(tempDir, "garmin.zip") + "\n" + filepath.Join(tempDir, "garmin-mobile.zip") + "\nNL,B\n"
+			if string(data) != want {
+				t.Errorf("command environment = %q, want %q", data, want)
 			}
 		})
 	}
 }
 
-func TestSCDBDownloader_FormDataValidation(t *testing.T) {
-	// Test that form data is constructed correctly for downloadFixed
-	config := CreateTestConfig()
-	config.Countries = []string{"D", "A", "CH"} // DACH region
-	config.DisplayType = 3
-	config.IconSize = 4
-	config.WarningTime = 300
-	config.DangerZones = true
-	config.FranceDangerMode = true
-
-	downloader := NewDownloader(config)
-
-	// We can't easily test the form data construction without refactoring
-	// the downloadFixed method to be more testable (e.g., by extracting
-	// form building into a separate method)
-
-	// For now, verify the configuration is set up correctly
-	if len(config.Countries) != 3 {
-		t.Errorf("Countries length = %d, want 3", len(config.Countries))
+func TestSCDBDownloader_RunFormat(t *testing.T) {
+	tests := []struct {
+		format      string
+		wantFiles   []string
+		wantReferer string
+	}{
+		{format: "", wantFiles: []string{"garmin.zip", "garmin-mobile.zip"}, wantReferer: "/my/downloadsection"},
+		{format: "garmin", wantFiles: []string{"garmin.zip", "garmin-mobile.zip"}, wantReferer: "/my/downloadsection"},
 	}
 
-	expectedCountries := []string{"D", "A", "CH"}
-	for i, expected := range expectedCountries {
-		if i >= len(config.Countries) || config.Countries[i] != expected {
-			t.Errorf("Countries[%d] = %q, want %q", i, config.Countries[i], expected)
-		}
-	}
+	for _, tt := range tests {
+		t.Run("Format "+tt.format, func(t *testing.T) {
+			mockServer := NewMockSCDBServer()
+			defer mockServer.Close()
 
-	// Test the downloader has the right config
-	if downloader.config.DisplayType != 3 {
-		t.Errorf("DisplayType = %d, want 3", downloader.config.DisplayType)
-	}
+			tempDir := CreateTempDir(t, "scdb_format_test")
+			defer func() { _ = os.RemoveAll(tempDir) }()
 
-	if downloader.config.IconSize != 4 {
-		t.Errorf("IconSize = %d, want 4", downloader.config.IconSize)
-	}
+			config := CreateTestConfig()
+			config.OutputDir = tempDir
+			config.Format = tt.format
+			AssertNoError(t, ValidateConfig(config))
+			AssertNoError(t, CreateMockDownloader(config, mockServer).Run())
 
-	if downloader.config.WarningTime != 300 {
-		t.Errorf("WarningTime = %d, want 300", downloader.config.WarningTime)
+			for _, name := range tt.wantFiles {
+				AssertFileExists(t, filepath.Join(tempDir, name), 100)
+			}
+			if _, fixed, mobile := mockServer.GetStats(); fixed != 1 || mobile != 1 {
+				t.Errorf("fixed/mobile requests = %d/%d, want 1/1", fixed, mobile)
+			}
+			if want := mockServer.URL() + tt.wantReferer; mockServer.lastReferer != want {
+				t.Errorf("Referer = %q, want %q", mockServer.lastReferer, want)
+			}
+		})
 	}
 
-	if !downloader.config.DangerZones {
-		t.Errorf("DangerZones = false, want true")
-	}
+	// Formats with unconfirmed endpoints are not offered
+	AssertErrorContains(t, checkFormat("tomtom"), `invalid format "tomtom"`)
+}
 
-	if !downloader.config.FranceDangerMode {
-		t.Errorf("FranceDangerMode = false, want true")
+func TestSCDBDownloader_RunDangerZonesOnly(t *testing.T) {
+	mockServer := NewMockSCDBServer()
+	defer mockServer.Close()
+
+	config := CreateTestConfig()
+	config.BaseURL = mockServer.URL()
+	config.OutputDir = t.TempDir()
+	config.DownloadMobile = false
+	config.DangerZonesOnly = true
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	AssertNoError(t, NewDownloader(config, WithHTTPClient(mockServer.Client()), WithLogger(logger)).Run())
+
+	AssertFileExists(t, filepath.Join(config.OutputDir, "garmin-dangerzones.zip"), 100)
+	// The form field is unconfirmed, so the run says it may get every camera
+	if !strings.Contains(buf.String(), "danger zones only download is experimental") {
+		t.Errorf("log lacks the experimental warning:\n%s", buf.String())
 	}
 }
 
-func TestSCDBDownloader_HTTPClientConfiguration(t *testing.T) {
-	config := CreateTestConfig()
-	downloader := NewDownloader(config)
+func TestMissingCountries(t *testing.T) {
+	tempDir := CreateTempDir(t, "scdb_missing_countries_test")
+	defer func() { _ = os.RemoveAll(tempDir) }()
 
-	// Test that HTTP client has cookie jar
-	if downloader.client.Jar == nil {
-		t.Error("HTTP client should have cookie jar")
-		return
+	archive := filepath.Join(tempDir, "garmin.zip")
+	AssertNoError(t, os.WriteFile(archive, MockZipContent(map[string]string{
+		"NL.gpi":                    "code",
+		"garmin/speedcams_D.gpi":    "code as a word",
+		"United_Kingdom.gpi":        "name",
+		"CZ-Czech_Republic_old.txt": "code and name",
+		"FINLAND.gpi":               "name, not the code L",
+		"speed-cameras-a-roads.csv": "the word a, not the code A",
+		"no-is-pa.txt":              "lowercase words, not NO, IS and PA",
+	}), 0644))
+
+	missing, err := missingCountries(archive, []string{"NL", "D", "GB", "CZ", "FI", "L", "B", "A", "NO", "IS", "PA"})
+	AssertNoError(t, err)
+	if want := []string{"L", "B", "A", "NO", "IS", "PA"}; !reflect.DeepEqual(missing, want) {
+		t.Errorf("missingCountries() = %v, want %v", missing, want)
 	}
 
-	// Test that cookie jar works
-	jar := downloader.client.Jar
-	if jar == nil {
-		t.Error("Cookie jar is nil")
-		return
-	}
+	_, err = missingCountries(filepath.Join(tempDir, "missing.zip"), []string{"NL"})
+	AssertErrorContains(t, err, "failed to open")
+}
 
-	// Create a test cookie
-	testURL := "https://www.scdb.info/"
-	parsedURL, _ := parseURL(testURL)
-	if parsedURL == nil {
-		t.Error("Failed to parse test URL")
-		return
+func TestCountriesFromZip(t *testing.T) {
+	tempDir := t.TempDir()
+	archive := filepath.Join(tempDir, "garmin.zip")
+	AssertNoError(t, os.WriteFile(archive, MockZipContent(map[string]string{
+		"NL.gpi":                 "code",
+		"garmin/speedcams_D.gpi": "code as a word",
+		"United_Kingdom.gpi":     "name",
+		"Romania.gpi":            "the longest name, not Oman",
+		"readme.txt":             "no country",
+		// Lowercase words that are also codes: A, IS, NO, RE, PA
+		"speed-cameras-a-roads.csv": "no country",
+		"this-is-no-re-pa.txt":      "no country",
+	}), 0644))
+
+	countries, unknown, err := CountriesFromZip(archive)
+	AssertNoError(t, err)
+	// The entries of MockZipContent come in map order
+	slices.Sort(countries)
+	slices.Sort(unknown)
+	if want := []string{"D", "GB", "NL", "RO"}; !reflect.DeepEqual(countries, want) {
+		t.Errorf("CountriesFromZip() countries = %v, want %v", countries, want)
+	}
+	if want := []string{"readme.txt", "speed-cameras-a-roads.csv", "this-is-no-re-pa.txt"}; !reflect.DeepEqual(unknown, want) {
+		t.Errorf("CountriesFromZip() unknown = %v, want %v", unknown, want)
 	}
 
-	// The cookie jar should be ready to use (we don't need to test actual cookie storage here)
+	_, _, err = CountriesFromZip(filepath.Join(tempDir, "missing.zip"))
+	AssertErrorContains(t, err, "failed to open")
 }
 
-func TestSCDBDownloader_TLSConfiguration(t *testing.T) {
-	config := CreateTestConfig()
-	downloader := NewDownloader(config)
+func TestSCDBDownloader_RunVerifyCountries(t *testing.T) {
+	for _, verify := range []bool{true, false} {
+		t.Run(fmt.Sprintf("VerifyCountries=%v", verify), func(t *testing.T) {
+			mockServer := NewMockSCDBServer()
+			defer mockServer.Close()
+			mockServer.dropCountry = "B"
 
-	// Verify TLS configuration
-	transport, ok := downloader.client.Transport.(*http.Transport)
-	if !ok {
-		t.Error("HTTP client transport is not *http.Transport")
-		return
-	}
+			tempDir := CreateTempDir(t, "scdb_verify_countries_test")
+			defer func() { _ = os.RemoveAll(tempDir) }()
 
-	tlsConfig := transport.TLSClientConfig
-	if tlsConfig == nil {
-		t.Error("TLS config is nil")
-		return
-	}
+			config := CreateTestConfig()
+			config.BaseURL = mockServer.URL()
+			config.OutputDir = tempDir
+			config.DownloadMobile = false
+			config.VerifyCountries = verify
 
-	// Verify InsecureSkipVerify is set (for self-signed certificates)
-	if !tlsConfig.InsecureSkipVerify {
-		t.Error("InsecureSkipVerify should be true for SCDB compatibility")
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&buf, nil))
+			// A missing country is only a warning
+			AssertNoError(t, NewDownloader(config, WithHTTPClient(mockServer.Client()), WithLogger(logger)).Run())
+
+			warned := strings.Contains(buf.String(), `msg="countries missing from archive"`)
+			if warned != verify {
+				t.Errorf("missing country warning = %v, want %v:\n%s", warned, verify, buf.String())
+			}
+			if verify && !strings.Contains(buf.String(), `countries="B (Belgium)"`) {
+				t.Errorf("warning does not name Belgium:\n%s", buf.String())
+			}
+		})
 	}
 }
 
-// simpleBody implements io.ReadCloser for testing
-type simpleBody struct {
-	content string
-	pos     int
-	closed  bool
+func TestSCDBDownloader_RunStdout(t *testing.T) {
+	t.Run("Fixed archive", func(t *testing.T) {
+		mockServer := NewMockSCDBServer()
+		defer mockServer.Close()
+
+		config := CreateTestConfig()
+		config.BaseURL = mockServer.URL()
+		config.OutputDir = StdoutOutput
+		config.DownloadMobile = false
+		AssertNoError(t, ValidateConfig(config))
+
+		var result *RunResult
+		var err error
+		out := CaptureStdout(t, func() {
+			result, err = NewDownloader(config, WithHTTPClient(mockServer.Client())).RunWithResult(context.Background())
+		})
+		AssertNoError(t, err)
+
+		r, err := zip.NewReader(strings.NewReader(out), int64(len(out)))
+		if err != nil {
+			t.Fatalf("stdout is not a ZIP archive: %v", err)
+		}
+		if len(r.File) != len(config.Countries) {
+			t.Errorf("archive has %d entries, want %d", len(r.File), len(config.Countries))
+		}
+
+		if len(result.Files) != 1 {
+			t.Fatalf("result.Files = %+v, want one file", result.Files)
+		}
+		if file := result.Files[0]; file.Path != StdoutOutput || file.Type != "fixed" || file.Bytes != int64(len(out)) {
+			t.Errorf("result.Files[0] = %+v, want %d fixed bytes on %q", file, len(out), StdoutOutput)
+		}
+		AssertFileNotExists(t, StdoutOutput)
+		AssertFileNotExists(t, partialPath(StdoutOutput))
+	})
+
+	t.Run("Mobile archive", func(t *testing.T) {
+		mockServer := NewMockSCDBServer()
+		defer mockServer.Close()
+
+		config := CreateTestConfig()
+		config.BaseURL = mockServer.URL()
+		config.OutputDir = StdoutOutput
+		config.DownloadFixed = false
+
+		var result *RunResult
+		var err error
+		out := CaptureStdout(t, func() {
+			result, err = NewDownloader(config, WithHTTPClient(mockServer.Client())).RunWithResult(context.Background())
+		})
+		AssertNoError(t, err)
+		if out == "" {
+			t.Error("nothing written to stdout")
+		}
+		if len(result.Files) != 1 || result.Files[0].Type != "mobile" {
+			t.Errorf("result.Files = %+v, want one mobile file", result.Files)
+		}
+	})
+
+	t.Run("Error page is not written", func(t *testing.T) {
+		mockServer := NewMockSCDBServer()
+		defer mockServer.Close()
+		mockServer.limitReached = true
+
+		config := CreateTestConfig()
+		config.BaseURL = mockServer.URL()
+		config.OutputDir = StdoutOutput
+		config.DownloadMobile = false
+
+		var err error
+		out := CaptureStdout(t, func() {
+			err = NewDownloader(config, WithHTTPClient(mockServer.Client())).Run()
+		})
+		if !errors.Is(err, ErrDownloadLimitReached) {
+			t.Errorf("Run() error = %v, want ErrDownloadLimitReached", err)
+		}
+		if out != "" {
+			t.Errorf("stdout = %q, want nothing", out)
+		}
+	})
+
+	t.Run("Dry run keeps stdout empty", func(t *testing.T) {
+		config := CreateTestConfig()
+		config.OutputDir = StdoutOutput
+		config.DownloadMobile = false
+		config.DryRun = true
+
+		out := CaptureStdout(t, func() {
+			AssertNoError(t, NewDownloader(config).Run())
+		})
+		if out != "" {
+			t.Errorf("stdout = %q, want nothing", out)
+		}
+	})
 }
 
-func (s *simpleBody) Read(p []byte) (n int, err error) {
-	if s.closed {
-		return 0, nil
+func TestSCDBDownloader_RunTypeOutputDirs(t *testing.T) {
+	mockServer := NewMockSCDBServer()
+	defer mockServer.Close()
+
+	tempDir := CreateTempDir(t, "scdb_type_output_test")
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	config := CreateTestConfig()
+	config.BaseURL = mockServer.URL()
+	config.OutputDir = filepath.Join(tempDir, "out")
+	config.FixedOutputDir = filepath.Join(tempDir, "car")
+	config.MobileOutputDir = filepath.Join(tempDir, "phone", "cameras")
+	config.Checksums = true
+	// The directories differ, so both archives may have the same name
+	config.FilenameTemplate = "cameras.zip"
+	AssertNoError(t, ValidateConfig(config))
+
+	result, err := NewDownloader(config, WithHTTPClient(mockServer.Client())).RunWithResult(context.Background())
+	AssertNoError(t, err)
+
+	fixed := filepath.Join(config.FixedOutputDir, "cameras.zip")
+	mobile := filepath.Join(config.MobileOutputDir, "cameras.zip")
+	AssertFileExists(t, fixed, -1)
+	AssertFileExists(t, mobile, -1)
+	AssertFileNotExists(t, filepath.Join(config.OutputDir, "cameras.zip"))
+
+	types := map[string]string{}
+	for _, file := range result.Files {
+		types[file.Path] = file.Type
 	}
-	if s.pos >= len(s.content) {
-		return 0, nil // EOF
+	if types[fixed] != "fixed" || types[mobile] != "mobile" {
+		t.Errorf("result.Files = %+v, want %s fixed and %s mobile", result.Files, fixed, mobile)
 	}
-	n = copy(p, s.content[s.pos:])
-	s.pos += n
-	return n, nil
-}
 
-func (s *simpleBody) Close() error {
-	s.closed = true
-	return nil
-}
-
-// Helper function to parse URL (simplified version for testing)
-func parseURL(rawURL string) (*http.Request, error) {
-	req, err := http.NewRequest("GET", rawURL, nil)
-	if err != nil {
-		return nil, err
+	// checksums.txt stays in the output directory and points at both archives
+	data, err := os.ReadFile(filepath.Join(config.OutputDir, checksumsFile))
+	AssertNoError(t, err)
+	for _, want := range []string{"../car/cameras.zip", "../phone/cameras/cameras.zip"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("checksums.txt does not list %s:\n%s", want, data)
+		}
 	}
-	return req, nil
 }
 
-// TestDownloaderIntegration tests basic integration without actual network calls
-func TestDownloaderIntegration(t *testing.T) {
-	tempDir := CreateTempDir(t, "scdb_integration_test")
+func TestSCDBDownloader_RunClean(t *testing.T) {
+	mockServer := NewMockSCDBServer()
+	defer mockServer.Close()
+
+	tempDir := CreateTempDir(t, "scdb_clean_test")
 	defer func() { _ = os.RemoveAll(tempDir) }()
 
-	config := &Config{
-		Username:         "test@example.com",
-		Password:         "testpass123",
-		OutputDir:        tempDir,
-		Countries:        []string{"NL", "B"},
-		DisplayType:      2,
-		DangerZones:      true,
-		FranceDangerMode: false,
-		IconSize:         4,
-		WarningTime:      300,
-		DownloadFixed:    true,
-		DownloadMobile:   true,
-		Verbose:          true,
+	config := CreateTestConfig()
+	config.BaseURL = mockServer.URL()
+	config.OutputDir = tempDir
+	config.DownloadMobile = false
+	config.SeparateByCountry = true
+	config.Checksums = true
+	config.Clean = true
+	config.FilenameTemplate = "{{.Format}}-{{.Country}}-{{.Date}}.zip"
+	AssertNoError(t, ValidateConfig(config))
+
+	owned := []string{
+		"garmin-NL-2025-01-01.zip",
+		"garmin-NL-2025-01-01.zip.etag",
+		"garmin-B-2024-12-31.zip.partial",
+		"garmin-B-2024-12-31.zip.partial.if-range",
+	}
+	kept := []string{
+		"garmin-NL-2025-01-01.zip.bak", // backups
+		"garmin-D-2025-01-01.zip",      // a country this run does not download
+		"garmin-NL-latest.zip",         // not a date
+		"notes.txt",
+		checksumsFile, // rewritten instead
+	}
+	for _, name := range append(owned, kept...) {
+		AssertNoError(t, os.WriteFile(filepath.Join(tempDir, name), []byte("old"), 0644))
+	}
+	// An extracted directory matching the template is not a file the run owns
+	AssertNoError(t, os.Mkdir(filepath.Join(tempDir, "garmin-NL-2025-02-02.zip"), 0755))
+
+	// A dry run only lists the files
+	dryConfig := config.Clone()
+	dryConfig.DryRun = true
+	output := CaptureStdout(t, func() {
+		_, err := NewDownloader(dryConfig, WithHTTPClient(mockServer.Client())).RunWithResult(context.Background())
+		AssertNoError(t, err)
+	})
+	for _, name := range owned {
+		if !strings.Contains(output, "[dry-run] remove "+filepath.Join(tempDir, name)) {
+			t.Errorf("dry run output does not list %s:\n%s", name, output)
+		}
+		AssertFileExists(t, filepath.Join(tempDir, name), -1)
 	}
 
-	// Validate the config first
-	err := validateConfig(config)
+	_, err := NewDownloader(config, WithHTTPClient(mockServer.Client())).RunWithResult(context.Background())
 	AssertNoError(t, err)
 
-	// Create downloader
-	downloader := NewDownloader(config)
+	for _, name := range owned {
+		AssertFileNotExists(t, filepath.Join(tempDir, name))
+	}
+	for _, name := range kept {
+		AssertFileExists(t, filepath.Join(tempDir, name), -1)
+	}
+	if info, err := os.Stat(filepath.Join(tempDir, "garmin-NL-2025-02-02.zip")); err != nil || !info.IsDir() {
+		t.Errorf("extracted directory was removed: %v", err)
+	}
+	date := time.Now().Format(time.DateOnly)
+	AssertFileExists(t, filepath.Join(tempDir, "garmin-NL-"+date+".zip"), 100)
+	AssertFileExists(t, filepath.Join(tempDir, "garmin-B-"+date+".zip"), 100)
+	data, err := os.ReadFile(filepath.Join(tempDir, checksumsFile))
+	AssertNoError(t, err)
+	if string(data) == "old" {
+		t.Error("checksums.txt was not rewritten")
+	}
 
-	// Verify downloader setup
-	if downloader.config.Username != config.Username {
-		t.Errorf("Username = %q, want %q", downloader.config.Username, config.Username)
+	// A failed run removes the partial download it leaves behind, but not the archives
+	// of the run before
+	AssertNoError(t, os.WriteFile(filepath.Join(tempDir, "garmin-NL-2025-01-01.zip"), []byte("old"), 0644))
+	mockServer.abortFixed = true
+	config.RetryCount = 0
+	config.Force = true
+	_, err = NewDownloader(config, WithHTTPClient(mockServer.Client())).RunWithResult(context.Background())
+	if err == nil {
+		t.Fatal("RunWithResult() succeeded with aborted downloads")
+	}
+	AssertFileExists(t, filepath.Join(tempDir, "garmin-NL-2025-01-01.zip"), -1)
+	AssertFileExists(t, filepath.Join(tempDir, "garmin-NL-"+date+".zip"), 100)
+	entries, err := os.ReadDir(tempDir)
+	AssertNoError(t, err)
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".partial") {
+			t.Errorf("partial file %s left after a failed run", entry.Name())
+		}
 	}
+	for _, name := range kept {
+		AssertFileExists(t, filepath.Join(tempDir, name), -1)
+	}
+}
 
-	if downloader.config.Verbose != config.Verbose {
-		t.Errorf("Verbose = %v, want %v", downloader.config.Verbose, config.Verbose)
+func TestSCDBDownloader_RunOnlyChanged(t *testing.T) {
+	mockServer := NewMockSCDBServer()
+	defer mockServer.Close()
+
+	tempDir := CreateTempDir(t, "scdb_only_changed_test")
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	config := CreateTestConfig()
+	config.BaseURL = mockServer.URL()
+	config.OutputDir = tempDir
+	config.DownloadMobile = false
+	config.SeparateByCountry = true
+	config.OnlyChanged = true
+	AssertNoError(t, ValidateConfig(config))
+
+	run := func() map[string]bool {
+		t.Helper()
+		result, err := NewDownloader(config, WithHTTPClient(mockServer.Client())).RunWithResult(context.Background())
+		AssertNoError(t, err)
+		unchanged := make(map[string]bool)
+		for _, file := range result.Files {
+			unchanged[filepath.Base(file.Path)] = file.Unchanged
+		}
+		return unchanged
+	}
+	statePath := filepath.Join(tempDir, stateFile)
+	readState := func() map[string]string {
+		t.Helper()
+		state, err := loadCountryState(statePath)
+		AssertNoError(t, err)
+		return state
 	}
 
-	// Test that expected output files would be created in the right location
-	expectedFixed := filepath.Join(tempDir, "garmin.zip")
-	expectedMobile := filepath.Join(tempDir, "garmin-mobile.zip")
+	// The first run writes every country and records its checksum
+	if got := run(); !reflect.DeepEqual(got, map[string]bool{"garmin-NL.zip": false, "garmin-B.zip": false}) {
+		t.Errorf("first run unchanged = %v, want both written", got)
+	}
+	state := readState()
+	for _, country := range []string{"NL", "B"} {
+		sum, _, err := fileSHA256(filepath.Join(tempDir, "garmin-"+country+".zip"))
+		AssertNoError(t, err)
+		if state[country] != sum {
+			t.Errorf("state[%s] = %q, want %q", country, state[country], sum)
+		}
+	}
 
-	// These files shouldn't exist yet
-	AssertFileNotExists(t, expectedFixed)
-	AssertFileNotExists(t, expectedMobile)
+	// The same content again leaves the archives and the state file alone
+	old := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, name := range []string{"garmin-NL.zip", "garmin-B.zip", stateFile} {
+		AssertNoError(t, os.Chtimes(filepath.Join(tempDir, name), old, old))
+	}
+	if got := run(); !reflect.DeepEqual(got, map[string]bool{"garmin-NL.zip": true, "garmin-B.zip": true}) {
+		t.Errorf("second run unchanged = %v, want both unchanged", got)
+	}
+	for _, name := range []string{"garmin-NL.zip", "garmin-B.zip", stateFile} {
+		info, err := os.Stat(filepath.Join(tempDir, name))
+		AssertNoError(t, err)
+		if !info.ModTime().Equal(old) {
+			t.Errorf("%s was rewritten although nothing changed", name)
+		}
+	}
+	AssertFileNotExists(t, filepath.Join(tempDir, "garmin-NL.zip.partial"))
 
-	// Verify we can create files in the output directory
-	testFile := filepath.Join(tempDir, "test.txt")
-	err = os.WriteFile(testFile, []byte("test"), 0644)
+	// A country whose content changed is written and recorded; the other is kept
+	mockServer.dropCountry = "NL"
+	if got := run(); !reflect.DeepEqual(got, map[string]bool{"garmin-NL.zip": false, "garmin-B.zip": true}) {
+		t.Errorf("third run unchanged = %v, want only NL written", got)
+	}
+	sum, _, err := fileSHA256(filepath.Join(tempDir, "garmin-NL.zip"))
 	AssertNoError(t, err)
-	AssertFileExists(t, testFile, 4)
+	if newState := readState(); newState["NL"] != sum || newState["B"] != state["B"] {
+		t.Errorf("state after NL changed = %v, want NL %s and B unchanged", newState, sum)
+	}
+
+	// A missing archive is written again even though its checksum is recorded
+	mockServer.dropCountry = ""
+	AssertNoError(t, os.Remove(filepath.Join(tempDir, "garmin-B.zip")))
+	if got := run(); !reflect.DeepEqual(got, map[string]bool{"garmin-NL.zip": false, "garmin-B.zip": false}) {
+		t.Errorf("fourth run unchanged = %v, want both written", got)
+	}
+	AssertFileExists(t, filepath.Join(tempDir, "garmin-B.zip"), 100)
 }
 
-// TestCSRFTokenExtraction tests CSRF token pattern matching
-func TestCSRFTokenExtraction(t *testing.T) {
+func TestSCDBDownloader_RunSizeLimits(t *testing.T) {
+	fixedSize := int64(len(MockZipContent(map[string]string{"NL.gpi": "mock_garmin_content_NL", "B.gpi": "mock_garmin_content_B"})))
+	mobileSize := int64(len(MockZipContent(map[string]string{"mobile.gpi": "mock_mobile_content"})))
+
 	tests := []struct {
-		name     string
-		html     string
-		wantName string
-		wantVal  string
-		wantErr  bool
+		name        string
+		maxDownload int64
+		maxTotal    int64
+		wantErr     bool
+		wantFixed   bool
+		wantMobile  bool
 	}{
-		{
-			name:     "Valid CSRF token",
-			html:     `<input type="hidden" name="abcdef1234567890abcdef1234567890abcdef12" value="abcdef1234567890abcdef1234567890abcdef12">`,
-			wantName: "abcdef1234567890abcdef1234567890abcdef12",
-			wantVal:  "abcdef1234567890abcdef1234567890abcdef12",
-			wantErr:  false,
-		},
-		{
-			name:     "Different token values",
-			html:     `<input type="hidden" name="1234567890abcdef1234567890abcdef12345678" value="8765432109fedcba8765432109fedcba87654321">`,
-			wantName: "1234567890abcdef1234567890abcdef12345678",
-			wantVal:  "8765432109fedcba8765432109fedcba87654321",
-			wantErr:  false,
-		},
-		{
-			name:    "No CSRF token",
-			html:    `<input type="text" name="username">`,
-			wantErr: true,
-		},
-		{
-			name:    "Invalid token length",
-			html:    `<input type="hidden" name="short" value="tooshort">`,
-			wantErr: true,
-		},
+		{"Within both caps", fixedSize, fixedSize + mobileSize, false, true, true},
+		{"Fixed archive over the per-download cap", fixedSize - 1, 0, true, false, false},
+		{"Mobile archive takes the run over the total cap", 0, fixedSize + mobileSize - 1, true, true, false},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Use the same regex pattern from the login method
-			tokenPattern := regexp.MustCompile(`name="([a-f0-9]{40})" value="([a-f0-9]{40})"`)
-			matches := tokenPattern.FindStringSubmatch(tt.html)
-
+			mockServer := NewMockSCDBServer()
+			defer mockServer.Close()
+			tempDir := t.TempDir()
+
+			config := CreateTestConfig()
+			config.OutputDir = tempDir
+			config.MaxDownloadBytes = tt.maxDownload
+			config.MaxTotalBytes = tt.maxTotal
+			// The mock sends no Content-Length, so the caps are enforced while reading
+			_, err := CreateMockDownloader(config, mockServer).RunWithResult(context.Background())
 			if tt.wantErr {
-				if len(matches) >= 3 {
-					t.Errorf("Expected no matches, got %v", matches)
+				if !errors.Is(err, ErrDownloadTooLarge) {
+					t.Fatalf("RunWithResult() error = %v, want ErrDownloadTooLarge", err)
 				}
-				return
+			} else {
+				AssertNoError(t, err)
 			}
 
-			if len(matches) < 3 {
-				t.Errorf("Expected matches, got none")
-				return
+			for _, out := range []struct {
+				path string
+				want bool
+			}{
+				{filepath.Join(tempDir, "garmin.zip"), tt.wantFixed},
+				{filepath.Join(tempDir, "garmin-mobile.zip"), tt.wantMobile},
+			} {
+				if out.want {
+					AssertFileExists(t, out.path, 1)
+				} else {
+					AssertFileNotExists(t, out.path)
+				}
+				AssertFileNotExists(t, partialPath(out.path))
 			}
+		})
+	}
+}
 
-			tokenName := matches[1]
-			tokenValue := matches[2]
+func TestCheckDownloadSize(t *testing.T) {
+	config := CreateTestConfig()
+	config.MaxDownloadBytes = 100
+	config.MaxTotalBytes = 150
+	d := NewDownloader(config)
+	d.downloaded = 60
 
-			if tokenName != tt.wantName {
-				t.Errorf("Token name = %q, want %q", tokenName, tt.wantName)
-			}
+	tests := []struct {
+		name          string
+		offset, total int64
+		wantErr       bool
+	}{
+		{"Unknown size", 0, -1, false},
+		{"Within both caps", 0, 90, false},
+		{"Over the per-download cap", 0, 101, true},
+		{"Over the total cap", 0, 91, true},
+		{"Resumed download counts only the rest towards the total", 20, 100, false},
+	}
 
-			if tokenValue != tt.wantVal {
-				t.Errorf("Token value = %q, want %q", tokenValue, tt.wantVal)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := d.checkDownloadSize("garmin.zip", tt.offset, tt.total)
+			if tt.wantErr != errors.Is(err, ErrDownloadTooLarge) {
+				t.Errorf("checkDownloadSize(%d, %d) = %v, wantErr %v", tt.offset, tt.total, err, tt.wantErr)
 			}
 		})
 	}
+
+	// No file system has this much space free
+	err := checkDiskSpace(filepath.Join(t.TempDir(), "garmin.zip"), 1<<62)
+	if _, known := freeDiskSpace(t.TempDir()); known {
+		AssertErrorContains(t, err, "not enough disk space")
+	} else {
+		AssertNoError(t, err)
+	}
+	AssertNoError(t, checkDiskSpace(filepath.Join(t.TempDir(), "garmin.zip"), 1))
+}
+
+func TestSCDBDownloader_RunMobilePath(t *testing.T) {
+	mockServer := NewMockSCDBServer()
+	defer mockServer.Close()
+
+	config := CreateTestConfig()
+	config.OutputDir = t.TempDir()
+	config.DownloadFixed = false
+	config.MobilePath = altMobilePath
+	config.MobileForm = map[string]string{"mobile_submit": "Download", "format": "gpx"}
+	AssertNoError(t, ValidateConfig(config))
+	AssertNoError(t, CreateMockDownloader(config, mockServer).Run())
+
+	AssertFileExists(t, filepath.Join(config.OutputDir, "garmin-mobile.zip"), 1)
+	mockServer.mu.Lock()
+	defer mockServer.mu.Unlock()
+	if want := (url.Values{"mobile_submit": {"Download"}, "format": {"gpx"}}); !reflect.DeepEqual(mockServer.lastMobileForm, want) {
+		t.Errorf("mobile form = %v, want %v", mockServer.lastMobileForm, want)
+	}
+	if want := mockServer.URL() + downloadSectionPath; mockServer.lastReferer != want {
+		t.Errorf("Referer = %q, want %q", mockServer.lastReferer, want)
+	}
 }
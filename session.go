@@ -0,0 +1,267 @@
+package scdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Session is a saved login session: the cookies SCDB set, and the site and account they
+// belong to. FileCookieStore writes it as JSON with the field names below, so a session
+// from a browser login can be saved by hand in the same form.
+type Session struct {
+	BaseURL  string          `json:"base_url"`
+	Username string          `json:"username"`
+	SavedAt  time.Time       `json:"saved_at"`
+	Cookies  []SessionCookie `json:"cookies"`
+}
+
+// SessionCookie is a cookie of a Session
+type SessionCookie struct {
+	Domain  string    `json:"domain,omitempty"` // Host the cookie was set by, or its Domain attribute
+	Path    string    `json:"path,omitempty"`   // "" = "/"
+	Name    string    `json:"name"`
+	Value   string    `json:"value"`
+	Expires time.Time `json:"expires,omitzero"` // Zero for a cookie that lasts until the browser closes
+}
+
+// expired reports whether the cookie's recorded expiry has passed at now
+func (c SessionCookie) expired(now time.Time) bool {
+	return !c.Expires.IsZero() && !c.Expires.After(now)
+}
+
+// CookieStore keeps the login session between runs. The downloader uses a
+// FileCookieStore for Config.SessionFile unless WithCookieStore gives it another store.
+type CookieStore interface {
+	// Load returns the saved session, or nil without an error if there is none
+	Load() (*Session, error)
+	// Save replaces the saved session
+	Save(session *Session) error
+}
+
+// FileCookieStore is a CookieStore keeping the session as JSON in the file at Path,
+// readable only by the owner since the cookies grant access to the account
+type FileCookieStore struct {
+	Path string
+}
+
+// Load reads the session saved in the file; a missing file means no session
+func (s FileCookieStore) Load() (*Session, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("invalid session file %s: %w", s.Path, err)
+	}
+	return &session, nil
+}
+
+// Save writes session to the file, creating its directory if needed
+func (s FileCookieStore) Save(session *Session) error {
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0700); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.Path, data, 0600)
+}
+
+// String returns the file path, for log messages
+func (s FileCookieStore) String() string {
+	return s.Path
+}
+
+// DefaultSessionPath returns the default file for saved session cookies, next to the
+// default config file
+func DefaultSessionPath() string {
+	return filepath.Join(filepath.Dir(DefaultConfigPath()), "cookies.json")
+}
+
+// sessionStore returns the store given with WithCookieStore, a FileCookieStore for
+// Config.SessionFile, or nil when sessions are not saved
+func (d *SCDBDownloader) sessionStore() CookieStore {
+	if d.cookieStore != nil {
+		return d.cookieStore
+	}
+	if d.config.SessionFile != "" {
+		return FileCookieStore{Path: d.config.SessionFile}
+	}
+	return nil
+}
+
+// sessionURL is the URL the session cookies are stored and restored for
+func (d *SCDBDownloader) sessionURL() (*url.URL, error) {
+	return url.Parse(d.url(accountPath))
+}
+
+// resumeSession loads the cookies saved by an earlier run and reports whether they still
+// authenticate, checked against /my/. Cookies past their recorded expiry are dropped. A
+// missing, foreign or expired session is not an error: the caller logs in as usual.
+func (d *SCDBDownloader) resumeSession(ctx context.Context) bool {
+	store := d.sessionStore()
+	if store == nil || d.client.Jar == nil {
+		return false
+	}
+
+	session, err := store.Load()
+	if err != nil {
+		d.logger.Warn("ignoring saved session", "store", store, "error", err)
+		return false
+	}
+	if session == nil {
+		return false
+	}
+	if session.BaseURL != d.url("") || session.Username != d.config.Username {
+		d.logger.Debug("saved session belongs to another account", "store", store)
+		return false
+	}
+
+	u, err := d.sessionURL()
+	if err != nil {
+		return false
+	}
+	now := time.Now()
+	var cookies []*http.Cookie
+	for _, c := range session.Cookies {
+		if c.expired(now) {
+			d.logger.Debug("saved cookie expired", "name", c.Name, "expires", c.Expires.Format(time.RFC3339))
+			continue
+		}
+		cookie := &http.Cookie{Name: c.Name, Value: c.Value, Path: c.Path, Expires: c.Expires}
+		if cookie.Path == "" {
+			cookie.Path = "/"
+		}
+		// A cookie recorded for the host itself stays a host-only cookie
+		if c.Domain != u.Hostname() {
+			cookie.Domain = c.Domain
+		}
+		cookies = append(cookies, cookie)
+	}
+	if len(cookies) == 0 {
+		d.logger.Debug("saved session has no live cookies", "store", store)
+		return false
+	}
+	d.client.Jar.SetCookies(u, cookies)
+
+	if err := d.checkLoggedIn(ctx); err != nil {
+		d.logger.Info("saved session expired, logging in again", "store", store)
+		d.logger.Debug("session check failed", "error", err)
+		return false
+	}
+
+	d.logger.Info("reusing saved session", "user", d.config.Username, "saved_at", session.SavedAt.Format(time.RFC3339))
+	return true
+}
+
+// saveSession writes the current session cookies to the session store. Failing to save
+// only costs a login next time, so it is logged rather than returned.
+func (d *SCDBDownloader) saveSession() {
+	store := d.sessionStore()
+	if store == nil || d.client.Jar == nil {
+		return
+	}
+
+	u, err := d.sessionURL()
+	if err != nil {
+		return
+	}
+	session := &Session{
+		BaseURL:  d.url(""),
+		Username: d.config.Username,
+		SavedAt:  time.Now().UTC(),
+	}
+	recorded, _ := d.client.Jar.(*sessionJar)
+	for _, c := range d.client.Jar.Cookies(u) {
+		cookie := SessionCookie{Domain: u.Hostname(), Path: "/", Name: c.Name, Value: c.Value}
+		if recorded != nil {
+			if attrs, ok := recorded.lookup(c.Name, c.Value); ok {
+				cookie = attrs
+			}
+		}
+		session.Cookies = append(session.Cookies, cookie)
+	}
+
+	if err := store.Save(session); err != nil {
+		d.logger.Warn("failed to save session", "store", store, "error", err)
+		return
+	}
+	d.logger.Debug("session saved", "store", store, "cookies", len(session.Cookies))
+}
+
+// sessionJar wraps a cookie jar to remember the domain, path and expiry of the cookies
+// set through it, which http.CookieJar does not hand back
+type sessionJar struct {
+	http.CookieJar
+
+	mu      sync.Mutex
+	cookies map[string]SessionCookie // keyed by domain, path and name
+}
+
+// newSessionJar wraps jar
+func newSessionJar(jar http.CookieJar) *sessionJar {
+	return &sessionJar{CookieJar: jar, cookies: make(map[string]SessionCookie)}
+}
+
+// SetCookies stores the cookies in the wrapped jar and records their attributes
+func (j *sessionJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.CookieJar.SetCookies(u, cookies)
+
+	now := time.Now()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, c := range cookies {
+		cookie := SessionCookie{
+			Domain:  strings.TrimPrefix(c.Domain, "."),
+			Path:    c.Path,
+			Name:    c.Name,
+			Value:   c.Value,
+			Expires: c.Expires,
+		}
+		if cookie.Domain == "" {
+			cookie.Domain = u.Hostname()
+		}
+		if cookie.Path == "" {
+			cookie.Path = "/"
+		}
+		// Max-Age takes precedence over Expires
+		if c.MaxAge > 0 {
+			cookie.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		}
+
+		key := cookie.Domain + ";" + cookie.Path + ";" + cookie.Name
+		if c.MaxAge < 0 || cookie.expired(now) {
+			delete(j.cookies, key)
+			continue
+		}
+		j.cookies[key] = cookie
+	}
+}
+
+// lookup returns the recorded attributes of the cookie with the given name and value
+func (j *sessionJar) lookup(name, value string) (SessionCookie, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, c := range j.cookies {
+		if c.Name == name && c.Value == value {
+			return c, true
+		}
+	}
+	return SessionCookie{}, false
+}
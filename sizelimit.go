@@ -0,0 +1,85 @@
+package scdb
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// checkDownloadSize rejects a download to path before its body is read when the
+// Content-Length already breaks Config.MaxDownloadBytes or Config.MaxTotalBytes. total is
+// the size of the whole file and offset the part a resumed download already has; a total
+// of zero or less is unknown, and left to the limitedBody guard.
+func (d *SCDBDownloader) checkDownloadSize(path string, offset, total int64) error {
+	if total <= 0 {
+		return nil
+	}
+	if limit := d.config.MaxDownloadBytes; limit > 0 && total > limit {
+		return fmt.Errorf("%w: %s is %d bytes, more than the %d allowed per download", ErrDownloadTooLarge, path, total, limit)
+	}
+	if limit := d.config.MaxTotalBytes; limit > 0 {
+		d.mu.Lock()
+		downloaded := d.downloaded
+		d.mu.Unlock()
+		if downloaded+total-offset > limit {
+			return fmt.Errorf("%w: %s would bring the run to %d bytes, more than the %d allowed in total", ErrDownloadTooLarge, path, downloaded+total-offset, limit)
+		}
+	}
+	return nil
+}
+
+// limitedBody returns r guarded by Config.MaxDownloadBytes and Config.MaxTotalBytes. offset
+// is the size of the partial file a resumed download appends to, which counts towards
+// the per-download cap.
+func (d *SCDBDownloader) limitedBody(r io.Reader, path string, offset int64) io.Reader {
+	if d.config.MaxDownloadBytes <= 0 && d.config.MaxTotalBytes <= 0 {
+		return r
+	}
+	return &sizeLimitedReader{r: r, d: d, path: path, read: offset}
+}
+
+// sizeLimitedReader fails with ErrDownloadTooLarge once the download grows past the caps
+type sizeLimitedReader struct {
+	r    io.Reader
+	d    *SCDBDownloader
+	path string
+	read int64
+}
+
+func (l *sizeLimitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if limit := l.d.config.MaxDownloadBytes; limit > 0 && l.read > limit {
+		return n, fmt.Errorf("%w: %s is more than the %d bytes allowed per download", ErrDownloadTooLarge, l.path, limit)
+	}
+	if limitErr := l.d.countDownloaded(int64(n)); limitErr != nil {
+		return n, limitErr
+	}
+	return n, err
+}
+
+// countDownloaded adds n bytes to the run's total and fails once it passes
+// Config.MaxTotalBytes
+func (d *SCDBDownloader) countDownloaded(n int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.downloaded += n
+	if limit := d.config.MaxTotalBytes; limit > 0 && d.downloaded > limit {
+		return fmt.Errorf("%w: the downloads of this run are more than the %d bytes allowed in total", ErrDownloadTooLarge, limit)
+	}
+	return nil
+}
+
+// checkDiskSpace rejects writing need more bytes to path when its file system has less
+// space free. Where the free space cannot be told, the download goes ahead.
+func checkDiskSpace(path string, need int64) error {
+	if need <= 0 {
+		return nil
+	}
+	dir := filepath.Dir(path)
+	free, ok := freeDiskSpace(dir)
+	if ok && need > free {
+		return fmt.Errorf("not enough disk space in %s: the download needs %d bytes, %d are free", dir, need, free)
+	}
+	return nil
+}
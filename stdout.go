@@ -0,0 +1,78 @@
+package scdb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// StdoutOutput is the Config.OutputDir that streams the downloaded archive to standard
+// output instead of writing files, for pipelines such as "scdb-downloader -output - | ..."
+const StdoutOutput = "-"
+
+// streaming reports whether the run writes its archive to standard output
+func (d *SCDBDownloader) streaming() bool {
+	return d.config.OutputDir == StdoutOutput
+}
+
+// checkStdoutOutput rejects settings that need more than one archive, or files on disk,
+// when config streams to standard output
+func checkStdoutOutput(config *Config) error {
+	if config.OutputDir != StdoutOutput {
+		return nil
+	}
+	if config.DownloadFixed && config.DownloadMobile {
+		return optionError("%s %s writes a single archive: turn off %s or %s", configField("OutputDir"), StdoutOutput, configField("DownloadFixed"), configField("DownloadMobile"))
+	}
+
+	conflicts := []struct {
+		set   bool
+		field configField
+	}{
+		{config.SeparateByCountry, "SeparateByCountry"},
+		{config.FixedOutputDir != "", "FixedOutputDir"},
+		{config.MobileOutputDir != "", "MobileOutputDir"},
+		{config.Archive, "Archive"},
+		{config.Extract, "Extract"},
+		{config.Checksums, "Checksums"},
+		{config.VerifyCountries, "VerifyCountries"},
+		{config.VerifyAgainst != "", "VerifyAgainst"},
+		{config.MaxAge > 0, "MaxAge"},
+		{config.Clean, "Clean"},
+		{config.OnlyChanged, "OnlyChanged"},
+		{config.UseServerFilename, "UseServerFilename"},
+		{config.Diff, "Diff"},
+	}
+	for _, c := range conflicts {
+		if c.set {
+			return optionError("%s cannot be used with %s %s", c.field, configField("OutputDir"), StdoutOutput)
+		}
+	}
+	return nil
+}
+
+// streamResponse copies the body of a download response to standard output. Unlike a
+// file, the stream cannot be taken back, so the archive is not checked with VerifyZip;
+// the caller has already rejected responses that are not a ZIP by their content type.
+func (d *SCDBDownloader) streamResponse(resp *http.Response) error {
+	if err := d.checkDownloadSize(StdoutOutput, 0, resp.ContentLength); err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(os.Stdout, hash), d.limitedBody(d.responseBody(resp), StdoutOutput, 0))
+	if err != nil {
+		return fmt.Errorf("failed to stream download: %w", err)
+	}
+	if resp.ContentLength > 0 && written != resp.ContentLength {
+		return fmt.Errorf("incomplete download: received %d of %d bytes", written, resp.ContentLength)
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+	d.logger.Info("download written to standard output", "bytes", written, "sha256", sum)
+	d.addFile(FileResult{Path: StdoutOutput, Bytes: written, SHA256: sum})
+	return nil
+}
@@ -23,6 +23,8 @@ echo "Test 1: Regional preset 'benelux' with France danger mode..."
 ./scdb-downloader \
   -user "$SCDB_USER" \
   -pass "$SCDB_PASS" \
+  -accept-agreement \
+  -waive-rescission \
   -output "$TEST_DIR" \
   -countries "benelux" \
   -display 3 \
@@ -46,6 +48,8 @@ echo "Test 3: Load from saved configuration..."
 ./scdb-downloader \
   -user "$SCDB_USER" \
   -pass "$SCDB_PASS" \
+  -accept-agreement \
+  -waive-rescission \
   -config "$TEST_DIR/test-config.yml" \
   -output "$TEST_DIR" \
   -mobile false \
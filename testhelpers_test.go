@@ -1,18 +1,28 @@
-package main
+package scdb
 
 import (
+	"archive/zip"
+	"bytes"
 	"fmt"
+	"io"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
 // MockSCDBServer creates a mock server that simulates SCDB responses
 type MockSCDBServer struct {
-	server      *httptest.Server
+	server *httptest.Server
+	// mu guards the call counters and last* fields, which handlers update concurrently
+	mu          sync.Mutex
 	loginCalls  int
 	fixedCalls  int
 	mobileCalls int
@@ -20,8 +30,119 @@ type MockSCDBServer struct {
 	failFixed   bool
 	failMobile  bool
 	csrfToken   string
+	lastOrigin  string
+	lastReferer string
+	// lastContentType is the Content-Type of the last download request
+	lastContentType string
+	// lastForm is the form of the last fixed download, lastMobileForm of the last mobile one
+	lastForm       url.Values
+	lastMobileForm url.Values
+	// failCountry makes fixed downloads that include this country code fail
+	failCountry string
+	// dropCountry is left out of fixed archives without an error, like a silent omission
+	dropCountry string
+	// validPassword, when set, makes logins with any other password re-render the
+	// login form with status 200, like the real site does
+	validPassword string
+	// noSession makes successful logins omit the session cookie, so /my/ bounces back
+	// to the login page
+	noSession bool
+	// expiredSession, when set, is a session cookie value /my/ no longer accepts
+	expiredSession string
+	// sessionMaxAge, when set, is sent as the Max-Age of the session cookie
+	sessionMaxAge int
+	// accountPage, when set, replaces the body of the /my/ account page
+	accountPage string
+	// mobileETag, when set, is sent with mobile downloads; requests carrying it in
+	// If-None-Match get 304 Not Modified
+	mobileETag string
+	// challenge serves challengePage instead of the login form; challengeAfterLogin
+	// serves it in answer to the login instead
+	challenge           bool
+	challengeAfterLogin bool
+	// maintenance answers the login page with maintenancePage
+	maintenance bool
+	// loginPageDownloads is the number of fixed downloads still to be answered with the
+	// login page, as if the session had expired; sessionExpired then makes /my/ turn
+	// the session away until the next login
+	loginPageDownloads int
+	sessionExpired     bool
+	// otpCode, when set, answers correct credentials with otpPage and only starts the
+	// session once this code is posted to otpPath; otpCalls counts the code posts
+	otpCode  string
+	otpCalls int
+	// fixedDisposition and mobileDisposition replace the Content-Disposition headers of
+	// the downloads when set
+	fixedDisposition  string
+	mobileDisposition string
+	// lastModified, when set, is sent as the Last-Modified date of both downloads
+	lastModified time.Time
+	// abortFixed cuts fixed downloads off halfway, announcing range support and an ETag so
+	// the partial file is kept for resuming
+	abortFixed bool
+	// limitReached makes fixed downloads return SCDB's download limit page
+	limitReached bool
+	// fixedDelay holds each fixed download open this long; maxFixedInFlight records the
+	// most fixed downloads that were in progress at once
+	fixedDelay       time.Duration
+	fixedInFlight    int
+	maxFixedInFlight int
 }
 
+// downloadLimitPage mimics the page SCDB serves once the daily download limit is used up
+const downloadLimitPage = `<html><head><title>SCDB.info</title></head><body>
+<div class="alert alert-danger">Your daily download limit has been reached.</div></body></html>`
+
+// maintenancePage mimics the page SCDB serves for every URL while the site is maintained
+const maintenancePage = `<!DOCTYPE html>
+<html>
+<head><title>SCDB.info - Maintenance</title></head>
+<body>
+<div class="container">
+	<h1>We'll be back soon!</h1>
+	<p>SCDB.info is currently undergoing scheduled maintenance. Please try again in a few hours.</p>
+</div>
+</body>
+</html>
+`
+
+// challengePage mimics a CAPTCHA page served in place of the login form after repeated
+// logins
+const challengePage = `<!DOCTYPE html>
+<html>
+<head><title>Just a moment...</title></head>
+<body>
+<h1>Please verify you are human</h1>
+<form method="POST" action="/en/login/">
+	<div class="g-recaptcha" data-sitekey="6LeIxAcTAAAAAJcZVRqyHh71UMIEGNQ_MXjiZKhI"></div>
+	<input type="submit" value="Continue">
+</form>
+<script src="https://www.google.com/recaptcha/api.js" async defer></script>
+</body>
+</html>
+`
+
+// otpPath is where the mock's second login step posts the one-time code
+const otpPath = "/en/login/otp/"
+
+// otpPage mimics a second login step asking for a code sent by email
+const otpPage = `<!DOCTYPE html>
+<html>
+<head><title>SCDB Login</title></head>
+<body>
+<p>We have sent a login code to your email address.</p>
+<form method="POST" action="otp/">
+	<input type="hidden" name="otp_token" value="step-2">
+	<input type="text" name="otp" autocomplete="one-time-code">
+	<input type="submit" name="otp_submit" value="Continue">
+</form>
+</body>
+</html>
+`
+
+// altMobilePath is a mobile download endpoint no format uses, for Config.MobilePath
+const altMobilePath = "/intern/download/v2/garmin-mobile.zip"
+
 // NewMockSCDBServer creates a new mock server for testing
 func NewMockSCDBServer() *MockSCDBServer {
 	mock := &MockSCDBServer{
@@ -32,19 +153,25 @@ func NewMockSCDBServer() *MockSCDBServer {
 
 	// Login page - handles both GET and POST
 	mux.HandleFunc("/en/login/", mock.handleLogin)
+	mux.HandleFunc(otpPath, mock.handleOTP)
 
-	// Fixed cameras download
-	mux.HandleFunc("/my/downloadsection", mock.handleFixedDownload)
+	// Account page reached after a successful login redirect
+	mux.HandleFunc("/my/", mock.handleAccount)
 
-	// Mobile cameras download
-	mux.HandleFunc("/intern/download/garmin-mobile.zip", mock.handleMobileDownload)
+	// Fixed and mobile camera downloads of every format
+	for _, format := range formats {
+		mux.HandleFunc(format.fixedPath, mock.handleFixedDownload)
+		mux.HandleFunc(format.mobilePath, mock.handleMobileDownload)
+	}
+	mux.HandleFunc(altMobilePath, mock.handleMobileDownload)
 
-	mock.server = httptest.NewServer(mux)
+	mock.server = httptest.NewUnstartedServer(mux)
 
 	// Add timeout controls to prevent test hangs
 	mock.server.Config.ReadTimeout = 10 * time.Second
 	mock.server.Config.WriteTimeout = 10 * time.Second
 	mock.server.Config.IdleTimeout = 10 * time.Second
+	mock.server.Start()
 
 	return mock
 }
@@ -59,6 +186,15 @@ func (m *MockSCDBServer) URL() string {
 	return m.server.URL
 }
 
+// Client returns an HTTP client for the mock server with its own session cookie jar,
+// recording cookie attributes like the default client's
+func (m *MockSCDBServer) Client() *http.Client {
+	client := m.server.Client()
+	jar, _ := cookiejar.New(nil)
+	client.Jar = newSessionJar(jar)
+	return client
+}
+
 // SetFailures configures the mock server to simulate failures
 func (m *MockSCDBServer) SetFailures(login, fixed, mobile bool) {
 	m.failLogin = login
@@ -68,31 +204,27 @@ func (m *MockSCDBServer) SetFailures(login, fixed, mobile bool) {
 
 // GetStats returns call statistics
 func (m *MockSCDBServer) GetStats() (login, fixed, mobile int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	return m.loginCalls, m.fixedCalls, m.mobileCalls
 }
 
 // handleLogin processes both GET (login page) and POST (login attempt)
 func (m *MockSCDBServer) handleLogin(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "GET" {
-		// Serve login page with CSRF token
-		html := fmt.Sprintf(`
-<!DOCTYPE html>
-<html>
-<head><title>SCDB Login</title></head>
-<body>
-<form method="POST" action="/en/login/">
-	<input type="hidden" name="%s" value="%s">
-	<input type="text" name="u_name" placeholder="Username">
-	<input type="password" name="u_password" placeholder="Password">
-	<input type="submit" name="login_submit" value="Login">
-</form>
-</body>
-</html>
-`, m.csrfToken, m.csrfToken)
-
-		w.Header().Set("Content-Type", "text/html")
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte(html))
+		if m.maintenance {
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(maintenancePage))
+			return
+		}
+		if m.challenge {
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(challengePage))
+			return
+		}
+		m.writeLoginPage(w, "")
 		return
 	}
 
@@ -101,7 +233,11 @@ func (m *MockSCDBServer) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	m.mu.Lock()
 	m.loginCalls++
+	m.lastOrigin = r.Header.Get("Origin")
+	m.lastReferer = r.Header.Get("Referer")
+	m.mu.Unlock()
 
 	if m.failLogin {
 		http.Error(w, "Login failed", http.StatusUnauthorized)
@@ -131,12 +267,110 @@ func (m *MockSCDBServer) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Simulate successful login with redirect
-	w.Header().Set("Set-Cookie", "PHPSESSID=test_session_id; Path=/")
+	if m.validPassword != "" && password != m.validPassword {
+		m.writeLoginPage(w, "Invalid username or password")
+		return
+	}
+
+	if m.challengeAfterLogin {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(challengePage))
+		return
+	}
+
+	if m.otpCode != "" {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(otpPage))
+		return
+	}
+
+	m.startSession(w)
+}
+
+// handleOTP checks the one-time code of the second login step, showing otpPage again
+// for a wrong one
+func (m *MockSCDBServer) handleOTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	m.mu.Lock()
+	m.otpCalls++
+	m.lastReferer = r.Header.Get("Referer")
+	m.mu.Unlock()
+
+	if r.FormValue("otp_token") != "step-2" || r.FormValue("otp_submit") == "" {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	if r.FormValue("otp") != m.otpCode {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(otpPage))
+		return
+	}
+	m.startSession(w)
+}
+
+// startSession answers a completed login with the session cookie and a redirect to /my/
+func (m *MockSCDBServer) startSession(w http.ResponseWriter) {
+	m.mu.Lock()
+	m.sessionExpired = false
+	m.mu.Unlock()
+	if !m.noSession {
+		cookie := "PHPSESSID=test_session_id; Path=/"
+		if m.sessionMaxAge > 0 {
+			cookie += fmt.Sprintf("; Max-Age=%d", m.sessionMaxAge)
+		}
+		w.Header().Set("Set-Cookie", cookie)
+	}
 	w.Header().Set("Location", "/my/")
 	w.WriteHeader(http.StatusFound)
 }
 
+// writeLoginPage serves the login form with a CSRF token and an optional error message
+func (m *MockSCDBServer) writeLoginPage(w http.ResponseWriter, errorMsg string) {
+	html := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head><title>SCDB Login</title></head>
+<body>
+<p class="error">%s</p>
+<form method="POST" action="/en/login/">
+	<input type="hidden" name="%s" value="%s">
+	<input type="text" name="u_name" placeholder="Username">
+	<input type="password" name="u_password" placeholder="Password">
+	<input type="submit" name="login_submit" value="Login">
+</form>
+</body>
+</html>
+`, errorMsg, m.csrfToken, m.csrfToken)
+
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(html))
+}
+
+// handleAccount serves the logged-in account page, or redirects anonymous visitors to
+// the login page
+func (m *MockSCDBServer) handleAccount(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	expired := m.sessionExpired
+	m.mu.Unlock()
+	if cookie, err := r.Cookie("PHPSESSID"); err != nil || cookie.Value == "" || cookie.Value == m.expiredSession || expired {
+		http.Redirect(w, r, "/en/login/", http.StatusFound)
+		return
+	}
+
+	page := m.accountPage
+	if page == "" {
+		page = `<html><head><title>My SCDB</title></head><body><a href="/en/logout/">Logout</a></body></html>`
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(page))
+}
+
 // handleFixedDownload processes fixed camera download requests
 func (m *MockSCDBServer) handleFixedDownload(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
@@ -144,22 +378,40 @@ func (m *MockSCDBServer) handleFixedDownload(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	m.mu.Lock()
 	m.fixedCalls++
+	m.lastOrigin = r.Header.Get("Origin")
+	m.lastReferer = r.Header.Get("Referer")
+	m.lastContentType = r.Header.Get("Content-Type")
+	m.fixedInFlight++
+	m.maxFixedInFlight = max(m.maxFixedInFlight, m.fixedInFlight)
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.fixedInFlight--
+		m.mu.Unlock()
+	}()
+	time.Sleep(m.fixedDelay)
 
 	if m.failFixed {
 		http.Error(w, "Download failed", http.StatusInternalServerError)
 		return
 	}
+	if m.limitReached {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(downloadLimitPage))
+		return
+	}
 
 	// Parse form to validate required fields
-	err := r.ParseForm()
+	err := parseForm(r)
 	if err != nil {
 		http.Error(w, "Invalid form data", http.StatusBadRequest)
 		return
 	}
 
 	// Check required form fields
-	requiredFields := []string{"download_agreement_accept", "download_wave_right_of_rescission", "typ", "iconsize", "download_start"}
+	requiredFields := []string{"download_agreement_accept", "typ", "iconsize", "download_start"}
 	for _, field := range requiredFields {
 		if r.FormValue(field) == "" {
 			http.Error(w, fmt.Sprintf("Missing required field: %s", field), http.StatusBadRequest)
@@ -168,18 +420,66 @@ func (m *MockSCDBServer) handleFixedDownload(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Check that countries are specified
+	m.mu.Lock()
+	m.lastForm = r.Form
+	expire := m.loginPageDownloads > 0
+	if expire {
+		m.loginPageDownloads--
+		m.sessionExpired = true
+	}
+	m.mu.Unlock()
+	if expire {
+		m.writeLoginPage(w, "")
+		return
+	}
+
 	countries := r.Form["land[]"]
 	if len(countries) == 0 {
 		http.Error(w, "No countries specified", http.StatusBadRequest)
 		return
 	}
 
-	// Return mock ZIP content
-	mockZipContent := "PK\x03\x04mock_garmin_zip_content_here"
+	for _, country := range countries {
+		if country == m.failCountry {
+			http.Error(w, "Country unavailable", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Return a real ZIP archive with one entry per requested country
+	entries := make(map[string]string, len(countries))
+	for _, country := range countries {
+		if country != m.dropCountry {
+			entries[country+".gpi"] = "mock_garmin_content_" + country
+		}
+	}
+	content := MockZipContent(entries)
 	w.Header().Set("Content-Type", "application/zip")
 	w.Header().Set("Content-Disposition", "attachment; filename=garmin.zip")
+	if m.fixedDisposition != "" {
+		w.Header().Set("Content-Disposition", m.fixedDisposition)
+	}
+	if !m.lastModified.IsZero() {
+		w.Header().Set("Last-Modified", m.lastModified.UTC().Format(http.TimeFormat))
+	}
+	if m.abortFixed {
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("ETag", `"fixed"`)
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		_, _ = w.Write(content[:len(content)/2])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
 	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write([]byte(mockZipContent))
+	_, _ = w.Write(content)
+}
+
+// parseForm parses an urlencoded or multipart/form-data request body into r.Form
+func parseForm(r *http.Request) error {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		return r.ParseMultipartForm(1 << 20)
+	}
+	return r.ParseForm()
 }
 
 // handleMobileDownload processes mobile camera download requests
@@ -189,19 +489,45 @@ func (m *MockSCDBServer) handleMobileDownload(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	m.mu.Lock()
 	m.mobileCalls++
+	m.lastOrigin = r.Header.Get("Origin")
+	m.lastReferer = r.Header.Get("Referer")
+	m.lastContentType = r.Header.Get("Content-Type")
+	m.mu.Unlock()
 
 	if m.failMobile {
 		http.Error(w, "Download failed", http.StatusInternalServerError)
 		return
 	}
+	if err := parseForm(r); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	m.mu.Lock()
+	m.lastMobileForm = r.Form
+	m.mu.Unlock()
 
-	// Return mock ZIP content
-	mockZipContent := "PK\x03\x04mock_mobile_zip_content_here"
+	if m.mobileETag != "" {
+		if r.Header.Get("If-None-Match") == m.mobileETag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", m.mobileETag)
+	}
+
+	// Return a real ZIP archive
+	mockZipContent := MockZipContent(map[string]string{"mobile.gpi": "mock_mobile_content"})
 	w.Header().Set("Content-Type", "application/octetstream") // Note: no hyphen, matches real server
 	w.Header().Set("Content-Disposition", "attachment; filename=garmin-mobile.zip")
+	if m.mobileDisposition != "" {
+		w.Header().Set("Content-Disposition", m.mobileDisposition)
+	}
+	if !m.lastModified.IsZero() {
+		w.Header().Set("Last-Modified", m.lastModified.UTC().Format(http.TimeFormat))
+	}
 	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write([]byte(mockZipContent))
+	_, _ = w.Write(mockZipContent)
 }
 
 // CreateTestConfig creates a test configuration with reasonable defaults
@@ -216,9 +542,13 @@ func CreateTestConfig() *Config {
 		FranceDangerMode: false,
 		IconSize:         4,
 		WarningTime:      300,
+		AcceptAgreement:  true,
+		WaiveRescission:  true,
 		DownloadFixed:    true,
 		DownloadMobile:   true,
 		Verbose:          false,
+		Timeout:          DefaultTimeout,
+		LoginTimeout:     DefaultLoginTimeout,
 	}
 }
 
@@ -227,6 +557,37 @@ func CreateTestDownloader(config *Config) *SCDBDownloader {
 	return NewDownloader(config)
 }
 
+// CreateMockDownloader creates a downloader wired to the mock server's URL and client
+func CreateMockDownloader(config *Config, mock *MockSCDBServer) *SCDBDownloader {
+	config.BaseURL = mock.URL()
+	return NewDownloader(config, WithHTTPClient(mock.Client()))
+}
+
+// CaptureStdout runs fn and returns everything it wrote to os.Stdout
+func CaptureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+
+	original := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = original }()
+
+	done := make(chan string)
+	go func() {
+		out, _ := io.ReadAll(r)
+		done <- string(out)
+	}()
+
+	fn()
+
+	_ = w.Close()
+	return <-done
+}
+
 // CreateTempDir creates a temporary directory for testing
 func CreateTempDir(t *testing.T, prefix string) string {
 	tempDir, err := os.MkdirTemp("", prefix)
@@ -303,6 +664,31 @@ func MockHTMLResponse(csrfToken string) string {
 `, csrfToken, csrfToken)
 }
 
+// MockZipContent builds an in-memory ZIP archive from a map of entry names to contents
+func MockZipContent(entries map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f, err := zw.Create(name)
+		if err != nil {
+			panic(err)
+		}
+		_, _ = f.Write([]byte(entries[name]))
+	}
+
+	if err := zw.Close(); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
 // MockErrorHTMLResponse creates an HTML error response without CSRF token
 func MockErrorHTMLResponse() string {
 	return `
@@ -349,3 +735,19 @@ func CountriesTestData() map[string][]string {
 		"multiple":    {"NL", "B", "D", "FR"},
 	}
 }
+
+// memoryCookieStore is a CookieStore keeping the session in memory
+type memoryCookieStore struct {
+	session *Session
+	saves   int
+}
+
+func (s *memoryCookieStore) Load() (*Session, error) {
+	return s.session, nil
+}
+
+func (s *memoryCookieStore) Save(session *Session) error {
+	s.session = session
+	s.saves++
+	return nil
+}
@@ -0,0 +1,199 @@
+package scdb
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptrace"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redacted replaces secrets in the trace
+const redacted = "[redacted]"
+
+// secretHeaders are the headers whose values the trace never shows
+var secretHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization", "Set-Cookie"}
+
+// tracingTransport writes every request and response passing through next to out, for
+// Config.Trace: the connection steps from httptrace, the headers, and the bodies of
+// forms and text pages. Passwords and cookies are redacted and archives left out.
+type tracingTransport struct {
+	next http.RoundTripper
+	out  io.Writer
+	// mu keeps the exchanges of concurrent downloads from interleaving
+	mu sync.Mutex
+}
+
+// withTrace returns client sending its requests through a tracingTransport writing to out
+func withTrace(client *http.Client, out io.Writer) *http.Client {
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	traced := *client
+	traced.Transport = &tracingTransport{next: next, out: out}
+	return &traced
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var b bytes.Buffer
+	start := time.Now()
+	event := func(format string, args ...any) {
+		_, _ = fmt.Fprintf(&b, "* %s (%s)\n", fmt.Sprintf(format, args...), time.Since(start).Round(time.Millisecond))
+	}
+	trace := &httptrace.ClientTrace{
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			event("resolved %v", info.Addrs)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err != nil {
+				event("connect to %s failed: %v", addr, err)
+				return
+			}
+			event("connected to %s", addr)
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err != nil {
+				event("TLS handshake failed: %v", err)
+				return
+			}
+			event("TLS %s, %s", tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite))
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				event("reusing connection to %s", info.Conn.RemoteAddr())
+			}
+		},
+		GotFirstResponseByte: func() {
+			event("first response byte")
+		},
+	}
+
+	// Dumped before the trace is attached, which would report DumpRequestOut's own
+	// pretend connection
+	dump, err := httputil.DumpRequestOut(req, showBody(req.Header))
+	if err != nil {
+		_, _ = fmt.Fprintf(&b, "> %s %s (not dumped: %v)\n", req.Method, req.URL, err)
+	} else {
+		writeDump(&b, "> ", redactDump(dump, req.Header.Get("Content-Type")))
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		event("request failed: %v", err)
+		t.flush(&b)
+		return nil, err
+	}
+
+	dump, dumpErr := httputil.DumpResponse(resp, false)
+	if dumpErr != nil {
+		_, _ = fmt.Fprintf(&b, "< %s (not dumped: %v)\n", resp.Status, dumpErr)
+	} else {
+		writeDump(&b, "< ", redactDump(dump, ""))
+	}
+	if showBody(resp.Header) {
+		body, err := traceResponseBody(resp)
+		if err != nil {
+			event("response body not shown: %v", err)
+		} else {
+			writeDump(&b, "< ", body)
+		}
+	} else {
+		size := "size unknown"
+		if resp.ContentLength >= 0 {
+			size = fmt.Sprintf("%d bytes", resp.ContentLength)
+		}
+		_, _ = fmt.Fprintf(&b, "< [body not shown: %s, %s]\n", resp.Header.Get("Content-Type"), size)
+	}
+	t.flush(&b)
+	return resp, nil
+}
+
+// traceResponseBody reads the body of resp for the trace, decoded when it is compressed,
+// and puts the body back as it came for the client to read
+func traceResponseBody(resp *http.Response) ([]byte, error) {
+	raw, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	shown := &http.Response{
+		StatusCode:    resp.StatusCode,
+		Header:        resp.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(raw)),
+		ContentLength: int64(len(raw)),
+	}
+	if err := decodeBody(shown); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(shown.Body)
+}
+
+// flush writes one traced exchange at once
+func (t *tracingTransport) flush(b *bytes.Buffer) {
+	b.WriteString("\n")
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, _ = t.out.Write(b.Bytes())
+}
+
+// showBody reports whether a body with header is worth dumping: a form, page or JSON
+// document, but no archive
+func showBody(header http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") ||
+		mediaType == "application/x-www-form-urlencoded" ||
+		mediaType == "application/json" ||
+		strings.HasSuffix(mediaType, "+xml") || mediaType == "application/xml"
+}
+
+// redactDump blanks out secretHeaders and, in an urlencoded body of contentType, every
+// field whose name mentions a password. Lines end in \n rather than \r\n afterwards.
+func redactDump(dump []byte, contentType string) []byte {
+	head, body, _ := bytes.Cut(dump, []byte("\r\n\r\n"))
+	lines := strings.Split(string(head), "\r\n")
+	for i, line := range lines {
+		name, _, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		for _, secret := range secretHeaders {
+			if strings.EqualFold(strings.TrimSpace(name), secret) {
+				lines[i] = name + ": " + redacted
+			}
+		}
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "application/x-www-form-urlencoded" {
+		fields := strings.Split(string(body), "&")
+		for i, field := range fields {
+			name, _, _ := strings.Cut(field, "=")
+			if unescaped, err := url.QueryUnescape(name); err == nil && strings.Contains(strings.ToLower(unescaped), "pass") {
+				fields[i] = name + "=" + redacted
+			}
+		}
+		body = []byte(strings.Join(fields, "&"))
+	}
+	return []byte(strings.Join(lines, "\n") + "\n\n" + string(body))
+}
+
+// writeDump writes dump with prefix before each line
+func writeDump(w io.Writer, prefix string, dump []byte) {
+	text := strings.TrimRight(string(dump), "\n")
+	for _, line := range strings.Split(text, "\n") {
+		_, _ = fmt.Fprintf(w, "%s%s\n", prefix, strings.TrimRight(line, "\r"))
+	}
+}
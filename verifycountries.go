@@ -0,0 +1,152 @@
+package scdb
+
+import (
+	"archive/zip"
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+)
+
+// missingCountries returns the countries without an entry in the fixed camera archive at
+// archive. SCDB names the files in the archive after the country, so an entry counts for
+// a country when its file name has the country code as a separate word ("NL.gpi",
+// "speedcams_NL.gpi") or contains the country's English name ("Netherlands.gpi").
+func missingCountries(archive string, countries []string) ([]string, error) {
+	names, err := entryNames(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, country := range countries {
+		if !hasCountryEntry(names, country) {
+			missing = append(missing, country)
+		}
+	}
+	return missing, nil
+}
+
+// CountriesFromZip reads the countries of the fixed camera archive at archive from its
+// entry names, matched the way missingCountries matches them, in the order of the
+// archive. Entries that name no supported country are returned as unknown rather than
+// failing, so a stray readme does not stop the rest from being used.
+func CountriesFromZip(archive string) (countries, unknown []string, err error) {
+	names, err := entryNames(archive)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, entry := range names {
+		found := entryCountries(entry)
+		if len(found) == 0 {
+			unknown = append(unknown, entry)
+		}
+		countries = append(countries, found...)
+	}
+	return DeduplicateStable(countries), unknown, nil
+}
+
+// entryNames returns the base names of the file entries of the ZIP archive at archive
+func entryNames(archive string) ([]string, error) {
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", archive, err)
+	}
+	defer func() { _ = r.Close() }()
+
+	var names []string
+	for _, f := range r.File {
+		if !f.FileInfo().IsDir() {
+			names = append(names, path.Base(f.Name))
+		}
+	}
+	return names, nil
+}
+
+// entryCountries returns the countries an archive entry belongs to: those whose code is
+// a word of its name or, failing that, the one with the longest English name it
+// contains, so "Romania.gpi" is not also taken for Oman
+func entryCountries(entry string) []string {
+	stem := letters(strings.TrimSuffix(entry, path.Ext(entry)))
+	var byCode []string
+	byName, nameLen := "", 0
+	for _, code := range allCountries {
+		if hasCodeWord(entry, code) {
+			byCode = append(byCode, code)
+			continue
+		}
+		name := CountryName(code)
+		if name == code {
+			continue
+		}
+		if name = letters(name); len(name) > nameLen && strings.Contains(stem, name) {
+			byName, nameLen = code, len(name)
+		}
+	}
+	if len(byCode) > 0 || byName == "" {
+		return byCode
+	}
+	return []string{byName}
+}
+
+// hasCountryEntry reports whether one of the entry names belongs to country
+func hasCountryEntry(names []string, country string) bool {
+	var name string
+	if full := CountryName(country); full != country {
+		name = letters(full)
+	}
+	for _, entry := range names {
+		if hasCodeWord(entry, country) {
+			return true
+		}
+		stem := strings.TrimSuffix(entry, path.Ext(entry))
+		if name != "" && strings.Contains(letters(stem), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasCodeWord reports whether the entry name, without its extension, has the country
+// code as a separate word. The case must match: many codes are also ordinary words such
+// as "a", "is" or "no".
+func hasCodeWord(entry, country string) bool {
+	stem := strings.TrimSuffix(entry, path.Ext(entry))
+	words := strings.FieldsFunc(stem, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		if word == country {
+			return true
+		}
+	}
+	return false
+}
+
+// letters returns the letters of s in lowercase, so "United_Kingdom" and "United Kingdom"
+// compare equal
+func letters(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
+
+// verifyCountries warns about requested countries missing from the fixed camera archive
+// at archive, which SCDB may drop without reporting an error
+func (d *SCDBDownloader) verifyCountries(archive string, countries []string) {
+	missing, err := missingCountries(archive, countries)
+	if err != nil {
+		d.logger.Warn("countries not verified", "path", archive, "error", err)
+		return
+	}
+	if len(missing) > 0 {
+		d.logger.Warn("countries missing from archive", "path", archive, "countries", CountryLabels(missing))
+		return
+	}
+	d.logger.Debug("all countries present in archive", "path", archive, "countries", len(countries))
+}
@@ -0,0 +1,41 @@
+package scdb
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// MaxWarningTime is the longest accepted Config.WarningTime
+const MaxWarningTime = time.Hour
+
+// ParseWarningTime converts a duration or a bare number of seconds to whole seconds
+func ParseWarningTime(s string) (int, error) {
+	seconds, err := strconv.Atoi(s)
+	if err != nil {
+		d, durErr := time.ParseDuration(s)
+		if durErr != nil {
+			return 0, fmt.Errorf("invalid warning time %q (want seconds or a duration like 5m)", s)
+		}
+		if d%time.Second != 0 {
+			return 0, fmt.Errorf("warning time must be a whole number of seconds (got %s)", d)
+		}
+		seconds = int(d / time.Second)
+	}
+
+	if err := CheckWarningTime(seconds); err != nil {
+		return 0, err
+	}
+	return seconds, nil
+}
+
+// CheckWarningTime rejects negative warning times and those above MaxWarningTime
+func CheckWarningTime(seconds int) error {
+	if seconds < 0 {
+		return fmt.Errorf("warning time cannot be negative (got %d)", seconds)
+	}
+	if limit := int(MaxWarningTime / time.Second); seconds > limit {
+		return fmt.Errorf("warning time cannot exceed %d seconds (got %d)", limit, seconds)
+	}
+	return nil
+}